@@ -0,0 +1,36 @@
+package dsig
+
+import "crypto"
+
+// DigestAlgorithmURI returns the URI of the digest algorithm that uses h. It is
+// the inverse of the mapping Verify uses to interpret a DigestMethod.
+//
+// If this package does not support digesting with h, DigestAlgorithmURI
+// returns false.
+func DigestAlgorithmURI(h crypto.Hash) (string, bool) {
+	switch h {
+	case crypto.SHA1:
+		return DigestMethodAlgorithmSHA1, true
+	case crypto.SHA256:
+		return DigestMethodAlgorithmSHA256, true
+	default:
+		return "", false
+	}
+}
+
+// SignatureAlgorithmURI returns the URI of the RSA signature algorithm that
+// uses h. It is the inverse of the mapping Verify uses to interpret a
+// SignatureMethod.
+//
+// If this package does not support signing with h, SignatureAlgorithmURI
+// returns false.
+func SignatureAlgorithmURI(h crypto.Hash) (string, bool) {
+	switch h {
+	case crypto.SHA1:
+		return SignatureMethodAlgorithmSHA1, true
+	case crypto.SHA256:
+		return SignatureMethodAlgorithmSHA256, true
+	default:
+		return "", false
+	}
+}
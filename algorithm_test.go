@@ -0,0 +1,53 @@
+package dsig_test
+
+import (
+	"crypto"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/dsig"
+)
+
+func TestAlgorithmURI(t *testing.T) {
+	type testCase struct {
+		Hash         crypto.Hash
+		DigestURI    string
+		SignatureURI string
+		OK           bool
+	}
+
+	testCases := map[string]testCase{
+		"sha1": testCase{
+			Hash:         crypto.SHA1,
+			DigestURI:    dsig.DigestMethodAlgorithmSHA1,
+			SignatureURI: dsig.SignatureMethodAlgorithmSHA1,
+			OK:           true,
+		},
+		"sha256": testCase{
+			Hash:         crypto.SHA256,
+			DigestURI:    dsig.DigestMethodAlgorithmSHA256,
+			SignatureURI: dsig.SignatureMethodAlgorithmSHA256,
+			OK:           true,
+		},
+		"md5": testCase{
+			Hash: crypto.MD5,
+			OK:   false,
+		},
+		"zero": testCase{
+			Hash: 0,
+			OK:   false,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			digestURI, ok := dsig.DigestAlgorithmURI(tt.Hash)
+			assert.Equal(t, tt.DigestURI, digestURI)
+			assert.Equal(t, tt.OK, ok)
+
+			signatureURI, ok := dsig.SignatureAlgorithmURI(tt.Hash)
+			assert.Equal(t, tt.SignatureURI, signatureURI)
+			assert.Equal(t, tt.OK, ok)
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package dsig
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/xml"
+	"io"
+	"runtime"
+	"sync"
+)
+
+// VerifyBatch verifies the enveloped signature of each of docs using cert, and
+// returns the outcome for each document, in the same order as docs. A nil
+// error means the document's signature is valid.
+//
+// Each document is verified exactly as Verify would, using the ds:Signature
+// that is an immediate child of its root element. If there is no such
+// ds:Signature, the document's error is ErrSignatureNotFound. Each document is
+// read with the default limits of NewDecoder.
+//
+// Documents are verified in parallel, using up to GOMAXPROCS goroutines. An
+// invalid document does not stop VerifyBatch from verifying the others.
+func VerifyBatch(cert *x509.Certificate, docs [][]byte) []error {
+	errs := make([]error, len(docs))
+
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(docs) {
+		workers = len(docs)
+	}
+
+	indices := make(chan int)
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for j := range indices {
+				errs[j] = verifyEnveloped(cert, docs[j])
+			}
+		}()
+	}
+
+	for i := range docs {
+		indices <- i
+	}
+
+	close(indices)
+	wg.Wait()
+
+	return errs
+}
+
+// verifyEnveloped verifies the ds:Signature that is an immediate child of the
+// root element of data, using cert.
+func verifyEnveloped(cert *x509.Certificate, data []byte) error {
+	s, err := findEnvelopedSignature(data)
+	if err != nil {
+		return err
+	}
+
+	return s.Verify(cert, NewDecoder(bytes.NewReader(data)))
+}
+
+// findEnvelopedSignature decodes the first ds:Signature that is an immediate
+// child of the root element of data.
+func findEnvelopedSignature(data []byte) (*Signature, error) {
+	depth := 0
+	decoder := NewDecoder(bytes.NewReader(data))
+	for {
+		t, err := decoder.Token()
+		if err != nil {
+			if err == io.EOF {
+				return nil, ErrSignatureNotFound
+			}
+
+			return nil, err
+		}
+
+		switch t := t.(type) {
+		case xml.StartElement:
+			if depth != 1 || t.Name.Space != namespace || t.Name.Local != "Signature" {
+				depth++
+				continue
+			}
+
+			var s Signature
+			if err := decoder.DecodeElement(&s, &t); err != nil {
+				return nil, err
+			}
+
+			return &s, nil
+		case xml.EndElement:
+			depth--
+		}
+	}
+}
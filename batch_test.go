@@ -0,0 +1,47 @@
+package dsig_test
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/dsig"
+)
+
+func TestVerifyBatch(t *testing.T) {
+	valid := signTestDocument(t, `<root><foo>xxx</foo>`+testSignatureFormat+`</root>`, base64.StdEncoding)
+	tampered := strings.Replace(valid, "xxx", "yyy", 1)
+
+	var docs [][]byte
+	var want []error
+	for i := 0; i < 50; i++ {
+		switch i % 4 {
+		case 0:
+			docs = append(docs, []byte(valid))
+			want = append(want, nil)
+		case 1:
+			docs = append(docs, []byte(tampered))
+			want = append(want, dsig.ErrBadDigest)
+		case 2:
+			docs = append(docs, []byte(`<root><foo>xxx</foo></root>`))
+			want = append(want, dsig.ErrSignatureNotFound)
+		case 3:
+			// A ds:Signature that isn't an immediate child of the root isn't
+			// enveloped.
+			docs = append(docs, []byte(fmt.Sprintf(`<root><foo>%s</foo></root>`, valid)))
+			want = append(want, dsig.ErrSignatureNotFound)
+		}
+	}
+
+	assert.Equal(t, want, dsig.VerifyBatch(testCert, docs))
+}
+
+func TestVerifyBatch_Malformed(t *testing.T) {
+	errs := dsig.VerifyBatch(testCert, [][]byte{[]byte(`<root>`)})
+	assert.Len(t, errs, 1)
+	assert.Error(t, errs[0])
+
+	assert.Empty(t, dsig.VerifyBatch(testCert, nil))
+}
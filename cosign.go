@@ -0,0 +1,133 @@
+package dsig
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/xml"
+	"io"
+)
+
+// AddSignature adds a signature over the whole of doc, which already has an
+// enveloped signature over the whole of it, signed with signer, and returns
+// the resulting document. It's meant for documents that need to be signed by
+// more than one party, one after the other.
+//
+// SignDocument can't be used for this, as each signature's enveloped signature
+// transform removes only that signature from what it signs. A second
+// child-of-root signature would be part of what the first one signs, and so
+// would invalidate it. Instead, AddSignature puts the new ds:Signature in a
+// ds:Object at the end of the existing one. The existing signature's enveloped
+// signature transform removes it, along with everything else in the existing
+// ds:Signature, so the existing signature stays valid. The new signature's
+// enveloped signature transform removes only the new ds:Signature, and so it
+// signs the rest of the document, including the existing signature.
+//
+// If the existing signature already has a co-signature added this way, the new
+// one is put in a ds:Object of the co-signature instead, and so on, so that
+// each signature signs all of those before it. The existing signature must be
+// the only child-of-root ds:Signature in doc; if there is none, AddSignature
+// returns ErrSignatureNotFound, and if there is more than one, it returns
+// ErrMultipleSignatures.
+//
+// Each co-signature can be unmarshaled from the content of the ds:Object it's
+// in, and verified against the whole document, as the existing signature is.
+// The new signature always has a single Reference to the whole document, so
+// opts.References and opts.ReferenceID are ignored; the rest of opts, and
+// cert, are handled as they are by SignDocument.
+func AddSignature(doc []byte, signer crypto.Signer, cert *x509.Certificate, opts SignOptions) ([]byte, error) {
+	endTag, err := lastCoSignatureEnd(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	if cert != nil && opts.Certificate == nil && len(opts.CertificateChain) == 0 {
+		opts.Certificate = cert
+	}
+
+	opts.References = nil
+	opts.ReferenceID = ""
+
+	s, err := NewSignature(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	open, close := objectTags(s.Prefix)
+	return signSpliced(append(append([]byte{}, doc[:endTag]...), open...), append([]byte(close), doc[endTag:]...), s, signer)
+}
+
+// lastCoSignatureEnd returns the offset in doc of the end tag of the last
+// signature in its chain of co-signatures, as described by AddSignature.
+func lastCoSignatureEnd(doc []byte) (int, error) {
+	// element describes an open element: whether it's a ds:Signature in the
+	// chain, or a ds:Object of one, and where it starts.
+	type element struct {
+		signature bool
+		object    bool
+		start     int64
+	}
+
+	var open []element
+	lastStart, lastEnd := int64(-1), int64(-1)
+	roots := 0
+
+	decoder := xml.NewDecoder(bytes.NewReader(doc))
+	for {
+		offset := decoder.InputOffset()
+		t, err := decoder.Token()
+		if err != nil {
+			if err != io.EOF {
+				return 0, err
+			}
+
+			break
+		}
+
+		switch t := t.(type) {
+		case xml.StartElement:
+			e := element{start: offset}
+			if t.Name.Space == namespace {
+				switch {
+				case t.Name.Local == "Signature" && len(open) == 1:
+					e.signature = true
+					roots++
+				case t.Name.Local == "Signature" && len(open) > 1 && open[len(open)-1].object:
+					e.signature = true
+				case t.Name.Local == "Object" && len(open) > 0 && open[len(open)-1].signature:
+					e.object = true
+				}
+			}
+
+			open = append(open, e)
+		case xml.EndElement:
+			e := open[len(open)-1]
+			open = open[:len(open)-1]
+
+			// A co-signature ends before the signature it's in, but starts after
+			// it.
+			if e.signature && e.start > lastStart {
+				lastStart, lastEnd = e.start, decoder.InputOffset()
+			}
+		}
+	}
+
+	switch {
+	case roots == 0:
+		return 0, ErrSignatureNotFound
+	case roots > 1:
+		return 0, ErrMultipleSignatures
+	}
+
+	return bytes.LastIndex(doc[:lastEnd], []byte("</")), nil
+}
+
+// objectTags returns the start and end tags of a ds:Object, written with
+// prefix, as NewSignature would write it.
+func objectTags(prefix string) (string, string) {
+	if prefix == "" {
+		return `<Object xmlns="` + namespace + `">`, `</Object>`
+	}
+
+	return `<` + prefix + `:Object xmlns:` + prefix + `="` + namespace + `">`, `</` + prefix + `:Object>`
+}
@@ -0,0 +1,89 @@
+package dsig_test
+
+import (
+	"crypto/x509"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/dsig"
+)
+
+func TestAddSignature(t *testing.T) {
+	type testCase struct {
+		Prefix string
+	}
+
+	testCases := map[string]testCase{
+		"default namespace signature": testCase{},
+		"ds prefix":                   testCase{Prefix: "ds"},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			doc, err := dsig.SignDocument([]byte(`<root><foo>xxx</foo></root>`), testKey, testCert, dsig.SignOptions{Prefix: tt.Prefix})
+			assert.NoError(t, err)
+
+			// Each officer signs in turn, with their own key.
+			key1, cert1 := generateTestCert()
+			doc, err = dsig.AddSignature(doc, key1, cert1, dsig.SignOptions{Prefix: tt.Prefix})
+			assert.NoError(t, err)
+
+			key2, cert2 := generateTestCert()
+			doc, err = dsig.AddSignature(doc, key2, cert2, dsig.SignOptions{Prefix: tt.Prefix})
+			assert.NoError(t, err)
+
+			var payload struct {
+				Foo       string         `xml:"foo"`
+				Signature dsig.Signature `xml:"http://www.w3.org/2000/09/xmldsig# Signature"`
+			}
+
+			assert.NoError(t, xml.Unmarshal(doc, &payload))
+			assert.Equal(t, "xxx", payload.Foo)
+
+			// Each co-signature is in a ds:Object of the one before it.
+			var first, second dsig.Signature
+			assert.Equal(t, 1, len(payload.Signature.Objects))
+			assert.NoError(t, xml.Unmarshal(payload.Signature.Objects[0].Content, &first))
+			assert.Equal(t, 1, len(first.Objects))
+			assert.NoError(t, xml.Unmarshal(first.Objects[0].Content, &second))
+
+			verify := func(sig dsig.Signature, cert *x509.Certificate, doc string) error {
+				return sig.Verify(cert, xml.NewDecoder(strings.NewReader(doc)))
+			}
+
+			assert.NoError(t, verify(payload.Signature, testCert, string(doc)))
+			assert.NoError(t, verify(first, cert1, string(doc)))
+			assert.NoError(t, verify(second, cert2, string(doc)))
+
+			tampered := strings.Replace(string(doc), "xxx", "zzz", 1)
+			assert.Equal(t, dsig.ErrBadDigest, verify(payload.Signature, testCert, tampered))
+			assert.Equal(t, dsig.ErrBadDigest, verify(first, cert1, tampered))
+			assert.Equal(t, dsig.ErrBadDigest, verify(second, cert2, tampered))
+
+			// Each signature covers those before it, but not those after it.
+			tampered = strings.Replace(string(doc), first.SignatureValue.Value, "AAAA", 1)
+			assert.NoError(t, verify(payload.Signature, testCert, tampered))
+			assert.Equal(t, dsig.ErrBadDigest, verify(second, cert2, tampered))
+		})
+	}
+}
+
+func TestAddSignature_Errors(t *testing.T) {
+	_, err := dsig.AddSignature([]byte(`<root><foo>xxx</foo></root>`), testKey, testCert, dsig.SignOptions{})
+	assert.Equal(t, dsig.ErrSignatureNotFound, err)
+
+	doc, err := dsig.SignDocument([]byte(`<root><foo ID="foo">xxx</foo></root>`), testKey, testCert, dsig.SignOptions{ReferenceID: "foo"})
+	assert.NoError(t, err)
+
+	_, err = dsig.AddSignature(doc, testKey, testCert, dsig.SignOptions{})
+	assert.Equal(t, dsig.ErrSignatureNotFound, err)
+
+	sig := signatureElement.FindString(string(doc))
+	_, err = dsig.AddSignature([]byte(`<root>`+sig+sig+`</root>`), testKey, testCert, dsig.SignOptions{})
+	assert.Equal(t, dsig.ErrMultipleSignatures, err)
+
+	_, err = dsig.AddSignature([]byte(`<root>`), testKey, testCert, dsig.SignOptions{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,80 @@
+package dsig
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/xml"
+	"errors"
+)
+
+// ReferenceTypeSignatureValue is the Type of a Reference to the
+// ds:SignatureValue of another signature, as in a counter-signature.
+var ReferenceTypeSignatureValue = "http://www.w3.org/2000/09/xmldsig#SignatureValue"
+
+// ErrMissingSignatureValueID is returned by CounterSign if the
+// ds:SignatureValue to be counter-signed has no Id attribute, and so can't be
+// referred to.
+var ErrMissingSignatureValueID = errors.New("dsig: signature value has no Id")
+
+// CounterSign adds to doc a counter-signature of the first ds:Signature in it,
+// signed with signer, and returns the resulting document. If doc has no
+// ds:Signature, CounterSign returns ErrSignatureNotFound.
+//
+// The counter-signature has a single Reference, of type
+// ReferenceTypeSignatureValue, whose URI is "#" followed by the Id of the
+// ds:SignatureValue of the signature being counter-signed. That Id must be set,
+// such as by setting SignatureValue.ID before signing; otherwise, CounterSign
+// returns ErrMissingSignatureValueID. The Reference's only transform is the
+// counter-signature's canonicalization algorithm, and opts.References and
+// opts.ReferenceID are ignored.
+//
+// The counter-signature is put in a ds:Object at the end of the signature being
+// counter-signed. That signature is excluded from its own digest by the
+// enveloped signature transform, so it stays valid. Both signatures can be
+// verified against the whole document, and the counter-signature can be
+// unmarshaled from the content of the ds:Object. As the ds:SignatureValue it
+// refers to doesn't contain it, the counter-signature must be verified with
+// VerifyOptions.AllowArbitraryReferences.
+//
+// cert and the rest of opts are handled as they are by SignDocument.
+func CounterSign(doc []byte, signer crypto.Signer, cert *x509.Certificate, opts SignOptions) ([]byte, error) {
+	before, first, after, err := cutSignature(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	if first.SignatureValue.ID == "" {
+		return nil, ErrMissingSignatureValueID
+	}
+
+	if cert != nil && opts.Certificate == nil && len(opts.CertificateChain) == 0 {
+		opts.Certificate = cert
+	}
+
+	opts.References = nil
+	opts.ReferenceID = ""
+
+	s, err := NewSignature(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	s.SignedInfo.Reference().URI = "#" + first.SignatureValue.ID
+	s.SignedInfo.Reference().Type = ReferenceTypeSignatureValue
+	s.SignedInfo.Reference().Transforms = []Transform{
+		{Algorithm: s.SignedInfo.CanonicalizationMethod.Algorithm, InclusiveNamespaces: s.SignedInfo.CanonicalizationMethod.InclusiveNamespaces},
+	}
+
+	// ds:SignatureValue's ID attribute is Id, whatever opts.IDAttribute says.
+	s.IDAttribute = xml.Name{Local: "Id"}
+
+	// The counter-signature goes just before the end tag of the signature being
+	// counter-signed, in a ds:Object.
+	end := len(doc) - len(after)
+	endTag := bytes.LastIndex(doc[len(before):end], []byte("</")) + len(before)
+
+	open, close := objectTags(s.Prefix)
+
+	return signSpliced(append(append([]byte{}, doc[:endTag]...), open...), append([]byte(close), doc[endTag:]...), s, signer)
+}
@@ -0,0 +1,83 @@
+package dsig_test
+
+import (
+	"crypto/rsa"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/dsig"
+)
+
+func TestCounterSign(t *testing.T) {
+	type doc struct {
+		XMLName   xml.Name `xml:"doc"`
+		Foo       string   `xml:"foo"`
+		Signature dsig.Signature
+	}
+
+	testCases := map[string]string{
+		"default namespace": "",
+		"ds prefix":         "ds",
+	}
+
+	for name, prefix := range testCases {
+		t.Run(name, func(t *testing.T) {
+			// The first party signs the document, with an Id on its SignatureValue.
+			sig, err := dsig.NewSignature(dsig.SignOptions{Certificate: testCert, Prefix: prefix})
+			assert.NoError(t, err)
+			sig.SignatureValue.ID = "first-value"
+
+			d := doc{Foo: "xxx", Signature: *sig}
+			unsigned, err := xml.Marshal(d)
+			assert.NoError(t, err)
+			assert.NoError(t, d.Signature.Sign(testKey, xml.NewDecoder(strings.NewReader(string(unsigned)))))
+
+			signed, err := xml.Marshal(d)
+			assert.NoError(t, err)
+
+			// The second party counter-signs it with another key.
+			key, cert := generateTestCert()
+			counterSigned, err := dsig.CounterSign(signed, key, cert, dsig.SignOptions{Prefix: prefix})
+			assert.NoError(t, err)
+
+			var decoded doc
+			assert.NoError(t, xml.Unmarshal(counterSigned, &decoded))
+			assert.Len(t, decoded.Signature.Objects, 1)
+
+			var counter dsig.Signature
+			assert.NoError(t, xml.Unmarshal(decoded.Signature.Objects[0].Content, &counter))
+			assert.Equal(t, "#first-value", counter.SignedInfo.Reference().URI)
+			assert.Equal(t, dsig.ReferenceTypeSignatureValue, counter.SignedInfo.Reference().Type)
+
+			// Both signatures verify against the counter-signed document, each with
+			// its own certificate. The counter-signature's Reference is to a
+			// SignatureValue outside of it, so it needs AllowArbitraryReferences.
+			opts := dsig.VerifyOptions{AllowArbitraryReferences: true}
+			assert.NoError(t, decoded.Signature.Verify(testCert, xml.NewDecoder(strings.NewReader(string(counterSigned)))))
+			assert.NoError(t, counter.VerifyWithOptions(cert, xml.NewDecoder(strings.NewReader(string(counterSigned))), opts))
+			assert.Equal(t, rsa.ErrVerification, counter.VerifyWithOptions(testCert, xml.NewDecoder(strings.NewReader(string(counterSigned))), opts))
+
+			// The counter-signature covers the first SignatureValue, but not the
+			// rest of the document.
+			tampered := strings.Replace(string(counterSigned), d.Signature.SignatureValue.Value[:8], "AAAAAAAA", 1)
+			assert.Equal(t, dsig.ErrBadDigest, counter.VerifyWithOptions(cert, xml.NewDecoder(strings.NewReader(tampered)), opts))
+
+			modified := strings.Replace(string(counterSigned), "xxx", "yyy", 1)
+			assert.NoError(t, counter.VerifyWithOptions(cert, xml.NewDecoder(strings.NewReader(modified)), opts))
+			assert.Equal(t, dsig.ErrBadDigest, decoded.Signature.Verify(testCert, xml.NewDecoder(strings.NewReader(modified))))
+		})
+	}
+}
+
+func TestCounterSign_Errors(t *testing.T) {
+	_, err := dsig.CounterSign([]byte(`<doc><foo>xxx</foo></doc>`), testKey, testCert, dsig.SignOptions{})
+	assert.Equal(t, dsig.ErrSignatureNotFound, err)
+
+	signed, err := dsig.SignDocument([]byte(`<doc><foo>xxx</foo></doc>`), testKey, testCert, dsig.SignOptions{})
+	assert.NoError(t, err)
+
+	_, err = dsig.CounterSign(signed, testKey, testCert, dsig.SignOptions{})
+	assert.Equal(t, dsig.ErrMissingSignatureValueID, err)
+}
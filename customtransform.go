@@ -0,0 +1,87 @@
+package dsig
+
+import (
+	"sync"
+
+	"github.com/ucarion/c14n"
+)
+
+// TokenTransform is a transform that Verify can apply to the data a Reference
+// refers to. Custom transforms are made available with RegisterTransform.
+type TokenTransform interface {
+	// TransformTokens returns a reader of the tokens of r, with the transform
+	// applied.
+	//
+	// r reads the raw tokens of the whole document, as described in the
+	// documentation for TokenReader, and so the returned reader must produce
+	// raw tokens too. The enveloped signature transform is applied after
+	// TransformTokens, so the ds:Signature being verified is among the tokens of
+	// r; it must be passed through unchanged.
+	TransformTokens(r c14n.RawTokenReader) c14n.RawTokenReader
+}
+
+var (
+	customTransformsMu sync.RWMutex
+	customTransforms   = map[string]TokenTransform{}
+)
+
+// RegisterTransform makes t available to Verify as the transform identified by
+// uri. When a signature's Reference lists uri among its transforms, the
+// document is passed through t before it's digested. If several custom
+// transforms are listed, they are applied in the order they're listed.
+//
+// RegisterTransform is meant to be called from an init function. It panics if t
+// is nil, if uri is already registered, or if uri is one of the transforms that
+// this package implements itself.
+func RegisterTransform(uri string, t TokenTransform) {
+	if t == nil {
+		panic("dsig: RegisterTransform transform is nil")
+	}
+
+	if isBuiltinTransform(uri) {
+		panic("dsig: RegisterTransform called for built-in transform " + uri)
+	}
+
+	customTransformsMu.Lock()
+	defer customTransformsMu.Unlock()
+
+	if _, ok := customTransforms[uri]; ok {
+		panic("dsig: RegisterTransform called twice for transform " + uri)
+	}
+
+	customTransforms[uri] = t
+}
+
+// customTransform returns the transform registered for uri, or nil if there is
+// none.
+func customTransform(uri string) TokenTransform {
+	customTransformsMu.RLock()
+	defer customTransformsMu.RUnlock()
+
+	return customTransforms[uri]
+}
+
+// applyCustomTransforms passes tr through each of the transforms listed in r
+// that were registered with RegisterTransform, in the order they're listed.
+func (r *Reference) applyCustomTransforms(tr c14n.RawTokenReader) c14n.RawTokenReader {
+	for _, t := range r.Transforms {
+		if custom := customTransform(t.Algorithm); custom != nil {
+			tr = custom.TransformTokens(tr)
+		}
+	}
+
+	return tr
+}
+
+// isBuiltinTransform returns whether uri is a transform that Verify handles
+// itself.
+func isBuiltinTransform(uri string) bool {
+	switch uri {
+	case TransformAlgorithmEnveloped, TransformAlgorithmXPath, TransformAlgorithmXSLT, TransformAlgorithmDSig2,
+		CanonicalizationMethodAlgorithmExclusive, CanonicalizationMethodAlgorithmExclusiveWithComments,
+		CanonicalizationMethodAlgorithmInclusive, CanonicalizationMethodAlgorithmInclusiveWithComments:
+		return true
+	default:
+		return false
+	}
+}
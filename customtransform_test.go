@@ -0,0 +1,92 @@
+package dsig_test
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/c14n"
+	"github.com/ucarion/dsig"
+)
+
+const stripExtensionURI = "urn:example:strip-extension"
+
+// stripExtension is a custom transform that removes vendor:Extension elements.
+type stripExtension struct{}
+
+func (stripExtension) TransformTokens(r c14n.RawTokenReader) c14n.RawTokenReader {
+	return &stripExtensionReader{r: r}
+}
+
+type stripExtensionReader struct {
+	r     c14n.RawTokenReader
+	depth int // how deep within a vendor:Extension the reader is
+}
+
+func (s *stripExtensionReader) RawToken() (xml.Token, error) {
+	for {
+		t, err := s.r.RawToken()
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := t.(type) {
+		case xml.StartElement:
+			if s.depth > 0 || (t.Name.Space == "vendor" && t.Name.Local == "Extension") {
+				s.depth++
+				continue
+			}
+		case xml.EndElement:
+			if s.depth > 0 {
+				s.depth--
+				continue
+			}
+		default:
+			if s.depth > 0 {
+				continue
+			}
+		}
+
+		return t, nil
+	}
+}
+
+func init() {
+	dsig.RegisterTransform(stripExtensionURI, stripExtension{})
+}
+
+func TestRegisterTransform(t *testing.T) {
+	signatureFormat := strings.Replace(testSignatureFormat, "</ds:Transforms>", `<ds:Transform Algorithm="`+stripExtensionURI+`"></ds:Transform></ds:Transforms>`, 1)
+	extension := `<vendor:Extension><vendor:Data>xxx</vendor:Data></vendor:Extension>`
+
+	// The document is signed without the extension, and then has one added to
+	// it, as the transform should remove it before digesting.
+	doc := signTestDocument(t, `<root xmlns:vendor="urn:example:vendor"><foo>xxx</foo>`+signatureFormat+`</root>`, base64.StdEncoding)
+	doc = strings.Replace(doc, "<foo>", extension+"<foo>", 1)
+
+	assert.NoError(t, verifyTestDocument(t, doc))
+	assert.NoError(t, verifyTestDocument(t, strings.Replace(doc, "<vendor:Data>xxx", "<vendor:Data>yyy", 1)))
+	assert.Equal(t, dsig.ErrBadDigest, verifyTestDocument(t, strings.Replace(doc, "<foo>xxx", "<foo>yyy", 1)))
+
+	// Without the transform listed, the extension is digested as usual.
+	doc = signTestDocument(t, `<root xmlns:vendor="urn:example:vendor"><foo>xxx</foo>`+testSignatureFormat+`</root>`, base64.StdEncoding)
+	doc = strings.Replace(doc, "<foo>", extension+"<foo>", 1)
+
+	assert.Equal(t, dsig.ErrBadDigest, verifyTestDocument(t, doc))
+}
+
+func TestRegisterTransform_Panics(t *testing.T) {
+	assert.Panics(t, func() {
+		dsig.RegisterTransform(stripExtensionURI, stripExtension{})
+	})
+
+	assert.Panics(t, func() {
+		dsig.RegisterTransform(dsig.TransformAlgorithmEnveloped, stripExtension{})
+	})
+
+	assert.Panics(t, func() {
+		dsig.RegisterTransform("urn:example:nil", nil)
+	})
+}
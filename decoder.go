@@ -0,0 +1,163 @@
+package dsig
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+)
+
+// ErrDocumentTooLarge is returned by decoders created with NewDecoder if the
+// document is larger than DecoderOptions.MaxBytes.
+var ErrDocumentTooLarge = errors.New("dsig: document is too large")
+
+// ErrDocumentTooDeep is returned by decoders created with NewDecoder if the
+// document's elements are nested more deeply than DecoderOptions.MaxDepth.
+var ErrDocumentTooDeep = errors.New("dsig: document is nested too deeply")
+
+// ErrDirectiveNotAllowed is returned by decoders created with NewDecoder if the
+// document contains a directive, such as a DOCTYPE declaration, and
+// DecoderOptions.AllowDirectives is not set.
+var ErrDirectiveNotAllowed = errors.New("dsig: document contains a directive")
+
+// DefaultMaxBytes is the largest document, in bytes, that a decoder created
+// with NewDecoder will read.
+const DefaultMaxBytes = 64 << 20
+
+// DefaultMaxDepth is the deepest that elements may be nested in a document read
+// by a decoder created with NewDecoder.
+const DefaultMaxDepth = 256
+
+// DecoderOptions controls the limits that NewDecoderWithOptions places on the
+// documents it reads.
+//
+// The zero value of DecoderOptions is the behavior of NewDecoder.
+type DecoderOptions struct {
+	// MaxBytes is the largest document, in bytes, that the decoder will read.
+	// Reading past this limit results in ErrDocumentTooLarge.
+	//
+	// If zero, DefaultMaxBytes is used. If negative, there is no limit.
+	MaxBytes int64
+
+	// MaxDepth is the deepest that elements may be nested. Nesting elements any
+	// deeper results in ErrDocumentTooDeep.
+	//
+	// If zero, DefaultMaxDepth is used. If negative, there is no limit.
+	MaxDepth int
+
+	// AllowDirectives, if true, lets the document contain directives such as a
+	// DOCTYPE declaration. Otherwise, they result in ErrDirectiveNotAllowed.
+	//
+	// encoding/xml never processes a DTD, but signed documents have no use for
+	// one either, so they are rejected by default.
+	//
+	// If directives are allowed, a DOCTYPE before the root element is excluded
+	// from what's verified, as canonicalization requires. Its internal subset is
+	// ignored: entities declared there are not expanded, so references to them
+	// are errors, and attribute defaults declared there are not applied.
+	AllowDirectives bool
+
+	// CharsetReader is used by the decoder to read documents that aren't UTF-8,
+	// as with xml.Decoder's CharsetReader. If nil, only UTF-8 documents can be
+	// read.
+	CharsetReader func(charset string, input io.Reader) (io.Reader, error)
+}
+
+// NewDecoder creates an xml.Decoder suitable for reading untrusted signed
+// documents. It's equivalent to NewDecoderWithOptions with the zero value of
+// DecoderOptions.
+//
+// The decoder reads at most DefaultMaxBytes of input, allows elements to be
+// nested at most DefaultMaxDepth deep, and rejects directives such as DOCTYPE
+// declarations. Only UTF-8 documents can be read.
+//
+// The decoder can be used with xml.Unmarshal-style decoding, and can also be
+// passed to Verify.
+func NewDecoder(r io.Reader) *xml.Decoder {
+	return NewDecoderWithOptions(r, DecoderOptions{})
+}
+
+// NewDecoderWithOptions is like NewDecoder, but lets the caller override the
+// limits placed on the document. See the documentation for DecoderOptions.
+func NewDecoderWithOptions(r io.Reader, opts DecoderOptions) *xml.Decoder {
+	maxBytes := opts.MaxBytes
+	if maxBytes == 0 {
+		maxBytes = DefaultMaxBytes
+	}
+
+	if maxBytes > 0 {
+		r = &limitedReader{r: r, n: maxBytes}
+	}
+
+	maxDepth := opts.MaxDepth
+	if maxDepth == 0 {
+		maxDepth = DefaultMaxDepth
+	}
+
+	decoder := xml.NewDecoder(r)
+	decoder.CharsetReader = opts.CharsetReader
+
+	return xml.NewTokenDecoder(&secureTokenReader{
+		decoder:         decoder,
+		maxDepth:        maxDepth,
+		allowDirectives: opts.AllowDirectives,
+	})
+}
+
+// limitedReader is like io.LimitedReader, but returns ErrDocumentTooLarge
+// rather than io.EOF when the limit is exceeded.
+type limitedReader struct {
+	r io.Reader
+	n int64 // bytes remaining
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	// Read one more byte than is allowed, so that a document of exactly the
+	// maximum size can be distinguished from one that's too large.
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n < 0 {
+		return 0, ErrDocumentTooLarge
+	}
+
+	return n, err
+}
+
+// secureTokenReader is an xml.TokenReader that enforces the limits of
+// DecoderOptions.
+//
+// It returns raw tokens, as described in the documentation for TokenReader.
+// The xml.Decoder created by xml.NewTokenDecoder resolves namespaces in Token,
+// and passes raw tokens through as-is in RawToken, which is what Verify uses.
+type secureTokenReader struct {
+	decoder         *xml.Decoder
+	maxDepth        int
+	allowDirectives bool
+	depth           int
+}
+
+func (s *secureTokenReader) Token() (xml.Token, error) {
+	t, err := s.decoder.RawToken()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t.(type) {
+	case xml.StartElement:
+		s.depth++
+		if s.maxDepth > 0 && s.depth > s.maxDepth {
+			return nil, ErrDocumentTooDeep
+		}
+	case xml.EndElement:
+		s.depth--
+	case xml.Directive:
+		if !s.allowDirectives {
+			return nil, ErrDirectiveNotAllowed
+		}
+	}
+
+	return t, nil
+}
@@ -0,0 +1,152 @@
+package dsig_test
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/dsig"
+)
+
+func TestNewDecoder(t *testing.T) {
+	type testCase struct {
+		In      string
+		Options dsig.DecoderOptions
+		Err     error
+	}
+
+	testCases := map[string]testCase{
+		"ok": testCase{
+			In:  `<?xml version="1.0"?><a><b><c /></b></a>`,
+			Err: nil,
+		},
+		"directive": testCase{
+			In:  `<!DOCTYPE a><a />`,
+			Err: dsig.ErrDirectiveNotAllowed,
+		},
+		"directive allowed": testCase{
+			In:      `<!DOCTYPE a><a />`,
+			Options: dsig.DecoderOptions{AllowDirectives: true},
+			Err:     nil,
+		},
+		"too deep": testCase{
+			In:  strings.Repeat("<a>", dsig.DefaultMaxDepth+1) + strings.Repeat("</a>", dsig.DefaultMaxDepth+1),
+			Err: dsig.ErrDocumentTooDeep,
+		},
+		"exactly max depth": testCase{
+			In:  strings.Repeat("<a>", dsig.DefaultMaxDepth) + strings.Repeat("</a>", dsig.DefaultMaxDepth),
+			Err: nil,
+		},
+		"custom max depth": testCase{
+			In:      `<a><b><c /></b></a>`,
+			Options: dsig.DecoderOptions{MaxDepth: 2},
+			Err:     dsig.ErrDocumentTooDeep,
+		},
+		"no max depth": testCase{
+			In:      strings.Repeat("<a>", dsig.DefaultMaxDepth+1) + strings.Repeat("</a>", dsig.DefaultMaxDepth+1),
+			Options: dsig.DecoderOptions{MaxDepth: -1},
+			Err:     nil,
+		},
+		"too large": testCase{
+			In:      `<a>xxxxx</a>`,
+			Options: dsig.DecoderOptions{MaxBytes: 11},
+			Err:     dsig.ErrDocumentTooLarge,
+		},
+		"exactly max bytes": testCase{
+			In:      `<a>xxxxx</a>`,
+			Options: dsig.DecoderOptions{MaxBytes: 12},
+			Err:     nil,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			decoder := dsig.NewDecoderWithOptions(strings.NewReader(tt.In), tt.Options)
+
+			var err error
+			for err == nil {
+				_, err = decoder.Token()
+			}
+
+			if tt.Err == nil {
+				assert.Equal(t, io.EOF, err)
+			} else {
+				assert.Equal(t, tt.Err, err)
+			}
+		})
+	}
+}
+
+func TestNewDecoder_NonUTF8(t *testing.T) {
+	decoder := dsig.NewDecoder(strings.NewReader(`<?xml version="1.0" encoding="ISO-8859-1"?><a />`))
+
+	var err error
+	for err == nil {
+		_, err = decoder.Token()
+	}
+
+	assert.Contains(t, err.Error(), "CharsetReader")
+}
+
+func TestNewDecoder_CharsetReader(t *testing.T) {
+	decoder := dsig.NewDecoderWithOptions(strings.NewReader(`<?xml version="1.0" encoding="US-ASCII"?><a>xxx</a>`), dsig.DecoderOptions{
+		CharsetReader: func(charset string, input io.Reader) (io.Reader, error) {
+			assert.Equal(t, "US-ASCII", charset)
+			return input, nil
+		},
+	})
+
+	var a string
+	assert.NoError(t, decoder.Decode(&a))
+	assert.Equal(t, "xxx", a)
+}
+
+func TestNewDecoder_Verify(t *testing.T) {
+	doc := signTestDocument(t, `<root xmlns="http://example.com"><foo>xxx</foo>`+testSignatureFormat+`</root>`, base64.StdEncoding)
+
+	var payload struct {
+		XMLName   xml.Name       `xml:"http://example.com root"`
+		Foo       string         `xml:"http://example.com foo"`
+		Signature dsig.Signature `xml:"http://www.w3.org/2000/09/xmldsig# Signature"`
+	}
+
+	assert.NoError(t, dsig.NewDecoder(strings.NewReader(doc)).Decode(&payload))
+	assert.Equal(t, "xxx", payload.Foo)
+	assert.NoError(t, payload.Signature.Verify(testCert, dsig.NewDecoder(strings.NewReader(doc))))
+
+	tampered := strings.Replace(doc, "xxx", "yyy", 1)
+	assert.Equal(t, dsig.ErrBadDigest, payload.Signature.Verify(testCert, dsig.NewDecoder(strings.NewReader(tampered))))
+}
+
+func TestVerify_Doctype(t *testing.T) {
+	doc := signTestDocument(t, `<root><foo>xxx</foo>`+testSignatureFormat+`</root>`, base64.StdEncoding)
+
+	var payload struct {
+		Signature dsig.Signature `xml:"http://www.w3.org/2000/09/xmldsig# Signature"`
+	}
+
+	assert.NoError(t, xml.Unmarshal([]byte(doc), &payload))
+
+	// The DOCTYPE isn't part of the canonical form, so adding one doesn't affect
+	// the digest.
+	withDoctype := "<?xml version=\"1.0\"?>\n<!DOCTYPE root [\n<!ELEMENT root ANY>\n]>\n" + doc
+
+	decoder := dsig.NewDecoderWithOptions(strings.NewReader(withDoctype), dsig.DecoderOptions{AllowDirectives: true})
+	assert.NoError(t, payload.Signature.Verify(testCert, decoder))
+
+	decoder = dsig.NewDecoder(strings.NewReader(withDoctype))
+	assert.Equal(t, dsig.ErrDirectiveNotAllowed, payload.Signature.Verify(testCert, decoder))
+
+	// External entities are never resolved.
+	withEntity := `<!DOCTYPE root [<!ENTITY xxe SYSTEM "file:///etc/passwd">]>` + strings.Replace(doc, "xxx", "&xxe;", 1)
+
+	decoder = dsig.NewDecoderWithOptions(strings.NewReader(withEntity), dsig.DecoderOptions{AllowDirectives: true})
+	err := payload.Signature.Verify(testCert, decoder)
+
+	var syntaxErr *xml.SyntaxError
+	assert.True(t, errors.As(err, &syntaxErr))
+}
@@ -0,0 +1,266 @@
+package dsig
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"io"
+
+	"github.com/ucarion/dsig/internal/canon"
+	"github.com/ucarion/dsig/internal/sigsplit"
+)
+
+// ErrBadDigestLength is returned by SignDetachedDigest if the digest it's given
+// isn't the length of the digest algorithm's output.
+var ErrBadDigestLength = errors.New("dsig: digest length does not match digest algorithm")
+
+// SignDetached creates a detached Signature over content, which is identified
+// by uri, such as the URL of a binary file. Unlike with Sign, there is no
+// enclosing document: the returned Signature stands on its own, and can be
+// marshaled with xml.Marshal.
+//
+// content is read to its end and digested as-is, with no transforms. The
+// Reference of the signature has uri as its URI and no transforms. The
+// algorithms, and the certificates to put in KeyInfo, are chosen by opts as
+// with NewSignature. signer must produce RSA PKCS #1 v1.5 signatures, as with
+// SignWithSigner.
+//
+// Detached signatures are verified with VerifyDetached, rather than Verify, as
+// Verify doesn't dereference URIs.
+func SignDetached(signer crypto.Signer, uri string, content io.Reader, opts SignOptions) (*Signature, error) {
+	s, err := newDetachedSignature(uri, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	digestHash, err := s.SignedInfo.Reference().DigestMethod.hash()
+	if err != nil {
+		return nil, err
+	}
+
+	h := digestHash.New()
+	if _, err := io.Copy(h, content); err != nil {
+		return nil, err
+	}
+
+	if err := s.signDetached(signer, h.Sum(nil)); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// SignDetachedDigest is like SignDetached, but takes the digest of the
+// content instead of the content itself. digest must have been computed with
+// opts.DigestAlgorithm; if it's the wrong length for that algorithm,
+// SignDetachedDigest returns ErrBadDigestLength.
+func SignDetachedDigest(signer crypto.Signer, uri string, digest []byte, opts SignOptions) (*Signature, error) {
+	s, err := newDetachedSignature(uri, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	digestHash, err := s.SignedInfo.Reference().DigestMethod.hash()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(digest) != digestHash.Size() {
+		return nil, ErrBadDigestLength
+	}
+
+	if err := s.signDetached(signer, digest); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// VerifyDetached verifies a detached signature, such as one made by
+// SignDetached, using cert. data is the signature, as a ds:Signature root
+// element, and resolve returns the content that each of its References refers
+// to, as FSResolver does for the files of a package.
+//
+// Each Reference must have a non-empty URI, or else VerifyDetached returns an
+// *UnsupportedReferenceError. References to content outside of data must have
+// no transforms, or else VerifyDetached returns ErrUnsupportedTransform. The
+// content that resolve returns is digested as-is, and an error from resolve is
+// returned unchanged.
+//
+// A signature may also have References like "#foo" to elements of data itself,
+// such as one of its own ds:Object elements, alongside those to external
+// content. If it does, data is verified with VerifyWithOptions, with resolve
+// as VerifyOptions.Resolver, so those References are handled as they are by
+// Verify. The
+// algorithms and keys that VerifyDetached supports are those that Verify does,
+// and data is read with the default limits of NewDecoder.
+//
+// If the signature is valid, VerifyDetached returns it.
+func VerifyDetached(cert *x509.Certificate, data []byte, resolve Resolver) (*Signature, error) {
+	var s Signature
+	if err := NewDecoder(bytes.NewReader(data)).Decode(&s); err != nil {
+		return nil, err
+	}
+
+	signedInfo, err := signedInfoTokens(data)
+	if err != nil {
+		return nil, err
+	}
+
+	toVerify, err := canon.Canonicalize(&signedInfo, s.SignedInfo.CanonicalizationMethod.options())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkSignedInfo(&s.SignedInfo, toVerify); err != nil {
+		return nil, err
+	}
+
+	if len(s.SignedInfo.References) == 0 {
+		return nil, &UnsupportedReferenceError{URI: ""}
+	}
+
+	sameDocument := false
+	for _, ref := range s.SignedInfo.References {
+		if ref.URI == "" {
+			return nil, &UnsupportedReferenceError{URI: ref.URI}
+		}
+
+		if !ref.external() {
+			sameDocument = true
+		}
+	}
+
+	// A same-document Reference refers to an element of data, such as a
+	// ds:Object of the signature, and so data is verified as a document.
+	opts := VerifyOptions{Resolver: resolve}
+	if sameDocument {
+		if err := s.VerifyWithOptions(cert, NewDecoder(bytes.NewReader(data)), opts); err != nil {
+			return nil, err
+		}
+
+		return &s, nil
+	}
+
+	for _, ref := range s.SignedInfo.References {
+		if _, err := ref.verifyExternalDigest(opts); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.verifySignature(cert.PublicKey, toVerify, opts); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// newDetachedSignature returns an unsigned Signature with a Reference to uri
+// and no transforms.
+func newDetachedSignature(uri string, opts SignOptions) (*Signature, error) {
+	if uri == "" {
+		return nil, &UnsupportedReferenceError{URI: uri}
+	}
+
+	s, err := NewSignature(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	s.SignedInfo.Reference().URI = uri
+	s.SignedInfo.Reference().Transforms = nil
+	return s, nil
+}
+
+// signDetached fills in the DigestValue and SignatureValue of s, given the
+// digest of the content s refers to.
+func (s *Signature) signDetached(signer crypto.Signer, digest []byte) error {
+	if _, ok := signer.Public().(*rsa.PublicKey); !ok {
+		return ErrPublicKeyNotRSA
+	}
+
+	signatureHash, err := s.SignedInfo.SignatureMethod.hash()
+	if err != nil {
+		return err
+	}
+
+	s.SignedInfo.Reference().DigestValue = wrapBase64(base64.StdEncoding.EncodeToString(digest), s.Base64LineLength)
+
+	// ds:SignedInfo is canonicalized as it will appear once s is marshaled.
+	data, err := xml.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	signedInfo, err := signedInfoTokens(data)
+	if err != nil {
+		return err
+	}
+
+	toSign, err := canon.Canonicalize(&signedInfo, s.SignedInfo.CanonicalizationMethod.options())
+	if err != nil {
+		return err
+	}
+
+	h := signatureHash.New()
+	h.Write(toSign)
+	signature, err := signer.Sign(rand.Reader, h.Sum(nil), signatureHash)
+	if err != nil {
+		return err
+	}
+
+	s.SignatureValue.Value = wrapBase64(base64.StdEncoding.EncodeToString(signature), s.Base64LineLength)
+	return nil
+}
+
+// signedInfoTokens returns the tokens of the ds:SignedInfo in data, a marshaled
+// Signature. The namespaces declared on ds:Signature are declared on
+// ds:SignedInfo, so that it can be canonicalized on its own.
+func signedInfoTokens(data []byte) (recorderReplay, error) {
+	var tokens recorderReplay
+	var scope map[string]string
+	depth := 0
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		t, err := decoder.RawToken()
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := t.(type) {
+		case xml.StartElement:
+			depth++
+			if depth == 1 {
+				scope = sigsplit.DeclaredNamespaces(t)
+				continue
+			}
+
+			if len(tokens) == 0 {
+				t = t.Copy()
+				sigsplit.InjectNamespaces(&t, scope)
+			}
+
+			tokens = append(tokens, t)
+		case xml.EndElement:
+			depth--
+			if depth == 0 {
+				return nil, io.ErrUnexpectedEOF
+			}
+
+			tokens = append(tokens, t)
+			if depth == 1 {
+				return tokens, nil
+			}
+		default:
+			if depth > 1 {
+				tokens = append(tokens, xml.CopyToken(t))
+			}
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package dsig_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/dsig"
+	"github.com/ucarion/dsig/internal/canon"
+	"github.com/ucarion/dsig/internal/sigsplit"
+)
+
+func TestSignDetached(t *testing.T) {
+	content := "some binary content"
+	digest := sha256.Sum256([]byte(content))
+
+	fromReader, err := dsig.SignDetached(testKey, "https://example.com/file.bin", strings.NewReader(content), dsig.SignOptions{})
+	assert.NoError(t, err)
+
+	fromDigest, err := dsig.SignDetachedDigest(testKey, "https://example.com/file.bin", digest[:], dsig.SignOptions{})
+	assert.NoError(t, err)
+
+	assert.Equal(t, fromReader, fromDigest)
+
+	s := fromReader
+	assert.Equal(t, "https://example.com/file.bin", s.SignedInfo.Reference().URI)
+	assert.Empty(t, s.SignedInfo.Reference().Transforms)
+	assert.Equal(t, base64.StdEncoding.EncodeToString(digest[:]), s.SignedInfo.Reference().DigestValue)
+
+	data, err := xml.Marshal(s)
+	assert.NoError(t, err)
+
+	// The signature is over ds:SignedInfo as it appears in the marshaled
+	// signature.
+	start := strings.Index(string(data), "<SignedInfo")
+	end := strings.Index(string(data), "</SignedInfo>") + len("</SignedInfo>")
+	signedInfo, err := canon.Canonicalize(xml.NewDecoder(strings.NewReader(string(data[start:end]))), canon.Options{})
+	assert.NoError(t, err)
+
+	signature, err := base64.StdEncoding.DecodeString(s.SignatureValue.Value)
+	assert.NoError(t, err)
+
+	hashed := sha256.Sum256(signedInfo)
+	assert.NoError(t, rsa.VerifyPKCS1v15(&testKey.PublicKey, crypto.SHA256, hashed[:], signature))
+
+	var roundTrip dsig.Signature
+	assert.NoError(t, xml.Unmarshal(data, &roundTrip))
+	assert.Equal(t, s.SignedInfo.Reference().URI, roundTrip.SignedInfo.Reference().URI)
+	assert.Equal(t, s.SignedInfo.Reference().DigestValue, roundTrip.SignedInfo.Reference().DigestValue)
+	assert.Equal(t, s.SignatureValue.Value, roundTrip.SignatureValue.Value)
+}
+
+func TestVerifyDetached(t *testing.T) {
+	fsys := fstest.MapFS{
+		"content.xml":  &fstest.MapFile{Data: []byte("<content />")},
+		"tampered.xml": &fstest.MapFile{Data: []byte("<content />")},
+		"image 1.png":  &fstest.MapFile{Data: []byte("png")},
+	}
+
+	sign := func(uri string, content string, opts dsig.SignOptions) []byte {
+		s, err := dsig.SignDetached(testKey, uri, strings.NewReader(content), opts)
+		assert.NoError(t, err)
+
+		data, err := xml.Marshal(s)
+		assert.NoError(t, err)
+		return data
+	}
+
+	key, cert := generateTestCert()
+	other, err := dsig.SignDetached(key, "content.xml", strings.NewReader("<content />"), dsig.SignOptions{})
+	assert.NoError(t, err)
+
+	otherData, err := xml.Marshal(other)
+	assert.NoError(t, err)
+
+	type testCase struct {
+		Data []byte
+		Err  error
+	}
+
+	testCases := map[string]testCase{
+		"valid": testCase{
+			Data: sign("content.xml", "<content />", dsig.SignOptions{}),
+		},
+		"percent-encoded": testCase{
+			Data: sign("image%201.png", "png", dsig.SignOptions{}),
+		},
+		"prefix and sha1": testCase{
+			Data: sign("content.xml", "<content />", dsig.SignOptions{Prefix: "ds", DigestAlgorithm: dsig.DigestMethodAlgorithmSHA1}),
+		},
+		"tampered": testCase{
+			Data: sign("tampered.xml", "<original />", dsig.SignOptions{}),
+			Err:  dsig.ErrBadDigest,
+		},
+		"other key": testCase{
+			Data: otherData,
+			Err:  rsa.ErrVerification,
+		},
+		"path traversal": testCase{
+			Data: sign("../secret.txt", "secret", dsig.SignOptions{}),
+			Err:  dsig.ErrBadReferenceURI,
+		},
+		"same-document reference": testCase{
+			Data: sign("#content", "<content />", dsig.SignOptions{}),
+			Err:  dsig.ErrReferenceNotFound,
+		},
+		"empty reference": testCase{
+			Data: []byte(`<Signature xmlns="http://www.w3.org/2000/09/xmldsig#"><SignedInfo><Reference URI=""></Reference></SignedInfo></Signature>`),
+			Err:  &dsig.UnsupportedReferenceError{URI: ""},
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			s, err := dsig.VerifyDetached(testCert, tt.Data, dsig.FSResolver(fsys))
+			assert.Equal(t, tt.Err, err)
+
+			if tt.Err == nil {
+				assert.NotNil(t, s)
+			}
+		})
+	}
+
+	// The other key's signature verifies with its own certificate.
+	_, err = dsig.VerifyDetached(cert, otherData, dsig.FSResolver(fsys))
+	assert.NoError(t, err)
+}
+
+// signWithAttachment fills in the digests and SignatureValue of s, which has a
+// Reference to the element of the document with the given id, and one to
+// attachment. The document is s, marshaled and put in format, which has a
+// single %s verb.
+func signWithAttachment(t *testing.T, s *dsig.Signature, format, id string, attachment []byte) string {
+	doc := func() string {
+		data, err := xml.Marshal(s)
+		assert.NoError(t, err)
+		return fmt.Sprintf(format, data)
+	}
+
+	opts := sigsplit.Options{ID: id, ReferenceURI: "#" + id}
+	toDigest, _, err := sigsplit.SplitSignature(xml.NewDecoder(strings.NewReader(doc())), opts)
+	assert.NoError(t, err)
+
+	for i, ref := range s.SignedInfo.References {
+		digest := sha256.Sum256(attachment)
+		if ref.URI == opts.ReferenceURI {
+			digest = sha256.Sum256(toDigest)
+		}
+
+		s.SignedInfo.References[i].DigestValue = base64.StdEncoding.EncodeToString(digest[:])
+	}
+
+	_, toSign, err := sigsplit.SplitSignature(xml.NewDecoder(strings.NewReader(doc())), opts)
+	assert.NoError(t, err)
+
+	hashed := sha256.Sum256(toSign)
+	signature, err := rsa.SignPKCS1v15(rand.Reader, testKey, crypto.SHA256, hashed[:])
+	assert.NoError(t, err)
+
+	s.SignatureValue.Value = base64.StdEncoding.EncodeToString(signature)
+	return doc()
+}
+
+func TestVerifyDetached_SameDocumentAndExternal(t *testing.T) {
+	// An enveloping signature, over one of its own ds:Objects and over a file
+	// that travels alongside it.
+	s, err := dsig.NewSignature(dsig.SignOptions{References: []dsig.ReferenceOptions{
+		{URI: "#manifest", Transforms: []string{dsig.CanonicalizationMethodAlgorithmExclusive}},
+		{URI: "content.bin"},
+	}})
+	assert.NoError(t, err)
+
+	s.SignedInfo.References[1].Transforms = nil
+	s.Objects = []dsig.Object{{ID: "manifest", Content: []byte("<files>content.bin</files>")}}
+	data := signWithAttachment(t, s, "%s", "manifest", []byte("xxx"))
+
+	resolve := func(content string) dsig.Resolver {
+		return dsig.FSResolver(fstest.MapFS{"content.bin": &fstest.MapFile{Data: []byte(content)}})
+	}
+
+	verified, err := dsig.VerifyDetached(testCert, []byte(data), resolve("xxx"))
+	assert.NoError(t, err)
+	assert.Equal(t, "manifest", verified.Objects[0].ID)
+
+	_, err = dsig.VerifyDetached(testCert, []byte(data), resolve("yyy"))
+	assert.Equal(t, dsig.ErrBadDigest, err)
+
+	_, err = dsig.VerifyDetached(testCert, []byte(strings.Replace(data, "content.bin</files>", "other.bin</files>", 1)), resolve("xxx"))
+	assert.Equal(t, dsig.ErrBadDigest, err)
+}
+
+func TestVerify_Resolver(t *testing.T) {
+	// An enveloped signature, over an attachment and over an element of the
+	// document. The signature is found by the second Reference, as the first
+	// isn't to anything in the document.
+	s, err := dsig.NewSignature(dsig.SignOptions{References: []dsig.ReferenceOptions{
+		{URI: "cid:attachment"},
+		{URI: "#foo"},
+	}})
+	assert.NoError(t, err)
+
+	s.SignedInfo.References[0].Transforms = nil
+	doc := signWithAttachment(t, s, `<root><foo ID="foo">xxx%s</foo></root>`, "foo", []byte("attached"))
+
+	resolve := func(content string) dsig.Resolver {
+		return func(uri string) ([]byte, error) {
+			if uri != "cid:attachment" {
+				return nil, dsig.ErrBadReferenceURI
+			}
+
+			return []byte(content), nil
+		}
+	}
+
+	verify := func(doc string, opts dsig.VerifyOptions) (*dsig.VerifyResult, error) {
+		return s.VerifyWithResult(testCert, xml.NewDecoder(strings.NewReader(doc)), opts)
+	}
+
+	result, err := verify(doc, dsig.VerifyOptions{Resolver: resolve("attached")})
+	assert.NoError(t, err)
+	assert.Equal(t, []dsig.ReferencedElement{
+		{URI: "cid:attachment", DigestMethod: dsig.DigestMethodAlgorithmSHA256, Digest: referenceDigest(t, s.SignedInfo.References[0])},
+		{URI: "#foo", Path: "root>foo", Name: xml.Name{Local: "foo"}, DigestMethod: dsig.DigestMethodAlgorithmSHA256, Digest: referenceDigest(t, s.SignedInfo.References[1])},
+	}, result.ReferencedElements)
+
+	_, err = verify(doc, dsig.VerifyOptions{Resolver: resolve("tampered")})
+	assert.Equal(t, dsig.ErrBadDigest, err)
+
+	_, err = verify(strings.Replace(doc, "xxx", "yyy", 1), dsig.VerifyOptions{Resolver: resolve("attached")})
+	assert.Equal(t, dsig.ErrBadDigest, err)
+
+	_, err = verify(doc, dsig.VerifyOptions{})
+	assert.Equal(t, &dsig.UnsupportedReferenceError{URI: "cid:attachment"}, err)
+}
+
+func TestSignDetached_Errors(t *testing.T) {
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	_, err = dsig.SignDetached(testKey, "", strings.NewReader("xxx"), dsig.SignOptions{})
+	assert.Equal(t, &dsig.UnsupportedReferenceError{URI: ""}, err)
+
+	_, err = dsig.SignDetached(ecdsaKey, "file.bin", strings.NewReader("xxx"), dsig.SignOptions{})
+	assert.Equal(t, dsig.ErrPublicKeyNotRSA, err)
+
+	_, err = dsig.SignDetached(testKey, "file.bin", strings.NewReader("xxx"), dsig.SignOptions{DigestAlgorithm: "bogus"})
+	assert.Equal(t, dsig.ErrBadDigestAlgorithm, err)
+
+	_, err = dsig.SignDetachedDigest(testKey, "file.bin", []byte("too short"), dsig.SignOptions{})
+	assert.Equal(t, dsig.ErrBadDigestLength, err)
+}
@@ -0,0 +1,98 @@
+package dsig
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/xml"
+
+	"github.com/ucarion/c14n"
+	"github.com/ucarion/dsig/internal/canon"
+	"github.com/ucarion/dsig/internal/sigsplit"
+)
+
+// DigestMismatchError is returned by VerifyWithOptions instead of ErrBadDigest
+// if VerifyOptions.DiagnoseDigest is set. It wraps ErrBadDigest.
+type DigestMismatchError struct {
+	// MatchingAlgorithm is the URI of the canonicalization algorithm that the
+	// signed data would have matched the digest under, or the empty string if
+	// none of the alternatives that were tried match.
+	MatchingAlgorithm string
+}
+
+func (e *DigestMismatchError) Error() string {
+	if e.MatchingAlgorithm == "" {
+		return ErrBadDigest.Error()
+	}
+
+	return ErrBadDigest.Error() + " (would match with canonicalization " + e.MatchingAlgorithm + ")"
+}
+
+func (e *DigestMismatchError) Unwrap() error {
+	return ErrBadDigest
+}
+
+// digestAlternatives are the canonicalization algorithms that DiagnoseDigest
+// tries when a digest doesn't match.
+var digestAlternatives = []struct {
+	algorithm string
+	options   canon.Options
+}{
+	{algorithm: CanonicalizationMethodAlgorithmExclusive, options: canon.Options{}},
+	{algorithm: CanonicalizationMethodAlgorithmExclusiveWithComments, options: canon.Options{WithComments: true}},
+	{algorithm: CanonicalizationMethodAlgorithmInclusive, options: canon.Options{Inclusive: true}},
+	{algorithm: CanonicalizationMethodAlgorithmInclusiveWithComments, options: canon.Options{Inclusive: true, WithComments: true}},
+}
+
+// diagnoseDigest looks for an alternative canonicalization of the tokens in
+// replay under which the signed data has the expected digest. The alternative
+// that's the same as the canonicalization already tried is skipped.
+func diagnoseDigest(replay []xml.Token, opts sigsplit.Options, digestHash crypto.Hash, expected []byte, vopts VerifyOptions) error {
+	for _, alt := range digestAlternatives {
+		if alt.options.Inclusive == opts.Outer.Inclusive && alt.options.WithComments == opts.Outer.WithComments {
+			continue
+		}
+
+		outer := alt.options
+		outer.NormalizePrefixes = opts.Outer.NormalizePrefixes
+
+		// The InclusiveNamespaces PrefixList is a parameter of Exclusive
+		// Canonical XML only.
+		if !outer.Inclusive {
+			outer.InclusivePrefixes = opts.Outer.InclusivePrefixes
+		}
+
+		altOpts := opts
+		altOpts.Outer = outer
+
+		r := recorderReplay(replay)
+		toDigest, _, err := sigsplit.SplitSignature(&r, altOpts)
+		if err != nil {
+			continue
+		}
+
+		h := vopts.newHash(digestHash)
+		h.Write(toDigest)
+		if bytes.Equal(expected, h.Sum(nil)) {
+			return &DigestMismatchError{MatchingAlgorithm: alt.algorithm}
+		}
+	}
+
+	return &DigestMismatchError{}
+}
+
+// tokenRecorder is a c14n.RawTokenReader that keeps a copy of each token it
+// reads, so that they can be read again with recorderReplay.
+type tokenRecorder struct {
+	r      c14n.RawTokenReader
+	tokens []xml.Token
+}
+
+func (r *tokenRecorder) RawToken() (xml.Token, error) {
+	t, err := r.r.RawToken()
+	if err != nil {
+		return nil, err
+	}
+
+	r.tokens = append(r.tokens, xml.CopyToken(t))
+	return t, nil
+}
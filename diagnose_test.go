@@ -0,0 +1,81 @@
+package dsig_test
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/dsig"
+	"github.com/ucarion/dsig/internal/canon"
+	"github.com/ucarion/dsig/internal/sigsplit"
+)
+
+func TestVerifyWithOptions_DiagnoseDigest(t *testing.T) {
+	format := `<root><foo>xxx<!-- comment --></foo>` + testSignatureFormat + `</root>`
+
+	// The namespace declared on the root is unused, so only Canonical XML 1.0
+	// keeps it.
+	inclusiveFormat := `<root xmlns:a="urn:a"><foo>xxx<!-- comment --></foo>` + testSignatureFormat + `</root>`
+
+	type testCase struct {
+		Doc   string
+		Opts  dsig.VerifyOptions
+		Error error
+	}
+
+	testCases := map[string]testCase{
+		"signed with comments": testCase{
+			Doc:   signTestDocumentWithOptions(t, format, base64.StdEncoding, sigsplit.Options{Outer: canon.Options{WithComments: true}}),
+			Opts:  dsig.VerifyOptions{DiagnoseDigest: true},
+			Error: &dsig.DigestMismatchError{MatchingAlgorithm: dsig.CanonicalizationMethodAlgorithmExclusiveWithComments},
+		},
+		"signed with comments, without diagnosis": testCase{
+			Doc:   signTestDocumentWithOptions(t, format, base64.StdEncoding, sigsplit.Options{Outer: canon.Options{WithComments: true}}),
+			Opts:  dsig.VerifyOptions{},
+			Error: dsig.ErrBadDigest,
+		},
+		"signed inclusive": testCase{
+			Doc:   signTestDocumentWithOptions(t, inclusiveFormat, base64.StdEncoding, sigsplit.Options{Outer: canon.Options{Inclusive: true}}),
+			Opts:  dsig.VerifyOptions{DiagnoseDigest: true},
+			Error: &dsig.DigestMismatchError{MatchingAlgorithm: dsig.CanonicalizationMethodAlgorithmInclusive},
+		},
+		"signed inclusive with comments": testCase{
+			Doc:   signTestDocumentWithOptions(t, inclusiveFormat, base64.StdEncoding, sigsplit.Options{Outer: canon.Options{Inclusive: true, WithComments: true}}),
+			Opts:  dsig.VerifyOptions{DiagnoseDigest: true},
+			Error: &dsig.DigestMismatchError{MatchingAlgorithm: dsig.CanonicalizationMethodAlgorithmInclusiveWithComments},
+		},
+		"signed exclusive, verified inclusive": testCase{
+			Doc:   signTestDocument(t, strings.Replace(inclusiveFormat, `"http://www.w3.org/2001/10/xml-exc-c14n#"></ds:Transform>`, `"`+dsig.CanonicalizationMethodAlgorithmInclusive+`"></ds:Transform>`, 1), base64.StdEncoding),
+			Opts:  dsig.VerifyOptions{DiagnoseDigest: true},
+			Error: &dsig.DigestMismatchError{MatchingAlgorithm: dsig.CanonicalizationMethodAlgorithmExclusive},
+		},
+		"tampered": testCase{
+			Doc:   strings.Replace(signTestDocument(t, format, base64.StdEncoding), "xxx", "yyy", 1),
+			Opts:  dsig.VerifyOptions{DiagnoseDigest: true},
+			Error: &dsig.DigestMismatchError{},
+		},
+		"valid": testCase{
+			Doc:   signTestDocument(t, format, base64.StdEncoding),
+			Opts:  dsig.VerifyOptions{DiagnoseDigest: true},
+			Error: nil,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := verifyTestDocumentWithOptions(t, tt.Doc, tt.Opts)
+			assert.Equal(t, tt.Error, err)
+
+			if tt.Error != nil {
+				assert.True(t, errors.Is(err, dsig.ErrBadDigest))
+			}
+		})
+	}
+}
+
+func TestDigestMismatchError(t *testing.T) {
+	assert.Equal(t, "dsig: incorrect digest", (&dsig.DigestMismatchError{}).Error())
+	assert.Equal(t, "dsig: incorrect digest (would match with canonicalization http://www.w3.org/2001/10/xml-exc-c14n#WithComments)", (&dsig.DigestMismatchError{MatchingAlgorithm: dsig.CanonicalizationMethodAlgorithmExclusiveWithComments}).Error())
+}
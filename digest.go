@@ -0,0 +1,62 @@
+package dsig
+
+import (
+	"bytes"
+
+	"github.com/ucarion/c14n"
+	"github.com/ucarion/dsig/internal/canon"
+	"github.com/ucarion/dsig/internal/sigsplit"
+)
+
+// ComputeDigest computes the digest of the data in r, exactly as Verify would
+// when checking a DigestValue.
+//
+// The first child-of-root ds:Signature whose Reference has an empty URI, or
+// failing that the first child-of-root ds:Signature, is removed from the data,
+// as the enveloped signature transform requires. The rest is canonicalized
+// with Exclusive Canonical XML. Unlike Verify, the data does not need to
+// contain a signature.
+//
+// algorithmURI must be one of the DigestMethodAlgorithm values. Otherwise,
+// ComputeDigest returns ErrBadDigestAlgorithm.
+func ComputeDigest(r c14n.RawTokenReader, algorithmURI string) ([]byte, error) {
+	method := DigestMethod{Algorithm: algorithmURI}
+	digestHash, err := method.hash()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := sigsplit.CanonicalizeOuter(r, canon.Options{})
+	if err != nil {
+		return nil, err
+	}
+
+	h := digestHash.New()
+	h.Write(data)
+	return h.Sum(nil), nil
+}
+
+// CompareDigest checks that the digest of the data in r matches digestValue,
+// a base64-encoded value as would appear in a DigestValue.
+//
+// The digest is computed as ComputeDigest does. If it doesn't match
+// digestValue, CompareDigest returns ErrBadDigest. No signature or key is
+// involved, so CompareDigest only detects changes to the data; it says nothing
+// about who produced it.
+func CompareDigest(r c14n.RawTokenReader, algorithmURI, digestValue string) error {
+	expectedDigest, err := decodeBase64(digestValue)
+	if err != nil {
+		return err
+	}
+
+	digest, err := ComputeDigest(r, algorithmURI)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(expectedDigest, digest) {
+		return ErrBadDigest
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package dsig_test
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/dsig"
+)
+
+func TestComputeDigest(t *testing.T) {
+	type testCase struct {
+		In        string
+		Algorithm string
+		Out       string
+		Err       error
+	}
+
+	sum := sha256.Sum256([]byte(`<foo a="b"><bar></bar></foo>`))
+	testCases := map[string]testCase{
+		"no signature": testCase{
+			In:        `<foo a="b"><bar /></foo>`,
+			Algorithm: dsig.DigestMethodAlgorithmSHA256,
+			Out:       string(sum[:]),
+		},
+		"with signature": testCase{
+			In:        `<foo a="b"><ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:SignedInfo /></ds:Signature><bar /></foo>`,
+			Algorithm: dsig.DigestMethodAlgorithmSHA256,
+			Out:       string(sum[:]),
+		},
+		"bad algorithm": testCase{
+			In:        `<foo a="b"><bar /></foo>`,
+			Algorithm: "http://example.com/bad",
+			Err:       dsig.ErrBadDigestAlgorithm,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			out, err := dsig.ComputeDigest(xml.NewDecoder(strings.NewReader(tt.In)), tt.Algorithm)
+			assert.Equal(t, tt.Err, err)
+			if tt.Err == nil {
+				assert.Equal(t, tt.Out, string(out))
+			}
+		})
+	}
+}
+
+func TestCompareDigest(t *testing.T) {
+	doc := signTestDocument(t, fmt.Sprintf("<foo>%s<bar /></foo>", testSignatureFormat), base64.StdEncoding)
+
+	var payload struct {
+		Signature dsig.Signature `xml:"http://www.w3.org/2000/09/xmldsig# Signature"`
+	}
+
+	assert.NoError(t, xml.Unmarshal([]byte(doc), &payload))
+	digestValue := payload.Signature.SignedInfo.Reference().DigestValue
+
+	err := dsig.CompareDigest(xml.NewDecoder(strings.NewReader(doc)), dsig.DigestMethodAlgorithmSHA256, digestValue)
+	assert.NoError(t, err)
+
+	tampered := strings.Replace(doc, "<bar />", "<baz />", 1)
+	err = dsig.CompareDigest(xml.NewDecoder(strings.NewReader(tampered)), dsig.DigestMethodAlgorithmSHA256, digestValue)
+	assert.Equal(t, dsig.ErrBadDigest, err)
+
+	err = dsig.CompareDigest(xml.NewDecoder(strings.NewReader(doc)), dsig.DigestMethodAlgorithmSHA256, "!!!")
+	assert.True(t, errors.As(err, new(base64.CorruptInputError)))
+}
@@ -8,23 +8,49 @@ import (
 	"encoding/base64"
 	"encoding/xml"
 	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/ucarion/c14n"
+	"github.com/ucarion/dsig/internal/canon"
 	"github.com/ucarion/dsig/internal/sigsplit"
 )
 
+// namespace is the XML namespace of the elements making up an XML signature.
+var namespace = "http://www.w3.org/2000/09/xmldsig#"
+
 // Signature represents an enveloped XML signature.
 //
 // If you have a struct that is supposed to contain an envloped XML signature,
 // then you should embed Signature into your struct.
 type Signature struct {
 	XMLName        xml.Name `xml:"http://www.w3.org/2000/09/xmldsig# Signature"`
+	ID             string   `xml:"Id,attr,omitempty"`
 	SignedInfo     SignedInfo
-	SignatureValue string
+	SignatureValue SignatureValue
+	KeyInfo        *KeyInfo
+	Objects        []Object `xml:"http://www.w3.org/2000/09/xmldsig# Object"`
+
+	// Prefix is the namespace prefix that MarshalXML writes the elements of the
+	// signature with. xml.Unmarshal sets it to the prefix the signature was
+	// written with, if ds:Signature declares it; see UnmarshalXML.
+	Prefix string `xml:"-"`
+
+	// IDAttribute is the attribute that Sign looks in for the ID a Reference
+	// refers to, as with SignOptions.IDAttribute. It only affects signing, and
+	// isn't written out, so it is not set by xml.Unmarshal.
+	IDAttribute xml.Name `xml:"-"`
+
+	// Base64LineLength is the length that Sign wraps the base64 text it
+	// generates at, as with SignOptions.Base64LineLength. xml.Unmarshal sets it
+	// from how the SignatureValue is wrapped; see UnmarshalXML.
+	Base64LineLength int `xml:"-"`
 }
 
 // ErrPublicKeyNotRSA is returned by Verify if the given x509.Certificate
-// doesn't contain an RSA public key.
+// doesn't contain an RSA public key, and by SignWithSigner if the signer's
+// public key isn't an RSA key.
 var ErrPublicKeyNotRSA = errors.New("dsig: public key must be a *rsa.PublicKey")
 
 // ErrBadDigest is returned by Verify if the embedded signature doesn't match
@@ -66,71 +92,551 @@ var ErrBadSignatureAlgorithm = errors.New("dsig: invalid or unsupported signatur
 //  xml.Unmarshal(data, &foo)
 //  foo.Signature.Verify(cert, xml.NewDecoder(data))
 //
+// Tokenizers other than xml.Decoder can be used, so long as they follow the
+// contract described in the documentation for TokenReader.
+//
 // Verify supports only the SHA1 and SHA256 digest algorithms, and only the
 // RSA-SHA1 and RSA-SHA256 signature algorithms. All other algorithms will lead
 // Verify to return ErrBadDigestAlgorithm or ErrBadSignatureAlgorithm.
 //
-// Verify supports only the Exclusive Canonical XML canonicalization algorithm,
-// and does not support the InclusiveNamespaces argument. No special error will
-// be returned if s uses a different c14n algorithm, but most likely Verify will
-// return ErrBadDigest in this case.
+// Only the content outside of s's ds:Signature element is digested. Other
+// children of ds:Signature, such as ds:Object or ds:KeyInfo, are neither
+// digested nor signed, and so can be changed without affecting Verify. The
+// exception is an enveloping signature, whose Reference refers to one of its
+// own ds:Object elements by ID; that ds:Object is digested.
+//
+// If the signature's Reference has an empty URI, or none at all, the whole
+// document is digested, as it is with the XPointer "#xpointer(/)". A URI like
+// "#foo", or the XPointer "#xpointer(id('foo'))", makes Verify digest only the
+// element whose ID, Id, id, or WS-Security wsu:Id attribute is "foo". If no
+// element has that ID, Verify returns ErrReferenceNotFound, and if several do,
+// it returns ErrDuplicateID. VerifyOptions.IDAttribute can restrict which
+// attribute the ID is looked for in. Other URIs, including any other XPointer,
+// lead to an *UnsupportedReferenceError.
+//
+// By default, an element referred to by ID must contain s, or be contained by
+// it, as in an enveloping signature. Otherwise, Verify returns
+// ErrReferenceNotEnveloping, as the rest of the document, including where the
+// signed element is, isn't covered by the signature. This includes the common
+// SOAP case of a signature in the header over the body; see
+// VerifyOptions.AllowArbitraryReferences for how to verify those safely.
+//
+// A signature may have several References, such as one for each part of a SOAP
+// message. The data each refers to is digested separately, and Verify returns
+// ErrBadDigest if any of their digests is incorrect. The ds:Signature being
+// verified is found using the URI of the first Reference.
+//
+// Comments are never digested for empty or bare-name URIs. For the XPointer
+// forms, which keep comments, they are digested if the Reference lists the
+// Exclusive Canonical XML with comments transform.
+//
+// With an empty URI or "#xpointer(/)", s must be an immediate child of the
+// root element. With an ID, s must by default be an immediate child of the
+// element it refers to, or, if it's an enveloping signature, the root element
+// or a child of it; otherwise, Verify returns ErrSignatureMisplaced. With
+// VerifyOptions.AllowArbitraryReferences, s may be anywhere in the document,
+// before or after the element it refers to, as is common in SOAP messages.
+// Verify looks for s as the first ds:Signature whose Reference has the same
+// URI, and returns ErrSignatureNotFound if there is none.
+//
+// Only s itself is removed from the digested data, as the enveloped signature
+// transform requires. Any other ds:Signature in the data, such as one that
+// signs a child element, is digested like the rest of the data.
+//
+// The transforms listed in the signature's Reference are not evaluated, except
+// for those registered with RegisterTransform. XPath and XSLT transforms are
+// accepted only if they are identity transforms, which have no effect; all
+// others cause Verify to return ErrUnsupportedTransform.
+// The XPath expressions "true()" and "1" are recognized as identity transforms,
+// as is an XSLT stylesheet consisting of exactly one template, matching
+// "@*|node()", whose body is an xsl:copy of xsl:apply-templates selecting
+// "@*|node()".
+//
+// XML Signature 2.0 signatures, which use the Canonical XML 2.0 algorithm or
+// the 2.0 transform, are recognized but not supported. Verify returns a
+// *DSig2UnsupportedError for them.
+//
+// If the algorithms or DigestValue in s differ from those in the ds:SignedInfo
+// found in r, Verify returns a *SignedInfoMismatchError.
+//
+// Verify supports the Exclusive Canonical XML canonicalization algorithm, with
+// or without comments, along with its InclusiveNamespaces PrefixList
+// parameter, and the Canonical XML 1.0 algorithm, with or without comments.
+// No special error will be returned if s uses a different c14n algorithm, but
+// most likely Verify will return ErrBadDigest in this case.
+//
+// Verify is equivalent to VerifyWithOptions with the zero value of
+// VerifyOptions.
 func (s *Signature) Verify(cert *x509.Certificate, r c14n.RawTokenReader) error {
+	return s.VerifyWithOptions(cert, r, VerifyOptions{})
+}
+
+// VerifyWithOptions is like Verify, but lets the caller control how the
+// signature is verified. See the documentation for VerifyOptions.
+func (s *Signature) VerifyWithOptions(cert *x509.Certificate, r c14n.RawTokenReader, opts VerifyOptions) error {
+	_, err := s.VerifyWithResult(cert, r, opts)
+	return err
+}
+
+// VerifyWithResult is like VerifyWithOptions, but additionally returns details
+// about the signature it verified. See the documentation for VerifyResult.
+//
+// If the signature is not valid, VerifyWithResult returns a nil VerifyResult
+// along with the same error VerifyWithOptions would return.
+func (s *Signature) VerifyWithResult(cert *x509.Certificate, r c14n.RawTokenReader, opts VerifyOptions) (*VerifyResult, error) {
+	defer opts.startTimer()()
+
+	result, toVerify, err := s.verifyDigest(r, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.QCStatements != nil {
+		if err := opts.QCStatements.check(cert); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.verifySignature(cert.PublicKey, toVerify, opts); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// verifyDigest does all of the work of verifying s that doesn't involve a
+// public key. It returns the result of verifying s, if the signature turns out
+// to be valid, and the canonicalized SignedInfo that the signature must be
+// verified against.
+func (s *Signature) verifyDigest(r c14n.RawTokenReader, opts VerifyOptions) (*VerifyResult, []byte, error) {
+	if opts.RequireKeyInfo && s.KeyInfo == nil {
+		return nil, nil, ErrMissingKeyInfo
+	}
+
+	if s.SignedInfo.CanonicalizationMethod.Algorithm == CanonicalizationMethodAlgorithmC14N20 {
+		return nil, nil, &DSig2UnsupportedError{Feature: "canonicalization " + CanonicalizationMethodAlgorithmC14N20}
+	}
+
+	refs := s.SignedInfo.References
+	if len(refs) == 0 {
+		refs = []Reference{{}}
+	}
+
+	for _, ref := range refs {
+		for _, t := range ref.Transforms {
+			if err := t.check(); err != nil {
+				return nil, nil, err
+			}
+		}
+
+		if opts.MinDigestStrength != 0 {
+			digestHash, err := ref.DigestMethod.hash()
+			if err != nil {
+				return nil, nil, err
+			}
+
+			if digestHash.Size() < opts.MinDigestStrength.Size() {
+				return nil, nil, ErrWeakDigest
+			}
+		}
+	}
+
+	if opts.MinSignatureStrength != 0 {
+		signatureHash, err := s.SignedInfo.SignatureMethod.hash()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if signatureHash.Size() < opts.MinSignatureStrength.Size() {
+			return nil, nil, ErrWeakSignature
+		}
+	}
+
+	// primary is the Reference that the ds:Signature is found by, and the one
+	// whose data is digested as the document is read. References to data outside
+	// of the document can't be used to find it.
+	primary := s.SignedInfo.Reference()
+	if opts.Resolver != nil {
+		for i := range s.SignedInfo.References {
+			if !s.SignedInfo.References[i].external() {
+				primary = &s.SignedInfo.References[i]
+				break
+			}
+		}
+	}
+
+	id, err := primary.id()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if opts.Progress != nil {
+		r = &progressReader{r: r, progress: opts.Progress}
+	}
+
+	if opts.XOPParts != nil {
+		r = &xopReader{r: r, parts: opts.XOPParts}
+	}
+
+	// The data is digested once per Reference. The primary one is digested as
+	// the data is read, and the rest from a copy of it.
+	var all *tokenRecorder
+	if len(refs) > 1 {
+		all = &tokenRecorder{r: r}
+		r = all
+	}
+
+	r = primary.applyCustomTransforms(r)
+
+	var recorder *tokenRecorder
+	if opts.DiagnoseDigest {
+		recorder = &tokenRecorder{r: r}
+		r = recorder
+	}
+
+	inner := s.SignedInfo.CanonicalizationMethod.options()
+	inner.NormalizePrefixes = opts.NormalizePrefixes
+
+	outer := primary.canonOptions()
+	outer.NormalizePrefixes = opts.NormalizePrefixes
+
+	splitOpts := sigsplit.Options{
+		Outer:               outer,
+		Inner:               inner,
+		ID:                  id,
+		IDAttribute:         opts.IDAttribute,
+		ReferenceURI:        primary.URI,
+		RequireEnveloped:    !opts.AllowArbitraryReferences,
+		RequireFullCoverage: opts.RequireFullCoverage,
+		MatchSignatureValue: s.matchSignatureValue(),
+	}
+
 	// Split the token stream into the part that needs to be digested and the part
 	// that needs to be signed.
-	toDigest, toVerify, err := sigsplit.SplitSignature(r)
+	start := opts.timer.now()
+	split, err := sigsplit.Split(r, splitOpts)
+	opts.timer.canonicalization(start)
 	if err != nil {
-		return err
+		return nil, nil, splitError(err)
+	}
+
+	toDigest, toVerify := split.Outer, split.Inner
+
+	if opts.ValidateUTF8 && !(utf8.Valid(toDigest) && utf8.Valid(toVerify)) {
+		return nil, nil, ErrInvalidUTF8
+	}
+
+	if err := checkSignedInfo(&s.SignedInfo, toVerify); err != nil {
+		return nil, nil, err
 	}
 
-	expectedDigest, err := base64.StdEncoding.DecodeString(s.SignedInfo.Reference.DigestValue)
+	expectedDigest, err := decodeBase64(primary.DigestValue)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	digestHash, err := s.SignedInfo.Reference.DigestMethod.hash()
+	digestHash, err := primary.DigestMethod.hash()
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	h := digestHash.New()
+	start = opts.timer.now()
+	h := opts.newHash(digestHash)
 	h.Write(toDigest)
+	digest := h.Sum(nil)
+	opts.timer.hashing(start)
 
 	// This does not need to be a subtle.ConstantTimeCompare, because the digest
 	// is not being used as an HMAC. There is no secret key here.
 	//
 	// Instead, verifying the digest here can act as a hint to the caller that the
 	// embedded signature does not correspond to the data it's embedded in.
-	if !bytes.Equal(expectedDigest, h.Sum(nil)) {
-		return ErrBadDigest
+	if !bytes.Equal(expectedDigest, digest) {
+		if recorder != nil {
+			return nil, nil, diagnoseDigest(recorder.tokens, splitOpts, digestHash, expectedDigest, opts)
+		}
+
+		return nil, nil, ErrBadDigest
+	}
+
+	var referenced []ReferencedElement
+	for i := range refs {
+		ref := &refs[i]
+
+		var element ReferencedElement
+		switch {
+		case ref == primary || len(s.SignedInfo.References) == 0:
+			element = newReferencedElement(primary, split, digest)
+		case opts.Resolver != nil && ref.external():
+			element, err = ref.verifyExternalDigest(opts)
+		default:
+			element, err = ref.verifyDigest(all.tokens, splitOpts, opts)
+		}
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		referenced = append(referenced, element)
+	}
+
+	result := &VerifyResult{
+		CanonicalizationMethod: s.SignedInfo.CanonicalizationMethod.Algorithm,
+		SignatureMethod:        s.SignedInfo.SignatureMethod.Algorithm,
+		DigestMethod:           primary.DigestMethod.Algorithm,
+		Digest:                 digest,
+		SignedData:             toDigest,
+		SignedInfo:             toVerify,
+		ReferencedElements:     referenced,
 	}
 
-	publicKey, ok := cert.PublicKey.(*rsa.PublicKey)
+	return result, toVerify, nil
+}
+
+// verifySignature checks that the SignatureValue of s is a valid signature of
+// toVerify by publicKey.
+func (s *Signature) verifySignature(publicKey crypto.PublicKey, toVerify []byte, opts VerifyOptions) error {
+	rsaKey, ok := publicKey.(*rsa.PublicKey)
 	if !ok {
 		return ErrPublicKeyNotRSA
 	}
 
+	if rsaKey.N.BitLen() > opts.maxKeySize() {
+		return ErrKeyTooLarge
+	}
+
+	if rsaKey.N.BitLen() < opts.MinKeySize {
+		return ErrKeyTooSmall
+	}
+
 	signatureHash, err := s.SignedInfo.SignatureMethod.hash()
 	if err != nil {
 		return err
 	}
 
-	h = signatureHash.New()
+	start := opts.timer.now()
+	h := opts.newHash(signatureHash)
 	h.Write(toVerify)
+	hashed := h.Sum(nil)
+	opts.timer.hashing(start)
 
-	expectedSignature, err := base64.StdEncoding.DecodeString(s.SignatureValue)
+	expectedSignature, err := decodeBase64(s.SignatureValue.Value)
 	if err != nil {
 		return err
 	}
 
-	return rsa.VerifyPKCS1v15(publicKey, signatureHash, h.Sum(nil), expectedSignature)
+	if len(expectedSignature) > rsaKey.Size() {
+		return ErrSignatureTooLarge
+	}
+
+	start = opts.timer.now()
+	defer opts.timer.publicKey(start)
+
+	return opts.verifyPKCS1v15(rsaKey, signatureHash, hashed, expectedSignature)
+}
+
+// decodeBase64 decodes a base64-encoded value from a signature.
+//
+// Whitespace in s is ignored, as base64 values in XML are frequently wrapped or
+// indented, and elements with xml:space="preserve" keep the whitespace
+// surrounding their value.
+//
+// encoding/xml concatenates all of the text in an element, skipping any
+// comments or processing instructions in between, so s is the full value even
+// if a producer split it up with a comment.
+//
+// Some producers omit the trailing padding from their base64 output, so if s
+// isn't validly padded, decodeBase64 falls back to decoding it without padding.
+// If neither works, the error from the padded decoding is returned.
+func decodeBase64(s string) ([]byte, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err == nil {
+		return b, nil
+	}
+
+	trimmed := strings.Join(strings.Fields(s), "")
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding} {
+		if b, err := enc.DecodeString(trimmed); err == nil {
+			return b, nil
+		}
+	}
+
+	return nil, err
+}
+
+// matchSignatureValue returns a function that reports whether the text of a
+// ds:SignatureValue is that of s, so that sigsplit splits out the ds:Signature
+// that s was unmarshaled from, rather than the first one that has the same
+// Reference URI. Otherwise, a copy of s placed earlier in the document could
+// stand in for it, while the data that s is actually over is never digested.
+//
+// Values are compared once decoded, so that they match however they're
+// wrapped. If either doesn't decode, they're compared as text instead.
+func (s *Signature) matchSignatureValue() func(string) bool {
+	want, wantErr := decodeBase64(s.SignatureValue.Value)
+	wantText := strings.Join(strings.Fields(s.SignatureValue.Value), "")
+
+	return func(value string) bool {
+		got, err := decodeBase64(value)
+		if wantErr != nil || err != nil {
+			return strings.Join(strings.Fields(value), "") == wantText
+		}
+
+		return bytes.Equal(got, want)
+	}
+}
+
+// String returns a concise summary of s, for use in logs and debugging.
+//
+// Well-known algorithms are described by short names, and the DigestValue and
+// SignatureValue are truncated.
+func (s *Signature) String() string {
+	return fmt.Sprintf(
+		"Signature{CanonicalizationMethod: %s, SignatureMethod: %s, DigestMethod: %s, DigestValue: %s, SignatureValue: %s}",
+		shortAlgorithm(s.SignedInfo.CanonicalizationMethod.Algorithm),
+		shortAlgorithm(s.SignedInfo.SignatureMethod.Algorithm),
+		shortAlgorithm(s.SignedInfo.Reference().DigestMethod.Algorithm),
+		truncateValue(s.SignedInfo.Reference().DigestValue),
+		truncateValue(s.SignatureValue.Value),
+	)
+}
+
+// shortAlgorithm returns a short name for the algorithm identified by uri, or
+// uri itself if it's not an algorithm this package knows about.
+func shortAlgorithm(uri string) string {
+	switch uri {
+	case CanonicalizationMethodAlgorithmExclusive:
+		return "exc-c14n"
+	case CanonicalizationMethodAlgorithmExclusiveWithComments:
+		return "exc-c14n-with-comments"
+	case CanonicalizationMethodAlgorithmInclusive:
+		return "c14n"
+	case CanonicalizationMethodAlgorithmInclusiveWithComments:
+		return "c14n-with-comments"
+	case SignatureMethodAlgorithmSHA1:
+		return "rsa-sha1"
+	case SignatureMethodAlgorithmSHA256:
+		return "rsa-sha256"
+	case DigestMethodAlgorithmSHA1:
+		return "sha1"
+	case DigestMethodAlgorithmSHA256:
+		return "sha256"
+	case "":
+		return "none"
+	default:
+		return uri
+	}
+}
+
+// truncatedValueLen is the number of characters of a base64 value that String
+// includes.
+const truncatedValueLen = 8
+
+// truncateValue returns a quoted prefix of a base64 value, with whitespace
+// removed.
+func truncateValue(v string) string {
+	v = strings.Join(strings.Fields(v), "")
+	if len(v) > truncatedValueLen {
+		return fmt.Sprintf("%q...", v[:truncatedValueLen])
+	}
+
+	return fmt.Sprintf("%q", v)
+}
+
+// KeyInfo contains information about the key that a Signature was created
+// with. It's a nil pointer if the Signature had no KeyInfo.
+//
+// KeyInfo is never trusted on its own. Verify ignores it, as the caller always
+// supplies the key to verify with. VerifyWithTrustStore uses the certificates
+// in KeyInfo only if they chain up to one of the store's certificate pools.
+type KeyInfo struct {
+	XMLName  xml.Name   `xml:"http://www.w3.org/2000/09/xmldsig# KeyInfo"`
+	X509Data []X509Data `xml:"http://www.w3.org/2000/09/xmldsig# X509Data"`
+}
+
+// X509Data contains X.509 certificates related to the key that a Signature was
+// created with.
+type X509Data struct {
+	XMLName xml.Name `xml:"http://www.w3.org/2000/09/xmldsig# X509Data"`
+
+	// X509Certificates are base64-encoded, DER-encoded certificates.
+	X509Certificates []string `xml:"http://www.w3.org/2000/09/xmldsig# X509Certificate"`
+
+	// X509Digests are digests of certificates, as introduced in XML Signature
+	// 1.1. See SelectCertificate.
+	X509Digests []X509Digest `xml:"http://www.w3.org/2009/xmldsig11# X509Digest"`
+}
+
+// certificates parses the certificates in k. Certificates that can't be parsed
+// are skipped.
+func (k *KeyInfo) certificates() []*x509.Certificate {
+	var certs []*x509.Certificate
+	for _, data := range k.X509Data {
+		for _, s := range data.X509Certificates {
+			der, err := decodeBase64(s)
+			if err != nil {
+				continue
+			}
+
+			cert, err := x509.ParseCertificate(der)
+			if err != nil {
+				continue
+			}
+
+			certs = append(certs, cert)
+		}
+	}
+
+	return certs
 }
 
 // SignedInfo contains information about what is signed by a Signature.
+//
+// Each of References is digested separately, and each of their DigestValues is
+// covered by the SignatureValue.
 type SignedInfo struct {
 	XMLName                xml.Name `xml:"http://www.w3.org/2000/09/xmldsig# SignedInfo"`
+	ID                     string   `xml:"Id,attr,omitempty"`
 	CanonicalizationMethod CanonicalizationMethod
 	SignatureMethod        SignatureMethod
-	Reference              Reference
+	References             []Reference `xml:"http://www.w3.org/2000/09/xmldsig# Reference"`
+}
+
+// Reference returns the first of s's References. Most signatures have exactly
+// one Reference. If s has no References, Reference returns a zero Reference,
+// which is not part of s.
+func (s *SignedInfo) Reference() *Reference {
+	if len(s.References) == 0 {
+		return &Reference{}
+	}
+
+	return &s.References[0]
+}
+
+// EachReference calls fn with each of s's References, in order, and returns
+// the first error fn returns, without calling it for the rest. It lets code
+// that only looks at References, such as to list the files that a manifest
+// signs, stop early.
+//
+// The References are already unmarshaled, so EachReference is no cheaper than
+// ranging over s.References; it doesn't parse them lazily. Nor does it let
+// verification skip any: XML-DSig core validation requires the digest of every
+// Reference in ds:SignedInfo to be checked, and Verify always checks them all.
+func (s *SignedInfo) EachReference(fn func(ref Reference) error) error {
+	for _, ref := range s.References {
+		if err := fn(ref); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SignatureValue contains the base64-encoded signature of a Signature's
+// SignedInfo.
+type SignatureValue struct {
+	ID    string `xml:"Id,attr,omitempty"`
+	Value string `xml:",chardata"`
 }
 
 // CanonicalizationMethod contains information about the c14n algorithm used to
@@ -138,12 +644,51 @@ type SignedInfo struct {
 type CanonicalizationMethod struct {
 	XMLName   xml.Name `xml:"http://www.w3.org/2000/09/xmldsig# CanonicalizationMethod"`
 	Algorithm string   `xml:"Algorithm,attr"`
+
+	// InclusiveNamespaces is the InclusiveNamespaces parameter that ds:SignedInfo
+	// is canonicalized with, or nil if there isn't one.
+	InclusiveNamespaces *InclusiveNamespaces `xml:"http://www.w3.org/2001/10/xml-exc-c14n# InclusiveNamespaces,omitempty"`
 }
 
 // CanonicalizationMethodAlgorithmExclusive is the URI for the Exclusive
 // Canonical XML c14n algorithm.
 var CanonicalizationMethodAlgorithmExclusive = "http://www.w3.org/2001/10/xml-exc-c14n#"
 
+// CanonicalizationMethodAlgorithmExclusiveWithComments is the URI for the
+// Exclusive Canonical XML c14n algorithm, with comments preserved.
+var CanonicalizationMethodAlgorithmExclusiveWithComments = "http://www.w3.org/2001/10/xml-exc-c14n#WithComments"
+
+// CanonicalizationMethodAlgorithmInclusive is the URI for the Canonical XML
+// 1.0 c14n algorithm.
+var CanonicalizationMethodAlgorithmInclusive = "http://www.w3.org/TR/2001/REC-xml-c14n-20010315"
+
+// CanonicalizationMethodAlgorithmInclusiveWithComments is the URI for the
+// Canonical XML 1.0 c14n algorithm, with comments preserved.
+var CanonicalizationMethodAlgorithmInclusiveWithComments = "http://www.w3.org/TR/2001/REC-xml-c14n-20010315#WithComments"
+
+func (c *CanonicalizationMethod) options() canon.Options {
+	return canon.Options{
+		WithComments:      c.Algorithm == CanonicalizationMethodAlgorithmExclusiveWithComments || c.Algorithm == CanonicalizationMethodAlgorithmInclusiveWithComments,
+		InclusivePrefixes: c.InclusiveNamespaces.prefixes(),
+		Inclusive:         c.Algorithm == CanonicalizationMethodAlgorithmInclusive || c.Algorithm == CanonicalizationMethodAlgorithmInclusiveWithComments,
+	}
+}
+
+// check returns an error if c's algorithm isn't one that options knows. An
+// empty algorithm is treated by options as Exclusive Canonical XML, and so is
+// accepted.
+func (c *CanonicalizationMethod) check() error {
+	switch c.Algorithm {
+	case "", CanonicalizationMethodAlgorithmExclusive, CanonicalizationMethodAlgorithmExclusiveWithComments,
+		CanonicalizationMethodAlgorithmInclusive, CanonicalizationMethodAlgorithmInclusiveWithComments:
+		return nil
+	case CanonicalizationMethodAlgorithmC14N20:
+		return &DSig2UnsupportedError{Feature: "canonicalization " + CanonicalizationMethodAlgorithmC14N20}
+	default:
+		return ErrBadCanonicalizationAlgorithm
+	}
+}
+
 // SignatureMethod contains information about the signature algorithm used to
 // calculate a Signature's SignatureValue.
 type SignatureMethod struct {
@@ -172,7 +717,11 @@ func (s *SignatureMethod) hash() (crypto.Hash, error) {
 // Reference contains details about the data that makes up the DigestValue of a
 // Signature.
 type Reference struct {
-	XMLName      xml.Name `xml:"http://www.w3.org/2000/09/xmldsig# Reference"`
+	XMLName      xml.Name    `xml:"http://www.w3.org/2000/09/xmldsig# Reference"`
+	ID           string      `xml:"Id,attr,omitempty"`
+	URI          string      `xml:"URI,attr,omitempty"`
+	Type         string      `xml:"Type,attr,omitempty"`
+	Transforms   []Transform `xml:"http://www.w3.org/2000/09/xmldsig# Transforms>Transform"`
 	DigestMethod DigestMethod
 	DigestValue  string
 }
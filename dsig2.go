@@ -0,0 +1,41 @@
+package dsig
+
+import (
+	"encoding/xml"
+	"fmt"
+)
+
+// CanonicalizationMethodAlgorithmC14N20 is the URI for the Canonical XML 2.0
+// c14n algorithm, as used by XML Signature 2.0.
+var CanonicalizationMethodAlgorithmC14N20 = "http://www.w3.org/2010/xml-c14n2"
+
+// SelectionAlgorithmXML is the URI for the XML Signature 2.0 selection
+// algorithm that selects an XML document or element.
+var SelectionAlgorithmXML = "http://www.w3.org/2010/xmldsig2#xml"
+
+// DSig2UnsupportedError is returned by Verify if the signature uses a feature
+// of XML Signature 2.0 that this package does not support.
+//
+// Feature describes the unsupported feature, such as "selection" followed by
+// the URI of a selection algorithm, or "canonicalization" followed by the URI
+// of Canonical XML 2.0.
+type DSig2UnsupportedError struct {
+	Feature string
+}
+
+func (e *DSig2UnsupportedError) Error() string {
+	return fmt.Sprintf("dsig: unsupported xml signature 2.0 feature: %s", e.Feature)
+}
+
+// Selection is an XML Signature 2.0 dsig2:Selection, which describes the data
+// that a Reference covers.
+//
+// Selections are parsed so that signatures using them can be identified, but
+// Verify does not yet support any selection algorithm. It returns a
+// *DSig2UnsupportedError for signatures that use one.
+type Selection struct {
+	XMLName                 xml.Name `xml:"http://www.w3.org/2010/xmldsig2# Selection"`
+	Algorithm               string   `xml:"Algorithm,attr"`
+	URI                     string   `xml:"URI,attr"`
+	AllowExternalReferences bool     `xml:"AllowExternalReferences,attr"`
+}
@@ -0,0 +1,67 @@
+package dsig_test
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/dsig"
+)
+
+// testDSig2Transform is an XML Signature 2.0 transform selecting the element
+// with ID "foo".
+var testDSig2Transform = strings.ReplaceAll(`<ds:Transforms>
+<ds:Transform Algorithm="http://www.w3.org/2010/xmldsig2#transform">
+<dsig2:Selection xmlns:dsig2="http://www.w3.org/2010/xmldsig2#" AllowExternalReferences="false" Algorithm="http://www.w3.org/2010/xmldsig2#xml" URI="#foo"></dsig2:Selection>
+<ds:CanonicalizationMethod Algorithm="http://www.w3.org/2010/xml-c14n2"></ds:CanonicalizationMethod>
+</ds:Transform>
+</ds:Transforms>`, "\n", "")
+
+func TestVerify_DSig2(t *testing.T) {
+	oldTransforms := testSignatureFormat[strings.Index(testSignatureFormat, "<ds:Transforms>"):strings.Index(testSignatureFormat, "<ds:DigestMethod")]
+
+	type testCase struct {
+		Replacer *strings.Replacer
+		Err      error
+	}
+
+	testCases := map[string]testCase{
+		"c14n 2.0 signed info": testCase{
+			Replacer: strings.NewReplacer(
+				`<ds:CanonicalizationMethod Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#">`,
+				`<ds:CanonicalizationMethod Algorithm="http://www.w3.org/2010/xml-c14n2">`,
+			),
+			Err: &dsig.DSig2UnsupportedError{Feature: "canonicalization http://www.w3.org/2010/xml-c14n2"},
+		},
+		"selection": testCase{
+			Replacer: strings.NewReplacer(oldTransforms, testDSig2Transform),
+			Err:      &dsig.DSig2UnsupportedError{Feature: "selection http://www.w3.org/2010/xmldsig2#xml"},
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			format := `<root><foo ID="foo">xxx</foo>` + tt.Replacer.Replace(testSignatureFormat) + `</root>`
+			doc := signTestDocument(t, format, base64.StdEncoding)
+			assert.Equal(t, tt.Err, verifyTestDocument(t, doc))
+		})
+	}
+}
+
+func TestSelection_Unmarshal(t *testing.T) {
+	oldTransforms := testSignatureFormat[strings.Index(testSignatureFormat, "<ds:Transforms>"):strings.Index(testSignatureFormat, "<ds:DigestMethod")]
+	format := strings.Replace(testSignatureFormat, oldTransforms, testDSig2Transform, 1)
+
+	var sig dsig.Signature
+	assert.NoError(t, xml.Unmarshal([]byte(fmt.Sprintf(format, "", "")), &sig))
+	assert.Equal(t, 1, len(sig.SignedInfo.Reference().Transforms))
+
+	transform := sig.SignedInfo.Reference().Transforms[0]
+	assert.Equal(t, dsig.TransformAlgorithmDSig2, transform.Algorithm)
+	assert.Equal(t, dsig.SelectionAlgorithmXML, transform.Selection.Algorithm)
+	assert.Equal(t, "#foo", transform.Selection.URI)
+	assert.False(t, transform.Selection.AllowExternalReferences)
+}
@@ -13,6 +13,8 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/ucarion/dsig"
+	"github.com/ucarion/dsig/internal/canon"
+	"github.com/ucarion/dsig/internal/sigsplit"
 )
 
 func ExampleSignature() {
@@ -38,7 +40,7 @@ func ExampleSignature() {
 
 	var foo Foo
 	err := xml.Unmarshal([]byte(input), &foo)
-	fmt.Println(foo.FavoriteNumber, foo.FavoriteQuote, foo.Signature.SignedInfo.Reference.DigestValue, foo.Signature.SignatureValue, err)
+	fmt.Println(foo.FavoriteNumber, foo.FavoriteQuote, foo.Signature.SignedInfo.Reference().DigestValue, foo.Signature.SignatureValue.Value, err)
 	// Output:
 	// 42 hello xxx yyy <nil>
 }
@@ -450,3 +452,296 @@ diwCIQC/JKDqOZLQ3+PrWMHO+fh3uU8cj/cPRlsUkE3wjaM4lA==
 		})
 	}
 }
+
+func TestVerify_Base64Padding(t *testing.T) {
+	format := `<root><foo>xxx</foo>` + testSignatureFormat + `</root>`
+
+	type testCase struct {
+		Encoding *base64.Encoding
+	}
+
+	testCases := map[string]testCase{
+		"padded":   testCase{Encoding: base64.StdEncoding},
+		"unpadded": testCase{Encoding: base64.RawStdEncoding},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			doc := signTestDocument(t, format, tt.Encoding)
+			assert.NoError(t, verifyTestDocument(t, doc))
+		})
+	}
+}
+
+func TestVerify_SignedInfoWithComments(t *testing.T) {
+	format := strings.ReplaceAll(`<root><foo>xxx</foo><ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#">
+<ds:SignedInfo>
+<!-- a comment covered by the signature -->
+<ds:CanonicalizationMethod Algorithm="%s"></ds:CanonicalizationMethod>
+<ds:SignatureMethod Algorithm="http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"></ds:SignatureMethod>
+<ds:Reference URI="">
+<ds:DigestMethod Algorithm="http://www.w3.org/2001/04/xmlenc#sha256"></ds:DigestMethod>
+<ds:DigestValue>%%s</ds:DigestValue>
+</ds:Reference>
+</ds:SignedInfo>
+<ds:SignatureValue>%%s</ds:SignatureValue>
+</ds:Signature></root>`, "\n", "")
+
+	type testCase struct {
+		C14NMethod   string
+		SignComments bool
+		Err          error
+	}
+
+	testCases := map[string]testCase{
+		"signed with comments, declared with comments": testCase{
+			C14NMethod:   dsig.CanonicalizationMethodAlgorithmExclusiveWithComments,
+			SignComments: true,
+			Err:          nil,
+		},
+		"signed without comments, declared without comments": testCase{
+			C14NMethod:   dsig.CanonicalizationMethodAlgorithmExclusive,
+			SignComments: false,
+			Err:          nil,
+		},
+		"signed without comments, declared with comments": testCase{
+			C14NMethod:   dsig.CanonicalizationMethodAlgorithmExclusiveWithComments,
+			SignComments: false,
+			Err:          rsa.ErrVerification,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			opts := sigsplit.Options{Inner: canon.Options{WithComments: tt.SignComments}}
+			doc := signTestDocumentWithOptions(t, fmt.Sprintf(format, tt.C14NMethod), base64.StdEncoding, opts)
+			assert.Equal(t, tt.Err, verifyTestDocument(t, doc))
+		})
+	}
+}
+
+func TestVerify_WhitespaceInValues(t *testing.T) {
+	format := `<root xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><foo>xxx</foo>` + strings.NewReplacer(
+		`<ds:DigestValue>%s</ds:DigestValue>`, "<ds:DigestValue xml:space=\"preserve\">\n\t\t%s\n\t</ds:DigestValue>",
+		`<ds:SignatureValue>%s</ds:SignatureValue>`, "<ds:SignatureValue xml:space=\"preserve\">\n\t\t%s\n\t</ds:SignatureValue>",
+	).Replace(testSignatureFormat) + `</root>`
+
+	doc := signTestDocument(t, format, base64.StdEncoding)
+	assert.Contains(t, doc, "<ds:DigestValue xml:space=\"preserve\">\n\t\t")
+	assert.NoError(t, verifyTestDocument(t, doc))
+}
+
+func TestVerify_CommentsInValues(t *testing.T) {
+	doc := signTestDocument(t, `<root><foo>xxx</foo>`+testSignatureFormat+`</root>`, base64.StdEncoding)
+
+	// splitValue puts a comment in the middle of the contents of the element
+	// named name. Comments are not part of the canonicalized SignedInfo, so the
+	// signature remains valid.
+	splitValue := func(doc, name string) string {
+		start := strings.Index(doc, "<"+name+">") + len(name) + 2
+		end := strings.Index(doc, "</"+name+">")
+		mid := start + (end-start)/2
+		return doc[:mid] + "<!-- split -->" + doc[mid:]
+	}
+
+	type testCase struct {
+		Doc string
+	}
+
+	testCases := map[string]testCase{
+		"digest value":    testCase{Doc: splitValue(doc, "ds:DigestValue")},
+		"signature value": testCase{Doc: splitValue(doc, "ds:SignatureValue")},
+		"both":            testCase{Doc: splitValue(splitValue(doc, "ds:DigestValue"), "ds:SignatureValue")},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Contains(t, tt.Doc, "<!-- split -->")
+			assert.NoError(t, verifyTestDocument(t, tt.Doc))
+		})
+	}
+}
+
+func TestSignature_String(t *testing.T) {
+	type testCase struct {
+		Signature dsig.Signature
+		Out       string
+	}
+
+	testCases := map[string]testCase{
+		"empty": testCase{
+			Signature: dsig.Signature{},
+			Out:       `Signature{CanonicalizationMethod: none, SignatureMethod: none, DigestMethod: none, DigestValue: "", SignatureValue: ""}`,
+		},
+		"known algorithms": testCase{
+			Signature: dsig.Signature{
+				SignedInfo: dsig.SignedInfo{
+					CanonicalizationMethod: dsig.CanonicalizationMethod{Algorithm: dsig.CanonicalizationMethodAlgorithmExclusive},
+					SignatureMethod:        dsig.SignatureMethod{Algorithm: dsig.SignatureMethodAlgorithmSHA256},
+					References: []dsig.Reference{
+						dsig.Reference{
+							DigestMethod: dsig.DigestMethod{Algorithm: dsig.DigestMethodAlgorithmSHA256},
+							DigestValue:  "\n  q5Xb3r1R\n  ZfU+k4Q=\n",
+						},
+					},
+				},
+				SignatureValue: dsig.SignatureValue{Value: "L4l1Qyp8kVFaZ9893/IW0bEBGBuAavssuv916PuM"},
+			},
+			Out: `Signature{CanonicalizationMethod: exc-c14n, SignatureMethod: rsa-sha256, DigestMethod: sha256, DigestValue: "q5Xb3r1R"..., SignatureValue: "L4l1Qyp8"...}`,
+		},
+		"unknown algorithms": testCase{
+			Signature: dsig.Signature{
+				SignedInfo: dsig.SignedInfo{
+					CanonicalizationMethod: dsig.CanonicalizationMethod{Algorithm: "http://example.com/c14n"},
+					SignatureMethod:        dsig.SignatureMethod{Algorithm: "http://example.com/sig"},
+					References: []dsig.Reference{
+						dsig.Reference{
+							DigestMethod: dsig.DigestMethod{Algorithm: "http://example.com/digest"},
+							DigestValue:  "AAAA",
+						},
+					},
+				},
+				SignatureValue: dsig.SignatureValue{Value: "BBBB"},
+			},
+			Out: `Signature{CanonicalizationMethod: http://example.com/c14n, SignatureMethod: http://example.com/sig, DigestMethod: http://example.com/digest, DigestValue: "AAAA", SignatureValue: "BBBB"}`,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tt.Out, tt.Signature.String())
+		})
+	}
+}
+
+func TestVerify_MixedPrefixes(t *testing.T) {
+	type testCase struct {
+		Replacer *strings.Replacer
+	}
+
+	testCases := map[string]testCase{
+		"children of SignedInfo": testCase{
+			Replacer: strings.NewReplacer(
+				"ds:SignatureMethod", "dsig:SignatureMethod",
+				"ds:DigestValue", "dsig:DigestValue",
+			),
+		},
+		"SignedInfo itself": testCase{
+			Replacer: strings.NewReplacer(
+				"ds:SignedInfo", "dsig:SignedInfo",
+				"ds:Reference", "dsig:Reference",
+			),
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			format := `<root xmlns:dsig="http://www.w3.org/2000/09/xmldsig#"><foo>xxx</foo>` + tt.Replacer.Replace(testSignatureFormat) + `</root>`
+			doc := signTestDocument(t, format, base64.StdEncoding)
+			assert.Contains(t, doc, "<dsig:")
+
+			var payload struct {
+				Signature dsig.Signature `xml:"http://www.w3.org/2000/09/xmldsig# Signature"`
+			}
+
+			assert.NoError(t, xml.Unmarshal([]byte(doc), &payload))
+			assert.Equal(t, dsig.SignatureMethodAlgorithmSHA256, payload.Signature.SignedInfo.SignatureMethod.Algorithm)
+			assert.NotEmpty(t, payload.Signature.SignedInfo.Reference().DigestValue)
+
+			assert.NoError(t, verifyTestDocument(t, doc))
+		})
+	}
+}
+
+func TestVerify_UnreferencedObjects(t *testing.T) {
+	objects := `<ds:Object Id="metadata"><foo>xxx</foo></ds:Object><ds:Object><bar /></ds:Object></ds:Signature>`
+	format := `<root><foo>xxx</foo>` + strings.Replace(testSignatureFormat, `</ds:Signature>`, objects, 1) + `</root>`
+	doc := signTestDocument(t, format, base64.StdEncoding)
+
+	type testCase struct {
+		Doc string
+		Err error
+	}
+
+	testCases := map[string]testCase{
+		"as signed": testCase{
+			Doc: doc,
+			Err: nil,
+		},
+		"object modified": testCase{
+			Doc: strings.Replace(doc, `<ds:Object><bar /></ds:Object>`, `<ds:Object><baz /></ds:Object>`, 1),
+			Err: nil,
+		},
+		"object removed": testCase{
+			Doc: strings.Replace(doc, `<ds:Object Id="metadata"><foo>xxx</foo></ds:Object>`, ``, 1),
+			Err: nil,
+		},
+		"content modified": testCase{
+			Doc: strings.Replace(doc, `<root><foo>xxx</foo>`, `<root><foo>yyy</foo>`, 1),
+			Err: dsig.ErrBadDigest,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tt.Err, verifyTestDocument(t, tt.Doc))
+		})
+	}
+}
+
+func TestVerify_TrailingContent(t *testing.T) {
+	doc := signTestDocument(t, `<root><foo>xxx</foo>`+testSignatureFormat+`</root>`, base64.StdEncoding)
+
+	type testCase struct {
+		Doc string
+	}
+
+	testCases := map[string]testCase{
+		"as signed":           testCase{Doc: doc},
+		"trailing newline":    testCase{Doc: doc + "\n"},
+		"trailing crlf":       testCase{Doc: doc + "\r\n"},
+		"trailing comment":    testCase{Doc: doc + "\n<!-- signed elsewhere -->\n"},
+		"leading declaration": testCase{Doc: "<?xml version=\"1.0\"?>\n" + doc},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert.NoError(t, verifyTestDocument(t, tt.Doc))
+		})
+	}
+}
+
+func TestVerify_WrappedSignatureCopy(t *testing.T) {
+	signed, err := dsig.SignDocument([]byte(`<root><a ID="a"><foo>xxx</foo></a><bar>yyy</bar></root>`), testKey, testCert, dsig.SignOptions{Prefix: "ds", ReferenceID: "a"})
+	assert.NoError(t, err)
+
+	doc := string(signed)
+	sig := doc[strings.Index(doc, "<ds:Signature") : strings.Index(doc, "</ds:Signature>")+len("</ds:Signature>")]
+
+	type testCase struct {
+		Doc  string
+		Opts dsig.VerifyOptions
+	}
+
+	// The signature is over #a, and is inside of it, so it isn't where a
+	// child-of-root Signature field would be unmarshaled from. An attacker can
+	// add a copy of it there, alongside content that was never signed.
+	testCases := map[string]testCase{
+		"copy added": testCase{
+			Doc: strings.Replace(doc, "</root>", sig+"</root>", 1),
+		},
+		"unsigned content changed": testCase{
+			Doc: strings.Replace(strings.Replace(doc, "yyy", "zzz", 1), "</root>", sig+"</root>", 1),
+		},
+		"allow arbitrary references": testCase{
+			Doc:  strings.Replace(strings.Replace(doc, "yyy", "zzz", 1), "</root>", sig+"</root>", 1),
+			Opts: dsig.VerifyOptions{AllowArbitraryReferences: true},
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, dsig.ErrDuplicateSignature, verifyTestDocumentWithOptions(t, tt.Doc, tt.Opts))
+		})
+	}
+}
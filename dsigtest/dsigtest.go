@@ -0,0 +1,114 @@
+// Package dsigtest implements support for testing integrations with dsig.
+package dsigtest
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/ucarion/dsig"
+)
+
+// documents are the inputs TestTokenReader checks a tokenizer against. They
+// exercise each of the parts of the dsig.TokenReader contract.
+var documents = []string{
+	`<root />`,
+	`<?xml version="1.0" encoding="UTF-8"?><!DOCTYPE root><root><!-- comment --><?pi data?></root>`,
+	`<ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:SignedInfo /></ds:Signature>`,
+	`<root xmlns="http://example.com/a"><child xmlns="" /></root>`,
+	`<root xmlns:a="http://example.com/a" a:z="1" b="2" a:c="3"><a:child /></root>`,
+	"<root attr='a&amp;b&#x9;c'>x &lt; y &#38; z</root>",
+	"<root attr=\"line\r\nbreak\">line\r\nbreak\rlone</root>",
+	`<root><![CDATA[<not-a-tag>]]></root>`,
+}
+
+// TestTokenReader checks that the dsig.TokenReader returned by newReader
+// follows the contract described in the documentation for dsig.TokenReader,
+// using the RawToken method of xml.Decoder as the reference implementation.
+//
+// newReader will be called several times, each time with a different XML
+// document. TestTokenReader returns an error describing the first deviation
+// from the contract it finds, or nil if it finds none.
+//
+// Tokenizers may split character data differently from xml.Decoder, so
+// adjacent CharData tokens are merged before comparing.
+func TestTokenReader(newReader func(r io.Reader) dsig.TokenReader) error {
+	for _, doc := range documents {
+		expected, err := readAll(xml.NewDecoder(strings.NewReader(doc)))
+		if err != nil {
+			return fmt.Errorf("dsigtest: reference decoder failed on %q: %w", doc, err)
+		}
+
+		actual, err := readAll(newReader(strings.NewReader(doc)))
+		if err != nil {
+			return fmt.Errorf("dsigtest: %q: %w", doc, err)
+		}
+
+		for i := 0; i < len(expected) || i < len(actual); i++ {
+			if i >= len(actual) {
+				return fmt.Errorf("dsigtest: %q: missing token %d: expected %#v", doc, i, expected[i])
+			}
+
+			if i >= len(expected) {
+				return fmt.Errorf("dsigtest: %q: unexpected token %d: %#v", doc, i, actual[i])
+			}
+
+			if !reflect.DeepEqual(expected[i], actual[i]) {
+				return fmt.Errorf("dsigtest: %q: token %d: expected %#v, got %#v", doc, i, expected[i], actual[i])
+			}
+		}
+	}
+
+	return nil
+}
+
+// readAll reads all of the tokens from r until io.EOF, copying each token and
+// merging adjacent xml.CharData.
+func readAll(r dsig.TokenReader) ([]xml.Token, error) {
+	var tokens []xml.Token
+	for {
+		t, err := r.RawToken()
+		if err != nil {
+			if err == io.EOF {
+				return tokens, nil
+			}
+
+			return nil, err
+		}
+
+		if t == nil {
+			return nil, fmt.Errorf("nil token returned without an error")
+		}
+
+		switch t := t.(type) {
+		case xml.StartElement:
+			if t.Attr == nil {
+				t.Attr = []xml.Attr{}
+			}
+
+			tokens = append(tokens, t.Copy())
+		case xml.EndElement:
+			tokens = append(tokens, t)
+		case xml.CharData:
+			if len(tokens) > 0 {
+				if prev, ok := tokens[len(tokens)-1].(xml.CharData); ok {
+					tokens[len(tokens)-1] = xml.CharData(bytes.Join([][]byte{prev, t}, nil))
+					continue
+				}
+			}
+
+			tokens = append(tokens, t.Copy())
+		case xml.Comment:
+			tokens = append(tokens, t.Copy())
+		case xml.ProcInst:
+			tokens = append(tokens, t.Copy())
+		case xml.Directive:
+			tokens = append(tokens, t.Copy())
+		default:
+			return nil, fmt.Errorf("unexpected token type %T", t)
+		}
+	}
+}
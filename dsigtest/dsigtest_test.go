@@ -0,0 +1,36 @@
+package dsigtest_test
+
+import (
+	"encoding/xml"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/dsig"
+	"github.com/ucarion/dsig/dsigtest"
+)
+
+func TestTestTokenReader(t *testing.T) {
+	err := dsigtest.TestTokenReader(func(r io.Reader) dsig.TokenReader {
+		return xml.NewDecoder(r)
+	})
+
+	assert.NoError(t, err)
+}
+
+func TestTestTokenReader_Resolved(t *testing.T) {
+	// Token, unlike RawToken, resolves namespaces. That violates the contract.
+	err := dsigtest.TestTokenReader(func(r io.Reader) dsig.TokenReader {
+		return tokenReader{xml.NewDecoder(r)}
+	})
+
+	assert.Error(t, err)
+}
+
+type tokenReader struct {
+	*xml.Decoder
+}
+
+func (t tokenReader) RawToken() (xml.Token, error) {
+	return t.Token()
+}
@@ -0,0 +1,97 @@
+package dsig
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+)
+
+// ErrSignatureNotFound is returned if a document does not contain a Signature
+// where one was expected.
+var ErrSignatureNotFound = errors.New("dsig: signature not found")
+
+// VerifyField verifies the Signature located at fieldPath within data, using
+// cert.
+//
+// fieldPath uses the same syntax as the "a>b>c" paths in encoding/xml struct
+// tags, and names the local names of the elements from the root of the
+// document down to the Signature. For example, in:
+//
+//  <Response>
+//    <Assertion>...</Assertion>
+//    <ds:Signature>...</ds:Signature>
+//  </Response>
+//
+// The fieldPath of the Signature is "Response>Signature". If fieldPath does not
+// lead to a ds:Signature element, VerifyField returns ErrSignatureNotFound.
+//
+// VerifyField is equivalent to unmarshaling the Signature out of data and then
+// calling Verify with a decoder reading from data, and so all of Verify's
+// restrictions on what signatures it supports apply to VerifyField as well.
+// data is read with the default limits of NewDecoder.
+func VerifyField(cert *x509.Certificate, data []byte, fieldPath string) error {
+	path := strings.Split(fieldPath, ">")
+
+	s, err := findSignature(data, path)
+	if err != nil {
+		return err
+	}
+
+	return s.Verify(cert, NewDecoder(bytes.NewReader(data)))
+}
+
+// findSignature decodes the first ds:Signature element whose path from the
+// root of data is path.
+func findSignature(data []byte, path []string) (*Signature, error) {
+	var stack []string
+
+	decoder := NewDecoder(bytes.NewReader(data))
+	for {
+		t, err := decoder.Token()
+		if err != nil {
+			if err == io.EOF {
+				return nil, ErrSignatureNotFound
+			}
+
+			return nil, err
+		}
+
+		switch t := t.(type) {
+		case xml.StartElement:
+			stack = append(stack, t.Name.Local)
+			if !equalPath(stack, path) {
+				continue
+			}
+
+			if t.Name.Space != namespace || t.Name.Local != "Signature" {
+				return nil, ErrSignatureNotFound
+			}
+
+			var s Signature
+			if err := decoder.DecodeElement(&s, &t); err != nil {
+				return nil, err
+			}
+
+			return &s, nil
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		}
+	}
+}
+
+func equalPath(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,36 @@
+package dsig_test
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/dsig"
+)
+
+func TestVerifyField(t *testing.T) {
+	doc := signTestDocument(t, `<root><foo>xxx</foo>`+testSignatureFormat+`</root>`, base64.StdEncoding)
+
+	type testCase struct {
+		FieldPath string
+		Err       error
+	}
+
+	testCases := map[string]testCase{
+		"ok":              testCase{FieldPath: "root>Signature", Err: nil},
+		"missing":         testCase{FieldPath: "root>Assertion>Signature", Err: dsig.ErrSignatureNotFound},
+		"wrong root":      testCase{FieldPath: "Response>Signature", Err: dsig.ErrSignatureNotFound},
+		"not a signature": testCase{FieldPath: "root>foo", Err: dsig.ErrSignatureNotFound},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tt.Err, dsig.VerifyField(testCert, []byte(doc), tt.FieldPath))
+		})
+	}
+}
+
+func TestVerifyField_Directive(t *testing.T) {
+	doc := signTestDocument(t, `<!DOCTYPE root><root><foo>xxx</foo>`+testSignatureFormat+`</root>`, base64.StdEncoding)
+	assert.Equal(t, dsig.ErrDirectiveNotAllowed, dsig.VerifyField(testCert, []byte(doc), "root>Signature"))
+}
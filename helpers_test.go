@@ -0,0 +1,124 @@
+package dsig_test
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/dsig"
+	"github.com/ucarion/dsig/internal/sigsplit"
+)
+
+// testKey and testCert are a freshly-generated key pair, for tests that need to
+// produce their own signatures rather than relying on fixtures generated with
+// openssl.
+var testKey, testCert = generateTestCert()
+
+func generateTestCert() (*rsa.PrivateKey, *x509.Certificate) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "www.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		panic(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		panic(err)
+	}
+
+	return key, cert
+}
+
+// testSignatureFormat is a RSA-SHA256, SHA256, exclusive c14n signature. Its
+// first verb is the DigestValue, and its second is the SignatureValue.
+var testSignatureFormat = strings.ReplaceAll(`<ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#">
+<ds:SignedInfo>
+<ds:CanonicalizationMethod Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"></ds:CanonicalizationMethod>
+<ds:SignatureMethod Algorithm="http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"></ds:SignatureMethod>
+<ds:Reference URI="">
+<ds:Transforms>
+<ds:Transform Algorithm="http://www.w3.org/2000/09/xmldsig#enveloped-signature"></ds:Transform>
+<ds:Transform Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"></ds:Transform>
+</ds:Transforms>
+<ds:DigestMethod Algorithm="http://www.w3.org/2001/04/xmlenc#sha256"></ds:DigestMethod>
+<ds:DigestValue>%s</ds:DigestValue>
+</ds:Reference>
+</ds:SignedInfo>
+<ds:SignatureValue>%s</ds:SignatureValue>
+</ds:Signature>`, "\n", "")
+
+// signTestDocument fills in the DigestValue and SignatureValue of a document.
+//
+// format must contain exactly two %s verbs, the first being the contents of
+// DigestValue and the second the contents of SignatureValue. The digest and
+// signature are computed with SHA256 using testKey, and are encoded using enc.
+func signTestDocument(t *testing.T, format string, enc *base64.Encoding) string {
+	return signTestDocumentWithOptions(t, format, enc, sigsplit.Options{})
+}
+
+// signTestDocumentWithOptions is like signTestDocument, but uses opts to
+// canonicalize the document.
+func signTestDocumentWithOptions(t *testing.T, format string, enc *base64.Encoding, opts sigsplit.Options) string {
+	toDigest, _, err := sigsplit.SplitSignature(xml.NewDecoder(strings.NewReader(fmt.Sprintf(format, "", ""))), opts)
+	assert.NoError(t, err)
+
+	h := crypto.SHA256.New()
+	h.Write(toDigest)
+	digestValue := enc.EncodeToString(h.Sum(nil))
+
+	_, toSign, err := sigsplit.SplitSignature(xml.NewDecoder(strings.NewReader(fmt.Sprintf(format, digestValue, ""))), opts)
+	assert.NoError(t, err)
+
+	h = crypto.SHA256.New()
+	h.Write(toSign)
+	signature, err := rsa.SignPKCS1v15(rand.Reader, testKey, crypto.SHA256, h.Sum(nil))
+	assert.NoError(t, err)
+
+	return fmt.Sprintf(format, digestValue, enc.EncodeToString(signature))
+}
+
+// verifyTestDocument verifies the child-of-root Signature in doc against
+// testCert.
+func verifyTestDocument(t *testing.T, doc string) error {
+	return verifyTestDocumentWithOptions(t, doc, dsig.VerifyOptions{})
+}
+
+// verifyTestDocumentWithOptions is like verifyTestDocument, but verifies using
+// opts.
+func verifyTestDocumentWithOptions(t *testing.T, doc string, opts dsig.VerifyOptions) error {
+	var payload struct {
+		Signature dsig.Signature `xml:"http://www.w3.org/2000/09/xmldsig# Signature"`
+	}
+
+	assert.NoError(t, xml.Unmarshal([]byte(doc), &payload))
+	return payload.Signature.VerifyWithOptions(testCert, xml.NewDecoder(strings.NewReader(doc)), opts)
+}
+
+// referenceDigest returns the decoded DigestValue of ref, which Verify reports
+// as the Digest of the ReferencedElement for it.
+func referenceDigest(t *testing.T, ref dsig.Reference) []byte {
+	digest, err := base64.StdEncoding.DecodeString(ref.DigestValue)
+	assert.NoError(t, err)
+	return digest
+}
@@ -0,0 +1,115 @@
+package dsig
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// SignedBodyOptions controls how RequireSignedBody verifies request bodies.
+//
+// The zero value of SignedBodyOptions limits bodies to DefaultMaxBytes, and
+// verifies them as Verify would.
+type SignedBodyOptions struct {
+	// MaxBytes is the largest request body, in bytes, that will be read.
+	// Requests with larger bodies are rejected. If zero, DefaultMaxBytes is
+	// used.
+	MaxBytes int64
+
+	// VerifyOptions controls how the signature is verified.
+	VerifyOptions VerifyOptions
+}
+
+func (o *SignedBodyOptions) maxBytes() int64 {
+	if o.MaxBytes == 0 {
+		return DefaultMaxBytes
+	}
+
+	return o.MaxBytes
+}
+
+// The reasons RequireSignedBody gives for rejecting a request. Each is the
+// entire body of the response, followed by a newline.
+const (
+	// RejectBodyTooLarge is the reason for rejecting a request whose body is
+	// larger than SignedBodyOptions.MaxBytes. The status code is 413.
+	RejectBodyTooLarge = "body_too_large"
+
+	// RejectMalformedBody is the reason for rejecting a request whose body is
+	// not acceptable XML. The status code is 400.
+	RejectMalformedBody = "malformed_body"
+
+	// RejectSignatureMissing is the reason for rejecting a request whose body has
+	// no enveloped signature. The status code is 400.
+	RejectSignatureMissing = "signature_missing"
+
+	// RejectSignatureInvalid is the reason for rejecting a request whose
+	// signature could not be verified. The status code is 403.
+	RejectSignatureInvalid = "signature_invalid"
+)
+
+type signedBodyContextKey struct{}
+
+// RequireSignedBody returns a handler that verifies the enveloped signature on
+// each request's body, and passes the request on to next only if the
+// signature is valid.
+//
+// The body is read in full, up to opts.MaxBytes, with the limits of NewDecoder.
+// Its ds:Signature must be an immediate child of the root element, and it's
+// verified with VerifyWithTrustStore using ts, which must not be nil. If the
+// signature is valid, next is given a request whose body contains the same
+// bytes that were verified, and whose context holds the VerifyResult, which
+// SignedBodyResult returns.
+//
+// Otherwise, the request is rejected with one of the Reject reasons as the
+// response body. The reasons are deliberately coarse, so that responses don't
+// reveal anything about how verification failed.
+func RequireSignedBody(next http.Handler, ts *TrustStore, opts SignedBodyOptions) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		maxBytes := opts.maxBytes()
+		body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxBytes+1))
+		if err != nil {
+			http.Error(w, RejectMalformedBody, http.StatusBadRequest)
+			return
+		}
+
+		if int64(len(body)) > maxBytes {
+			http.Error(w, RejectBodyTooLarge, http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		var envelope struct {
+			Signature *Signature `xml:"http://www.w3.org/2000/09/xmldsig# Signature"`
+		}
+
+		if err := NewDecoder(bytes.NewReader(body)).Decode(&envelope); err != nil {
+			http.Error(w, RejectMalformedBody, http.StatusBadRequest)
+			return
+		}
+
+		if envelope.Signature == nil {
+			http.Error(w, RejectSignatureMissing, http.StatusBadRequest)
+			return
+		}
+
+		result, err := envelope.Signature.VerifyWithTrustStore(ts, NewDecoder(bytes.NewReader(body)), opts.VerifyOptions)
+		if err != nil {
+			http.Error(w, RejectSignatureInvalid, http.StatusForbidden)
+			return
+		}
+
+		r = r.WithContext(context.WithValue(r.Context(), signedBodyContextKey{}, result))
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// SignedBodyResult returns the VerifyResult that RequireSignedBody stored in
+// ctx, or nil if there is none.
+func SignedBodyResult(ctx context.Context) *VerifyResult {
+	result, _ := ctx.Value(signedBodyContextKey{}).(*VerifyResult)
+	return result
+}
@@ -0,0 +1,97 @@
+package dsig_test
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/dsig"
+)
+
+func TestRequireSignedBody(t *testing.T) {
+	doc := signTestDocument(t, `<root><foo>xxx</foo>`+testSignatureFormat+`</root>`, base64.StdEncoding)
+
+	var ts dsig.TrustStore
+	ts.AddPublicKey(testCert.PublicKey)
+
+	var body string
+	var result *dsig.VerifyResult
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := ioutil.ReadAll(r.Body)
+		assert.NoError(t, err)
+
+		body = string(b)
+		result = dsig.SignedBodyResult(r.Context())
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	handler := dsig.RequireSignedBody(next, &ts, dsig.SignedBodyOptions{MaxBytes: int64(len(doc))})
+
+	type testCase struct {
+		Body   string
+		Status int
+		Reason string
+	}
+
+	testCases := map[string]testCase{
+		"valid": testCase{
+			Body:   doc,
+			Status: http.StatusNoContent,
+		},
+		"tampered": testCase{
+			Body:   strings.Replace(doc, "xxx", "yyy", 1),
+			Status: http.StatusForbidden,
+			Reason: dsig.RejectSignatureInvalid,
+		},
+		"no signature": testCase{
+			Body:   `<root><foo>xxx</foo></root>`,
+			Status: http.StatusBadRequest,
+			Reason: dsig.RejectSignatureMissing,
+		},
+		"malformed": testCase{
+			Body:   `<root><foo>`,
+			Status: http.StatusBadRequest,
+			Reason: dsig.RejectMalformedBody,
+		},
+		"directive": testCase{
+			Body:   `<!DOCTYPE root><root></root>`,
+			Status: http.StatusBadRequest,
+			Reason: dsig.RejectMalformedBody,
+		},
+		"too large": testCase{
+			Body:   doc + " ",
+			Status: http.StatusRequestEntityTooLarge,
+			Reason: dsig.RejectBodyTooLarge,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			body, result = "", nil
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.Body)))
+			assert.Equal(t, tt.Status, w.Code)
+
+			if tt.Reason != "" {
+				assert.Equal(t, tt.Reason+"\n", w.Body.String())
+				assert.Nil(t, result)
+				return
+			}
+
+			// The next handler sees the verified body, and the result of verifying it.
+			assert.Equal(t, tt.Body, body)
+			assert.NotNil(t, result)
+			assert.Equal(t, dsig.SignatureMethodAlgorithmSHA256, result.SignatureMethod)
+		})
+	}
+}
+
+func TestSignedBodyResult_Missing(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	assert.Nil(t, dsig.SignedBodyResult(r.Context()))
+}
@@ -0,0 +1,55 @@
+package dsig
+
+import "strings"
+
+// excC14NNamespace is the XML namespace of the InclusiveNamespaces element of
+// Exclusive Canonical XML.
+var excC14NNamespace = "http://www.w3.org/2001/10/xml-exc-c14n#"
+
+// InclusiveNamespaces is the InclusiveNamespaces parameter of Exclusive
+// Canonical XML, which can appear in a CanonicalizationMethod or a Transform.
+//
+// PrefixList is a whitespace-separated list of namespace prefixes, with
+// "#default" standing for the default namespace. Namespaces with these
+// prefixes are kept wherever they are in scope, rather than only where they
+// are visibly used, which matters for documents that use prefixes in attribute
+// values, such as xsi:type="saml:AttributeValue".
+type InclusiveNamespaces struct {
+	PrefixList string `xml:"PrefixList,attr"`
+}
+
+// prefixes returns the prefixes in n's PrefixList, with "#default" replaced by
+// the empty string. It returns nil if n is nil.
+func (n *InclusiveNamespaces) prefixes() []string {
+	if n == nil {
+		return nil
+	}
+
+	var prefixes []string
+	for _, prefix := range strings.Fields(n.PrefixList) {
+		if prefix == "#default" {
+			prefix = ""
+		}
+
+		prefixes = append(prefixes, prefix)
+	}
+
+	return prefixes
+}
+
+// newInclusiveNamespaces returns an InclusiveNamespaces with the given
+// prefixes, or nil if there are none. If a prefix is neither "#default" nor a
+// valid namespace prefix, it returns ErrInvalidPrefix.
+func newInclusiveNamespaces(prefixes []string) (*InclusiveNamespaces, error) {
+	if len(prefixes) == 0 {
+		return nil, nil
+	}
+
+	for _, prefix := range prefixes {
+		if prefix != "#default" && !validPrefix(prefix) {
+			return nil, ErrInvalidPrefix
+		}
+	}
+
+	return &InclusiveNamespaces{PrefixList: strings.Join(prefixes, " ")}, nil
+}
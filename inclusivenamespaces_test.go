@@ -0,0 +1,70 @@
+package dsig_test
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/dsig"
+)
+
+func TestSignOptions_InclusivePrefixes(t *testing.T) {
+	// The xs prefix is only used in an attribute value, so Exclusive Canonical
+	// XML doesn't render its declaration unless it's in the PrefixList.
+	doc := `<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:xs="http://www.w3.org/2001/XMLSchema" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"><saml:Assertion xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="assertion"><saml:AttributeValue xsi:type="xs:string">alice</saml:AttributeValue></saml:Assertion></samlp:Response>`
+
+	type testCase struct {
+		Prefixes []string
+		Err      error
+	}
+
+	testCases := map[string]testCase{
+		"without prefix list": testCase{
+			Prefixes: nil,
+			Err:      nil,
+		},
+		"with prefix list": testCase{
+			Prefixes: []string{"xs"},
+			Err:      dsig.ErrBadDigest,
+		},
+		"with default namespace": testCase{
+			Prefixes: []string{"#default", "xs", "xsi"},
+			Err:      dsig.ErrBadDigest,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			signed, err := dsig.SignDocument([]byte(doc), testKey, testCert, dsig.SignOptions{Prefix: "ds", ReferenceID: "assertion", InclusivePrefixes: tt.Prefixes})
+			assert.NoError(t, err)
+
+			if tt.Prefixes != nil {
+				inclusive := `<InclusiveNamespaces xmlns="http://www.w3.org/2001/10/xml-exc-c14n#" PrefixList="` + strings.Join(tt.Prefixes, " ") + `"></InclusiveNamespaces>`
+				assert.Equal(t, 2, strings.Count(string(signed), inclusive))
+			}
+
+			var sig dsig.Signature
+			assert.NoError(t, xml.Unmarshal([]byte(signatureElement.FindString(string(signed))), &sig))
+			assert.Equal(t, tt.Prefixes != nil, sig.SignedInfo.CanonicalizationMethod.InclusiveNamespaces != nil)
+			assert.Equal(t, tt.Prefixes != nil, sig.SignedInfo.Reference().Transforms[1].InclusiveNamespaces != nil)
+
+			verify := func(doc string) error {
+				return sig.Verify(testCert, xml.NewDecoder(strings.NewReader(doc)))
+			}
+
+			assert.NoError(t, verify(string(signed)))
+
+			// Redefining xs changes what xsi:type means. Only the PrefixList makes
+			// the signature cover that.
+			assert.Equal(t, tt.Err, verify(strings.Replace(string(signed), `xmlns:xs="http://www.w3.org/2001/XMLSchema"`, `xmlns:xs="urn:evil"`, 1)))
+		})
+	}
+}
+
+func TestSignOptions_InclusivePrefixesInvalid(t *testing.T) {
+	for _, prefix := range []string{"", "#other", "a b", "xmlns"} {
+		_, err := dsig.NewSignature(dsig.SignOptions{InclusivePrefixes: []string{prefix}})
+		assert.Equal(t, dsig.ErrInvalidPrefix, err, prefix)
+	}
+}
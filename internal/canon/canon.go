@@ -0,0 +1,419 @@
+// Package canon implements the XML canonicalization algorithms used by dsig.
+//
+// It is a fork of github.com/ucarion/c14n v0.1.0, which implements Exclusive
+// Canonical XML without comments, and whose Canonicalize takes no options.
+// XML signatures declare which variant of canonicalization they use, and dsig
+// needs all of them, so this package adds:
+//
+//   - Options, for comments (WithComments), the InclusiveNamespaces PrefixList
+//     (InclusivePrefixes), Canonical XML 1.0 (Inclusive), and NormalizePrefixes
+//   - CanonicalizeTo, which streams its output rather than buffering it
+//
+// It also fixes two bugs that the upstream package has with unprefixed
+// attributes, which are in no namespace even when there is a default
+// namespace: such an attribute is not a visible use of the default namespace,
+// and it sorts before attributes with a prefix, such as xsi:type.
+//
+// Only c14n.RawTokenReader is still used from the upstream package, so that
+// its callers can pass the same readers to either one. Fixes made upstream
+// after v0.1.0 need to be ported here by hand.
+//
+// https://www.w3.org/TR/xml-exc-c14n/
+package canon
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/ucarion/c14n"
+	"github.com/ucarion/dsig/internal/stack"
+)
+
+// Options controls which variant of canonicalization is performed.
+//
+// The zero value of Options corresponds to Exclusive Canonical XML without
+// comments.
+type Options struct {
+	// WithComments indicates whether comments should be preserved in the output.
+	WithComments bool
+
+	// NormalizePrefixes indicates whether namespace prefixes should be replaced
+	// with generated ones before canonicalizing. This is not part of any
+	// standard.
+	//
+	// Each namespace is given the prefix "n" followed by a decimal number,
+	// counting from zero in the order that namespaces are first used. Elements
+	// are visited in document order, and an element's name is used before its
+	// attributes. The order of attributes isn't significant in XML, so they are
+	// used in order of their namespace URI, as canonicalization sorts them.
+	// Unprefixed elements in a default namespace are given that namespace's
+	// prefix, and so the output never has a default namespace. Unprefixed
+	// attributes, attributes with the xml prefix, and undeclared prefixes are
+	// left alone.
+	//
+	// All of the original namespace declarations are removed, and the new
+	// prefixes are all declared on the root element; canonicalization then
+	// renders them where they are visibly utilized, as usual.
+	NormalizePrefixes bool
+
+	// InclusivePrefixes is the InclusiveNamespaces PrefixList of Exclusive
+	// Canonical XML. Namespaces with these prefixes are rendered wherever they
+	// are in scope and not already rendered, as in inclusive canonicalization,
+	// even if they aren't visibly utilized. The empty string stands for the
+	// default namespace.
+	InclusivePrefixes []string
+
+	// Inclusive indicates whether Canonical XML 1.0 should be used instead of
+	// Exclusive Canonical XML. Every namespace in scope is then rendered
+	// wherever it isn't already rendered, whether or not it's visibly utilized,
+	// as though every prefix were in InclusivePrefixes.
+	//
+	// Canonical XML also has the root of a document subset inherit the xml:*
+	// attributes of its ancestors. Canonicalize only sees the subset, so it's up
+	// to the caller to add them.
+	Inclusive bool
+}
+
+// Canonicalize returns the canonicalized representation of a sequence of raw
+// XML tokens.
+//
+// Canonicalize will render the first root-level element in the input token
+// sequence. Any leading character data, comments, or directives will be
+// skipped.
+//
+// The input stream is not checked for correctness. Canonicalize's behavior is
+// undefined if given unbalanced tokens or other incorrect XML input.
+func Canonicalize(r c14n.RawTokenReader, opts Options) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := CanonicalizeTo(&buf, r, opts); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// CanonicalizeTo is like Canonicalize, but writes the canonicalized
+// representation to w as it goes, rather than returning it. Only the current
+// token and the namespaces in scope are kept in memory, so CanonicalizeTo can
+// be given documents of any size, such as by passing a hash.Hash as w.
+//
+// NormalizePrefixes is the exception, as it has to see every namespace in the
+// input before renaming any of them, and so reads all of the input first.
+func CanonicalizeTo(w io.Writer, r c14n.RawTokenReader, opts Options) error {
+	if opts.NormalizePrefixes {
+		var err error
+		r, err = normalizePrefixes(r)
+		if err != nil {
+			return err
+		}
+	}
+
+	var knownNames stack.Stack    // a mapping of all declared namespaces in the input
+	var renderedNames stack.Stack // a mapping of all declared namespaces in the output
+	buf := bufio.NewWriter(w)     // the output, buffered
+
+	inclusive := map[string]struct{}{} // the prefixes in InclusivePrefixes
+	for _, prefix := range opts.InclusivePrefixes {
+		inclusive[prefix] = struct{}{}
+	}
+
+	for {
+		t, err := r.RawToken()
+		if err != nil {
+			if err == io.EOF {
+				return io.ErrUnexpectedEOF
+			}
+
+			return err
+		}
+
+		switch t := t.(type) {
+		case xml.StartElement:
+			names := map[string]string{}              // the names declared by this element
+			visiblyUsedNames := map[string]struct{}{} // the names visibly used by this element
+
+			visiblyUsedNames[t.Name.Space] = struct{}{}
+			for _, attr := range t.Attr {
+				if name, ok := getNamespace(attr); ok {
+					names[name] = attr.Value
+				} else if attr.Name.Space != "" {
+					// Unprefixed attributes are in no namespace, so they don't use the
+					// default namespace.
+					visiblyUsedNames[attr.Name.Space] = struct{}{}
+				}
+			}
+
+			// Note the previous value of the default namespace. This needs to be
+			// special-cased because the c14n spec special-cases the case of xmlns="".
+			previousDefaultNamespace, _ := knownNames.Lookup("")
+
+			// Push all the names declared by this element onto the input stack. We
+			// will use this to determine what namespaces to put on the output stack.
+			knownNames.Push(names)
+
+			namesToRender := map[string]struct{}{} // namespaces we will want to output
+			for name, uri := range knownNames.InScope() {
+				shouldRender := false
+
+				// xmlns="" is special-cased.
+				if name == "" && uri == "" {
+					// Per the spec, from the non-normative but clearer "constrained
+					// implementation":
+					//
+					// Render xmlns="" if and only if all of the conditions are met:
+					//
+					// The default namespace is visibly utilized by the immediate parent
+					// element node, or the default prefix token is present in
+					// InclusiveNamespaces PrefixList, and
+					//
+					// the element does not have a namespace node in the node-set
+					// declaring a value for the default namespace, and
+					//
+					// the default namespace prefix is present in the dictionary
+					// ns_rendered.
+					//
+					// ns_rendered corresponds to renderedNames in this code.
+					_, visiblyUsed := visiblyUsedNames[""]
+					_, included := inclusive[""]
+					included = included || opts.Inclusive
+					declaredValue, declared := names[""]
+					_, rendered := renderedNames.Lookup("")
+
+					shouldRender = (visiblyUsed || included) && (!declared || declaredValue != previousDefaultNamespace) && rendered
+				} else {
+					// Again from the spec:
+					//
+					// Render each namespace node if and only if all of the conditions are
+					// met:
+					//
+					// it is visibly utilized by the immediate parent element or one of
+					// its attributes, or is present in InclusiveNamespaces PrefixList,
+					// and
+					//
+					// its prefix and value do not appear in ns_rendered.
+					_, visiblyUsed := visiblyUsedNames[name]
+					_, included := inclusive[name]
+					included = included || opts.Inclusive
+					renderedValue, rendered := renderedNames.Lookup(name)
+
+					shouldRender = (visiblyUsed || included) && (!rendered || renderedValue != uri)
+				}
+
+				if shouldRender {
+					namesToRender[name] = struct{}{}
+				}
+			}
+
+			// attrsToRender is the set of attributes we'll render. The order doesn't
+			// matter yet, we'll sort them later.
+			attrsToRender := []xml.Attr{}
+			for _, attr := range t.Attr {
+				// Render all non-namespace nodes.
+				if _, ok := getNamespace(attr); !ok {
+					attrsToRender = append(attrsToRender, attr)
+				}
+			}
+
+			// renderedNameValues contains the names we're going to render, in a
+			// format we can push onto renderedNames.
+			renderedNameValues := map[string]string{}
+			for name := range namesToRender {
+				uri, _ := knownNames.Lookup(name)
+				renderedNameValues[name] = uri
+
+				if name == "" {
+					attrsToRender = append(attrsToRender, xml.Attr{
+						Name:  xml.Name{Space: "", Local: "xmlns"},
+						Value: uri,
+					})
+				} else {
+					attrsToRender = append(attrsToRender, xml.Attr{
+						Name:  xml.Name{Space: "xmlns", Local: name},
+						Value: uri,
+					})
+				}
+			}
+
+			renderedNames.Push(renderedNameValues)
+
+			// Establish a sorted order of attributes using sortAttr, which implements
+			// the ordering rules of the c14n spec.
+			sortAttr := sortAttr{stack: &knownNames, attrs: attrsToRender}
+			sort.Sort(sortAttr)
+
+			// Write out the element. From the spec:
+			//
+			// If the element is in the node-set, then the result is an open angle
+			// bracket (<), the element QName, the result of processing the namespace
+			// axis, the result of processing the attribute axis, a close angle
+			// bracket (>), [...]
+			//
+			// Where QName is:
+			//
+			// The QName of a node is either the local name if the namespace prefix
+			// string is empty or the namespace prefix, a colon, then the local name
+			// of the element. The namespace prefix used in the QName MUST be the same
+			// one which appeared in the input document.
+			//
+			// https://www.w3.org/TR/2001/REC-xml-c14n-20010315#ProcessingModel
+			if t.Name.Space == "" {
+				fmt.Fprintf(buf, "<%s", t.Name.Local)
+			} else {
+				fmt.Fprintf(buf, "<%s:%s", t.Name.Space, t.Name.Local)
+			}
+
+			for _, attr := range sortAttr.attrs {
+				// From the spec:
+				//
+				// Attribute Nodes- a space, the node's QName, an equals sign, an open
+				// quotation mark (double quote), the modified string value, and a close
+				// quotation mark (double quote). The string value of the node is
+				// modified by replacing all ampersands (&) with &amp;, all open angle
+				// brackets (<) with &lt;, all quotation mark characters with &quot;,
+				// and the whitespace characters #x9, #xA, and #xD, with character
+				// references. The character references are written in uppercase
+				// hexadecimal with no leading zeroes (for example, #xD is represented
+				// by the character reference &#xD;).
+				//
+				// https://www.w3.org/TR/2001/REC-xml-c14n-20010315#ProcessingModel
+				if attr.Name.Space == "" {
+					fmt.Fprintf(buf, " %s=\"", attr.Name.Local)
+				} else {
+					fmt.Fprintf(buf, " %s:%s=\"", attr.Name.Space, attr.Name.Local)
+				}
+
+				val := []byte(attr.Value)
+				val = bytes.ReplaceAll(val, amp, escAmp)
+				val = bytes.ReplaceAll(val, lt, escLt)
+				val = bytes.ReplaceAll(val, quot, escQuot)
+				val = bytes.ReplaceAll(val, tab, escTab)
+				val = bytes.ReplaceAll(val, nl, escNl)
+				val = bytes.ReplaceAll(val, cr, escCr)
+				buf.Write(val)
+
+				fmt.Fprint(buf, "\"")
+			}
+
+			// Having processed the attributes, we now close out the tag:
+			fmt.Fprint(buf, ">")
+		case xml.EndElement:
+			// Continuing the part of the spec abridged in the StartElement-handling
+			// section:
+			//
+			// [...] an open angle bracket, a forward slash (/), the element QName,
+			// and a close angle bracket.
+			if t.Name.Space == "" {
+				fmt.Fprintf(buf, "</%s>", t.Name.Local)
+			} else {
+				fmt.Fprintf(buf, "</%s:%s>", t.Name.Space, t.Name.Local)
+			}
+
+			knownNames.Pop()
+			renderedNames.Pop()
+
+			if knownNames.Len() == 0 {
+				return buf.Flush()
+			}
+		case xml.CharData:
+			// From the spec:
+			//
+			// Text Nodes- the string value, except all ampersands are replaced by
+			// &amp;, all open angle brackets (<) are replaced by &lt;, all closing
+			// angle brackets (>) are replaced by &gt;, and all #xD characters are
+			// replaced by &#xD;.
+
+			// Don't start rendering output until we've reached a StartElement.
+			if knownNames == nil {
+				continue
+			}
+
+			t = bytes.ReplaceAll(t, amp, escAmp)
+			t = bytes.ReplaceAll(t, lt, escLt)
+			t = bytes.ReplaceAll(t, gt, escGt)
+			t = bytes.ReplaceAll(t, cr, escCr)
+
+			buf.Write(t)
+		case xml.Comment:
+			// From the spec:
+			//
+			// Comment Nodes- Nothing if generating canonical XML without comments.
+			// For canonical XML with comments, generate the opening comment symbol
+			// (<!--), the string value of the node, and the closing comment symbol
+			// (-->).
+			//
+			// Comments outside of the root element are never rendered, because
+			// Canonicalize only renders the root element.
+			if knownNames == nil || !opts.WithComments {
+				continue
+			}
+
+			fmt.Fprintf(buf, "<!--%s-->", t)
+		case xml.ProcInst:
+			// From the spec:
+			//
+			// Processing Instruction (PI) Nodes- The opening PI symbol (<?), the PI
+			// target name of the node, a leading space and the string value if it is
+			// not empty, and the closing PI symbol (?>).
+			//
+			// The XML declaration is omitted from the canonical form, which we
+			// implement by simply checking if the target of the ProcInst is xml.
+
+			// Don't start rendering output until we've reached a StartElement.
+			if knownNames == nil {
+				continue
+			}
+
+			if t.Target != "xml" {
+				fmt.Fprintf(buf, "<?%s", t.Target)
+				if len(t.Inst) > 0 {
+					buf.WriteByte(' ')
+				}
+				buf.Write(t.Inst)
+				fmt.Fprintf(buf, "?>")
+			}
+		case xml.Directive:
+			// The canonical form has no document type declaration, and directives
+			// can't appear inside the root element, so they are never rendered.
+			//
+			// https://www.w3.org/TR/2001/REC-xml-c14n-20010315#DocType
+			continue
+		}
+	}
+}
+
+// getNamespace gets the namespace declared by this attribute, and whether it's
+// a namespace-declaring attribute.
+func getNamespace(attr xml.Attr) (string, bool) {
+	if attr.Name.Space == "" && attr.Name.Local == "xmlns" {
+		return "", true
+	}
+
+	if attr.Name.Space == "xmlns" {
+		return attr.Name.Local, true
+	}
+
+	return "", false
+}
+
+// These are used in handling xml.CharData and xml.StartElement attribute
+// values.
+var (
+	amp     = []byte("&")
+	escAmp  = []byte("&amp;")
+	lt      = []byte("<")
+	escLt   = []byte("&lt;")
+	gt      = []byte(">")
+	escGt   = []byte("&gt;")
+	cr      = []byte("\r")
+	escCr   = []byte("&#xD;")
+	quot    = []byte("\"")
+	escQuot = []byte("&quot;")
+	tab     = []byte("\t")
+	escTab  = []byte("&#x9;")
+	nl      = []byte("\n")
+	escNl   = []byte("&#xA;")
+)
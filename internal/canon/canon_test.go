@@ -0,0 +1,223 @@
+package canon_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/dsig/internal/canon"
+)
+
+func TestCanonicalize(t *testing.T) {
+	entries, err := ioutil.ReadDir("testdata")
+	assert.NoError(t, err)
+
+	for _, file := range entries {
+		t.Run(file.Name(), func(t *testing.T) {
+			in, err := ioutil.ReadFile(fmt.Sprintf("testdata/%s/in.xml", file.Name()))
+			assert.NoError(t, err)
+
+			out, err := ioutil.ReadFile(fmt.Sprintf("testdata/%s/out.xml", file.Name()))
+			assert.NoError(t, err)
+
+			decoder := xml.NewDecoder(bytes.NewReader(in))
+			actual, err := canon.Canonicalize(decoder, canon.Options{})
+			assert.NoError(t, err)
+			assert.Equal(t, string(out), string(actual))
+		})
+	}
+}
+
+func TestCanonicalize_Inclusive(t *testing.T) {
+	entries, err := ioutil.ReadDir("testdata")
+	assert.NoError(t, err)
+
+	for _, file := range entries {
+		// Only some of the test cases have an expected output for inclusive
+		// canonicalization, generated with xmllint --c14n.
+		out, err := ioutil.ReadFile(fmt.Sprintf("testdata/%s/out_inclusive.xml", file.Name()))
+		if os.IsNotExist(err) {
+			continue
+		}
+
+		t.Run(file.Name(), func(t *testing.T) {
+			assert.NoError(t, err)
+
+			in, err := ioutil.ReadFile(fmt.Sprintf("testdata/%s/in.xml", file.Name()))
+			assert.NoError(t, err)
+
+			decoder := xml.NewDecoder(bytes.NewReader(in))
+			actual, err := canon.Canonicalize(decoder, canon.Options{Inclusive: true})
+			assert.NoError(t, err)
+			assert.Equal(t, string(out), string(actual))
+		})
+	}
+}
+
+func TestCanonicalize_WithComments(t *testing.T) {
+	input := `<!-- before --><foo><!-- inside --><bar /></foo><!-- after -->`
+
+	type testCase struct {
+		Options canon.Options
+		Out     string
+	}
+
+	testCases := map[string]testCase{
+		"without comments": testCase{
+			Options: canon.Options{},
+			Out:     `<foo><bar></bar></foo>`,
+		},
+		"with comments": testCase{
+			Options: canon.Options{WithComments: true},
+			Out:     `<foo><!-- inside --><bar></bar></foo>`,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			decoder := xml.NewDecoder(strings.NewReader(input))
+			out, err := canon.Canonicalize(decoder, tt.Options)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.Out, string(out))
+		})
+	}
+}
+
+func TestCanonicalize_NormalizePrefixes(t *testing.T) {
+	type testCase struct {
+		In  string
+		Out string
+	}
+
+	testCases := map[string]testCase{
+		"prefixes renamed": testCase{
+			In:  `<a:foo xmlns:a="urn:a" xmlns:b="urn:b"><b:bar a:x="1"></b:bar></a:foo>`,
+			Out: `<n0:foo xmlns:n0="urn:a"><n1:bar xmlns:n1="urn:b" n0:x="1"></n1:bar></n0:foo>`,
+		},
+		"default namespace": testCase{
+			In:  `<foo xmlns="urn:a"><bar x="1" xmlns=""></bar></foo>`,
+			Out: `<n0:foo xmlns:n0="urn:a"><bar x="1"></bar></n0:foo>`,
+		},
+		"same namespace, different prefixes": testCase{
+			In:  `<a:foo xmlns:a="urn:a"><b:bar xmlns:b="urn:a"></b:bar></a:foo>`,
+			Out: `<n0:foo xmlns:n0="urn:a"><n0:bar></n0:bar></n0:foo>`,
+		},
+		"same prefix, different namespaces": testCase{
+			In:  `<a:foo xmlns:a="urn:a"><a:bar xmlns:a="urn:b"></a:bar></a:foo>`,
+			Out: `<n0:foo xmlns:n0="urn:a"><n1:bar xmlns:n1="urn:b"></n1:bar></n0:foo>`,
+		},
+		"order of first use": testCase{
+			In:  `<foo xmlns:a="urn:a" xmlns:b="urn:b"><b:bar b:x="1" a:y="2"></b:bar><a:baz></a:baz></foo>`,
+			Out: `<foo><n0:bar xmlns:n0="urn:b" xmlns:n1="urn:a" n1:y="2" n0:x="1"></n0:bar><n1:baz xmlns:n1="urn:a"></n1:baz></foo>`,
+		},
+		"attribute order": testCase{
+			In:  `<foo xmlns:a="urn:a" xmlns:b="urn:b"><bar b:x="1" a:y="2"></bar></foo>`,
+			Out: `<foo><bar xmlns:n0="urn:a" xmlns:n1="urn:b" n0:y="2" n1:x="1"></bar></foo>`,
+		},
+		"unused declarations": testCase{
+			In:  `<foo xmlns:a="urn:a" xmlns:b="urn:b"><b:bar></b:bar></foo>`,
+			Out: `<foo><n0:bar xmlns:n0="urn:b"></n0:bar></foo>`,
+		},
+		"xml prefix": testCase{
+			In:  `<a:foo xmlns:a="urn:a" xml:lang="en"></a:foo>`,
+			Out: `<n0:foo xmlns:n0="urn:a" xml:lang="en"></n0:foo>`,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			decoder := xml.NewDecoder(strings.NewReader(tt.In))
+			out, err := canon.Canonicalize(decoder, canon.Options{NormalizePrefixes: true})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.Out, string(out))
+		})
+	}
+}
+
+func TestCanonicalize_InclusivePrefixes(t *testing.T) {
+	type testCase struct {
+		In       string
+		Prefixes []string
+		Out      string
+	}
+
+	testCases := map[string]testCase{
+		"none": testCase{
+			In:  `<foo xmlns:xsi="urn:xsi" xmlns:saml="urn:saml"><bar xsi:type="saml:Foo"></bar></foo>`,
+			Out: `<foo><bar xmlns:xsi="urn:xsi" xsi:type="saml:Foo"></bar></foo>`,
+		},
+		"qname in attribute value": testCase{
+			In:       `<foo xmlns:xsi="urn:xsi" xmlns:saml="urn:saml"><bar xsi:type="saml:Foo"></bar></foo>`,
+			Prefixes: []string{"saml"},
+			Out:      `<foo xmlns:saml="urn:saml"><bar xmlns:xsi="urn:xsi" xsi:type="saml:Foo"></bar></foo>`,
+		},
+		"already rendered": testCase{
+			In:       `<a:foo xmlns:a="urn:a"><a:bar></a:bar></a:foo>`,
+			Prefixes: []string{"a"},
+			Out:      `<a:foo xmlns:a="urn:a"><a:bar></a:bar></a:foo>`,
+		},
+		"redeclared": testCase{
+			In:       `<foo xmlns:a="urn:a"><bar xmlns:a="urn:b"></bar></foo>`,
+			Prefixes: []string{"a"},
+			Out:      `<foo xmlns:a="urn:a"><bar xmlns:a="urn:b"></bar></foo>`,
+		},
+		"not in scope": testCase{
+			In:       `<foo><bar></bar></foo>`,
+			Prefixes: []string{"a"},
+			Out:      `<foo><bar></bar></foo>`,
+		},
+		"default namespace": testCase{
+			In:       `<a:foo xmlns:a="urn:a" xmlns="urn:default"><a:bar></a:bar></a:foo>`,
+			Prefixes: []string{""},
+			Out:      `<a:foo xmlns="urn:default" xmlns:a="urn:a"><a:bar></a:bar></a:foo>`,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			decoder := xml.NewDecoder(strings.NewReader(tt.In))
+			out, err := canon.Canonicalize(decoder, canon.Options{InclusivePrefixes: tt.Prefixes})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.Out, string(out))
+		})
+	}
+}
+
+func TestCanonicalize_Doctype(t *testing.T) {
+	input := `<?xml version="1.0"?>
+<!DOCTYPE foo [
+<!ELEMENT foo ANY>
+]>
+<foo><bar></bar></foo>`
+
+	decoder := xml.NewDecoder(strings.NewReader(input))
+	out, err := canon.Canonicalize(decoder, canon.Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, `<foo><bar></bar></foo>`, string(out))
+}
+
+func TestCanonicalize_NoStartElement(t *testing.T) {
+	decoder := xml.NewDecoder(strings.NewReader("<!-- foo -->"))
+	_, err := canon.Canonicalize(decoder, canon.Options{})
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+}
+
+func TestCanonicalize_RawTokenError(t *testing.T) {
+	_, err := canon.Canonicalize(&errRawTokener{}, canon.Options{})
+	assert.Equal(t, errDummy, err)
+}
+
+var errDummy = errors.New("dummy error")
+
+type errRawTokener struct{}
+
+func (e *errRawTokener) RawToken() (xml.Token, error) {
+	return nil, errDummy
+}
@@ -0,0 +1,172 @@
+package canon
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/ucarion/c14n"
+	"github.com/ucarion/dsig/internal/stack"
+)
+
+// normalizePrefixes reads all of the tokens in r, and returns them with their
+// namespace prefixes rewritten as described in the documentation for
+// Options.NormalizePrefixes.
+func normalizePrefixes(r c14n.RawTokenReader) (c14n.RawTokenReader, error) {
+	var tokens []xml.Token
+	for {
+		t, err := r.RawToken()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+
+			return nil, err
+		}
+
+		tokens = append(tokens, xml.CopyToken(t))
+	}
+
+	// The first pass assigns a prefix to each namespace, in order of first use.
+	var uris []string
+	prefixes := map[string]string{}
+	walkNames(tokens, func(uri string) {
+		if _, ok := prefixes[uri]; !ok {
+			prefixes[uri] = fmt.Sprintf("n%d", len(uris))
+			uris = append(uris, uri)
+		}
+	})
+
+	// The second pass renames everything, replacing the original namespace
+	// declarations with declarations of the new prefixes on the root element.
+	var names stack.Stack
+	out := make([]xml.Token, 0, len(tokens))
+	root := true
+	for _, t := range tokens {
+		switch t := t.(type) {
+		case xml.StartElement:
+			names.Push(declaredNames(t))
+
+			renamed := xml.StartElement{Name: rename(&names, prefixes, t.Name, true)}
+			if root {
+				for _, uri := range uris {
+					renamed.Attr = append(renamed.Attr, xml.Attr{
+						Name:  xml.Name{Space: "xmlns", Local: prefixes[uri]},
+						Value: uri,
+					})
+				}
+
+				root = false
+			}
+
+			for _, attr := range t.Attr {
+				if _, ok := getNamespace(attr); ok {
+					continue
+				}
+
+				renamed.Attr = append(renamed.Attr, xml.Attr{
+					Name:  rename(&names, prefixes, attr.Name, false),
+					Value: attr.Value,
+				})
+			}
+
+			out = append(out, renamed)
+		case xml.EndElement:
+			out = append(out, xml.EndElement{Name: rename(&names, prefixes, t.Name, true)})
+			names.Pop()
+		default:
+			out = append(out, t)
+		}
+	}
+
+	buf := tokenBuffer(out)
+	return &buf, nil
+}
+
+// walkNames calls f with the namespace URI of each qualified element and
+// attribute name in tokens, in document order. An element's own name comes
+// before its attributes, which are visited in order of their namespace URI.
+func walkNames(tokens []xml.Token, f func(uri string)) {
+	var names stack.Stack
+	for _, t := range tokens {
+		switch t := t.(type) {
+		case xml.StartElement:
+			names.Push(declaredNames(t))
+
+			if uri, ok := resolve(&names, t.Name, true); ok {
+				f(uri)
+			}
+
+			var attrURIs []string
+			for _, attr := range t.Attr {
+				if _, ok := getNamespace(attr); ok {
+					continue
+				}
+
+				if uri, ok := resolve(&names, attr.Name, false); ok {
+					attrURIs = append(attrURIs, uri)
+				}
+			}
+
+			sort.Strings(attrURIs)
+			for _, uri := range attrURIs {
+				f(uri)
+			}
+		case xml.EndElement:
+			names.Pop()
+		}
+	}
+}
+
+// resolve returns the namespace URI of name, and whether name is in a
+// namespace that normalizePrefixes renames. Unprefixed attributes are in no
+// namespace, while unprefixed elements are in the default namespace. The xml
+// prefix, and any prefix that was never declared, is left alone.
+func resolve(names *stack.Stack, name xml.Name, isElement bool) (string, bool) {
+	if name.Space == "xml" || (name.Space == "" && !isElement) {
+		return "", false
+	}
+
+	uri, ok := names.Lookup(name.Space)
+	if !ok || uri == "" {
+		return "", false
+	}
+
+	return uri, true
+}
+
+// rename returns name with its prefix replaced by the one assigned to its
+// namespace.
+func rename(names *stack.Stack, prefixes map[string]string, name xml.Name, isElement bool) xml.Name {
+	uri, ok := resolve(names, name, isElement)
+	if !ok {
+		return name
+	}
+
+	return xml.Name{Space: prefixes[uri], Local: name.Local}
+}
+
+// declaredNames returns the namespaces declared by t.
+func declaredNames(t xml.StartElement) map[string]string {
+	names := map[string]string{}
+	for _, attr := range t.Attr {
+		if name, ok := getNamespace(attr); ok {
+			names[name] = attr.Value
+		}
+	}
+
+	return names
+}
+
+type tokenBuffer []xml.Token
+
+func (b *tokenBuffer) RawToken() (xml.Token, error) {
+	if len(*b) == 0 {
+		return nil, io.EOF
+	}
+
+	t := (*b)[0]
+	*b = (*b)[1:]
+	return t, nil
+}
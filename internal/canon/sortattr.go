@@ -0,0 +1,101 @@
+package canon
+
+import (
+	"encoding/xml"
+
+	"github.com/ucarion/dsig/internal/stack"
+)
+
+// sortAttr can sort attributes in compliance with the c14n specification.
+type sortAttr struct {
+	stack *stack.Stack
+	attrs []xml.Attr
+}
+
+// Len implements Sort.
+func (s sortAttr) Len() int {
+	return len(s.attrs)
+}
+
+// Swap implements Sort.
+func (s sortAttr) Swap(i, j int) {
+	s.attrs[i], s.attrs[j] = s.attrs[j], s.attrs[i]
+}
+
+// Less implements Sort.
+func (s sortAttr) Less(i, j int) bool {
+	// Many comments in this function are copied from:
+	//
+	// https://www.w3.org/TR/2001/REC-xml-c14n-20010315#DocumentOrder
+
+	// The spec states:
+	//
+	// "Namespace nodes have a lesser document order position than attribute
+	// nodes."
+	//
+	// And:
+	//
+	// "An element's namespace nodes are sorted lexicographically by local name
+	// (the default namespace node, if one exists, has no local name and is
+	// therefore lexicographically least)."
+	//
+	// It follows that the very first node is the default namespace node. Let's
+	// handle those first:
+	if s.attrs[i].Name.Space == "" && s.attrs[i].Name.Local == "xmlns" {
+		return true
+	}
+
+	if s.attrs[j].Name.Space == "" && s.attrs[j].Name.Local == "xmlns" {
+		return false
+	}
+
+	// Namespace nodes go first. If one is a namespace node and the other isn't,
+	// then it goes first.
+	if s.attrs[i].Name.Space == "xmlns" && s.attrs[j].Name.Space != "xmlns" {
+		return true
+	}
+
+	if s.attrs[i].Name.Space != "xmlns" && s.attrs[j].Name.Space == "xmlns" {
+		return false
+	}
+
+	// Break ties between two namespace nodes by their local name.
+	if s.attrs[i].Name.Space == "xmlns" && s.attrs[j].Name.Space == "xmlns" {
+		return s.attrs[i].Name.Local < s.attrs[j].Name.Local
+	}
+
+	// Finally:
+	//
+	// "An element's attribute nodes are sorted lexicographically with namespace
+	// URI as the primary key and local name as the secondary key (an empty
+	// namespace URI is lexicographically least)."
+	//
+	// This just means: sort by Space first, break ties by Local. Space is a
+	// prefix, so it needs to be resolved to a namespace URI first.
+	spaceI := s.namespace(s.attrs[i].Name)
+	spaceJ := s.namespace(s.attrs[j].Name)
+	if spaceI != spaceJ {
+		return spaceI < spaceJ
+	}
+
+	return s.attrs[i].Name.Local < s.attrs[j].Name.Local
+}
+
+// xmlNamespace is the namespace URI that the xml prefix is bound to. It never
+// needs to be declared.
+const xmlNamespace = "http://www.w3.org/XML/1998/namespace"
+
+// namespace returns the namespace URI of an attribute's name. Unlike an
+// element, an unprefixed attribute is in no namespace, even if there is a
+// default namespace, and so sorts before attributes with a prefix, such as
+// xsi:type.
+func (s sortAttr) namespace(name xml.Name) string {
+	switch name.Space {
+	case "":
+		return ""
+	case "xml":
+		return xmlNamespace
+	default:
+		return s.stack.Get(name.Space)
+	}
+}
@@ -2,9 +2,12 @@ package sigsplit
 
 import (
 	"encoding/xml"
+	"errors"
 	"io"
+	"sort"
 
 	"github.com/ucarion/c14n"
+	"github.com/ucarion/dsig/internal/canon"
 	"github.com/ucarion/dsig/internal/stack"
 )
 
@@ -20,7 +23,138 @@ var signedInfoName = xml.Name{
 	Local: "SignedInfo",
 }
 
-var signedInfoDepth = 2
+var referenceName = xml.Name{
+	Space: "http://www.w3.org/2000/09/xmldsig#",
+	Local: "Reference",
+}
+
+var digestValueName = xml.Name{
+	Space: "http://www.w3.org/2000/09/xmldsig#",
+	Local: "DigestValue",
+}
+
+var signatureValueName = xml.Name{
+	Space: "http://www.w3.org/2000/09/xmldsig#",
+	Local: "SignatureValue",
+}
+
+var objectName = xml.Name{
+	Space: "http://www.w3.org/2000/09/xmldsig#",
+	Local: "Object",
+}
+
+// idAttrs are the local names of the unqualified attributes that are treated as
+// IDs when looking for the element with a given ID.
+var idAttrs = []string{"ID", "Id", "id"}
+
+// wsuNamespace is the namespace of the wsu:Id attribute, which WS-Security uses
+// to give IDs to the parts of a SOAP message that it signs.
+var wsuNamespace = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd"
+
+// ErrIDNotFound is returned by SplitSignature if Options.ID is set, but no
+// element has that ID.
+var ErrIDNotFound = errors.New("sigsplit: no element with id")
+
+// ErrDuplicateID is returned by SplitSignature if Options.ID is set, and more
+// than one element has that ID.
+var ErrDuplicateID = errors.New("sigsplit: more than one element with id")
+
+// ErrUncoveredContent is returned by SplitSignature if
+// Options.RequireFullCoverage is set, and there are elements outside of both
+// ds:Signature and the element with Options.ID.
+var ErrUncoveredContent = errors.New("sigsplit: content outside of referenced element")
+
+// ErrSignatureNotFound is returned by SplitSignature if Options.ReferenceURI is
+// set, but no ds:Signature has a ds:Reference with that URI.
+var ErrSignatureNotFound = errors.New("sigsplit: no signature with reference uri")
+
+// ErrDuplicateSignature is returned by SplitSignature if
+// Options.MatchSignatureValue matches more than one of the ds:Signature
+// elements that could be split out.
+var ErrDuplicateSignature = errors.New("sigsplit: more than one matching signature")
+
+// ErrNotEnveloped is returned by SplitSignature if Options.RequireEnveloped is
+// set, and the element with Options.ID neither contains the ds:Signature split
+// out nor is contained by it.
+var ErrNotEnveloped = errors.New("sigsplit: signature not enveloped by referenced element")
+
+// ErrSignatureMisplaced is returned by SplitSignature if
+// Options.RequireEnveloped is set, and the ds:Signature split out is enveloped
+// by the element with Options.ID without being its immediate child, or is an
+// enveloping signature that is neither the root element nor a child of it.
+var ErrSignatureMisplaced = errors.New("sigsplit: signature not in enveloped or enveloping position")
+
+// Options controls how SplitSignature canonicalizes the data it splits.
+type Options struct {
+	// Outer is used to canonicalize the data outside of ds:Signature.
+	Outer canon.Options
+
+	// Inner is used to canonicalize ds:SignedInfo.
+	Inner canon.Options
+
+	// ID, if non-empty, restricts the outer data to the element whose ID, Id,
+	// id, or wsu:Id attribute is ID, along with its descendants. The element
+	// must be unique.
+	ID string
+
+	// IDAttribute, if non-zero, is the only attribute that ID is looked for in,
+	// instead of ID, Id, id, and wsu:Id. Its Space is a namespace URI, not a
+	// prefix.
+	IDAttribute xml.Name
+
+	// ReferenceURI selects the ds:Signature to split out.
+	//
+	// If ID is empty, the ds:Signature split out is the first child-of-root
+	// ds:Signature whose ds:SignedInfo has a ds:Reference with this URI, or the
+	// first child-of-root ds:Signature if there is no such signature. Other
+	// ds:Signature elements are left in the outer data.
+	//
+	// If ID and ReferenceURI are both non-empty, the ds:Signature split out is
+	// the first one, at any depth, whose ds:SignedInfo has a ds:Reference with
+	// this URI; RequireEnveloped limits the depths it may be found at. If ID is
+	// non-empty but ReferenceURI is empty, every child-of-root ds:Signature is
+	// split out.
+	ReferenceURI string
+
+	// MatchSignatureValue, if non-nil, picks out the ds:Signature to split out
+	// from those that ReferenceURI selects, rather than taking the first of
+	// them. It's called with the text directly inside the ds:SignatureValue of
+	// each, as encoding/xml would unmarshal it, and only a ds:Signature that it
+	// returns true for is split out.
+	//
+	// If it returns true for more than one, such as for a copy of a signature
+	// that was moved elsewhere in the document, SplitSignature can't tell which
+	// one was meant, and returns ErrDuplicateSignature. If it returns true for
+	// none of them, the first is split out, as if MatchSignatureValue were nil;
+	// a signature value that isn't in the document won't verify against any of
+	// them anyway.
+	MatchSignatureValue func(value string) bool
+
+	// DigestValues, if non-empty, replace the content of the ds:DigestValue of
+	// each ds:Reference in the split-out ds:SignedInfo, in order. This lets a
+	// signer compute the canonical ds:SignedInfo that a document will have once
+	// its placeholder DigestValues are filled in.
+	DigestValues []string
+
+	// RequireEnveloped, if true, makes SplitSignature return ErrNotEnveloped if
+	// ID is non-empty, and the element with that ID neither contains the
+	// ds:Signature split out, as in an enveloped signature, nor is contained by
+	// it, as the ds:Object of an enveloping signature is.
+	//
+	// It also keeps the ds:Signature in one of those two positions, however
+	// deep ReferenceURI would otherwise let it be: an enveloped ds:Signature
+	// must be an immediate child of the element with ID, and an enveloping one
+	// must be the root element or a child of it. Otherwise, SplitSignature
+	// returns ErrSignatureMisplaced.
+	RequireEnveloped bool
+
+	// RequireFullCoverage, if true, makes SplitSignature return
+	// ErrUncoveredContent if there are any elements outside of both ds:Signature
+	// and the outer data. Text can only appear inside an element, so it's
+	// covered whenever its element is. Comments and processing instructions
+	// outside the root element are not considered.
+	RequireFullCoverage bool
+}
 
 // SplitSignature takes a raw sequence of tokens, and splits them into data
 // outside of ds:Signature and data inside ds:SignedInfo.
@@ -29,15 +163,122 @@ var signedInfoDepth = 2
 // cryptographically verified.
 //
 // This function assumes that the data has ds:Signature at the child-of-root
-// level, and ds:SignedInfo immediately inside ds:Signature.
-func SplitSignature(r c14n.RawTokenReader) ([]byte, []byte, error) {
-	outer := []xml.Token{}
-	inner := []xml.Token{}
+// level, unless Options.ReferenceURI says otherwise, and ds:SignedInfo
+// immediately inside ds:Signature.
+func SplitSignature(r c14n.RawTokenReader, opts Options) ([]byte, []byte, error) {
+	result, err := Split(r, opts)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	inSignature := false
-	inSignedInfo := false
-	stack := stack.Stack{}
+	return result.Outer, result.Inner, nil
+}
+
+// Result is the outcome of Split.
+type Result struct {
+	// Outer is the canonicalized data outside of ds:Signature.
+	Outer []byte
+
+	// Inner is the canonicalized ds:SignedInfo.
+	Inner []byte
+
+	// Path is the local names of the elements from the root element down to
+	// the element that Outer was taken from: the element with Options.ID, or
+	// the root element if Options.ID is empty.
+	Path []string
+
+	// Name is the name of the element that Outer was taken from, with its
+	// namespace URI as its Space.
+	Name xml.Name
+}
+
+// Split is like SplitSignature, but also describes the element that the outer
+// data was taken from.
+func Split(r c14n.RawTokenReader, opts Options) (*Result, error) {
+	result, parts, err := splitOuter(r, opts)
+	if err != nil {
+		return nil, err
+	}
 
+	innerReader := bufRawTokenReader(parts.inner)
+	result.Inner, err = canon.Canonicalize(&innerReader, opts.Inner)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// SplitOuter is like Split, but leaves Inner nil. ds:SignedInfo has a
+// ds:Reference for each piece of signed data, so a caller digesting each of
+// many References only needs ds:SignedInfo canonicalized once, not once per
+// Reference.
+func SplitOuter(r c14n.RawTokenReader, opts Options) (*Result, error) {
+	result, _, err := splitOuter(r, opts)
+	return result, err
+}
+
+// splitOuter does the work of Split, except for canonicalizing the inner data.
+func splitOuter(r c14n.RawTokenReader, opts Options) (*Result, *split, error) {
+	parts, err := splitTokens(r, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if opts.RequireFullCoverage && !parts.covered {
+		return nil, nil, ErrUncoveredContent
+	}
+
+	outerReader := bufRawTokenReader(parts.outer)
+	outerBytes, err := canon.Canonicalize(&outerReader, opts.Outer)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &Result{Outer: outerBytes, Path: parts.path, Name: parts.name}, parts, nil
+}
+
+// CanonicalizeOuter is like SplitSignature, but only returns the data outside
+// of ds:Signature. Unlike SplitSignature, it does not require that the data
+// contain a ds:Signature at all.
+func CanonicalizeOuter(r c14n.RawTokenReader, opts canon.Options) ([]byte, error) {
+	parts, err := splitTokens(r, Options{Outer: opts})
+	if err != nil {
+		return nil, err
+	}
+
+	outerReader := bufRawTokenReader(parts.outer)
+	return canon.Canonicalize(&outerReader, opts)
+}
+
+// split is the outcome of splitTokens.
+type split struct {
+	outer []xml.Token
+	inner []xml.Token
+
+	// covered is whether every element is either in outer or in ds:Signature.
+	covered bool
+
+	// path and name describe the element that outer was taken from, as with
+	// Result.
+	path []string
+	name xml.Name
+}
+
+// splitTokens does the work of Split, but returns the split tokens without
+// canonicalizing them. If opts.ID is non-empty, outer only contains the element
+// with that ID, and opts.ReferenceURI selects the ds:Signature.
+//
+// If opts.DigestValues is non-empty, they replace the content of each
+// ds:DigestValue in inner, in order. If opts.Outer or opts.Inner is inclusive,
+// the root of outer or inner is given the xml:* attributes of its ancestors, as
+// Canonical XML requires of a document subset.
+func splitTokens(r c14n.RawTokenReader, opts Options) (*split, error) {
+	id, idAttr, uri, digestValues := opts.ID, opts.IDAttribute, opts.ReferenceURI, opts.DigestValues
+
+	// The signature may come before or after the element it refers to, so all of
+	// the tokens are read before any of them are split.
+	var tokens []xml.Token
 	for {
 		t, err := r.RawToken()
 		if err != nil {
@@ -45,32 +286,99 @@ func SplitSignature(r c14n.RawTokenReader) ([]byte, []byte, error) {
 				break
 			}
 
-			return nil, nil, err
+			return nil, err
 		}
 
+		tokens = append(tokens, xml.CopyToken(t))
+	}
+
+	// signatureIndex is the index of the start of the ds:Signature to split out,
+	// or -1 if every child-of-root ds:Signature is split out.
+	//
+	// Without an ID, the signature is enveloped, and the enveloped signature
+	// transform removes only the ds:Signature being verified. Any others, such
+	// as a second child-of-root ds:Signature over something else, are part of
+	// the signed data. A signature over the whole document can also be in a
+	// ds:Object of another one, as a co-signature; the other signature's
+	// enveloped signature transform then removes it too.
+	//
+	// An error in selecting the signature is only returned once the element
+	// with the ID has been looked for, so that a missing or duplicate ID is
+	// reported first.
+	signatureIndex, selectErr := selectSignature(tokens, opts)
+
+	outer := []xml.Token{}
+	inner := []xml.Token{}
+
+	inSignature := false
+	currentSignatureDepth := 0
+	inSignedInfo := false
+	inDigestValue := false
+	digestValueDepth := 0
+	digestValueCount := 0
+	inReferenced := false
+	referencedDepth := 0
+	referencedCount := 0
+	covered := true
+	stack := stack.Stack{}
+
+	// xmlAttrs holds the xml:* attributes of each open element, and path their
+	// local names.
+	var xmlAttrs [][]xml.Attr
+	var path []string
+
+	// referencedPath and referencedName describe the element that outer is
+	// taken from.
+	var referencedPath []string
+	var referencedName xml.Name
+
+	// enveloped is whether the element with the ID contains the ds:Signature
+	// split out, or is contained by it, and positioned whether the
+	// ds:Signature is where RequireEnveloped allows it to be.
+	enveloped := false
+	positioned := false
+
+	// inOuter is whether the current token belongs in outer. The referenced
+	// element is normally outside of ds:Signature, but in an enveloping
+	// signature it's a ds:Object inside the ds:Signature being split out.
+	inOuter := func() bool {
+		if inSignature && inReferenced && referencedDepth > currentSignatureDepth {
+			return true
+		}
+
+		return !inSignature && (id == "" || inReferenced)
+	}
+
+	for i, t := range tokens {
 		switch t := t.(type) {
 		case xml.StartElement:
-			names := map[string]string{}
-			for _, attr := range t.Attr {
-				if attr.Name.Space == "xmlns" {
-					names[attr.Name.Local] = attr.Value
-				} else if attr.Name.Space == "" && attr.Name.Local == "xmlns" {
-					names[""] = attr.Value
-				}
-			}
-
-			stack.Push(names)
+			stack.Push(DeclaredNamespaces(t))
+			xmlAttrs = append(xmlAttrs, ownXMLAttrs(t))
+			path = append(path, t.Name.Local)
 
 			resolvedName := xml.Name{
 				Space: stack.Get(t.Name.Space),
 				Local: t.Name.Local,
 			}
 
-			if stack.Len() == signatureDepth+1 && resolvedName == signatureName {
-				inSignature = true
+			if id == "" && stack.Len() == 1 {
+				referencedPath = append([]string(nil), path...)
+				referencedName = resolvedName
+			}
+
+			if !inSignature && resolvedName == signatureName {
+				if signatureIndex == -1 && stack.Len() == signatureDepth+1 || i == signatureIndex {
+					inSignature = true
+					currentSignatureDepth = stack.Len()
+
+					if inReferenced {
+						enveloped = true
+						positioned = stack.Len() == referencedDepth+1
+					}
+				}
 			}
 
-			if stack.Len() == signedInfoDepth+1 && resolvedName == signedInfoName {
+			if inSignature && stack.Len() == currentSignatureDepth+1 && resolvedName == signedInfoName {
 				// A bit of a hack here:
 				//
 				// SplitSignature is all about selectively copying XML elements into
@@ -81,104 +389,454 @@ func SplitSignature(r c14n.RawTokenReader) ([]byte, []byte, error) {
 				// declarations into root of inner, and then we'll let the c14n
 				// algorithm filter away any namespace declarations that don't end up
 				// being visibly used.
-				allNames := map[string]string{}
-				for _, names := range stack {
-					for k, v := range names {
-						allNames[k] = v
-					}
+				t = t.Copy()
+				InjectNamespaces(&t, stack.InScope())
+				if opts.Inner.Inclusive {
+					inheritXMLAttrs(&t, xmlAttrs[:len(xmlAttrs)-1])
 				}
 
-				for k, v := range allNames {
-					if k == "" {
-						t.Attr = append(t.Attr, xml.Attr{
-							Name:  xml.Name{Space: "", Local: "xmlns"},
-							Value: v,
-						})
-					} else {
-						t.Attr = append(t.Attr, xml.Attr{
-							Name:  xml.Name{Space: "xmlns", Local: k},
-							Value: v,
-						})
+				inSignedInfo = true
+			}
+
+			if id != "" && HasID(t, id, idAttr, &stack) {
+				referencedCount++
+
+				// The referenced element is in the same position as ds:SignedInfo:
+				// it's canonicalized on its own, but it and its descendants may use
+				// namespaces declared on its ancestors, whether in element names or
+				// in prefixed attributes like xlink:href. The same hack applies.
+				if !inReferenced {
+					t = t.Copy()
+					InjectNamespaces(&t, stack.InScope())
+					if opts.Outer.Inclusive {
+						inheritXMLAttrs(&t, xmlAttrs[:len(xmlAttrs)-1])
 					}
-				}
 
-				inSignedInfo = true
+					inReferenced = true
+					referencedDepth = stack.Len()
+					referencedPath = append([]string(nil), path...)
+					referencedName = resolvedName
+
+					if inSignature {
+						enveloped = true
+						positioned = currentSignatureDepth <= signatureDepth+1
+					}
+				}
 			}
 
-			if inSignedInfo {
-				inner = append(inner, t.Copy())
+			if inSignedInfo && !inDigestValue {
+				inner = append(inner, t)
+
+				if digestValueCount < len(digestValues) && stack.Len() == currentSignatureDepth+3 && resolvedName == digestValueName {
+					inner = append(inner, xml.CharData(digestValues[digestValueCount]))
+					inDigestValue = true
+					digestValueDepth = stack.Len()
+					digestValueCount++
+				}
 			}
 
-			if !inSignature {
-				outer = append(outer, t.Copy())
+			if inOuter() {
+				outer = append(outer, t)
+			} else if !inSignature {
+				covered = false
 			}
 		case xml.EndElement:
-			if inSignedInfo {
+			if inDigestValue && stack.Len() == digestValueDepth {
+				inDigestValue = false
+			}
+
+			if inSignedInfo && !inDigestValue {
 				inner = append(inner, t)
 			}
 
-			if !inSignature {
+			if inOuter() {
 				outer = append(outer, t)
 			}
 
 			stack.Pop()
+			xmlAttrs = xmlAttrs[:len(xmlAttrs)-1]
+			path = path[:len(path)-1]
 
-			if stack.Len() == signatureDepth && inSignature {
+			if stack.Len() < currentSignatureDepth && inSignature {
 				inSignature = false
 			}
 
-			if stack.Len() == signedInfoDepth && inSignedInfo {
+			if stack.Len() == currentSignatureDepth && inSignedInfo {
 				inSignedInfo = false
 			}
 
-		case xml.CharData:
-			if inSignedInfo {
-				inner = append(inner, t.Copy())
+			if stack.Len() < referencedDepth && inReferenced {
+				inReferenced = false
+			}
+		default:
+			if inSignedInfo && !inDigestValue {
+				inner = append(inner, t)
 			}
 
-			if !inSignature {
-				outer = append(outer, t.Copy())
+			if inOuter() {
+				outer = append(outer, t)
 			}
-		case xml.Comment:
-			if inSignedInfo {
-				inner = append(inner, t.Copy())
+		}
+	}
+
+	if id != "" && referencedCount == 0 {
+		return nil, ErrIDNotFound
+	}
+
+	if referencedCount > 1 {
+		return nil, ErrDuplicateID
+	}
+
+	if selectErr != nil {
+		return nil, selectErr
+	}
+
+	if id != "" && uri != "" && signatureIndex == -1 {
+		return nil, ErrSignatureNotFound
+	}
+
+	if id != "" && opts.RequireEnveloped && !enveloped {
+		return nil, ErrNotEnveloped
+	}
+
+	if id != "" && opts.RequireEnveloped && !positioned {
+		return nil, ErrSignatureMisplaced
+	}
+
+	return &split{outer: outer, inner: inner, covered: covered, path: referencedPath, name: referencedName}, nil
+}
+
+// signature describes a ds:Signature in a sequence of tokens.
+type signature struct {
+	index int      // the index of its start tag
+	depth int      // its depth, counting the root element as depth 1
+	uris  []string // the URIs of the ds:References in its ds:SignedInfo
+	value string   // the text directly inside its ds:SignatureValue
+
+	// parent is the index of the ds:Signature that this one is a grandchild of,
+	// by way of one of its ds:Object elements, or -1 if there is none.
+	parent int
+}
+
+// hasURI returns whether s has a ds:Reference with the given URI. A
+// ds:Reference without a URI has the empty URI.
+func (s *signature) hasURI(uri string) bool {
+	for _, u := range s.uris {
+		if u == uri {
+			return true
+		}
+	}
+
+	return false
+}
+
+// selectSignature returns the index of the start of the ds:Signature in tokens
+// that opts selects, as described in the documentation for
+// Options.ReferenceURI and Options.MatchSignatureValue, or -1 if there is none
+// or if every child-of-root ds:Signature is split out.
+func selectSignature(tokens []xml.Token, opts Options) (int, error) {
+	if opts.ID != "" && opts.ReferenceURI == "" {
+		return -1, nil
+	}
+
+	var candidates []signature
+	sigs := findSignatures(tokens)
+	if opts.ID == "" {
+		// enveloped is whether each of sigs is a child of the root element, or is
+		// in a ds:Object of one that is.
+		enveloped := make([]bool, len(sigs))
+		for i, sig := range sigs {
+			enveloped[i] = sig.depth == signatureDepth+1 || sig.parent != -1 && enveloped[sig.parent]
+			if enveloped[i] && sig.hasURI(opts.ReferenceURI) {
+				candidates = append(candidates, sig)
+			}
+		}
+
+		if len(candidates) == 0 {
+			for _, sig := range sigs {
+				if sig.depth == signatureDepth+1 {
+					candidates = append(candidates, sig)
+				}
+			}
+		}
+	} else {
+		for _, sig := range sigs {
+			if sig.hasURI(opts.ReferenceURI) {
+				candidates = append(candidates, sig)
+			}
+		}
+	}
+
+	if opts.MatchSignatureValue != nil {
+		var matched []signature
+		for _, sig := range candidates {
+			if opts.MatchSignatureValue(sig.value) {
+				matched = append(matched, sig)
+			}
+		}
+
+		if len(matched) > 1 {
+			return -1, ErrDuplicateSignature
+		}
+
+		if len(matched) == 1 {
+			candidates = matched
+		}
+	}
+
+	if len(candidates) == 0 {
+		return -1, nil
+	}
+
+	return candidates[0].index, nil
+}
+
+// findSignatures returns every ds:Signature in tokens, in document order.
+// ds:Signature elements inside of other ds:Signature elements, such as a
+// counter-signature in a ds:Object, are included.
+func findSignatures(tokens []xml.Token) []signature {
+	var sigs []signature
+
+	// open holds the indexes into sigs of each ds:Signature that hasn't ended
+	// yet, from the outermost in, and inObject whether each of them is in one of
+	// its ds:Object children.
+	var open []int
+	var inObject []bool
+	inSignedInfo := false
+	inSignatureValue := false
+	stack := stack.Stack{}
+
+	for i, t := range tokens {
+		switch t := t.(type) {
+		case xml.StartElement:
+			stack.Push(DeclaredNamespaces(t))
+
+			resolvedName := xml.Name{
+				Space: stack.Get(t.Name.Space),
+				Local: t.Name.Local,
 			}
 
-			if !inSignature {
-				outer = append(outer, t.Copy())
+			if resolvedName == signatureName {
+				parent := -1
+				if len(open) > 0 && inObject[len(open)-1] && stack.Len() == sigs[open[len(open)-1]].depth+2 {
+					parent = open[len(open)-1]
+				}
+
+				open = append(open, len(sigs))
+				inObject = append(inObject, false)
+				sigs = append(sigs, signature{index: i, depth: stack.Len(), parent: parent})
+				continue
 			}
-		case xml.ProcInst:
-			if inSignedInfo {
-				inner = append(inner, t.Copy())
+
+			if len(open) == 0 {
+				continue
 			}
 
-			if !inSignature {
-				outer = append(outer, t.Copy())
+			current := &sigs[open[len(open)-1]]
+			switch {
+			case stack.Len() == current.depth+1 && resolvedName == signedInfoName:
+				inSignedInfo = true
+			case stack.Len() == current.depth+1 && resolvedName == signatureValueName:
+				inSignatureValue = true
+			case stack.Len() == current.depth+1 && resolvedName == objectName:
+				inObject[len(open)-1] = true
+			case inSignedInfo && stack.Len() == current.depth+2 && resolvedName == referenceName:
+				uri := ""
+				for _, attr := range t.Attr {
+					if attr.Name.Space == "" && attr.Name.Local == "URI" {
+						uri = attr.Value
+					}
+				}
+
+				current.uris = append(current.uris, uri)
+			}
+		case xml.CharData:
+			if inSignatureValue && stack.Len() == sigs[open[len(open)-1]].depth+1 {
+				sigs[open[len(open)-1]].value += string(t)
+			}
+		case xml.EndElement:
+			stack.Pop()
+
+			if len(open) == 0 {
+				continue
 			}
-		case xml.Directive:
-			if inSignedInfo {
-				inner = append(inner, t.Copy())
+
+			current := &sigs[open[len(open)-1]]
+			if stack.Len() == current.depth {
+				inSignedInfo = false
+				inSignatureValue = false
+				inObject[len(open)-1] = false
 			}
 
-			if !inSignature {
-				outer = append(outer, t.Copy())
+			if stack.Len() < current.depth {
+				open = open[:len(open)-1]
+				inObject = inObject[:len(inObject)-1]
 			}
 		}
 	}
 
-	outerReader := bufRawTokenReader(outer)
-	outerBytes, err := c14n.Canonicalize(&outerReader)
-	if err != nil {
-		return nil, nil, err
+	return sigs
+}
+
+// DeclaredNamespaces returns the namespaces declared on t, mapping prefixes to
+// namespace URIs, with the empty prefix being the default namespace.
+//
+// Most elements declare no namespaces, and the document is scanned once per
+// Reference, so the map is only allocated if there is something to put in it.
+// A nil map is empty, and stack.Stack only reads from it.
+func DeclaredNamespaces(t xml.StartElement) map[string]string {
+	var names map[string]string
+	for _, attr := range t.Attr {
+		if attr.Name.Space == "xmlns" || attr.Name.Space == "" && attr.Name.Local == "xmlns" {
+			if names == nil {
+				names = map[string]string{}
+			}
+
+			if attr.Name.Space == "xmlns" {
+				names[attr.Name.Local] = attr.Value
+			} else {
+				names[""] = attr.Value
+			}
+		}
 	}
 
-	innerReader := bufRawTokenReader(inner)
-	innerBytes, err := c14n.Canonicalize(&innerReader)
-	if err != nil {
-		return nil, nil, err
+	return names
+}
+
+// ownXMLAttrs returns the xml:* attributes of t, such as xml:lang.
+func ownXMLAttrs(t xml.StartElement) []xml.Attr {
+	var attrs []xml.Attr
+	for _, attr := range t.Attr {
+		if attr.Name.Space == "xml" {
+			attrs = append(attrs, attr)
+		}
+	}
+
+	return attrs
+}
+
+// inheritXMLAttrs adds to t the xml:* attributes of its ancestors, given as the
+// xml:* attributes of each ancestor from the outermost in. An attribute on a
+// nearer ancestor, or on t itself, wins over one further out.
+//
+// The attributes are added in order of their name, so that the tokens we
+// produce don't depend on map iteration order.
+func inheritXMLAttrs(t *xml.StartElement, ancestors [][]xml.Attr) {
+	inherited := map[string]string{}
+	for _, attrs := range ancestors {
+		for _, attr := range attrs {
+			inherited[attr.Name.Local] = attr.Value
+		}
+	}
+
+	for _, attr := range ownXMLAttrs(*t) {
+		delete(inherited, attr.Name.Local)
+	}
+
+	names := make([]string, 0, len(inherited))
+	for name := range inherited {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		t.Attr = append(t.Attr, xml.Attr{Name: xml.Name{Space: "xml", Local: name}, Value: inherited[name]})
+	}
+}
+
+// InjectNamespaces adds to t a declaration for each namespace in scope, which
+// maps prefixes to namespace URIs, with the empty prefix being the default
+// namespace.
+//
+// Declarations already present on t itself are not injected, so that the
+// element's own declaration wins and we don't produce duplicate attributes.
+//
+// The declarations are injected in order of their prefix, so that the tokens we
+// produce don't depend on map iteration order.
+func InjectNamespaces(t *xml.StartElement, scope map[string]string) {
+	own := map[string]bool{}
+	for _, attr := range t.Attr {
+		if attr.Name.Space == "xmlns" {
+			own[attr.Name.Local] = true
+		} else if attr.Name.Space == "" && attr.Name.Local == "xmlns" {
+			own[""] = true
+		}
+	}
+
+	prefixes := make([]string, 0, len(scope))
+	for k := range scope {
+		if !own[k] {
+			prefixes = append(prefixes, k)
+		}
+	}
+
+	sort.Strings(prefixes)
+
+	for _, k := range prefixes {
+		v := scope[k]
+		if k == "" {
+			t.Attr = append(t.Attr, xml.Attr{
+				Name:  xml.Name{Space: "", Local: "xmlns"},
+				Value: v,
+			})
+		} else {
+			t.Attr = append(t.Attr, xml.Attr{
+				Name:  xml.Name{Space: "xmlns", Local: k},
+				Value: v,
+			})
+		}
+	}
+}
+
+// HasID returns whether t has an ID attribute equal to id. If idAttr is
+// non-zero, it's the only attribute considered an ID attribute, as with
+// Options.IDAttribute. Prefixes are resolved with the namespaces in s. If s is
+// nil, the attributes of t are taken to be resolved already, as they are by
+// xml.Decoder.Token.
+func HasID(t xml.StartElement, id string, idAttr xml.Name, s *stack.Stack) bool {
+	resolve := func(space string) string {
+		if s == nil {
+			return space
+		}
+
+		return s.Get(space)
+	}
+
+	for _, attr := range t.Attr {
+		if attr.Value != id {
+			continue
+		}
+
+		if idAttr != (xml.Name{}) {
+			space := attr.Name.Space
+			if space != "" {
+				space = resolve(space)
+			}
+
+			if space == idAttr.Space && attr.Name.Local == idAttr.Local {
+				return true
+			}
+
+			continue
+		}
+
+		if attr.Name.Space != "" {
+			if resolve(attr.Name.Space) == wsuNamespace && attr.Name.Local == "Id" {
+				return true
+			}
+
+			continue
+		}
+
+		for _, name := range idAttrs {
+			if attr.Name.Local == name {
+				return true
+			}
+		}
 	}
 
-	return outerBytes, innerBytes, nil
+	return false
 }
 
 type bufRawTokenReader []xml.Token
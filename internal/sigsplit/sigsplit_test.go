@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/dsig/internal/canon"
 	"github.com/ucarion/dsig/internal/sigsplit"
 )
 
@@ -60,7 +61,7 @@ func TestSplitSignature(t *testing.T) {
 </xxx:SignedInfo>`
 
 	decoder := xml.NewDecoder(strings.NewReader(s))
-	outer, inner, err := sigsplit.SplitSignature(decoder)
+	outer, inner, err := sigsplit.SplitSignature(decoder, sigsplit.Options{})
 	assert.NoError(t, err)
 	assert.Equal(t, expectedOuter, string(outer))
 	assert.Equal(t, expectedInner, string(inner))
@@ -75,7 +76,7 @@ func TestSplitSignature_UnbalancedOuter(t *testing.T) {
 </Root>
 `))
 
-	_, _, err := sigsplit.SplitSignature(decoder)
+	_, _, err := sigsplit.SplitSignature(decoder, sigsplit.Options{})
 	assert.Equal(t, io.ErrUnexpectedEOF, err)
 }
 
@@ -89,12 +90,12 @@ func TestSplitSignature_UnbalancedInner(t *testing.T) {
 </Root>
 `))
 
-	_, _, err := sigsplit.SplitSignature(decoder)
+	_, _, err := sigsplit.SplitSignature(decoder, sigsplit.Options{})
 	assert.Equal(t, io.ErrUnexpectedEOF, err)
 }
 
 func TestSplitSignature_RawTokenError(t *testing.T) {
-	_, _, err := sigsplit.SplitSignature(&errRawTokener{})
+	_, _, err := sigsplit.SplitSignature(&errRawTokener{}, sigsplit.Options{})
 	assert.Equal(t, errDummy, err)
 }
 
@@ -105,3 +106,689 @@ type errRawTokener struct{}
 func (e *errRawTokener) RawToken() (xml.Token, error) {
 	return nil, errDummy
 }
+
+func TestSplitSignature_SignedInfoRedeclaresPrefix(t *testing.T) {
+	s := `<Root xmlns:foo="http://example.com/outer">
+<xxx:Signature xmlns:xxx="http://www.w3.org/2000/09/xmldsig#">
+<xxx:SignedInfo xmlns:foo="http://example.com/inner" xmlns:xxx="http://www.w3.org/2000/09/xmldsig#">
+<foo:IncludeMe />
+</xxx:SignedInfo>
+</xxx:Signature>
+</Root>`
+
+	expectedInner := `<xxx:SignedInfo xmlns:xxx="http://www.w3.org/2000/09/xmldsig#">
+<foo:IncludeMe xmlns:foo="http://example.com/inner"></foo:IncludeMe>
+</xxx:SignedInfo>`
+
+	decoder := xml.NewDecoder(strings.NewReader(s))
+	_, inner, err := sigsplit.SplitSignature(decoder, sigsplit.Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, expectedInner, string(inner))
+}
+
+func TestSplitSignature_DefaultNamespaceChanges(t *testing.T) {
+	s := `<Root xmlns="http://example.com/a">
+<ds:Signature xmlns="http://example.com/b" xmlns:ds="http://www.w3.org/2000/09/xmldsig#">
+<ds:SignedInfo>
+<IncludeMe />
+</ds:SignedInfo>
+</ds:Signature>
+<Other xmlns="http://example.com/c" />
+</Root>`
+
+	expectedInner := `<ds:SignedInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#">
+<IncludeMe xmlns="http://example.com/b"></IncludeMe>
+</ds:SignedInfo>`
+
+	// Run this a few times, to make sure that the result doesn't depend on map
+	// iteration order.
+	for i := 0; i < 10; i++ {
+		decoder := xml.NewDecoder(strings.NewReader(s))
+		_, inner, err := sigsplit.SplitSignature(decoder, sigsplit.Options{})
+		assert.NoError(t, err)
+		assert.Equal(t, expectedInner, string(inner))
+	}
+}
+
+func TestSplitSignature_InjectedDefaultNamespace(t *testing.T) {
+	type testCase struct {
+		In    string
+		Outer string
+		Inner string
+	}
+
+	sig := `<ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:SignedInfo><IncludeMe /><ds:Reference URI="#foo" /></ds:SignedInfo></ds:Signature>`
+
+	testCases := map[string]testCase{
+		"changed above signature": testCase{
+			In:    `<Root xmlns="urn:a"><Foo ID="foo">x</Foo><Wrapper xmlns="urn:b">` + sig + `</Wrapper></Root>`,
+			Outer: `<Foo xmlns="urn:a" ID="foo">x</Foo>`,
+			Inner: `<ds:SignedInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><IncludeMe xmlns="urn:b"></IncludeMe><ds:Reference URI="#foo"></ds:Reference></ds:SignedInfo>`,
+		},
+		"changed above signed element": testCase{
+			In:    `<Root xmlns="urn:a"><Wrapper xmlns="urn:b"><Foo ID="foo">x</Foo></Wrapper>` + sig + `</Root>`,
+			Outer: `<Foo xmlns="urn:b" ID="foo">x</Foo>`,
+			Inner: `<ds:SignedInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><IncludeMe xmlns="urn:a"></IncludeMe><ds:Reference URI="#foo"></ds:Reference></ds:SignedInfo>`,
+		},
+		"changed on signed element": testCase{
+			In:    `<Root xmlns="urn:a"><Foo xmlns="urn:b" ID="foo">x</Foo>` + sig + `</Root>`,
+			Outer: `<Foo xmlns="urn:b" ID="foo">x</Foo>`,
+			Inner: `<ds:SignedInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><IncludeMe xmlns="urn:a"></IncludeMe><ds:Reference URI="#foo"></ds:Reference></ds:SignedInfo>`,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			decoder := xml.NewDecoder(strings.NewReader(tt.In))
+			outer, inner, err := sigsplit.SplitSignature(decoder, sigsplit.Options{ID: "foo", ReferenceURI: "#foo"})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.Outer, string(outer))
+			assert.Equal(t, tt.Inner, string(inner))
+		})
+	}
+}
+
+func TestSplitSignature_MixedPrefixes(t *testing.T) {
+	s := `<Root xmlns:dsig="http://www.w3.org/2000/09/xmldsig#">
+<ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#">
+<dsig:SignedInfo>
+<ds:SignatureMethod />
+<dsig:Reference />
+</dsig:SignedInfo>
+</ds:Signature>
+</Root>`
+
+	expectedInner := `<dsig:SignedInfo xmlns:dsig="http://www.w3.org/2000/09/xmldsig#">
+<ds:SignatureMethod xmlns:ds="http://www.w3.org/2000/09/xmldsig#"></ds:SignatureMethod>
+<dsig:Reference></dsig:Reference>
+</dsig:SignedInfo>`
+
+	decoder := xml.NewDecoder(strings.NewReader(s))
+	outer, inner, err := sigsplit.SplitSignature(decoder, sigsplit.Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, "<Root>\n\n</Root>", string(outer))
+	assert.Equal(t, expectedInner, string(inner))
+}
+
+// SplitSignature relies on RawToken leaving namespace prefixes unresolved, and
+// resolves them itself using a stack of declarations. If encoding/xml ever
+// started resolving prefixes in RawToken, SplitSignature would resolve them a
+// second time and fail to find ds:Signature. This test pins down the behavior
+// SplitSignature depends on.
+func TestRawTokenNamespaces(t *testing.T) {
+	decoder := xml.NewDecoder(strings.NewReader(`<ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#" xmlns="http://example.com" ds:Id="x" Id="y"><SignedInfo /></ds:Signature>`))
+
+	tok, err := decoder.RawToken()
+	assert.NoError(t, err)
+	assert.Equal(t, xml.StartElement{
+		Name: xml.Name{Space: "ds", Local: "Signature"},
+		Attr: []xml.Attr{
+			xml.Attr{Name: xml.Name{Space: "xmlns", Local: "ds"}, Value: "http://www.w3.org/2000/09/xmldsig#"},
+			xml.Attr{Name: xml.Name{Space: "", Local: "xmlns"}, Value: "http://example.com"},
+			xml.Attr{Name: xml.Name{Space: "ds", Local: "Id"}, Value: "x"},
+			xml.Attr{Name: xml.Name{Space: "", Local: "Id"}, Value: "y"},
+		},
+	}, tok)
+
+	tok, err = decoder.RawToken()
+	assert.NoError(t, err)
+	assert.Equal(t, xml.StartElement{Name: xml.Name{Space: "", Local: "SignedInfo"}, Attr: []xml.Attr{}}, tok)
+
+	tok, err = decoder.RawToken()
+	assert.NoError(t, err)
+	assert.Equal(t, xml.EndElement{Name: xml.Name{Space: "", Local: "SignedInfo"}}, tok)
+
+	tok, err = decoder.RawToken()
+	assert.NoError(t, err)
+	assert.Equal(t, xml.EndElement{Name: xml.Name{Space: "ds", Local: "Signature"}}, tok)
+}
+
+func TestCanonicalizeOuter(t *testing.T) {
+	type testCase struct {
+		In  string
+		Out string
+	}
+
+	testCases := map[string]testCase{
+		"with signature": testCase{
+			In:  `<root><ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:SignedInfo /></ds:Signature><foo /></root>`,
+			Out: `<root><foo></foo></root>`,
+		},
+		"without signature": testCase{
+			In:  `<root><foo /></root>`,
+			Out: `<root><foo></foo></root>`,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			out, err := sigsplit.CanonicalizeOuter(xml.NewDecoder(strings.NewReader(tt.In)), canon.Options{})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.Out, string(out))
+		})
+	}
+}
+
+func TestSplitSignature_ContentOutsideRoot(t *testing.T) {
+	expectedOuter := `<Root><Foo></Foo></Root>`
+	expectedInner := `<ds:SignedInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#"></ds:SignedInfo>`
+
+	type testCase struct {
+		Before string
+		After  string
+	}
+
+	testCases := map[string]testCase{
+		"none":                testCase{Before: "", After: ""},
+		"trailing newline":    testCase{Before: "", After: "\n"},
+		"trailing crlf":       testCase{Before: "", After: "\r\n\r\n"},
+		"trailing comment":    testCase{Before: "", After: "\n<!-- foo -->\n"},
+		"trailing procinst":   testCase{Before: "", After: "\n<?foo bar?>\n"},
+		"leading declaration": testCase{Before: "<?xml version=\"1.0\"?>\n", After: "\n"},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			s := tt.Before + `<Root><Foo /><ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:SignedInfo /></ds:Signature></Root>` + tt.After
+
+			decoder := xml.NewDecoder(strings.NewReader(s))
+			outer, inner, err := sigsplit.SplitSignature(decoder, sigsplit.Options{})
+			assert.NoError(t, err)
+			assert.Equal(t, expectedOuter, string(outer))
+			assert.Equal(t, expectedInner, string(inner))
+		})
+	}
+}
+
+func TestSplitSignature_ID(t *testing.T) {
+	s := `<Root xmlns:a="http://example.com/a" xmlns:unused="http://example.com/unused">
+<ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:SignedInfo /></ds:Signature>
+<Parent>
+<a:Signed ID="foo"><a:Child Id="not-foo" /></a:Signed>
+</Parent>
+<Other />
+</Root>`
+
+	decoder := xml.NewDecoder(strings.NewReader(s))
+	outer, _, err := sigsplit.SplitSignature(decoder, sigsplit.Options{ID: "foo"})
+	assert.NoError(t, err)
+	assert.Equal(t, `<a:Signed xmlns:a="http://example.com/a" ID="foo"><a:Child Id="not-foo"></a:Child></a:Signed>`, string(outer))
+}
+
+func TestSplitSignature_IDPrefixedAttribute(t *testing.T) {
+	s := `<Root xmlns:xlink="http://www.w3.org/1999/xlink" xmlns:unused="http://example.com/unused">
+<ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:SignedInfo /></ds:Signature>
+<Signed ID="foo"><Link xlink:href="http://example.com" /></Signed>
+</Root>`
+
+	decoder := xml.NewDecoder(strings.NewReader(s))
+	outer, _, err := sigsplit.SplitSignature(decoder, sigsplit.Options{ID: "foo"})
+	assert.NoError(t, err)
+	assert.Equal(t, `<Signed ID="foo"><Link xmlns:xlink="http://www.w3.org/1999/xlink" xlink:href="http://example.com"></Link></Signed>`, string(outer))
+}
+
+func TestSplitSignature_IDAttribute(t *testing.T) {
+	type testCase struct {
+		In          string
+		IDAttribute xml.Name
+		Outer       string
+		Err         error
+	}
+
+	wsu := "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd"
+	sig := `<ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:SignedInfo /></ds:Signature>`
+
+	testCases := map[string]testCase{
+		"default attributes": testCase{
+			In:  `<Root><A ID="foo" /><B Id="foo" />` + sig + `</Root>`,
+			Err: sigsplit.ErrDuplicateID,
+		},
+		"only ID": testCase{
+			In:          `<Root><A ID="foo" /><B Id="foo" />` + sig + `</Root>`,
+			IDAttribute: xml.Name{Local: "ID"},
+			Outer:       `<A ID="foo"></A>`,
+		},
+		"custom attribute": testCase{
+			In:          `<Root><A AssertionID="foo" /><B ID="foo" />` + sig + `</Root>`,
+			IDAttribute: xml.Name{Local: "AssertionID"},
+			Outer:       `<A AssertionID="foo"></A>`,
+		},
+		"not found": testCase{
+			In:          `<Root><A Id="foo" />` + sig + `</Root>`,
+			IDAttribute: xml.Name{Local: "ID"},
+			Err:         sigsplit.ErrIDNotFound,
+		},
+		"namespaced attribute": testCase{
+			In:          `<Root xmlns:u="` + wsu + `"><A ID="foo" /><B u:Id="foo" />` + sig + `</Root>`,
+			IDAttribute: xml.Name{Space: wsu, Local: "Id"},
+			Outer:       `<B xmlns:u="` + wsu + `" u:Id="foo"></B>`,
+		},
+		"unprefixed attribute isn't namespaced": testCase{
+			In:          `<Root><B Id="foo" />` + sig + `</Root>`,
+			IDAttribute: xml.Name{Space: wsu, Local: "Id"},
+			Err:         sigsplit.ErrIDNotFound,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			decoder := xml.NewDecoder(strings.NewReader(tt.In))
+			outer, _, err := sigsplit.SplitSignature(decoder, sigsplit.Options{ID: "foo", IDAttribute: tt.IDAttribute})
+			assert.Equal(t, tt.Err, err)
+			assert.Equal(t, tt.Outer, string(outer))
+		})
+	}
+}
+
+func TestSplitSignature_DefaultNamespaceReset(t *testing.T) {
+	type testCase struct {
+		In    string
+		ID    string
+		Outer string
+	}
+
+	sig := `<ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:SignedInfo /></ds:Signature>`
+
+	testCases := map[string]testCase{
+		"whole document": testCase{
+			In:    `<Root xmlns="urn:a"><Foo><Bar xmlns="">x</Bar></Foo>` + sig + `</Root>`,
+			Outer: `<Root xmlns="urn:a"><Foo><Bar xmlns="">x</Bar></Foo></Root>`,
+		},
+		"reset inside referenced element": testCase{
+			In:    `<Root xmlns="urn:a"><Foo ID="foo"><Bar xmlns="">x</Bar></Foo>` + sig + `</Root>`,
+			ID:    "foo",
+			Outer: `<Foo xmlns="urn:a" ID="foo"><Bar xmlns="">x</Bar></Foo>`,
+		},
+		"reset above referenced element": testCase{
+			In:    `<Root xmlns="urn:a"><Wrapper xmlns=""><Foo ID="foo"><Bar>x</Bar></Foo></Wrapper>` + sig + `</Root>`,
+			ID:    "foo",
+			Outer: `<Foo ID="foo"><Bar>x</Bar></Foo>`,
+		},
+		"reset and redeclared": testCase{
+			In:    `<Root xmlns="urn:a"><Foo ID="foo"><Bar xmlns=""><Baz xmlns="urn:a">x</Baz></Bar></Foo>` + sig + `</Root>`,
+			ID:    "foo",
+			Outer: `<Foo xmlns="urn:a" ID="foo"><Bar xmlns=""><Baz xmlns="urn:a">x</Baz></Bar></Foo>`,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			decoder := xml.NewDecoder(strings.NewReader(tt.In))
+			outer, _, err := sigsplit.SplitSignature(decoder, sigsplit.Options{ID: tt.ID})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.Outer, string(outer))
+		})
+	}
+}
+
+func TestSplitSignature_IDEnveloped(t *testing.T) {
+	s := `<Root Id="foo"><Foo /><ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:SignedInfo /></ds:Signature></Root>`
+
+	decoder := xml.NewDecoder(strings.NewReader(s))
+	outer, _, err := sigsplit.SplitSignature(decoder, sigsplit.Options{ID: "foo"})
+	assert.NoError(t, err)
+	assert.Equal(t, `<Root Id="foo"><Foo></Foo></Root>`, string(outer))
+}
+
+func TestSplitSignature_IDEnveloping(t *testing.T) {
+	s := `<ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:SignedInfo><ds:Reference URI="#obj" /></ds:SignedInfo><ds:SignatureValue /><ds:Object Id="obj"><Foo>xxx</Foo></ds:Object></ds:Signature>`
+
+	decoder := xml.NewDecoder(strings.NewReader(s))
+	outer, inner, err := sigsplit.SplitSignature(decoder, sigsplit.Options{ID: "obj", ReferenceURI: "#obj"})
+	assert.NoError(t, err)
+	assert.Equal(t, `<ds:Object xmlns:ds="http://www.w3.org/2000/09/xmldsig#" Id="obj"><Foo>xxx</Foo></ds:Object>`, string(outer))
+	assert.Equal(t, `<ds:SignedInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:Reference URI="#obj"></ds:Reference></ds:SignedInfo>`, string(inner))
+}
+
+func TestSplitSignature_IDErrors(t *testing.T) {
+	type testCase struct {
+		In  string
+		Err error
+	}
+
+	testCases := map[string]testCase{
+		"not found": testCase{
+			In:  `<Root><Foo ID="bar" /></Root>`,
+			Err: sigsplit.ErrIDNotFound,
+		},
+		"qualified attribute": testCase{
+			In:  `<Root xmlns:x="http://example.com"><Foo x:ID="foo" /></Root>`,
+			Err: sigsplit.ErrIDNotFound,
+		},
+		"duplicate": testCase{
+			In:  `<Root><Foo ID="foo" /><Bar id="foo" /></Root>`,
+			Err: sigsplit.ErrDuplicateID,
+		},
+		"duplicate nested": testCase{
+			In:  `<Root ID="foo"><Foo ID="foo" /></Root>`,
+			Err: sigsplit.ErrDuplicateID,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			decoder := xml.NewDecoder(strings.NewReader(tt.In))
+			_, _, err := sigsplit.SplitSignature(decoder, sigsplit.Options{ID: "foo"})
+			assert.Equal(t, tt.Err, err)
+		})
+	}
+}
+
+func TestSplitSignature_RequireFullCoverage(t *testing.T) {
+	type testCase struct {
+		In  string
+		ID  string
+		Err error
+	}
+
+	signature := `<ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:SignedInfo /></ds:Signature>`
+
+	testCases := map[string]testCase{
+		"no id":           testCase{In: `<Root><Foo />SIG</Root>`, ID: "", Err: nil},
+		"id on root":      testCase{In: `<Root ID="foo"><Foo />SIG</Root>`, ID: "foo", Err: nil},
+		"id on child":     testCase{In: `<Root><Foo ID="foo" />SIG</Root>`, ID: "foo", Err: sigsplit.ErrUncoveredContent},
+		"trailing spaces": testCase{In: "<Root ID=\"foo\">SIG</Root>\n\n", ID: "foo", Err: nil},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			decoder := xml.NewDecoder(strings.NewReader(strings.Replace(tt.In, "SIG", signature, 1)))
+			_, _, err := sigsplit.SplitSignature(decoder, sigsplit.Options{ID: tt.ID, RequireFullCoverage: true})
+			assert.Equal(t, tt.Err, err)
+		})
+	}
+}
+
+func TestSplitSignature_RequireEnveloped(t *testing.T) {
+	type testCase struct {
+		In   string
+		ID   string
+		Path []string
+		Err  error
+	}
+
+	// SIG is an enveloped signature, and OBJ an enveloping one whose ds:Object
+	// has the ID.
+	replacer := strings.NewReplacer(
+		"SIG", `<ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:SignedInfo><ds:Reference URI="#foo" /></ds:SignedInfo></ds:Signature>`,
+		"OBJ", `<ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:SignedInfo><ds:Reference URI="#foo" /></ds:SignedInfo><ds:Object ID="foo" /></ds:Signature>`,
+	)
+
+	testCases := map[string]testCase{
+		"no id":                testCase{In: `<Root><Foo />SIG</Root>`, ID: "", Path: []string{"Root"}},
+		"id on root":           testCase{In: `<Root ID="foo"><Foo />SIG</Root>`, ID: "foo", Path: []string{"Root"}},
+		"id on parent":         testCase{In: `<Root><Foo ID="foo">SIG</Foo></Root>`, ID: "foo", Path: []string{"Root", "Foo"}},
+		"id on sibling":        testCase{In: `<Root><Foo ID="foo" />SIG</Root>`, ID: "foo", Err: sigsplit.ErrNotEnveloped},
+		"id after":             testCase{In: `<Root>SIG<Foo ID="foo" /></Root>`, ID: "foo", Err: sigsplit.ErrNotEnveloped},
+		"id on cousin":         testCase{In: `<Root><Foo>SIG</Foo><Bar><Baz ID="foo" /></Bar></Root>`, ID: "foo", Err: sigsplit.ErrNotEnveloped},
+		"nested in referenced": testCase{In: `<Root ID="foo"><Foo>SIG</Foo></Root>`, ID: "foo", Err: sigsplit.ErrSignatureMisplaced},
+		"enveloping root":      testCase{In: `OBJ`, ID: "foo", Path: []string{"Signature", "Object"}},
+		"enveloping child":     testCase{In: `<Root>OBJ</Root>`, ID: "foo", Path: []string{"Root", "Signature", "Object"}},
+		"enveloping nested":    testCase{In: `<Root><Foo>OBJ</Foo></Root>`, ID: "foo", Err: sigsplit.ErrSignatureMisplaced},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			decoder := xml.NewDecoder(strings.NewReader(replacer.Replace(tt.In)))
+			result, err := sigsplit.Split(decoder, sigsplit.Options{ID: tt.ID, ReferenceURI: "#foo", RequireEnveloped: true})
+			assert.Equal(t, tt.Err, err)
+
+			if err == nil {
+				assert.Equal(t, tt.Path, result.Path)
+			}
+		})
+	}
+}
+
+func TestSplitSignature_ReferenceURI(t *testing.T) {
+	type testCase struct {
+		In    string
+		Outer string
+		Inner string
+		Err   error
+	}
+
+	sig := func(uri, value string) string {
+		return `<ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:SignedInfo><ds:Reference URI="` + uri + `">` + value + `</ds:Reference></ds:SignedInfo></ds:Signature>`
+	}
+
+	testCases := map[string]testCase{
+		"before referenced element": testCase{
+			In:    `<Root><Header>` + sig("#foo", "a") + `</Header><Body ID="foo">x</Body></Root>`,
+			Outer: `<Body ID="foo">x</Body>`,
+			Inner: `<ds:SignedInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:Reference URI="#foo">a</ds:Reference></ds:SignedInfo>`,
+		},
+		"after referenced element": testCase{
+			In:    `<Root><Body ID="foo">x</Body><Trailer>` + sig("#foo", "a") + `</Trailer></Root>`,
+			Outer: `<Body ID="foo">x</Body>`,
+			Inner: `<ds:SignedInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:Reference URI="#foo">a</ds:Reference></ds:SignedInfo>`,
+		},
+		"chosen by uri": testCase{
+			In:    `<Root>` + sig("#bar", "a") + `<Header>` + sig("#foo", "b") + `</Header><Body ID="foo">x</Body></Root>`,
+			Outer: `<Body ID="foo">x</Body>`,
+			Inner: `<ds:SignedInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:Reference URI="#foo">b</ds:Reference></ds:SignedInfo>`,
+		},
+		"other signatures are digested": testCase{
+			In:    `<Root ID="foo">` + sig("#foo", "a") + `<Child>` + sig("#foo", "b") + `</Child></Root>`,
+			Outer: `<Root ID="foo"><Child>` + sig("#foo", "b") + `</Child></Root>`,
+			Inner: `<ds:SignedInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:Reference URI="#foo">a</ds:Reference></ds:SignedInfo>`,
+		},
+		"wsu id": testCase{
+			In:    `<Root xmlns:wsu="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd">` + sig("#foo", "a") + `<Body wsu:Id="foo">x</Body></Root>`,
+			Outer: `<Body xmlns:wsu="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd" wsu:Id="foo">x</Body>`,
+			Inner: `<ds:SignedInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:Reference URI="#foo">a</ds:Reference></ds:SignedInfo>`,
+		},
+		"counter-signature": testCase{
+			In:    `<Root><ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:SignedInfo><ds:Reference URI="">a</ds:Reference></ds:SignedInfo><ds:SignatureValue Id="foo">x</ds:SignatureValue><ds:Object>` + sig("#foo", "b") + `</ds:Object></ds:Signature></Root>`,
+			Outer: `<ds:SignatureValue xmlns:ds="http://www.w3.org/2000/09/xmldsig#" Id="foo">x</ds:SignatureValue>`,
+			Inner: `<ds:SignedInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:Reference URI="#foo">b</ds:Reference></ds:SignedInfo>`,
+		},
+		"no matching signature": testCase{
+			In:  `<Root>` + sig("#bar", "a") + `<Body ID="foo">x</Body></Root>`,
+			Err: sigsplit.ErrSignatureNotFound,
+		},
+		"id not found takes precedence": testCase{
+			In:  `<Root>` + sig("#bar", "a") + `<Body>x</Body></Root>`,
+			Err: sigsplit.ErrIDNotFound,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			decoder := xml.NewDecoder(strings.NewReader(tt.In))
+			outer, inner, err := sigsplit.SplitSignature(decoder, sigsplit.Options{ID: "foo", ReferenceURI: "#foo"})
+			assert.Equal(t, tt.Err, err)
+			assert.Equal(t, tt.Outer, string(outer))
+			assert.Equal(t, tt.Inner, string(inner))
+		})
+	}
+}
+
+func TestSplitSignature_MatchSignatureValue(t *testing.T) {
+	type testCase struct {
+		In    string
+		ID    string
+		URI   string
+		Outer string
+		Inner string
+		Err   error
+	}
+
+	sig := func(uri, value string) string {
+		return `<ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:SignedInfo><ds:Reference URI="` + uri + `"></ds:Reference></ds:SignedInfo><ds:SignatureValue>` + value + `</ds:SignatureValue></ds:Signature>`
+	}
+
+	testCases := map[string]testCase{
+		"chosen by value": testCase{
+			In:    `<Root>` + sig("", "a") + sig("", "b") + `</Root>`,
+			Outer: `<Root>` + sig("", "a") + `</Root>`,
+			Inner: `<ds:SignedInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:Reference URI=""></ds:Reference></ds:SignedInfo>`,
+		},
+		"no match falls back to first": testCase{
+			In:    `<Root>` + sig("", "a") + sig("", "c") + `</Root>`,
+			Outer: `<Root>` + sig("", "c") + `</Root>`,
+			Inner: `<ds:SignedInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:Reference URI=""></ds:Reference></ds:SignedInfo>`,
+		},
+		"duplicate enveloped signature": testCase{
+			In:  `<Root>` + sig("", "b") + sig("", "b") + `</Root>`,
+			Err: sigsplit.ErrDuplicateSignature,
+		},
+		"value split up by a comment": testCase{
+			In:    `<Root>` + sig("", "<!-- x -->b") + `</Root>`,
+			Outer: `<Root></Root>`,
+			Inner: `<ds:SignedInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:Reference URI=""></ds:Reference></ds:SignedInfo>`,
+		},
+		"co-signature": testCase{
+			In:    `<Root>` + strings.Replace(sig("", "a"), `</ds:Signature>`, `<ds:Object>`+sig("", "b")+`</ds:Object></ds:Signature>`, 1) + `</Root>`,
+			Outer: `<Root>` + strings.Replace(sig("", "a"), `</ds:Signature>`, `<ds:Object></ds:Object></ds:Signature>`, 1) + `</Root>`,
+			Inner: `<ds:SignedInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:Reference URI=""></ds:Reference></ds:SignedInfo>`,
+		},
+		"signature nested elsewhere": testCase{
+			In:    `<Root>` + sig("", "a") + `<Foo>` + sig("", "b") + `</Foo></Root>`,
+			Outer: `<Root><Foo>` + sig("", "b") + `</Foo></Root>`,
+			Inner: `<ds:SignedInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:Reference URI=""></ds:Reference></ds:SignedInfo>`,
+		},
+		// The signature is over #a, and is inside of it. A copy of it added to
+		// the root would otherwise be found first, leaving the original to be
+		// digested as part of #a, rather than removed from it.
+		"copy outside referenced element": testCase{
+			In:  `<Root><A ID="a">x` + sig("#a", "b") + `</A>` + sig("#a", "b") + `</Root>`,
+			ID:  "a",
+			URI: "#a",
+			Err: sigsplit.ErrDuplicateSignature,
+		},
+		"copy with another value": testCase{
+			In:    `<Root><A ID="a">x` + sig("#a", "b") + `</A>` + sig("#a", "a") + `</Root>`,
+			ID:    "a",
+			URI:   "#a",
+			Outer: `<A ID="a">x</A>`,
+			Inner: `<ds:SignedInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:Reference URI="#a"></ds:Reference></ds:SignedInfo>`,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			decoder := xml.NewDecoder(strings.NewReader(tt.In))
+			outer, inner, err := sigsplit.SplitSignature(decoder, sigsplit.Options{
+				ID:                  tt.ID,
+				ReferenceURI:        tt.URI,
+				MatchSignatureValue: func(value string) bool { return value == "b" },
+			})
+
+			assert.Equal(t, tt.Err, err)
+			assert.Equal(t, tt.Outer, string(outer))
+			assert.Equal(t, tt.Inner, string(inner))
+		})
+	}
+}
+
+func TestSplitSignature_Enveloped(t *testing.T) {
+	type testCase struct {
+		In    string
+		Outer string
+		Inner string
+	}
+
+	sig := func(uri, value string) string {
+		return `<ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:SignedInfo><ds:Reference URI="` + uri + `">` + value + `</ds:Reference></ds:SignedInfo></ds:Signature>`
+	}
+
+	testCases := map[string]testCase{
+		"other child-of-root signature is digested": testCase{
+			In:    `<Root><Body ID="foo">x</Body>` + sig("#foo", "a") + sig("", "b") + `</Root>`,
+			Outer: `<Root><Body ID="foo">x</Body>` + sig("#foo", "a") + `</Root>`,
+			Inner: `<ds:SignedInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:Reference URI="">b</ds:Reference></ds:SignedInfo>`,
+		},
+		"first matching signature is split out": testCase{
+			In:    `<Root>` + sig("", "a") + sig("", "b") + `</Root>`,
+			Outer: `<Root>` + sig("", "b") + `</Root>`,
+			Inner: `<ds:SignedInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:Reference URI="">a</ds:Reference></ds:SignedInfo>`,
+		},
+		"reference without uri": testCase{
+			In:    `<Root><ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:SignedInfo><ds:Reference>a</ds:Reference></ds:SignedInfo></ds:Signature></Root>`,
+			Outer: `<Root></Root>`,
+			Inner: `<ds:SignedInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:Reference>a</ds:Reference></ds:SignedInfo>`,
+		},
+		"no matching signature": testCase{
+			In:    `<Root>` + sig("#foo", "a") + sig("#bar", "b") + `</Root>`,
+			Outer: `<Root>` + sig("#bar", "b") + `</Root>`,
+			Inner: `<ds:SignedInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:Reference URI="#foo">a</ds:Reference></ds:SignedInfo>`,
+		},
+		"nested signature is digested": testCase{
+			In:    `<Root><Child>` + sig("", "a") + `</Child>` + sig("", "b") + `</Root>`,
+			Outer: `<Root><Child>` + sig("", "a") + `</Child></Root>`,
+			Inner: `<ds:SignedInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:Reference URI="">b</ds:Reference></ds:SignedInfo>`,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			decoder := xml.NewDecoder(strings.NewReader(tt.In))
+			outer, inner, err := sigsplit.SplitSignature(decoder, sigsplit.Options{})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.Outer, string(outer))
+			assert.Equal(t, tt.Inner, string(inner))
+		})
+	}
+}
+
+func TestSplitSignature_DigestValue(t *testing.T) {
+	in := `<Root><ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:SignedInfo><ds:Reference URI=""><ds:DigestValue>old<!-- comment --><x>old</x></ds:DigestValue></ds:Reference></ds:SignedInfo><ds:DigestValue>kept</ds:DigestValue></ds:Signature></Root>`
+
+	outer, inner, err := sigsplit.SplitSignature(xml.NewDecoder(strings.NewReader(in)), sigsplit.Options{DigestValues: []string{"new"}})
+	assert.NoError(t, err)
+	assert.Equal(t, `<Root></Root>`, string(outer))
+	assert.Equal(t, `<ds:SignedInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:Reference URI=""><ds:DigestValue>new</ds:DigestValue></ds:Reference></ds:SignedInfo>`, string(inner))
+
+	// An empty DigestValue is filled in too.
+	in = strings.Replace(in, `old<!-- comment --><x>old</x>`, "", 1)
+	_, inner, err = sigsplit.SplitSignature(xml.NewDecoder(strings.NewReader(in)), sigsplit.Options{DigestValues: []string{"new"}})
+	assert.NoError(t, err)
+	assert.Equal(t, `<ds:SignedInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:Reference URI=""><ds:DigestValue>new</ds:DigestValue></ds:Reference></ds:SignedInfo>`, string(inner))
+}
+
+func TestSplitSignature_DigestValues(t *testing.T) {
+	in := `<Root><ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:SignedInfo><ds:Reference URI="#a"><ds:DigestValue>old</ds:DigestValue></ds:Reference><ds:Reference URI="#b"><ds:DigestValue>old</ds:DigestValue></ds:Reference><ds:Reference URI="#c"><ds:DigestValue>old</ds:DigestValue></ds:Reference></ds:SignedInfo></ds:Signature></Root>`
+
+	// References without a corresponding DigestValue are left alone.
+	_, inner, err := sigsplit.SplitSignature(xml.NewDecoder(strings.NewReader(in)), sigsplit.Options{DigestValues: []string{"new-a", "new-b"}})
+	assert.NoError(t, err)
+	assert.Equal(t, `<ds:SignedInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:Reference URI="#a"><ds:DigestValue>new-a</ds:DigestValue></ds:Reference><ds:Reference URI="#b"><ds:DigestValue>new-b</ds:DigestValue></ds:Reference><ds:Reference URI="#c"><ds:DigestValue>old</ds:DigestValue></ds:Reference></ds:SignedInfo>`, string(inner))
+}
+
+func TestSplitSignature_Inclusive(t *testing.T) {
+	in := `<Root xmlns:a="urn:a" xml:lang="en" xml:space="preserve"><Outer xml:lang="fr"><A ID="foo" xml:space="default"><B /></A></Outer><ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:SignedInfo></ds:SignedInfo></ds:Signature></Root>`
+
+	type testCase struct {
+		Inclusive bool
+		Outer     string
+		Inner     string
+	}
+
+	testCases := map[string]testCase{
+		"exclusive": testCase{
+			Inclusive: false,
+			Outer:     `<A ID="foo" xml:space="default"><B></B></A>`,
+			Inner:     `<ds:SignedInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#"></ds:SignedInfo>`,
+		},
+		"inclusive": testCase{
+			Inclusive: true,
+			Outer:     `<A xmlns:a="urn:a" ID="foo" xml:lang="fr" xml:space="default"><B></B></A>`,
+			Inner:     `<ds:SignedInfo xmlns:a="urn:a" xmlns:ds="http://www.w3.org/2000/09/xmldsig#" xml:lang="en" xml:space="preserve"></ds:SignedInfo>`,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			outer, inner, err := sigsplit.SplitSignature(xml.NewDecoder(strings.NewReader(in)), sigsplit.Options{
+				Outer: canon.Options{Inclusive: tt.Inclusive},
+				Inner: canon.Options{Inclusive: tt.Inclusive},
+				ID:    "foo",
+			})
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.Outer, string(outer))
+			assert.Equal(t, tt.Inner, string(inner))
+		})
+	}
+}
@@ -23,11 +23,33 @@ func (s *Stack) Len() int {
 // Definitions closer to the top of the stack take predence over values further
 // from the top.
 func (s *Stack) Get(k string) string {
+	v, _ := s.Lookup(k)
+	return v
+}
+
+// Lookup is like Get, but additionally returns whether the name was found at
+// all. This distinguishes a name that was declared as the empty string (as in
+// xmlns="") from a name that was never declared.
+func (s *Stack) Lookup(k string) (string, bool) {
 	for i := len(*s) - 1; i >= 0; i-- {
 		if v, ok := (*s)[i][k]; ok {
-			return v
+			return v, true
+		}
+	}
+
+	return "", false
+}
+
+// InScope returns all of the names in the stack, mapped to the URI that is in
+// scope for them. As with Get, definitions closer to the top of the stack take
+// precedence over values further from the top.
+func (s *Stack) InScope() map[string]string {
+	names := map[string]string{}
+	for _, m := range *s {
+		for k, v := range m {
+			names[k] = v
 		}
 	}
 
-	return ""
+	return names
 }
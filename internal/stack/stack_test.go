@@ -28,3 +28,24 @@ func TestStack(t *testing.T) {
 	assert.Equal(t, "", s.Get("foo"))
 	assert.Equal(t, 0, s.Len())
 }
+
+func TestStack_InScope(t *testing.T) {
+	var s stack.Stack
+	assert.Equal(t, map[string]string{}, s.InScope())
+
+	s.Push(map[string]string{"": "a", "foo": "bar"})
+	s.Push(map[string]string{"": "b"})
+	s.Push(map[string]string{"baz": "quux"})
+	assert.Equal(t, map[string]string{"": "b", "foo": "bar", "baz": "quux"}, s.InScope())
+}
+
+func TestStack_Lookup(t *testing.T) {
+	var s stack.Stack
+	_, ok := s.Lookup("")
+	assert.False(t, ok)
+
+	s.Push(map[string]string{"": ""})
+	v, ok := s.Lookup("")
+	assert.Equal(t, "", v)
+	assert.True(t, ok)
+}
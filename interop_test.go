@@ -0,0 +1,186 @@
+package dsig_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/dsig"
+)
+
+// The documents in testdata/interop are shaped like those of other systems that
+// use XML signatures, with their identifying details replaced. They are signed
+// with goldenKey, and their digests and signature values agree with those
+// computed from xmllint's canonicalization of them.
+
+func TestInterop_CDA(t *testing.T) {
+	// An HL7 CDA R2 clinical document. Its ds:Signature is in the
+	// sdtc:signatureText of the legal authenticator, rather than a child of the
+	// ClinicalDocument it signs, and so it needs AllowArbitraryReferences. The
+	// caller then checks that what was signed is the root ClinicalDocument.
+	//
+	// xsi:type="hl7:CD" uses the hl7 prefix only in an attribute value, which
+	// Exclusive Canonical XML doesn't count as visibly utilized. The signature's
+	// PrefixList keeps the declaration in the signed data.
+	doc, err := ioutil.ReadFile(filepath.Join("testdata", "interop", "cda.xml"))
+	assert.NoError(t, err)
+
+	type testCase struct {
+		doc  string
+		opts dsig.VerifyOptions
+		err  error
+	}
+
+	testCases := map[string]testCase{
+		"ok": testCase{
+			doc:  string(doc),
+			opts: dsig.VerifyOptions{AllowArbitraryReferences: true},
+		},
+		"signature not a child of the signed element": testCase{
+			doc: string(doc),
+			err: dsig.ErrSignatureMisplaced,
+		},
+		"tampered observation": testCase{
+			doc:  strings.Replace(string(doc), `displayName="Rash"`, `displayName="Fever"`, 1),
+			opts: dsig.VerifyOptions{AllowArbitraryReferences: true},
+			err:  dsig.ErrBadDigest,
+		},
+		"tampered xsi:type namespace": testCase{
+			doc:  strings.Replace(string(doc), `xmlns:hl7="urn:hl7-org:v3"`, `xmlns:hl7="urn:evil"`, 1),
+			opts: dsig.VerifyOptions{AllowArbitraryReferences: true},
+			err:  dsig.ErrBadDigest,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var clinicalDocument struct {
+				Signature dsig.Signature `xml:"legalAuthenticator>signatureText>Signature"`
+			}
+
+			assert.NoError(t, xml.Unmarshal([]byte(tt.doc), &clinicalDocument))
+
+			result, err := clinicalDocument.Signature.VerifyWithResult(goldenCert, xml.NewDecoder(strings.NewReader(tt.doc)), tt.opts)
+			assert.Equal(t, tt.err, err)
+
+			if tt.err == nil {
+				assert.Equal(t, []dsig.ReferencedElement{{
+					URI:          "#cda",
+					Path:         "ClinicalDocument",
+					Name:         xml.Name{Space: "urn:hl7-org:v3", Local: "ClinicalDocument"},
+					DigestMethod: dsig.DigestMethodAlgorithmSHA256,
+					Digest:       referenceDigest(t, clinicalDocument.Signature.SignedInfo.References[0]),
+				}}, result.ReferencedElements)
+
+				assert.True(t, bytes.HasPrefix(result.SignedData, []byte(`<ClinicalDocument xmlns="urn:hl7-org:v3" xmlns:hl7="urn:hl7-org:v3" ID="cda">`)))
+				assert.NotContains(t, string(result.SignedData), "Signature")
+			}
+		})
+	}
+}
+
+func TestInterop_SIIDTE(t *testing.T) {
+	// A Chilean SII electronic tax document. It is encoded in ISO-8859-1, and
+	// has two RSA-SHA1 signatures: one over the Documento, by its ID attribute,
+	// and one over the SetDTE that contains the Documento and its signature.
+	// Each ds:Signature is a sibling of the element it signs, and so needs
+	// AllowArbitraryReferences.
+	//
+	// Neither Reference has any transforms, and so the data they refer to is
+	// canonicalized with Canonical XML 1.0. That gives the Documento and SetDTE
+	// the xsi namespace declared on the root EnvioDTE.
+	doc, err := ioutil.ReadFile(filepath.Join("testdata", "interop", "sii_dte.xml"))
+	assert.NoError(t, err)
+
+	type testCase struct {
+		doc          string
+		opts         dsig.VerifyOptions
+		documentoErr error
+		setDTEErr    error
+	}
+
+	testCases := map[string]testCase{
+		"ok": testCase{
+			doc:  string(doc),
+			opts: dsig.VerifyOptions{AllowArbitraryReferences: true},
+		},
+		"signatures not in the signed elements": testCase{
+			doc:          string(doc),
+			documentoErr: dsig.ErrReferenceNotEnveloping,
+			setDTEErr:    dsig.ErrReferenceNotEnveloping,
+		},
+		"tampered documento": testCase{
+			doc:          strings.Replace(string(doc), "<MntTotal>11900</MntTotal>", "<MntTotal>1190</MntTotal>", 1),
+			opts:         dsig.VerifyOptions{AllowArbitraryReferences: true},
+			documentoErr: dsig.ErrBadDigest,
+			setDTEErr:    dsig.ErrBadDigest,
+		},
+		"tampered latin-1 text": testCase{
+			doc:          strings.Replace(string(doc), "\xd1u\xf1oa", "Nunoa", 1),
+			opts:         dsig.VerifyOptions{AllowArbitraryReferences: true},
+			documentoErr: dsig.ErrBadDigest,
+			setDTEErr:    dsig.ErrBadDigest,
+		},
+		"tampered caratula": testCase{
+			doc:       strings.Replace(string(doc), "<NroResol>80</NroResol>", "<NroResol>0</NroResol>", 1),
+			opts:      dsig.VerifyOptions{AllowArbitraryReferences: true},
+			setDTEErr: dsig.ErrBadDigest,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			newDecoder := func() *xml.Decoder {
+				return dsig.NewDecoderWithOptions(strings.NewReader(tt.doc), dsig.DecoderOptions{CharsetReader: latin1Reader})
+			}
+
+			var envioDTE struct {
+				RznSoc    string         `xml:"SetDTE>DTE>Documento>Encabezado>Emisor>RznSoc"`
+				Documento dsig.Signature `xml:"SetDTE>DTE>Signature"`
+				SetDTE    dsig.Signature `xml:"Signature"`
+			}
+
+			assert.NoError(t, newDecoder().Decode(&envioDTE))
+			assert.Equal(t, "Compañía Ñandú Limitada", envioDTE.RznSoc)
+
+			result, err := envioDTE.Documento.VerifyWithResult(goldenCert, newDecoder(), tt.opts)
+			assert.Equal(t, tt.documentoErr, err)
+			if tt.documentoErr == nil {
+				assert.Equal(t, "EnvioDTE>SetDTE>DTE>Documento", result.ReferencedElements[0].Path)
+				assert.True(t, bytes.HasPrefix(result.SignedData, []byte(`<Documento xmlns="http://www.sii.cl/SiiDte" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" ID="F1T33">`)))
+			}
+
+			result, err = envioDTE.SetDTE.VerifyWithResult(goldenCert, newDecoder(), tt.opts)
+			assert.Equal(t, tt.setDTEErr, err)
+			if tt.setDTEErr == nil {
+				assert.Equal(t, "EnvioDTE>SetDTE", result.ReferencedElements[0].Path)
+			}
+		})
+	}
+}
+
+// latin1Reader is an xml.Decoder CharsetReader for ISO-8859-1, in which each
+// byte is the Unicode code point of the same value.
+func latin1Reader(charset string, input io.Reader) (io.Reader, error) {
+	if !strings.EqualFold(charset, "ISO-8859-1") {
+		return nil, fmt.Errorf("unsupported charset: %s", charset)
+	}
+
+	b, err := ioutil.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+
+	return strings.NewReader(string(runes)), nil
+}
@@ -0,0 +1,56 @@
+package dsig
+
+import "io"
+
+// NormalizeLineEndings returns a reader that translates the line endings in r
+// to "\n", as the XML specification requires parsers to do before anything
+// else. Both "\r\n" and a lone "\r" become "\n".
+//
+// xml.Decoder already normalizes line endings, so there is no need to use
+// NormalizeLineEndings with it. It is meant for tokenizers that don't, which
+// would otherwise pass carriage returns through to canonicalization and
+// produce digests that don't match what the signer computed.
+//
+// Because it works on the raw bytes of the document, NormalizeLineEndings does
+// not affect carriage returns written as character references, such as
+// "&#xD;". Those are preserved, as the specification requires.
+func NormalizeLineEndings(r io.Reader) io.Reader {
+	return &lineEndingReader{r: r}
+}
+
+type lineEndingReader struct {
+	r  io.Reader
+	cr bool // whether the last byte read was a "\r"
+}
+
+func (l *lineEndingReader) Read(p []byte) (int, error) {
+	for {
+		n, err := l.r.Read(p)
+
+		// Translation never makes the data longer, so it can be done in place.
+		j := 0
+		for _, c := range p[:n] {
+			switch {
+			case c == '\r':
+				p[j] = '\n'
+				j++
+				l.cr = true
+			case c == '\n' && l.cr:
+				// This is the "\n" of a "\r\n". Its "\r" was already written as a "\n".
+				l.cr = false
+			default:
+				p[j] = c
+				j++
+				l.cr = false
+			}
+		}
+
+		// A read that consisted of nothing but the "\n" of a "\r\n" produces no
+		// output. Rather than return zero bytes with no error, read again.
+		if j == 0 && n != 0 && err == nil {
+			continue
+		}
+
+		return j, err
+	}
+}
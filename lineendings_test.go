@@ -0,0 +1,118 @@
+package dsig_test
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/dsig"
+)
+
+func TestNormalizeLineEndings(t *testing.T) {
+	type testCase struct {
+		In  string
+		Out string
+	}
+
+	testCases := map[string]testCase{
+		"lf":         testCase{In: "a\nb\n", Out: "a\nb\n"},
+		"crlf":       testCase{In: "a\r\nb\r\n", Out: "a\nb\n"},
+		"lone cr":    testCase{In: "a\rb\r", Out: "a\nb\n"},
+		"mixed":      testCase{In: "a\r\r\nb\n\rc", Out: "a\n\nb\n\nc"},
+		"references": testCase{In: "a&#xD;\r\nb", Out: "a&#xD;\nb"},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			out, err := ioutil.ReadAll(dsig.NormalizeLineEndings(strings.NewReader(tt.In)))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.Out, string(out))
+
+			// Reading one byte at a time checks that a "\r\n" split across reads is
+			// handled correctly.
+			out, err = ioutil.ReadAll(dsig.NormalizeLineEndings(iotest.OneByteReader(strings.NewReader(tt.In))))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.Out, string(out))
+		})
+	}
+}
+
+func TestVerify_LineEndings(t *testing.T) {
+	doc := signTestDocument(t, "<root a=\"x\ny\"><foo>one\ntwo</foo>"+testSignatureFormat+"</root>", base64.StdEncoding)
+
+	type testCase struct {
+		Doc string
+		Err error
+	}
+
+	testCases := map[string]testCase{
+		"lf": testCase{
+			Doc: doc,
+			Err: nil,
+		},
+		"crlf": testCase{
+			Doc: strings.ReplaceAll(doc, "\n", "\r\n"),
+			Err: nil,
+		},
+		"lone cr": testCase{
+			Doc: strings.ReplaceAll(doc, "\n", "\r"),
+			Err: nil,
+		},
+		"cr reference": testCase{
+			Doc: strings.ReplaceAll(doc, "\n", "&#xD;\n"),
+			Err: dsig.ErrBadDigest,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tt.Err, verifyTestDocument(t, tt.Doc))
+		})
+	}
+}
+
+func TestVerify_NormalizeLineEndings(t *testing.T) {
+	doc := signTestDocument(t, "<root><foo>one\ntwo</foo>"+testSignatureFormat+"</root>", base64.StdEncoding)
+	doc = strings.ReplaceAll(doc, "\n", "\r\n")
+
+	var payload struct {
+		Signature dsig.Signature `xml:"http://www.w3.org/2000/09/xmldsig# Signature"`
+	}
+
+	assert.NoError(t, xml.Unmarshal([]byte(doc), &payload))
+
+	// crTokenReader stands in for a tokenizer that doesn't normalize line
+	// endings itself.
+	r := &crTokenReader{data: doc}
+	assert.Equal(t, dsig.ErrBadDigest, payload.Signature.Verify(testCert, r))
+
+	normalized, err := ioutil.ReadAll(dsig.NormalizeLineEndings(strings.NewReader(doc)))
+	assert.NoError(t, err)
+
+	r = &crTokenReader{data: string(normalized)}
+	assert.NoError(t, payload.Signature.Verify(testCert, r))
+}
+
+// crTokenReader is a TokenReader that restores any "\r\n" in its data that
+// xml.Decoder normalized away in character data.
+type crTokenReader struct {
+	data    string
+	decoder *xml.Decoder
+}
+
+func (r *crTokenReader) RawToken() (xml.Token, error) {
+	if r.decoder == nil {
+		r.decoder = xml.NewDecoder(strings.NewReader(r.data))
+	}
+
+	t, err := r.decoder.RawToken()
+	if c, ok := t.(xml.CharData); ok && strings.Contains(r.data, "\r\n") {
+		return xml.CharData(strings.ReplaceAll(string(c), "\n", "\r\n")), err
+	}
+
+	return t, err
+}
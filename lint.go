@@ -0,0 +1,171 @@
+package dsig
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"time"
+)
+
+// Severity describes how serious a Finding is.
+type Severity int
+
+const (
+	// SeverityInfo is for findings that are worth knowing about, but that don't
+	// call for any action yet.
+	SeverityInfo Severity = iota
+
+	// SeverityWarning is for findings that should be fixed, even though Verify
+	// accepts the signature.
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	default:
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+}
+
+// The codes of the findings that Lint can return. Codes are stable, and can be
+// relied upon by programs; the messages that go with them are meant for humans
+// and may change.
+const (
+	// LintSHA1SignatureMethod means the signature uses RSA-SHA1.
+	LintSHA1SignatureMethod = "sha1-signature-method"
+
+	// LintSHA1DigestMethod means the signed data is digested with SHA1.
+	LintSHA1DigestMethod = "sha1-digest-method"
+
+	// LintWeakKey means the certificate's RSA key is shorter than 2048 bits.
+	LintWeakKey = "weak-key"
+
+	// LintShortKey means the certificate's RSA key is at least 2048 bits, but
+	// shorter than 3072 bits.
+	LintShortKey = "short-key"
+
+	// LintMissingKeyInfo means the signature has no KeyInfo.
+	LintMissingKeyInfo = "missing-key-info"
+
+	// LintMissingEnvelopedTransform means the signature's Reference does not
+	// declare the enveloped signature transform.
+	LintMissingEnvelopedTransform = "missing-enveloped-transform"
+
+	// LintCertificateExpiring means the certificate expires within
+	// LintExpiryWindow.
+	LintCertificateExpiring = "certificate-expiring"
+
+	// LintCertificateExpired means the certificate has already expired.
+	LintCertificateExpired = "certificate-expired"
+)
+
+// LintExpiryWindow is how soon a certificate must expire for Lint to report
+// LintCertificateExpiring.
+const LintExpiryWindow = 30 * 24 * time.Hour
+
+// Finding is a potential problem with a signature, reported by Lint.
+type Finding struct {
+	// Code identifies the kind of problem. It is one of the Lint constants, such
+	// as LintSHA1SignatureMethod.
+	Code string
+
+	// Severity is how serious the problem is.
+	Severity Severity
+
+	// Message describes the problem to a human.
+	Message string
+}
+
+// Lint looks for problems with sig and cert that don't stop Verify from
+// accepting a signature, but that are worth fixing anyway.
+//
+// Lint only looks at sig and cert. It does not verify the signature, and it
+// does not need the document the signature came from. cert may be nil, in
+// which case only sig is checked.
+//
+// The findings are returned in a fixed order. If there are no problems, Lint
+// returns nil.
+func Lint(sig *Signature, cert *x509.Certificate) []Finding {
+	var findings []Finding
+
+	if sig.SignedInfo.SignatureMethod.Algorithm == SignatureMethodAlgorithmSHA1 {
+		findings = append(findings, Finding{
+			Code:     LintSHA1SignatureMethod,
+			Severity: SeverityWarning,
+			Message:  "signature uses RSA-SHA1, which is deprecated; use RSA-SHA256",
+		})
+	}
+
+	if sig.SignedInfo.Reference().DigestMethod.Algorithm == DigestMethodAlgorithmSHA1 {
+		findings = append(findings, Finding{
+			Code:     LintSHA1DigestMethod,
+			Severity: SeverityWarning,
+			Message:  "signed data is digested with SHA1, which is deprecated; use SHA256",
+		})
+	}
+
+	if sig.KeyInfo == nil {
+		findings = append(findings, Finding{
+			Code:     LintMissingKeyInfo,
+			Severity: SeverityInfo,
+			Message:  "signature has no KeyInfo, so the signing key must be known in advance",
+		})
+	}
+
+	enveloped := false
+	for _, t := range sig.SignedInfo.Reference().Transforms {
+		if t.Algorithm == TransformAlgorithmEnveloped {
+			enveloped = true
+		}
+	}
+
+	if !enveloped {
+		findings = append(findings, Finding{
+			Code:     LintMissingEnvelopedTransform,
+			Severity: SeverityWarning,
+			Message:  "signature's Reference does not declare the enveloped signature transform",
+		})
+	}
+
+	if cert == nil {
+		return findings
+	}
+
+	if key, ok := cert.PublicKey.(*rsa.PublicKey); ok {
+		bits := key.N.BitLen()
+		if bits < 2048 {
+			findings = append(findings, Finding{
+				Code:     LintWeakKey,
+				Severity: SeverityWarning,
+				Message:  fmt.Sprintf("certificate has a %d-bit RSA key; use at least 2048 bits", bits),
+			})
+		} else if bits < 3072 {
+			findings = append(findings, Finding{
+				Code:     LintShortKey,
+				Severity: SeverityInfo,
+				Message:  fmt.Sprintf("certificate has a %d-bit RSA key; consider 3072 bits or more", bits),
+			})
+		}
+	}
+
+	now := time.Now()
+	if now.After(cert.NotAfter) {
+		findings = append(findings, Finding{
+			Code:     LintCertificateExpired,
+			Severity: SeverityWarning,
+			Message:  fmt.Sprintf("certificate expired at %s", cert.NotAfter.UTC().Format(time.RFC3339)),
+		})
+	} else if cert.NotAfter.Sub(now) < LintExpiryWindow {
+		findings = append(findings, Finding{
+			Code:     LintCertificateExpiring,
+			Severity: SeverityWarning,
+			Message:  fmt.Sprintf("certificate expires at %s", cert.NotAfter.UTC().Format(time.RFC3339)),
+		})
+	}
+
+	return findings
+}
@@ -0,0 +1,143 @@
+package dsig_test
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/dsig"
+)
+
+func TestLint(t *testing.T) {
+	// clean is a signature with nothing for Lint to report.
+	clean := dsig.Signature{
+		SignedInfo: dsig.SignedInfo{
+			CanonicalizationMethod: dsig.CanonicalizationMethod{Algorithm: dsig.CanonicalizationMethodAlgorithmExclusive},
+			SignatureMethod:        dsig.SignatureMethod{Algorithm: dsig.SignatureMethodAlgorithmSHA256},
+			References: []dsig.Reference{
+				dsig.Reference{
+					Transforms: []dsig.Transform{
+						dsig.Transform{Algorithm: dsig.TransformAlgorithmEnveloped},
+						dsig.Transform{Algorithm: dsig.CanonicalizationMethodAlgorithmExclusive},
+					},
+					DigestMethod: dsig.DigestMethod{Algorithm: dsig.DigestMethodAlgorithmSHA256},
+				},
+			},
+		},
+		KeyInfo: &dsig.KeyInfo{},
+	}
+
+	// certWith returns a certificate with an RSA key of the given size, expiring
+	// after the given duration. Lint only looks at the key and expiry, so the
+	// certificate doesn't need to be signed.
+	certWith := func(bits int, expiresIn time.Duration) *x509.Certificate {
+		return &x509.Certificate{
+			PublicKey: &rsa.PublicKey{N: new(big.Int).Lsh(big.NewInt(1), uint(bits-1)), E: 65537},
+			NotAfter:  time.Now().Add(expiresIn),
+		}
+	}
+
+	year := 365 * 24 * time.Hour
+
+	type testCase struct {
+		Modify func(s *dsig.Signature)
+		Cert   *x509.Certificate
+		Codes  []string
+	}
+
+	testCases := map[string]testCase{
+		"clean": testCase{
+			Cert:  certWith(3072, year),
+			Codes: nil,
+		},
+		"no cert": testCase{
+			Cert:  nil,
+			Codes: nil,
+		},
+		"sha1 signature method": testCase{
+			Modify: func(s *dsig.Signature) {
+				s.SignedInfo.SignatureMethod.Algorithm = dsig.SignatureMethodAlgorithmSHA1
+			},
+			Codes: []string{dsig.LintSHA1SignatureMethod},
+		},
+		"sha1 digest method": testCase{
+			Modify: func(s *dsig.Signature) {
+				s.SignedInfo.Reference().DigestMethod.Algorithm = dsig.DigestMethodAlgorithmSHA1
+			},
+			Codes: []string{dsig.LintSHA1DigestMethod},
+		},
+		"missing key info": testCase{
+			Modify: func(s *dsig.Signature) {
+				s.KeyInfo = nil
+			},
+			Codes: []string{dsig.LintMissingKeyInfo},
+		},
+		"missing enveloped transform": testCase{
+			Modify: func(s *dsig.Signature) {
+				s.SignedInfo.Reference().Transforms = s.SignedInfo.Reference().Transforms[1:]
+			},
+			Codes: []string{dsig.LintMissingEnvelopedTransform},
+		},
+		"1024-bit key": testCase{
+			Cert:  certWith(1024, year),
+			Codes: []string{dsig.LintWeakKey},
+		},
+		"2048-bit key": testCase{
+			Cert:  certWith(2048, year),
+			Codes: []string{dsig.LintShortKey},
+		},
+		"certificate expiring": testCase{
+			Cert:  certWith(3072, 29*24*time.Hour),
+			Codes: []string{dsig.LintCertificateExpiring},
+		},
+		"certificate expired": testCase{
+			Cert:  certWith(3072, -time.Hour),
+			Codes: []string{dsig.LintCertificateExpired},
+		},
+		"everything": testCase{
+			Modify: func(s *dsig.Signature) {
+				s.SignedInfo.SignatureMethod.Algorithm = dsig.SignatureMethodAlgorithmSHA1
+				s.SignedInfo.Reference().DigestMethod.Algorithm = dsig.DigestMethodAlgorithmSHA1
+				s.SignedInfo.Reference().Transforms = nil
+				s.KeyInfo = nil
+			},
+			Cert: certWith(1024, time.Hour),
+			Codes: []string{
+				dsig.LintSHA1SignatureMethod,
+				dsig.LintSHA1DigestMethod,
+				dsig.LintMissingKeyInfo,
+				dsig.LintMissingEnvelopedTransform,
+				dsig.LintWeakKey,
+				dsig.LintCertificateExpiring,
+			},
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			sig := clean
+			sig.SignedInfo.References = append([]dsig.Reference{}, clean.SignedInfo.References...)
+			sig.SignedInfo.Reference().Transforms = append([]dsig.Transform{}, clean.SignedInfo.Reference().Transforms...)
+			if tt.Modify != nil {
+				tt.Modify(&sig)
+			}
+
+			var codes []string
+			for _, f := range dsig.Lint(&sig, tt.Cert) {
+				assert.NotEmpty(t, f.Message)
+				codes = append(codes, f.Code)
+			}
+
+			assert.Equal(t, tt.Codes, codes)
+		})
+	}
+}
+
+func TestSeverity_String(t *testing.T) {
+	assert.Equal(t, "info", dsig.SeverityInfo.String())
+	assert.Equal(t, "warning", dsig.SeverityWarning.String())
+	assert.Equal(t, "Severity(7)", dsig.Severity(7).String())
+}
@@ -0,0 +1,81 @@
+package dsig
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/xml"
+	"io"
+)
+
+// metadataNamespace is the XML namespace of SAML 2.0 metadata documents.
+var metadataNamespace = "urn:oasis:names:tc:SAML:2.0:metadata"
+
+// CertsFromMetadata extracts the signing certificates from a SAML metadata
+// document.
+//
+// Every md:KeyDescriptor whose use attribute is "signing", or which has no use
+// attribute at all (meaning the key may be used for both signing and
+// encryption), contributes the certificates in its
+// ds:KeyInfo/ds:X509Data/ds:X509Certificate elements. This works both for a
+// single md:EntityDescriptor and for an md:EntitiesDescriptor containing many
+// of them.
+//
+// CertsFromMetadata does not check if the certificates are expired, nor does
+// it verify any signature on the metadata itself. If you fetch metadata over
+// an untrusted channel, you should verify it before trusting its contents.
+func CertsFromMetadata(md []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+
+	decoder := xml.NewDecoder(bytes.NewReader(md))
+	for {
+		t, err := decoder.Token()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+
+			return nil, err
+		}
+
+		start, ok := t.(xml.StartElement)
+		if !ok || start.Name.Space != metadataNamespace || start.Name.Local != "KeyDescriptor" {
+			continue
+		}
+
+		var keyDescriptor metadataKeyDescriptor
+		if err := decoder.DecodeElement(&keyDescriptor, &start); err != nil {
+			return nil, err
+		}
+
+		if keyDescriptor.Use != "" && keyDescriptor.Use != "signing" {
+			continue
+		}
+
+		for _, data := range keyDescriptor.KeyInfo.X509Data {
+			for _, s := range data.X509Certificates {
+				der, err := decodeBase64(s)
+				if err != nil {
+					return nil, err
+				}
+
+				cert, err := x509.ParseCertificate(der)
+				if err != nil {
+					return nil, err
+				}
+
+				certs = append(certs, cert)
+			}
+		}
+	}
+
+	return certs, nil
+}
+
+type metadataKeyDescriptor struct {
+	Use     string `xml:"use,attr"`
+	KeyInfo struct {
+		X509Data []struct {
+			X509Certificates []string `xml:"http://www.w3.org/2000/09/xmldsig# X509Certificate"`
+		} `xml:"http://www.w3.org/2000/09/xmldsig# X509Data"`
+	} `xml:"http://www.w3.org/2000/09/xmldsig# KeyInfo"`
+}
@@ -0,0 +1,83 @@
+package dsig_test
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/dsig"
+)
+
+func TestCertsFromMetadata(t *testing.T) {
+	// This is the same certificate as the one used in ExampleSignature_Verify.
+	cert := `MIICVzCCAcACCQC9lei8Ir3KDzANBgkqhkiG9w0BAQsFADBwMQswCQYDVQQGEwJV
+UzEPMA0GA1UECAwGT3JlZ29uMREwDwYDVQQHDAhQb3J0bGFuZDEVMBMGA1UECgwM
+Q29tcGFueSBOYW1lMQwwCgYDVQQLDANPcmcxGDAWBgNVBAMMD3d3dy5leGFtcGxl
+LmNvbTAeFw0yMDA1MjgxNzUzNTJaFw0yMTA1MjgxNzUzNTJaMHAxCzAJBgNVBAYT
+AlVTMQ8wDQYDVQQIDAZPcmVnb24xETAPBgNVBAcMCFBvcnRsYW5kMRUwEwYDVQQK
+DAxDb21wYW55IE5hbWUxDDAKBgNVBAsMA09yZzEYMBYGA1UEAwwPd3d3LmV4YW1w
+bGUuY29tMIGfMA0GCSqGSIb3DQEBAQUAA4GNADCBiQKBgQDAqmyYL/bNqAL7uHFx
+lHT2Ullmh0UvMb1mJrtTVb/j+k+nKNklbdbz/mSOdc7OJ8kwu9xNcKvDADr8acir
+74p8Tp9hYEOR8p2XBcFiB7x5g76Vdm6NM4g3Ib5utXBRd13YSQajD6ynJYprrTBn
+gGnXzdvZ6ZhX3QeJebO9m9u7WQIDAQABMA0GCSqGSIb3DQEBCwUAA4GBAL8vaXlm
+1dd8U9UCrnt6X0MHvd5l5RRWqvXcV7FvjBqs6U9TP+soCKAzQSpJh4WpY1qaMlgc
+FVaTFT9FFMoqYHTn4yj/C6GS7tcyXEStKvr7UA6mH4yfepwndoc6/KAuCph1ucsb
+VuPh47/DnXFpm4ZKNsojqBwUjM9/EkP0UGGK`
+
+	keyDescriptorFormat := `<md:KeyDescriptor %s>
+<ds:KeyInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#">
+<ds:X509Data>
+<ds:X509Certificate>%s</ds:X509Certificate>
+</ds:X509Data>
+</ds:KeyInfo>
+</md:KeyDescriptor>`
+
+	type testCase struct {
+		Metadata string
+		Count    int
+		Err      error
+	}
+
+	testCases := map[string]testCase{
+		"signing": testCase{
+			Metadata: fmt.Sprintf(`<md:EntityDescriptor xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata"><md:IDPSSODescriptor>%s</md:IDPSSODescriptor></md:EntityDescriptor>`,
+				fmt.Sprintf(keyDescriptorFormat, `use="signing"`, cert)),
+			Count: 1,
+		},
+		"no use": testCase{
+			Metadata: fmt.Sprintf(`<md:EntityDescriptor xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata"><md:IDPSSODescriptor>%s</md:IDPSSODescriptor></md:EntityDescriptor>`,
+				fmt.Sprintf(keyDescriptorFormat, ``, cert)),
+			Count: 1,
+		},
+		"encryption": testCase{
+			Metadata: fmt.Sprintf(`<md:EntityDescriptor xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata"><md:IDPSSODescriptor>%s</md:IDPSSODescriptor></md:EntityDescriptor>`,
+				fmt.Sprintf(keyDescriptorFormat, `use="encryption"`, cert)),
+			Count: 0,
+		},
+		"entities descriptor": testCase{
+			Metadata: fmt.Sprintf(`<EntitiesDescriptor xmlns="urn:oasis:names:tc:SAML:2.0:metadata"><EntityDescriptor><IDPSSODescriptor>%s%s</IDPSSODescriptor></EntityDescriptor><EntityDescriptor><SPSSODescriptor>%s</SPSSODescriptor></EntityDescriptor></EntitiesDescriptor>`,
+				fmt.Sprintf(keyDescriptorFormat, `use="signing" xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata"`, cert),
+				fmt.Sprintf(keyDescriptorFormat, `use="encryption" xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata"`, cert),
+				fmt.Sprintf(keyDescriptorFormat, `xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata"`, cert)),
+			Count: 2,
+		},
+		"cert not base64": testCase{
+			Metadata: fmt.Sprintf(`<md:EntityDescriptor xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata"><md:IDPSSODescriptor>%s</md:IDPSSODescriptor></md:EntityDescriptor>`,
+				fmt.Sprintf(keyDescriptorFormat, `use="signing"`, "NOT BASE64")),
+			Err: base64.CorruptInputError(3),
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			certs, err := dsig.CertsFromMetadata([]byte(tt.Metadata))
+			assert.Equal(t, tt.Err, err)
+			assert.Len(t, certs, tt.Count)
+
+			for _, c := range certs {
+				assert.Equal(t, "www.example.com", c.Subject.CommonName)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package dsig
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+)
+
+// EncodingBase64 is the URI of the base64 encoding, for use as the Encoding of
+// an Object.
+var EncodingBase64 = "http://www.w3.org/2000/09/xmldsig#base64"
+
+// ErrMissingObjectID is returned by SignEnveloping if the Object it's given
+// has no ID, and so can't be referred to.
+var ErrMissingObjectID = errors.New("dsig: object must have an id")
+
+// Object represents a ds:Object, which carries arbitrary data inside a
+// ds:Signature.
+//
+// In an enveloping signature, the signed data is a ds:Object, and the
+// signature's Reference refers to it by its ID, like "#obj".
+type Object struct {
+	XMLName  xml.Name `xml:"http://www.w3.org/2000/09/xmldsig# Object"`
+	ID       string   `xml:"Id,attr,omitempty"`
+	MimeType string   `xml:"MimeType,attr,omitempty"`
+	Encoding string   `xml:"Encoding,attr,omitempty"`
+
+	// Content is the raw XML inside the ds:Object.
+	Content []byte `xml:",innerxml"`
+}
+
+// NewBase64Object returns an Object with the given ID whose content is data,
+// encoded with standard, padded base64.
+func NewBase64Object(id string, data []byte) Object {
+	return Object{
+		ID:       id,
+		Encoding: EncodingBase64,
+		Content:  []byte(base64.StdEncoding.EncodeToString(data)),
+	}
+}
+
+// SignEnveloping creates an enveloping Signature, which contains object and
+// signs it. The returned Signature stands on its own, and can be marshaled with
+// xml.Marshal and verified with Verify.
+//
+// object.ID must not be empty; otherwise, SignEnveloping returns
+// ErrMissingObjectID. The signature's Reference has "#" followed by object.ID
+// as its URI, and the signature's canonicalization algorithm, Exclusive
+// Canonical XML unless opts.CanonicalizationAlgorithm says otherwise, as its
+// only transform.
+//
+// object.Content is put into the ds:Object as-is, and so must be well-formed
+// XML or text. Elements in it without a namespace should declare xmlns="", as
+// they would otherwise be in the namespace of the ds:Object.
+//
+// The algorithms, and the certificates to put in KeyInfo, are chosen by opts as
+// with NewSignature. signer must produce RSA PKCS #1 v1.5 signatures, as with
+// SignWithSigner.
+func SignEnveloping(signer crypto.Signer, object Object, opts SignOptions) (*Signature, error) {
+	if object.ID == "" {
+		return nil, ErrMissingObjectID
+	}
+
+	s, err := NewSignature(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	s.SignedInfo.Reference().URI = "#" + object.ID
+	s.SignedInfo.Reference().Transforms = []Transform{
+		{Algorithm: s.SignedInfo.CanonicalizationMethod.Algorithm, InclusiveNamespaces: s.SignedInfo.CanonicalizationMethod.InclusiveNamespaces},
+	}
+	s.Objects = []Object{object}
+
+	// ds:Object's ID attribute is Id, whatever opts.IDAttribute says.
+	s.IDAttribute = xml.Name{Local: "Id"}
+
+	unsigned, err := xml.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.SignWithSigner(signer, xml.NewDecoder(bytes.NewReader(unsigned))); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
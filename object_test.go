@@ -0,0 +1,90 @@
+package dsig_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/dsig"
+)
+
+func TestSignEnveloping(t *testing.T) {
+	type testCase struct {
+		Object dsig.Object
+	}
+
+	testCases := map[string]testCase{
+		"xml": testCase{
+			Object: dsig.Object{ID: "invoice", Content: []byte(`<Invoice xmlns="urn:example:invoice"><Total>100</Total></Invoice>`)},
+		},
+		"unqualified xml": testCase{
+			Object: dsig.Object{ID: "invoice", Content: []byte(`<Invoice xmlns=""><!-- comment --><Total>100</Total></Invoice>`)},
+		},
+		"base64": testCase{
+			Object: dsig.NewBase64Object("data", []byte("some binary content")),
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			s, err := dsig.SignEnveloping(testKey, tt.Object, dsig.SignOptions{Certificate: testCert})
+			assert.NoError(t, err)
+			assert.Equal(t, "#"+tt.Object.ID, s.SignedInfo.Reference().URI)
+
+			data, err := xml.Marshal(s)
+			assert.NoError(t, err)
+
+			var decoded dsig.Signature
+			assert.NoError(t, xml.Unmarshal(data, &decoded))
+			assert.Len(t, decoded.Objects, 1)
+			assert.Equal(t, tt.Object.ID, decoded.Objects[0].ID)
+			assert.Equal(t, tt.Object.Encoding, decoded.Objects[0].Encoding)
+			assert.Equal(t, tt.Object.Content, decoded.Objects[0].Content)
+			assert.NoError(t, decoded.Verify(testCert, xml.NewDecoder(bytes.NewReader(data))))
+
+			// The ds:Object is signed, so changing it breaks the signature.
+			tampered := bytes.Replace(data, tt.Object.Content, append(tt.Object.Content[:len(tt.Object.Content):len(tt.Object.Content)], ' '), 1)
+			assert.Equal(t, dsig.ErrBadDigest, decoded.Verify(testCert, xml.NewDecoder(bytes.NewReader(tampered))))
+		})
+	}
+}
+
+func TestSignEnveloping_Base64(t *testing.T) {
+	o := dsig.NewBase64Object("data", []byte("some binary content"))
+	assert.Equal(t, dsig.EncodingBase64, o.Encoding)
+	assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("some binary content")), string(o.Content))
+}
+
+func TestSignEnveloping_MissingID(t *testing.T) {
+	_, err := dsig.SignEnveloping(testKey, dsig.Object{Content: []byte("xxx")}, dsig.SignOptions{})
+	assert.Equal(t, dsig.ErrMissingObjectID, err)
+}
+
+func TestSignEnveloping_Wrapped(t *testing.T) {
+	s, err := dsig.SignEnveloping(testKey, dsig.Object{ID: "invoice", Content: []byte(`<Invoice><Total>100</Total></Invoice>`)}, dsig.SignOptions{Certificate: testCert})
+	assert.NoError(t, err)
+
+	signature, err := xml.Marshal(s)
+	assert.NoError(t, err)
+
+	// An attacker hides the signed invoice in an extension element of a forged
+	// one. The ds:Object is unchanged, so its digest still matches.
+	wrapped := []byte(`<Invoice><Total>1000000</Total><Extensions>` + string(signature) + `</Extensions></Invoice>`)
+
+	var payload struct {
+		Extensions struct {
+			Signature dsig.Signature `xml:"http://www.w3.org/2000/09/xmldsig# Signature"`
+		}
+	}
+
+	assert.NoError(t, xml.Unmarshal(wrapped, &payload))
+	assert.Equal(t, dsig.ErrSignatureMisplaced, payload.Extensions.Signature.Verify(testCert, xml.NewDecoder(bytes.NewReader(wrapped))))
+
+	// AllowArbitraryReferences accepts it, but reports where the signed data
+	// really is.
+	result, err := payload.Extensions.Signature.VerifyWithResult(testCert, xml.NewDecoder(bytes.NewReader(wrapped)), dsig.VerifyOptions{AllowArbitraryReferences: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "Invoice>Extensions>Signature>Object", result.ReferencedElements[0].Path)
+}
@@ -0,0 +1,292 @@
+package dsig
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"encoding/xml"
+	"errors"
+	"hash"
+)
+
+// ErrKeyTooLarge is returned by VerifyWithOptions if the public key used to
+// verify a signature is larger than VerifyOptions.MaxKeySize.
+var ErrKeyTooLarge = errors.New("dsig: public key is too large")
+
+// ErrKeyTooSmall is returned by VerifyWithOptions if the public key used to
+// verify a signature is smaller than VerifyOptions.MinKeySize.
+var ErrKeyTooSmall = errors.New("dsig: public key is too small")
+
+// ErrSignatureTooLarge is returned by VerifyWithOptions if the SignatureValue
+// is longer than the public key it's supposed to be verified with. Such a
+// value can never be a valid signature.
+var ErrSignatureTooLarge = errors.New("dsig: signature value is too large")
+
+// ErrInvalidUTF8 is returned by VerifyWithOptions if VerifyOptions.ValidateUTF8
+// is set and the canonicalized data to be digested or signed isn't valid UTF-8.
+var ErrInvalidUTF8 = errors.New("dsig: canonicalized data is not valid utf-8")
+
+// ErrMissingKeyInfo is returned by VerifyWithOptions if
+// VerifyOptions.RequireKeyInfo is set and the signature has no KeyInfo.
+var ErrMissingKeyInfo = errors.New("dsig: signature has no KeyInfo")
+
+// ErrWeakDigest is returned by VerifyWithOptions if the signature's digest
+// algorithm is weaker than VerifyOptions.MinDigestStrength.
+var ErrWeakDigest = errors.New("dsig: digest algorithm is weaker than allowed")
+
+// ErrWeakSignature is returned by VerifyWithOptions if the hash of the
+// signature's algorithm is weaker than VerifyOptions.MinSignatureStrength.
+var ErrWeakSignature = errors.New("dsig: signature algorithm is weaker than allowed")
+
+// ErrUnsignedContentPresent is returned by VerifyWithOptions if
+// VerifyOptions.RequireFullCoverage is set and the document has content that
+// the signature doesn't cover.
+var ErrUnsignedContentPresent = errors.New("dsig: document has content outside of signed element")
+
+// DefaultMaxKeySize is the largest RSA key, in bits, that Verify will use to
+// verify a signature.
+const DefaultMaxKeySize = 16384
+
+// VerifyOptions controls how VerifyWithOptions verifies a signature.
+//
+// The zero value of VerifyOptions is the behavior of Verify.
+type VerifyOptions struct {
+	// MaxKeySize is the largest RSA public key, in bits, that will be used to
+	// verify a signature. Larger keys are rejected with ErrKeyTooLarge before any
+	// public-key operation is performed, as verifying with an enormous key can
+	// take a great deal of CPU time.
+	//
+	// If zero, DefaultMaxKeySize is used.
+	MaxKeySize int
+
+	// MinKeySize, if non-zero, is the smallest RSA public key, in bits, that
+	// will be used to verify a signature. Smaller keys are rejected with
+	// ErrKeyTooSmall.
+	MinKeySize int
+
+	// ValidateUTF8, if true, makes VerifyWithOptions check that the canonicalized
+	// data it digests and verifies is valid UTF-8, and return ErrInvalidUTF8 if
+	// it isn't.
+	//
+	// Canonical XML is always UTF-8, so a conforming signer can never have
+	// produced a signature over invalid UTF-8. xml.Decoder already rejects such
+	// input, but other TokenReader implementations may not; without this option,
+	// invalid input usually surfaces as a puzzling ErrBadDigest.
+	ValidateUTF8 bool
+
+	// XOPParts, if non-nil, makes VerifyWithOptions resolve xop:Include elements
+	// in the document, as used by MTOM-optimized SOAP messages. Each xop:Include
+	// is replaced with the base64-encoded contents of the MIME part it refers
+	// to, so that the data is digested as the signer saw it.
+	//
+	// XOPParts maps a part's Content-ID, without the "cid:" prefix or angle
+	// brackets, to its contents. If a part is missing, VerifyWithOptions returns
+	// a *XOPPartNotFoundError.
+	XOPParts map[string][]byte
+
+	// Resolver, if non-nil, makes VerifyWithOptions resolve References to data
+	// outside of the document, whose URI is neither empty nor starts with "#",
+	// as VerifyDetached does. The data Resolver returns is digested as-is, so such
+	// a Reference must have no transforms, or else VerifyWithOptions returns
+	// ErrUnsupportedTransform. An error from Resolver is returned unchanged.
+	//
+	// This lets a signature refer to both an element of the document and, say, an
+	// attachment that travels with it. The ds:Signature is still found in the
+	// document by its first same-document Reference, so it must have one. In
+	// the VerifyResult, the ReferencedElement of such a Reference has no Path or
+	// Name.
+	//
+	// Without a Resolver, such References lead to an *UnsupportedReferenceError.
+	Resolver Resolver
+
+	// RequireKeyInfo, if true, makes VerifyWithOptions return ErrMissingKeyInfo
+	// if the signature has no ds:KeyInfo.
+	//
+	// This is a policy check that the signature identifies its own key. The
+	// contents of KeyInfo are not checked, and the signature is still verified
+	// with the certificate passed to VerifyWithOptions.
+	RequireKeyInfo bool
+
+	// MinDigestStrength, if non-zero, is the weakest digest algorithm that
+	// VerifyWithOptions accepts for the signature's Reference. If the digest
+	// algorithm is weaker, VerifyWithOptions returns ErrWeakDigest.
+	//
+	// Algorithms are compared by the size of their output, so crypto.SHA256
+	// accepts SHA256 but rejects SHA1. This only applies to the digest of the
+	// signed data; the signature algorithm is not affected.
+	MinDigestStrength crypto.Hash
+
+	// MinSignatureStrength, if non-zero, is the weakest hash that
+	// VerifyWithOptions accepts as part of the signature's SignatureMethod. If
+	// the signature algorithm's hash is weaker, VerifyWithOptions returns
+	// ErrWeakSignature.
+	//
+	// Hashes are compared by the size of their output, as with
+	// MinDigestStrength, so crypto.SHA256 accepts RSA-SHA256 but rejects
+	// RSA-SHA1.
+	MinSignatureStrength crypto.Hash
+
+	// QCStatements, if non-nil, makes VerifyWithOptions require that the
+	// certificate it verifies with has the QCStatements that the policy calls
+	// for, as is required of qualified certificates under eIDAS. If it doesn't,
+	// VerifyWithOptions returns a *MissingQCStatementsError.
+	//
+	// VerifyWithTrustStore applies the policy to each candidate key's
+	// certificate. Keys added without a certificate never satisfy the policy.
+	QCStatements *QCStatementsPolicy
+
+	// IDAttribute, if non-zero, is the only attribute that VerifyWithOptions
+	// looks in for the ID that the signature's Reference refers to, instead of
+	// the ID, Id, id, and wsu:Id attributes. Its Space is a namespace URI, not a
+	// prefix. See SignOptions.IDAttribute.
+	IDAttribute xml.Name
+
+	// AllowArbitraryReferences, if true, lets the signature's References refer
+	// by ID to any element in the document, and lets the signature be anywhere
+	// in the document. Without it, each Reference must either refer to the
+	// whole document, or refer by ID to an element that contains the
+	// ds:Signature, or that the ds:Signature contains, as in an enveloping
+	// signature; otherwise, VerifyWithOptions returns
+	// ErrReferenceNotEnveloping. The ds:Signature must also be an immediate
+	// child of the element that contains it, or, if it's enveloping, the root
+	// element or a child of it; otherwise, VerifyWithOptions returns
+	// ErrSignatureMisplaced.
+	//
+	// Setting AllowArbitraryReferences exposes the caller to XML Signature
+	// Wrapping (XSW) attacks. A signature over an element by ID says only that
+	// an element with that ID, somewhere in the document, was signed. An
+	// attacker can take a signed document, move the signed element somewhere the
+	// application doesn't look, such as into an extension element, and put a
+	// forged element where the signed one used to be. The signature still
+	// verifies, and the application reads the forged element. Anything else
+	// outside of the signed element, such as a sibling of it, can also be
+	// changed freely.
+	//
+	// Callers that set AllowArbitraryReferences must read signed data only from
+	// the elements listed in VerifyResult.ReferencedElements, which says where
+	// in the document each of them was found, and treat the rest of the document
+	// as unsigned.
+	AllowArbitraryReferences bool
+
+	// RequireFullCoverage, if true, makes VerifyWithOptions return
+	// ErrUnsignedContentPresent if the document has any elements that are
+	// outside of both the signature and the element the signature's Reference
+	// refers to.
+	//
+	// A Reference with an empty URI covers the whole document, so this only
+	// affects signatures that refer to an element by ID. For those, it requires
+	// that the referenced element be the root element, so that no unsigned
+	// siblings can be added alongside the signed content. Only the first
+	// Reference of a signature with several References is considered.
+	RequireFullCoverage bool
+
+	// Progress, if non-nil, is called periodically while VerifyWithOptions
+	// reads the document, with the number of bytes of XML read so far. It's
+	// called roughly every 64KiB, and once more when the whole document has
+	// been read, and the values it's called with never decrease.
+	//
+	// The number of bytes is estimated from the tokens that have been read, as
+	// not every TokenReader can report its position in the document. It's
+	// suitable for progress bars and liveness checks, but should not be relied
+	// upon to be exact.
+	//
+	// Progress can't affect the outcome of verification. It is called from the
+	// goroutine that called VerifyWithOptions, and it should return quickly.
+	Progress func(bytesProcessed int64)
+
+	// NewHash, if non-nil, is used instead of crypto.Hash.New to create the
+	// hashes that VerifyWithOptions computes digests and signatures with. This
+	// lets deployments that must do all hashing in a validated cryptographic
+	// module, such as one validated under FIPS 140, route it there.
+	//
+	// NewHash is only called with the crypto.Hash of an algorithm this package
+	// supports. It must not return nil.
+	NewHash func(h crypto.Hash) hash.Hash
+
+	// VerifyPKCS1v15, if non-nil, is used instead of rsa.VerifyPKCS1v15 to
+	// check RSA signatures. It has the same contract as rsa.VerifyPKCS1v15, and
+	// is called only after the key has been checked against MaxKeySize.
+	VerifyPKCS1v15 func(pub *rsa.PublicKey, hash crypto.Hash, hashed []byte, sig []byte) error
+
+	// NormalizePrefixes, if true, makes VerifyWithOptions replace every
+	// namespace prefix with a generated one before canonicalizing, both for the
+	// digested data and for ds:SignedInfo.
+	//
+	// THIS IS NOT PART OF THE XML SIGNATURE STANDARD. Signatures made by a
+	// conforming signer will not verify with this option set. It exists only for
+	// interoperating with a partner whose messages pass through intermediaries
+	// that rename prefixes, and who has agreed to sign the same normalized form.
+	//
+	// The normalized form is produced from the Exclusive Canonical XML input as
+	// follows, before canonicalizing as usual:
+	//
+	//  1. Each namespace is assigned the prefix "n0", "n1", and so on, in the
+	//     order that namespaces are first used. Elements are visited in document
+	//     order, and an element's name is used before its attributes, which are
+	//     used in order of their namespace URI.
+	//  2. Every element in a namespace, including one that was in the default
+	//     namespace, and every prefixed attribute is renamed to use the prefix of
+	//     its namespace. Unprefixed attributes and the xml prefix are unchanged.
+	//  3. All namespace declarations are removed, and the assigned prefixes are
+	//     declared on the root element.
+	//
+	// Prefixes that appear inside attribute values or text, such as in
+	// xsi:type="ns1:Foo", are not rewritten, so documents that rely on them
+	// still can't survive an intermediary that renames prefixes.
+	NormalizePrefixes bool
+
+	// DiagnoseDigest, if true, makes VerifyWithOptions return a
+	// *DigestMismatchError instead of ErrBadDigest when the digest doesn't
+	// match. Before returning, the signed data is canonicalized again with each
+	// of a fixed list of alternative canonicalization algorithms, and the error
+	// reports which one, if any, the digest would have matched.
+	//
+	// Digest mismatches between otherwise compatible implementations are most
+	// often caused by one of them including comments when the other doesn't,
+	// or by one of them using Canonical XML 1.0 when the other uses Exclusive
+	// Canonical XML. The alternatives tried are Exclusive Canonical XML and
+	// Canonical XML 1.0, each with and without comments, other than the one
+	// that the Reference already called for.
+	//
+	// The diagnosis is purely informational. The signature is never accepted on
+	// the strength of an alternative, and the error still wraps ErrBadDigest.
+	// Setting DiagnoseDigest means that the document's tokens are kept in memory
+	// while verifying. Only the digest of a signature's first Reference is
+	// diagnosed.
+	DiagnoseDigest bool
+
+	// Timings, if non-nil, is called once each time VerifyWithOptions finishes
+	// verifying a signature, with how long each phase of verification took. It's
+	// called whether or not the signature turns out to be valid; phases that
+	// were never reached have a duration of zero.
+	//
+	// Timings is meant for diagnosing where the time goes when verifying large
+	// documents or with large keys. When it's nil, no time is measured.
+	Timings func(VerifyTimings)
+
+	// timer collects the durations reported to Timings.
+	timer *timer
+}
+
+func (o *VerifyOptions) maxKeySize() int {
+	if o.MaxKeySize == 0 {
+		return DefaultMaxKeySize
+	}
+
+	return o.MaxKeySize
+}
+
+func (o *VerifyOptions) newHash(h crypto.Hash) hash.Hash {
+	if o.NewHash == nil {
+		return h.New()
+	}
+
+	return o.NewHash(h)
+}
+
+func (o *VerifyOptions) verifyPKCS1v15(pub *rsa.PublicKey, hash crypto.Hash, hashed []byte, sig []byte) error {
+	if o.VerifyPKCS1v15 == nil {
+		return rsa.VerifyPKCS1v15(pub, hash, hashed, sig)
+	}
+
+	return o.VerifyPKCS1v15(pub, hash, hashed, sig)
+}
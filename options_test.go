@@ -0,0 +1,309 @@
+package dsig_test
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"hash"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/dsig"
+	"github.com/ucarion/dsig/internal/canon"
+	"github.com/ucarion/dsig/internal/sigsplit"
+)
+
+func TestVerifyWithOptions_MaxKeySize(t *testing.T) {
+	doc := signTestDocument(t, `<root><foo>xxx</foo>`+testSignatureFormat+`</root>`, base64.StdEncoding)
+
+	type testCase struct {
+		MaxKeySize int
+		Err        error
+	}
+
+	testCases := map[string]testCase{
+		"default": testCase{
+			MaxKeySize: 0,
+			Err:        nil,
+		},
+		"exactly key size": testCase{
+			MaxKeySize: 2048,
+			Err:        nil,
+		},
+		"smaller than key size": testCase{
+			MaxKeySize: 1024,
+			Err:        dsig.ErrKeyTooLarge,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := verifyTestDocumentWithOptions(t, doc, dsig.VerifyOptions{MaxKeySize: tt.MaxKeySize})
+			assert.Equal(t, tt.Err, err)
+		})
+	}
+}
+
+func TestVerifyWithOptions_MinKeySize(t *testing.T) {
+	doc := signTestDocument(t, `<root><foo>xxx</foo>`+testSignatureFormat+`</root>`, base64.StdEncoding)
+
+	type testCase struct {
+		MinKeySize int
+		Err        error
+	}
+
+	testCases := map[string]testCase{
+		"no minimum": testCase{
+			MinKeySize: 0,
+			Err:        nil,
+		},
+		"exactly key size": testCase{
+			MinKeySize: 2048,
+			Err:        nil,
+		},
+		"larger than key size": testCase{
+			MinKeySize: 3072,
+			Err:        dsig.ErrKeyTooSmall,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := verifyTestDocumentWithOptions(t, doc, dsig.VerifyOptions{MinKeySize: tt.MinKeySize})
+			assert.Equal(t, tt.Err, err)
+		})
+	}
+}
+
+func TestVerifyWithOptions_SignatureTooLarge(t *testing.T) {
+	doc := signTestDocument(t, `<root><foo>xxx</foo>`+testSignatureFormat+`</root>`, base64.StdEncoding)
+
+	// testCert has a 2048-bit key, so its signatures are 256 bytes long.
+	signatureValue := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("x", 257)))
+	doc = regexp.MustCompile(`<ds:SignatureValue>.*</ds:SignatureValue>`).ReplaceAllString(doc, "<ds:SignatureValue>"+signatureValue+"</ds:SignatureValue>")
+
+	assert.Equal(t, dsig.ErrSignatureTooLarge, verifyTestDocument(t, doc))
+}
+
+func TestVerifyWithOptions_ValidateUTF8(t *testing.T) {
+	doc := signTestDocument(t, `<root><foo>xxx</foo>`+testSignatureFormat+`</root>`, base64.StdEncoding)
+
+	var payload struct {
+		Signature dsig.Signature `xml:"http://www.w3.org/2000/09/xmldsig# Signature"`
+	}
+
+	assert.NoError(t, xml.Unmarshal([]byte(doc), &payload))
+
+	type testCase struct {
+		ValidateUTF8 bool
+		Err          error
+	}
+
+	testCases := map[string]testCase{
+		"without validation": testCase{
+			ValidateUTF8: false,
+			Err:          dsig.ErrBadDigest,
+		},
+		"with validation": testCase{
+			ValidateUTF8: true,
+			Err:          dsig.ErrInvalidUTF8,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			r := &invalidUTF8Reader{xml.NewDecoder(strings.NewReader(doc))}
+			err := payload.Signature.VerifyWithOptions(testCert, r, dsig.VerifyOptions{ValidateUTF8: tt.ValidateUTF8})
+			assert.Equal(t, tt.Err, err)
+		})
+	}
+}
+
+// invalidUTF8Reader is a TokenReader that, unlike xml.Decoder, lets invalid
+// UTF-8 through. It replaces any "xxx" text with an invalid byte sequence.
+type invalidUTF8Reader struct {
+	r dsig.TokenReader
+}
+
+func (r *invalidUTF8Reader) RawToken() (xml.Token, error) {
+	t, err := r.r.RawToken()
+	if c, ok := t.(xml.CharData); ok && string(c) == "xxx" {
+		return xml.CharData("\xff\xfe"), err
+	}
+
+	return t, err
+}
+
+func TestVerifyWithOptions_RequireKeyInfo(t *testing.T) {
+	keyInfo := `<ds:KeyInfo><ds:KeyName>test</ds:KeyName></ds:KeyInfo></ds:Signature>`
+	withKeyInfo := strings.Replace(testSignatureFormat, `</ds:Signature>`, keyInfo, 1)
+
+	type testCase struct {
+		Format         string
+		RequireKeyInfo bool
+		Err            error
+	}
+
+	testCases := map[string]testCase{
+		"not required, absent": testCase{
+			Format:         testSignatureFormat,
+			RequireKeyInfo: false,
+			Err:            nil,
+		},
+		"not required, present": testCase{
+			Format:         withKeyInfo,
+			RequireKeyInfo: false,
+			Err:            nil,
+		},
+		"required, absent": testCase{
+			Format:         testSignatureFormat,
+			RequireKeyInfo: true,
+			Err:            dsig.ErrMissingKeyInfo,
+		},
+		"required, present": testCase{
+			Format:         withKeyInfo,
+			RequireKeyInfo: true,
+			Err:            nil,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			doc := signTestDocument(t, `<root><foo>xxx</foo>`+tt.Format+`</root>`, base64.StdEncoding)
+			err := verifyTestDocumentWithOptions(t, doc, dsig.VerifyOptions{RequireKeyInfo: tt.RequireKeyInfo})
+			assert.Equal(t, tt.Err, err)
+		})
+	}
+}
+
+func TestVerifyWithOptions_MinDigestStrength(t *testing.T) {
+	doc := signTestDocument(t, `<root><foo>xxx</foo>`+testSignatureFormat+`</root>`, base64.StdEncoding)
+
+	type testCase struct {
+		MinDigestStrength crypto.Hash
+		Err               error
+	}
+
+	testCases := map[string]testCase{
+		"no minimum": testCase{
+			MinDigestStrength: 0,
+			Err:               nil,
+		},
+		"weaker than digest": testCase{
+			MinDigestStrength: crypto.SHA1,
+			Err:               nil,
+		},
+		"same as digest": testCase{
+			MinDigestStrength: crypto.SHA256,
+			Err:               nil,
+		},
+		"stronger than digest": testCase{
+			MinDigestStrength: crypto.SHA512,
+			Err:               dsig.ErrWeakDigest,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := verifyTestDocumentWithOptions(t, doc, dsig.VerifyOptions{MinDigestStrength: tt.MinDigestStrength})
+			assert.Equal(t, tt.Err, err)
+		})
+	}
+
+	// A SHA1 digest is rejected before the digest is even checked.
+	sha1Doc := strings.Replace(doc, dsig.DigestMethodAlgorithmSHA256, dsig.DigestMethodAlgorithmSHA1, 1)
+	assert.Equal(t, dsig.ErrWeakDigest, verifyTestDocumentWithOptions(t, sha1Doc, dsig.VerifyOptions{MinDigestStrength: crypto.SHA256}))
+}
+
+func TestVerifyWithOptions_MinSignatureStrength(t *testing.T) {
+	doc := signTestDocument(t, `<root><foo>xxx</foo>`+testSignatureFormat+`</root>`, base64.StdEncoding)
+
+	type testCase struct {
+		MinSignatureStrength crypto.Hash
+		Err                  error
+	}
+
+	testCases := map[string]testCase{
+		"no minimum": testCase{
+			MinSignatureStrength: 0,
+			Err:                  nil,
+		},
+		"same as signature": testCase{
+			MinSignatureStrength: crypto.SHA256,
+			Err:                  nil,
+		},
+		"stronger than signature": testCase{
+			MinSignatureStrength: crypto.SHA512,
+			Err:                  dsig.ErrWeakSignature,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := verifyTestDocumentWithOptions(t, doc, dsig.VerifyOptions{MinSignatureStrength: tt.MinSignatureStrength})
+			assert.Equal(t, tt.Err, err)
+		})
+	}
+
+	// An RSA-SHA1 signature is rejected before the digest is even checked.
+	sha1Doc := strings.Replace(doc, dsig.SignatureMethodAlgorithmSHA256, dsig.SignatureMethodAlgorithmSHA1, 1)
+	assert.Equal(t, dsig.ErrWeakSignature, verifyTestDocumentWithOptions(t, sha1Doc, dsig.VerifyOptions{MinSignatureStrength: crypto.SHA256}))
+}
+
+func TestVerifyWithOptions_NewHash(t *testing.T) {
+	doc := signTestDocument(t, `<root><foo>xxx</foo>`+testSignatureFormat+`</root>`, base64.StdEncoding)
+
+	var hashes []crypto.Hash
+	var verified bool
+	opts := dsig.VerifyOptions{
+		NewHash: func(h crypto.Hash) hash.Hash {
+			hashes = append(hashes, h)
+			return h.New()
+		},
+		VerifyPKCS1v15: func(pub *rsa.PublicKey, h crypto.Hash, hashed []byte, sig []byte) error {
+			verified = true
+			return rsa.VerifyPKCS1v15(pub, h, hashed, sig)
+		},
+	}
+
+	// Both the digest and the signature are computed through the options.
+	assert.NoError(t, verifyTestDocumentWithOptions(t, doc, opts))
+	assert.Equal(t, []crypto.Hash{crypto.SHA256, crypto.SHA256}, hashes)
+	assert.True(t, verified)
+
+	// Errors from VerifyPKCS1v15 are returned as-is.
+	errModule := errors.New("module unavailable")
+	opts.VerifyPKCS1v15 = func(pub *rsa.PublicKey, h crypto.Hash, hashed []byte, sig []byte) error {
+		return errModule
+	}
+
+	assert.Equal(t, errModule, verifyTestDocumentWithOptions(t, doc, opts))
+}
+
+func TestVerifyWithOptions_NormalizePrefixes(t *testing.T) {
+	format := `<a:root xmlns:a="http://example.com/a"><a:foo>xxx</a:foo>` + testSignatureFormat + `</a:root>`
+	normalized := canon.Options{NormalizePrefixes: true}
+	doc := signTestDocumentWithOptions(t, format, base64.StdEncoding, sigsplit.Options{Outer: normalized, Inner: normalized})
+
+	// An intermediary renames the prefixes, and makes the payload's namespace
+	// the default namespace.
+	rewritten := strings.NewReplacer(
+		`xmlns:a="http://example.com/a"`, `xmlns="http://example.com/a"`,
+		"a:", "",
+		`xmlns:ds=`, `xmlns:ns1=`,
+		"ds:", "ns1:",
+	).Replace(doc)
+
+	opts := dsig.VerifyOptions{NormalizePrefixes: true}
+	assert.NoError(t, verifyTestDocumentWithOptions(t, doc, opts))
+	assert.NoError(t, verifyTestDocumentWithOptions(t, rewritten, opts))
+	assert.Equal(t, dsig.ErrBadDigest, verifyTestDocumentWithOptions(t, strings.Replace(rewritten, "xxx", "yyy", 1), opts))
+
+	// Without the option, the signature is over a form that no conforming signer
+	// would produce.
+	assert.Equal(t, dsig.ErrBadDigest, verifyTestDocument(t, doc))
+}
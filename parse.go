@@ -0,0 +1,297 @@
+package dsig
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrMalformedSignature is returned, wrapped in a *MalformedSignatureError, by
+// ParseSignature if a ds:Signature doesn't have the structure that the XML
+// Signature schema requires.
+var ErrMalformedSignature = errors.New("dsig: malformed signature")
+
+// MalformedSignatureError describes how a ds:Signature violates the XML
+// Signature schema.
+//
+// Path is the local names of the elements from the ds:Signature down to the
+// element with the problem, in the same "a>b>c" syntax as VerifyField. Reason
+// describes the problem.
+type MalformedSignatureError struct {
+	Path   string
+	Reason string
+}
+
+func (e *MalformedSignatureError) Error() string {
+	return fmt.Sprintf("%v: %s: %s", ErrMalformedSignature, e.Path, e.Reason)
+}
+
+// Unwrap returns ErrMalformedSignature.
+func (e *MalformedSignatureError) Unwrap() error {
+	return ErrMalformedSignature
+}
+
+// ParseSignature parses data, which must consist of a single ds:Signature
+// element, into a Signature.
+//
+// Unlike xml.Unmarshal, which ignores anything it doesn't expect,
+// ParseSignature checks the structure of the signature as StrictSignature
+// does, and returns a *MalformedSignatureError describing the first problem it
+// finds. Content other than comments, processing instructions, and whitespace
+// is not allowed around the ds:Signature. data is read with the default limits
+// of NewDecoder.
+func ParseSignature(data []byte) (*Signature, error) {
+	decoder := NewDecoder(bytes.NewReader(data))
+
+	var s *Signature
+	for {
+		t, err := decoder.Token()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+
+			return nil, err
+		}
+
+		switch t := t.(type) {
+		case xml.StartElement:
+			if s != nil {
+				return nil, &MalformedSignatureError{Path: t.Name.Local, Reason: "unexpected element after Signature"}
+			}
+
+			s, err = decodeStrict(decoder, t)
+			if err != nil {
+				return nil, err
+			}
+		case xml.CharData:
+			if len(bytes.TrimSpace(t)) != 0 {
+				return nil, &MalformedSignatureError{Path: "Signature", Reason: "unexpected text outside of Signature"}
+			}
+		}
+	}
+
+	if s == nil {
+		return nil, ErrSignatureNotFound
+	}
+
+	return s, nil
+}
+
+// StrictSignature is a Signature that checks its own structure when it's
+// unmarshaled. Embed it in place of Signature to get the checks of
+// ParseSignature for a signature inside of a larger document:
+//
+//  type Foo struct {
+//    MyData string
+//    Signature dsig.StrictSignature
+//  }
+//
+// The ds:Signature, and every element in it down to the contents of
+// ds:KeyInfo, ds:Object, and the algorithm elements, must be in the XML
+// Signature namespace. Each element must have the children the schema calls
+// for, in the order it calls for them, and nothing else. Algorithm elements
+// must have an Algorithm attribute, and the schema's element-only content may
+// contain only whitespace text. Only one ds:Reference is allowed, as that's all
+// that this package supports.
+//
+// If the signature violates any of these rules, unmarshaling fails with a
+// *MalformedSignatureError.
+type StrictSignature struct {
+	Signature
+}
+
+// UnmarshalXML implements xml.Unmarshaler.
+func (s *StrictSignature) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	sig, err := decodeStrict(d, start)
+	if err != nil {
+		return err
+	}
+
+	s.Signature = *sig
+	return nil
+}
+
+// decodeStrict reads the element that starts with start from d, checks its
+// structure, and decodes it into a Signature.
+func decodeStrict(d *xml.Decoder, start xml.StartElement) (*Signature, error) {
+	tokens := []xml.Token{start.Copy()}
+	for depth := 1; depth > 0; {
+		t, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch t.(type) {
+		case xml.StartElement:
+			depth++
+		case xml.EndElement:
+			depth--
+		}
+
+		tokens = append(tokens, xml.CopyToken(t))
+	}
+
+	if err := checkStructure(tokens, 0, "Signature", ""); err != nil {
+		return nil, err
+	}
+
+	var s Signature
+	replay := recorderReplay(tokens)
+	if err := xml.NewTokenDecoder(&replay).Decode(&s); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// structureRule describes what the XML Signature schema requires of an
+// element.
+type structureRule struct {
+	// children are the elements that must appear in the element, in order. If
+	// children is nil, the element's content isn't checked.
+	children []childRule
+
+	// attrs are the attributes that the element must have.
+	attrs []string
+}
+
+// childRule describes how many times an element may appear in its parent.
+type childRule struct {
+	name     string
+	min, max int
+}
+
+// structureRules are the rules for each element in the XML Signature
+// namespace whose structure is checked. Elements with open content, like
+// ds:KeyInfo and ds:Object, are absent, and their contents aren't checked.
+var structureRules = map[string]structureRule{
+	"Signature": structureRule{children: []childRule{
+		{name: "SignedInfo", min: 1, max: 1},
+		{name: "SignatureValue", min: 1, max: 1},
+		{name: "KeyInfo", min: 0, max: 1},
+		{name: "Object", min: 0, max: -1},
+	}},
+	"SignedInfo": structureRule{children: []childRule{
+		{name: "CanonicalizationMethod", min: 1, max: 1},
+		{name: "SignatureMethod", min: 1, max: 1},
+		{name: "Reference", min: 1, max: 1},
+	}},
+	"Reference": structureRule{children: []childRule{
+		{name: "Transforms", min: 0, max: 1},
+		{name: "DigestMethod", min: 1, max: 1},
+		{name: "DigestValue", min: 1, max: 1},
+	}},
+	"Transforms": structureRule{children: []childRule{
+		{name: "Transform", min: 1, max: -1},
+	}},
+	"SignatureValue":         structureRule{children: []childRule{}},
+	"DigestValue":            structureRule{children: []childRule{}},
+	"CanonicalizationMethod": structureRule{attrs: []string{"Algorithm"}},
+	"SignatureMethod":        structureRule{attrs: []string{"Algorithm"}},
+	"DigestMethod":           structureRule{attrs: []string{"Algorithm"}},
+	"Transform":              structureRule{attrs: []string{"Algorithm"}},
+}
+
+// checkStructure checks the element that starts at tokens[i], which must be
+// the element named want in the XML Signature namespace, against
+// structureRules. parent is the path to the element's parent.
+func checkStructure(tokens []xml.Token, i int, want, parent string) error {
+	start := tokens[i].(xml.StartElement)
+
+	path := start.Name.Local
+	if parent != "" {
+		path = parent + ">" + path
+	}
+
+	if start.Name.Space != namespace {
+		return &MalformedSignatureError{Path: path, Reason: "not in the XML Signature namespace"}
+	}
+
+	if start.Name.Local != want {
+		return &MalformedSignatureError{Path: path, Reason: "expected " + want}
+	}
+
+	rule := structureRules[want]
+	for _, name := range rule.attrs {
+		if !hasAttr(start, name) {
+			return &MalformedSignatureError{Path: path, Reason: "missing " + name + " attribute"}
+		}
+	}
+
+	if rule.children == nil {
+		return nil
+	}
+
+	// Find the element's children. Elements with children in the schema have
+	// element-only content, and can't have any text but whitespace.
+	var children []int
+	for j, depth := i+1, 1; depth > 0; j++ {
+		switch t := tokens[j].(type) {
+		case xml.StartElement:
+			if depth == 1 {
+				children = append(children, j)
+			}
+
+			depth++
+		case xml.EndElement:
+			depth--
+		case xml.CharData:
+			if depth == 1 && len(rule.children) > 0 && len(bytes.TrimSpace(t)) != 0 {
+				return &MalformedSignatureError{Path: path, Reason: "unexpected text"}
+			}
+		}
+	}
+
+	if len(rule.children) == 0 && len(children) > 0 {
+		name := tokens[children[0]].(xml.StartElement).Name.Local
+		return &MalformedSignatureError{Path: path, Reason: "unexpected element " + name}
+	}
+
+	next := 0
+	for _, child := range rule.children {
+		count := 0
+		for next < len(children) && (child.max == -1 || count < child.max) {
+			t := tokens[children[next]].(xml.StartElement)
+			if t.Name.Local != child.name {
+				break
+			}
+
+			if err := checkStructure(tokens, children[next], child.name, path); err != nil {
+				return err
+			}
+
+			count++
+			next++
+		}
+
+		if count < child.min {
+			if next < len(children) {
+				t := tokens[children[next]].(xml.StartElement)
+				return &MalformedSignatureError{Path: path, Reason: "expected " + child.name + ", found " + t.Name.Local}
+			}
+
+			return &MalformedSignatureError{Path: path, Reason: "missing " + child.name}
+		}
+	}
+
+	if next < len(children) {
+		t := tokens[children[next]].(xml.StartElement)
+		return &MalformedSignatureError{Path: path, Reason: "unexpected element " + t.Name.Local}
+	}
+
+	return nil
+}
+
+// hasAttr returns whether t has an unqualified attribute with the given name.
+func hasAttr(t xml.StartElement, name string) bool {
+	for _, attr := range t.Attr {
+		if attr.Name.Space == "" && attr.Name.Local == name {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,149 @@
+package dsig_test
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/dsig"
+)
+
+func TestParseSignature(t *testing.T) {
+	doc := signTestDocument(t, `<root><foo>xxx</foo>`+testSignatureFormat+`</root>`, base64.StdEncoding)
+
+	var payload struct {
+		Signature dsig.Signature `xml:"http://www.w3.org/2000/09/xmldsig# Signature"`
+	}
+
+	assert.NoError(t, xml.Unmarshal([]byte(doc), &payload))
+
+	start := strings.Index(doc, "<ds:Signature")
+	end := strings.Index(doc, "</ds:Signature>") + len("</ds:Signature>")
+
+	sig, err := dsig.ParseSignature([]byte("<?xml version=\"1.0\"?>\n" + doc[start:end] + "\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, &payload.Signature, sig)
+
+	// The parsed signature can be used to verify the document it came from.
+	assert.NoError(t, sig.Verify(testCert, xml.NewDecoder(strings.NewReader(doc))))
+}
+
+func TestParseSignature_Errors(t *testing.T) {
+	const (
+		c14n      = `<ds:CanonicalizationMethod Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"/>`
+		sigMethod = `<ds:SignatureMethod Algorithm="http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"/>`
+		digest    = `<ds:DigestMethod Algorithm="http://www.w3.org/2001/04/xmlenc#sha256"/><ds:DigestValue>AAAA</ds:DigestValue>`
+		reference = `<ds:Reference URI="">` + digest + `</ds:Reference>`
+		value     = `<ds:SignatureValue>AAAA</ds:SignatureValue>`
+	)
+
+	// signature wraps its argument in a ds:Signature element.
+	signature := func(format string, args ...interface{}) string {
+		return `<ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#">` + fmt.Sprintf(format, args...) + `</ds:Signature>`
+	}
+
+	type testCase struct {
+		In  string
+		Err error
+	}
+
+	testCases := map[string]testCase{
+		"wrong root namespace": testCase{
+			In:  `<Signature xmlns="http://example.com"/>`,
+			Err: &dsig.MalformedSignatureError{Path: "Signature", Reason: "not in the XML Signature namespace"},
+		},
+		"wrong root": testCase{
+			In:  `<ds:SignedInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#"/>`,
+			Err: &dsig.MalformedSignatureError{Path: "SignedInfo", Reason: "expected Signature"},
+		},
+		"empty": testCase{
+			In:  signature(""),
+			Err: &dsig.MalformedSignatureError{Path: "Signature", Reason: "missing SignedInfo"},
+		},
+		"missing SignedInfo": testCase{
+			In:  signature(value),
+			Err: &dsig.MalformedSignatureError{Path: "Signature", Reason: "expected SignedInfo, found SignatureValue"},
+		},
+		"missing SignatureValue": testCase{
+			In:  signature(`<ds:SignedInfo>%s%s%s</ds:SignedInfo>`, c14n, sigMethod, reference),
+			Err: &dsig.MalformedSignatureError{Path: "Signature", Reason: "missing SignatureValue"},
+		},
+		"out of order": testCase{
+			In:  signature(`%s<ds:SignedInfo>%s%s%s</ds:SignedInfo>`, value, c14n, sigMethod, reference),
+			Err: &dsig.MalformedSignatureError{Path: "Signature", Reason: "expected SignedInfo, found SignatureValue"},
+		},
+		"child in wrong namespace": testCase{
+			In:  signature(`<ds:SignedInfo>%s%s<Reference>%s</Reference></ds:SignedInfo>%s`, c14n, sigMethod, digest, value),
+			Err: &dsig.MalformedSignatureError{Path: "Signature>SignedInfo>Reference", Reason: "not in the XML Signature namespace"},
+		},
+		"unexpected element": testCase{
+			In:  signature(`<ds:SignedInfo>%s%s%s<ds:Foo/></ds:SignedInfo>%s`, c14n, sigMethod, reference, value),
+			Err: &dsig.MalformedSignatureError{Path: "Signature>SignedInfo", Reason: "unexpected element Foo"},
+		},
+		"several references": testCase{
+			In:  signature(`<ds:SignedInfo>%s%s%s%s</ds:SignedInfo>%s`, c14n, sigMethod, reference, reference, value),
+			Err: &dsig.MalformedSignatureError{Path: "Signature>SignedInfo", Reason: "unexpected element Reference"},
+		},
+		"missing algorithm": testCase{
+			In:  signature(`<ds:SignedInfo><ds:CanonicalizationMethod/>%s%s</ds:SignedInfo>%s`, sigMethod, reference, value),
+			Err: &dsig.MalformedSignatureError{Path: "Signature>SignedInfo>CanonicalizationMethod", Reason: "missing Algorithm attribute"},
+		},
+		"empty transforms": testCase{
+			In:  signature(`<ds:SignedInfo>%s%s<ds:Reference><ds:Transforms/>%s</ds:Reference></ds:SignedInfo>%s`, c14n, sigMethod, digest, value),
+			Err: &dsig.MalformedSignatureError{Path: "Signature>SignedInfo>Reference>Transforms", Reason: "missing Transform"},
+		},
+		"text in element-only content": testCase{
+			In:  signature(`<ds:SignedInfo>%s%s%s</ds:SignedInfo>hello%s`, c14n, sigMethod, reference, value),
+			Err: &dsig.MalformedSignatureError{Path: "Signature", Reason: "unexpected text"},
+		},
+		"element in text-only content": testCase{
+			In:  signature(`<ds:SignedInfo>%s%s%s</ds:SignedInfo><ds:SignatureValue><ds:Foo/></ds:SignatureValue>`, c14n, sigMethod, reference),
+			Err: &dsig.MalformedSignatureError{Path: "Signature>SignatureValue", Reason: "unexpected element Foo"},
+		},
+		"trailing element": testCase{
+			In:  signature(`<ds:SignedInfo>%s%s%s</ds:SignedInfo>%s`, c14n, sigMethod, reference, value) + `<foo/>`,
+			Err: &dsig.MalformedSignatureError{Path: "foo", Reason: "unexpected element after Signature"},
+		},
+		"no signature": testCase{
+			In:  `<!-- nothing here -->`,
+			Err: dsig.ErrSignatureNotFound,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := dsig.ParseSignature([]byte(tt.In))
+			assert.Equal(t, tt.Err, err)
+
+			if _, ok := tt.Err.(*dsig.MalformedSignatureError); ok {
+				assert.True(t, errors.Is(err, dsig.ErrMalformedSignature))
+			}
+		})
+	}
+
+	// Open content, such as KeyInfo, isn't checked.
+	sig := signature(`<ds:SignedInfo>%s%s%s</ds:SignedInfo>%s<ds:KeyInfo><x:Foo xmlns:x="http://example.com"/></ds:KeyInfo><ds:Object>hello</ds:Object>`, c14n, sigMethod, reference, value)
+	_, err := dsig.ParseSignature([]byte(sig))
+	assert.NoError(t, err)
+}
+
+func TestStrictSignature(t *testing.T) {
+	doc := signTestDocument(t, `<root><foo>xxx</foo>`+testSignatureFormat+`</root>`, base64.StdEncoding)
+
+	var payload struct {
+		Foo       string               `xml:"foo"`
+		Signature dsig.StrictSignature `xml:"http://www.w3.org/2000/09/xmldsig# Signature"`
+	}
+
+	assert.NoError(t, xml.Unmarshal([]byte(doc), &payload))
+	assert.Equal(t, "xxx", payload.Foo)
+	assert.NoError(t, payload.Signature.Verify(testCert, xml.NewDecoder(strings.NewReader(doc))))
+
+	malformed := strings.Replace(doc, "<ds:SignatureValue>", "<ds:Foo></ds:Foo><ds:SignatureValue>", 1)
+	err := xml.Unmarshal([]byte(malformed), &payload)
+	assert.Equal(t, &dsig.MalformedSignatureError{Path: "Signature", Reason: "expected SignatureValue, found Foo"}, err)
+}
@@ -0,0 +1,36 @@
+package dsig
+
+import "crypto"
+
+// PolicyFIPS returns VerifyOptions that accept only the algorithms and key
+// sizes that FIPS 140 permits for verifying signatures:
+//
+//  - Digests must use SHA256 or stronger.
+//  - Signature algorithms must hash with SHA256 or stronger.
+//  - RSA keys must be at least 2048 bits.
+//
+// This package supports no HMAC or ECDSA signature methods, so signatures
+// using them are always rejected with ErrBadSignatureAlgorithm, with or without
+// this policy. The policy does not route hashing to a validated module; set
+// NewHash and VerifyPKCS1v15 on the returned options to do that.
+//
+// The returned options are an ordinary VerifyOptions value, so they can be
+// logged, compared, or adjusted before use.
+func PolicyFIPS() VerifyOptions {
+	return VerifyOptions{
+		MinKeySize:           2048,
+		MinDigestStrength:    crypto.SHA256,
+		MinSignatureStrength: crypto.SHA256,
+	}
+}
+
+// PolicyLegacyCompatible returns VerifyOptions for interoperating with older
+// signers. SHA1 digests and RSA-SHA1 signatures are accepted, but RSA keys must
+// still be at least 1024 bits.
+//
+// Like PolicyFIPS, the returned options are an ordinary VerifyOptions value.
+func PolicyLegacyCompatible() VerifyOptions {
+	return VerifyOptions{
+		MinKeySize: 1024,
+	}
+}
@@ -0,0 +1,38 @@
+package dsig_test
+
+import (
+	"crypto"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/dsig"
+)
+
+func TestPolicyFIPS(t *testing.T) {
+	// These are pinned so that a change to the policy can't go unnoticed.
+	assert.Equal(t, dsig.VerifyOptions{
+		MinKeySize:           2048,
+		MinDigestStrength:    crypto.SHA256,
+		MinSignatureStrength: crypto.SHA256,
+	}, dsig.PolicyFIPS())
+
+	doc := signTestDocument(t, `<root><foo>xxx</foo>`+testSignatureFormat+`</root>`, base64.StdEncoding)
+	assert.NoError(t, verifyTestDocumentWithOptions(t, doc, dsig.PolicyFIPS()))
+
+	sha1Digest := strings.Replace(doc, dsig.DigestMethodAlgorithmSHA256, dsig.DigestMethodAlgorithmSHA1, 1)
+	assert.Equal(t, dsig.ErrWeakDigest, verifyTestDocumentWithOptions(t, sha1Digest, dsig.PolicyFIPS()))
+
+	sha1Signature := strings.Replace(doc, dsig.SignatureMethodAlgorithmSHA256, dsig.SignatureMethodAlgorithmSHA1, 1)
+	assert.Equal(t, dsig.ErrWeakSignature, verifyTestDocumentWithOptions(t, sha1Signature, dsig.PolicyFIPS()))
+}
+
+func TestPolicyLegacyCompatible(t *testing.T) {
+	assert.Equal(t, dsig.VerifyOptions{
+		MinKeySize: 1024,
+	}, dsig.PolicyLegacyCompatible())
+
+	doc := signTestDocument(t, `<root><foo>xxx</foo>`+testSignatureFormat+`</root>`, base64.StdEncoding)
+	assert.NoError(t, verifyTestDocumentWithOptions(t, doc, dsig.PolicyLegacyCompatible()))
+}
@@ -0,0 +1,200 @@
+package dsig
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+
+	"github.com/ucarion/dsig/internal/sigsplit"
+)
+
+// ErrMultipleSignatures is returned by PrecheckDocument if it can't tell which
+// of several ds:Signature elements in the document is the one to verify, and
+// by StripSignature, Resign, and AddSignature if a document has more than one
+// enveloped ds:Signature.
+var ErrMultipleSignatures = errors.New("dsig: multiple enveloped signatures")
+
+// ErrMissingSignedInfo is returned by PrecheckDocument if the signature has no
+// ds:SignedInfo.
+var ErrMissingSignedInfo = errors.New("dsig: signature has no SignedInfo")
+
+// ErrBadCanonicalizationAlgorithm is returned by PrecheckDocument if the
+// signature uses a canonicalization algorithm that this package does not
+// support, and by NewSignature if SignOptions.CanonicalizationAlgorithm isn't
+// supported.
+var ErrBadCanonicalizationAlgorithm = errors.New("dsig: invalid or unsupported canonicalization algorithm")
+
+// PrecheckDocument checks that the signature in data is one that Verify can
+// process, without doing any cryptography.
+//
+// The signature is found the way a caller of Verify usually finds it. If the
+// root element has ds:Signature children, there must be exactly one of them,
+// or else PrecheckDocument returns ErrMultipleSignatures. Otherwise, the root
+// element may itself be an enveloping ds:Signature, or the document may have a
+// single ds:Signature elsewhere that refers to an element by ID, such as one in
+// a SOAP header. If there is no such signature, PrecheckDocument returns
+// ErrSignatureNotFound.
+//
+// That signature must have a ds:SignedInfo, or else PrecheckDocument returns
+// ErrMissingSignedInfo. Its canonicalization and signature algorithms, and the
+// digest algorithm and transforms of each of its References, must be ones that
+// Verify supports, or else PrecheckDocument returns the error Verify would,
+// such as ErrBadSignatureAlgorithm or ErrBadDigestAlgorithm. A
+// canonicalization algorithm that Verify doesn't know leads to
+// ErrBadCanonicalizationAlgorithm. Each Reference must refer to data that
+// Verify can find in the document, or else PrecheckDocument returns an error
+// like ErrReferenceNotFound or ErrDuplicateID.
+//
+// PrecheckDocument checks the signature as VerifyWithOptions would with
+// AllowArbitraryReferences, so a document that it accepts may still be
+// rejected by Verify for where its signature or referenced elements are.
+//
+// data is read with the default limits of NewDecoder.
+//
+// A nil error from PrecheckDocument does not mean the signature is valid, only
+// that it's worth calling Verify on. PrecheckDocument is meant to let callers
+// cheaply reject documents that could never be verified.
+func PrecheckDocument(data []byte) error {
+	var tokens []xml.Token
+	decoder := NewDecoder(bytes.NewReader(data))
+	for {
+		t, err := decoder.RawToken()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+
+			return err
+		}
+
+		tokens = append(tokens, xml.CopyToken(t))
+	}
+
+	sig, err := findPrecheckSignature(tokens)
+	if err != nil {
+		return err
+	}
+
+	return sig.check(tokens)
+}
+
+// findPrecheckSignature returns the signature in tokens that PrecheckDocument
+// checks.
+func findPrecheckSignature(tokens []xml.Token) (*precheckSignature, error) {
+	var enveloped, enveloping, referencing []*precheckSignature
+
+	replay := recorderReplay(tokens)
+	decoder := xml.NewTokenDecoder(&replay)
+
+	depth := 0
+	for {
+		t, err := decoder.Token()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+
+			return nil, err
+		}
+
+		switch t := t.(type) {
+		case xml.StartElement:
+			depth++
+			if t.Name.Space != namespace || t.Name.Local != "Signature" {
+				continue
+			}
+
+			// The whole ds:Signature is decoded, so any signatures inside of it,
+			// such as counter-signatures, aren't considered.
+			sig := &precheckSignature{}
+			if err := decoder.DecodeElement(sig, &t); err != nil {
+				return nil, err
+			}
+
+			switch {
+			case depth == 1:
+				enveloping = append(enveloping, sig)
+			case depth == 2:
+				enveloped = append(enveloped, sig)
+			case sig.SignedInfo != nil && sig.SignedInfo.Reference().URI != "":
+				referencing = append(referencing, sig)
+			}
+
+			depth--
+		case xml.EndElement:
+			depth--
+		}
+	}
+
+	for _, sigs := range [][]*precheckSignature{enveloped, enveloping, referencing} {
+		switch len(sigs) {
+		case 0:
+			continue
+		case 1:
+			return sigs[0], nil
+		default:
+			return nil, ErrMultipleSignatures
+		}
+	}
+
+	return nil, ErrSignatureNotFound
+}
+
+// precheckSignature is like Signature, but distinguishes a missing SignedInfo
+// from an empty one.
+type precheckSignature struct {
+	SignedInfo     *SignedInfo    `xml:"http://www.w3.org/2000/09/xmldsig# SignedInfo"`
+	SignatureValue SignatureValue `xml:"http://www.w3.org/2000/09/xmldsig# SignatureValue"`
+}
+
+// check does the checks of PrecheckDocument on s, which is in tokens. Each of
+// its References is located in tokens as Verify would locate it, without
+// being digested.
+func (s *precheckSignature) check(tokens []xml.Token) error {
+	if s.SignedInfo == nil {
+		return ErrMissingSignedInfo
+	}
+
+	if err := s.SignedInfo.CanonicalizationMethod.check(); err != nil {
+		return err
+	}
+
+	if _, err := s.SignedInfo.SignatureMethod.hash(); err != nil {
+		return err
+	}
+
+	refs := s.SignedInfo.References
+	if len(refs) == 0 {
+		refs = []Reference{{}}
+	}
+
+	for _, ref := range refs {
+		for _, t := range ref.Transforms {
+			if err := t.check(); err != nil {
+				return err
+			}
+		}
+
+		if _, err := ref.DigestMethod.hash(); err != nil {
+			return err
+		}
+
+		id, err := ref.id()
+		if err != nil {
+			return err
+		}
+
+		replay := recorderReplay(tokens)
+		splitOpts := sigsplit.Options{
+			ID:                  id,
+			ReferenceURI:        s.SignedInfo.Reference().URI,
+			MatchSignatureValue: (&Signature{SignatureValue: s.SignatureValue}).matchSignatureValue(),
+		}
+		if _, _, err := sigsplit.SplitSignature(&replay, splitOpts); err != nil {
+			return splitError(err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package dsig_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/dsig"
+)
+
+func TestPrecheckDocument(t *testing.T) {
+	signature := fmt.Sprintf(testSignatureFormat, "", "")
+
+	type testCase struct {
+		Doc string
+		Err error
+	}
+
+	testCases := map[string]testCase{
+		"ok": testCase{
+			Doc: `<root><foo />` + signature + `</root>`,
+			Err: nil,
+		},
+		"no signature": testCase{
+			Doc: `<root><foo /></root>`,
+			Err: dsig.ErrSignatureNotFound,
+		},
+		"nested signature": testCase{
+			Doc: `<root><foo>` + signature + `</foo></root>`,
+			Err: dsig.ErrSignatureNotFound,
+		},
+		"multiple signatures": testCase{
+			Doc: `<root>` + signature + signature + `</root>`,
+			Err: dsig.ErrMultipleSignatures,
+		},
+		"no signed info": testCase{
+			Doc: `<root><ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:SignatureValue /></ds:Signature></root>`,
+			Err: dsig.ErrMissingSignedInfo,
+		},
+		"bad canonicalization algorithm": testCase{
+			Doc: `<root>` + strings.Replace(signature, `"http://www.w3.org/2001/10/xml-exc-c14n#"`, `"http://www.w3.org/2006/12/xml-c14n11"`, 1) + `</root>`,
+			Err: dsig.ErrBadCanonicalizationAlgorithm,
+		},
+		"bad signature algorithm": testCase{
+			Doc: `<root>` + strings.Replace(signature, dsig.SignatureMethodAlgorithmSHA256, "http://example.com/bad", 1) + `</root>`,
+			Err: dsig.ErrBadSignatureAlgorithm,
+		},
+		"bad digest algorithm": testCase{
+			Doc: `<root>` + strings.Replace(signature, dsig.DigestMethodAlgorithmSHA256, "http://example.com/bad", 1) + `</root>`,
+			Err: dsig.ErrBadDigestAlgorithm,
+		},
+		"no canonicalization method": testCase{
+			Doc: `<root>` + strings.Replace(signature, `<ds:CanonicalizationMethod Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"></ds:CanonicalizationMethod>`, "", 1) + `</root>`,
+			Err: nil,
+		},
+		"inclusive canonicalization": testCase{
+			Doc: `<root>` + strings.Replace(signature, `"http://www.w3.org/2001/10/xml-exc-c14n#"`, `"`+dsig.CanonicalizationMethodAlgorithmInclusive+`"`, 1) + `</root>`,
+			Err: nil,
+		},
+		"bad digest algorithm in second reference": testCase{
+			Doc: `<root><foo ID="foo" />` + secondReference(signature, "http://example.com/bad") + `</root>`,
+			Err: dsig.ErrBadDigestAlgorithm,
+		},
+		"second reference not found": testCase{
+			Doc: `<root>` + secondReference(signature, dsig.DigestMethodAlgorithmSHA256) + `</root>`,
+			Err: dsig.ErrReferenceNotFound,
+		},
+		"soap header": testCase{
+			Doc: fmt.Sprintf(testSOAPFormat, "", ""),
+			Err: nil,
+		},
+		"soap body missing": testCase{
+			Doc: strings.Replace(fmt.Sprintf(testSOAPFormat, "", ""), `wsu:Id="body"`, "", 1),
+			Err: dsig.ErrReferenceNotFound,
+		},
+		"enveloping": testCase{
+			Doc: `<ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:SignedInfo><ds:CanonicalizationMethod Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#" /><ds:SignatureMethod Algorithm="http://www.w3.org/2001/04/xmldsig-more#rsa-sha256" /><ds:Reference URI="#obj"><ds:DigestMethod Algorithm="http://www.w3.org/2001/04/xmlenc#sha256" /></ds:Reference></ds:SignedInfo><ds:Object Id="obj">xxx</ds:Object></ds:Signature>`,
+			Err: nil,
+		},
+		"too deep": testCase{
+			Doc: strings.Repeat("<a>", dsig.DefaultMaxDepth+1) + signature + strings.Repeat("</a>", dsig.DefaultMaxDepth+1),
+			Err: dsig.ErrDocumentTooDeep,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tt.Err, dsig.PrecheckDocument([]byte(tt.Doc)))
+		})
+	}
+}
+
+// secondReference adds a second Reference, to "#foo" and with the given
+// digest algorithm, to signature, which is formatted from testSignatureFormat.
+func secondReference(signature, digestAlgorithm string) string {
+	start := strings.Index(signature, "<ds:Reference")
+	end := strings.Index(signature, "</ds:Reference>") + len("</ds:Reference>")
+	ref := strings.NewReplacer(`URI=""`, `URI="#foo"`, dsig.DigestMethodAlgorithmSHA256, digestAlgorithm).Replace(signature[start:end])
+
+	return signature[:end] + ref + signature[end:]
+}
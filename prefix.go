@@ -0,0 +1,234 @@
+package dsig
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"unicode"
+)
+
+// ErrInvalidPrefix is returned by NewSignature if SignOptions.Prefix isn't a
+// valid namespace prefix.
+var ErrInvalidPrefix = errors.New("dsig: invalid namespace prefix")
+
+// signature is Signature without its MarshalXML method, so that it can be
+// marshaled the default way.
+type signature Signature
+
+// MarshalXML implements xml.Marshaler. If s.Prefix is empty, s is marshaled as
+// it would be without this method, with the XML-DSig namespace as the default
+// namespace. Otherwise, every element in the XML-DSig namespace is written with
+// s.Prefix, which is declared once, on ds:Signature.
+//
+// The content of each Object is written as-is. Elements in it without a prefix
+// are in whatever the default namespace is where they appear, which with a
+// non-empty s.Prefix isn't the XML-DSig namespace.
+//
+// If s.Base64LineLength is positive, the line breaks in the SignatureValue,
+// DigestValues, and X509Certificates of s are written as literal newlines,
+// rather than as the character references xml.Encoder would otherwise use.
+func (s Signature) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if s.Prefix == "" && s.Base64LineLength <= 0 {
+		return e.Encode(signature(s))
+	}
+
+	data, err := xml.Marshal(signature(s))
+	if err != nil {
+		return err
+	}
+
+	if s.Prefix != "" {
+		if data, err = prefixNames(data, s.Prefix); err != nil {
+			return err
+		}
+	}
+
+	if s.Base64LineLength > 0 {
+		if data, err = unescapeLineBreaks(data); err != nil {
+			return err
+		}
+	}
+
+	return encodeRaw(e, data)
+}
+
+// UnmarshalXML implements xml.Unmarshaler. s is decoded as it would be without
+// this method, and then s.Prefix and s.Base64LineLength are set to how s was
+// written, so that marshaling s again writes it the same way.
+//
+// s.Prefix is set to the prefix that the start tag of ds:Signature declares
+// for the XML-DSig namespace, if it declares one and doesn't make it the
+// default namespace, as MarshalXML does. If the prefix is declared on an
+// ancestor instead, s.Prefix is left empty, as xml.Decoder doesn't report
+// prefixes. s.Base64LineLength is set if the SignatureValue is wrapped into
+// lines of equal length, as MarshalXML wraps it.
+func (s *Signature) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	if err := d.DecodeElement((*signature)(s), &start); err != nil {
+		return err
+	}
+
+	s.Prefix = declaredPrefix(start)
+	s.Base64LineLength = base64LineLength(s.SignatureValue.Value)
+	return nil
+}
+
+// declaredPrefix returns the prefix that start declares for the XML-DSig
+// namespace, or the empty string if it declares none, or declares the XML-DSig
+// namespace as the default namespace.
+func declaredPrefix(start xml.StartElement) string {
+	prefix := ""
+	for _, attr := range start.Attr {
+		if attr.Value != namespace {
+			continue
+		}
+
+		if attr.Name.Space == "" && attr.Name.Local == "xmlns" {
+			return ""
+		}
+
+		if attr.Name.Space == "xmlns" && prefix == "" {
+			prefix = attr.Name.Local
+		}
+	}
+
+	return prefix
+}
+
+// prefixNames rewrites data, a marshaled Signature, so that every element in
+// the XML-DSig namespace is written with prefix.
+func prefixNames(data []byte, prefix string) ([]byte, error) {
+	var out bytes.Buffer
+	e := xml.NewEncoder(&out)
+
+	// defaults holds the default namespace of each open element, and renamed
+	// holds the name each open element was written with.
+	var defaults []string
+	var renamed []xml.Name
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		t, err := decoder.RawToken()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+
+			return nil, err
+		}
+
+		switch t := t.(type) {
+		case xml.StartElement:
+			defaultNamespace := ""
+			if len(defaults) > 0 {
+				defaultNamespace = defaults[len(defaults)-1]
+			}
+
+			for _, attr := range t.Attr {
+				if attr.Name.Space == "" && attr.Name.Local == "xmlns" {
+					defaultNamespace = attr.Value
+				}
+			}
+
+			defaults = append(defaults, defaultNamespace)
+
+			out := xml.StartElement{Name: rawName(t.Name)}
+			if t.Name.Space == "" && defaultNamespace == namespace {
+				out.Name = xml.Name{Local: prefix + ":" + t.Name.Local}
+			}
+
+			if len(renamed) == 0 {
+				out.Attr = append(out.Attr, xml.Attr{Name: xml.Name{Local: "xmlns:" + prefix}, Value: namespace})
+			}
+
+			for _, attr := range t.Attr {
+				if attr.Name.Space == "" && attr.Name.Local == "xmlns" && attr.Value == namespace {
+					continue
+				}
+
+				out.Attr = append(out.Attr, xml.Attr{Name: rawName(attr.Name), Value: attr.Value})
+			}
+
+			renamed = append(renamed, out.Name)
+			if err := e.EncodeToken(out); err != nil {
+				return nil, err
+			}
+		case xml.EndElement:
+			name := renamed[len(renamed)-1]
+			defaults = defaults[:len(defaults)-1]
+			renamed = renamed[:len(renamed)-1]
+
+			if err := e.EncodeToken(xml.EndElement{Name: name}); err != nil {
+				return nil, err
+			}
+		default:
+			if err := e.EncodeToken(t); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := e.Flush(); err != nil {
+		return nil, err
+	}
+
+	return out.Bytes(), nil
+}
+
+// encodeRaw writes data, a single marshaled element, to e unchanged.
+func encodeRaw(e *xml.Encoder, data []byte) error {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	t, err := decoder.RawToken()
+	if err != nil {
+		return err
+	}
+
+	root, ok := t.(xml.StartElement)
+	if !ok {
+		return fmt.Errorf("dsig: marshaled signature starts with %T", t)
+	}
+
+	start := xml.StartElement{Name: rawName(root.Name)}
+	for _, attr := range root.Attr {
+		start.Attr = append(start.Attr, xml.Attr{Name: rawName(attr.Name), Value: attr.Value})
+	}
+
+	// xml.Marshal writes nothing after the end tag of the root element.
+	end := len(data) - len("</"+start.Name.Local+">")
+
+	return e.EncodeElement(struct {
+		Content []byte `xml:",innerxml"`
+	}{data[decoder.InputOffset():end]}, start)
+}
+
+// rawName returns name, as returned by RawToken, with its prefix folded into
+// its local name, so that xml.Encoder writes it unchanged.
+func rawName(name xml.Name) xml.Name {
+	if name.Space == "" {
+		return name
+	}
+
+	return xml.Name{Local: name.Space + ":" + name.Local}
+}
+
+// validPrefix returns whether prefix can be declared as a namespace prefix.
+func validPrefix(prefix string) bool {
+	if prefix == "" || len(prefix) >= 3 && (prefix[0] == 'x' || prefix[0] == 'X') && (prefix[1] == 'm' || prefix[1] == 'M') && (prefix[2] == 'l' || prefix[2] == 'L') {
+		return false
+	}
+
+	for i, r := range prefix {
+		if unicode.IsLetter(r) || r == '_' {
+			continue
+		}
+
+		if i > 0 && (unicode.IsDigit(r) || r == '-' || r == '.') {
+			continue
+		}
+
+		return false
+	}
+
+	return true
+}
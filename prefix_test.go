@@ -0,0 +1,148 @@
+package dsig_test
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/dsig"
+)
+
+func TestSignature_MarshalXML(t *testing.T) {
+	type doc struct {
+		XMLName   xml.Name `xml:"urn:example Doc"`
+		Foo       string   `xml:"urn:example Foo"`
+		Signature dsig.Signature
+	}
+
+	type testCase struct {
+		Prefix string
+		Start  string
+	}
+
+	testCases := map[string]testCase{
+		"default namespace": testCase{
+			Prefix: "",
+			Start:  `<Doc xmlns="urn:example"><Foo xmlns="urn:example">xxx</Foo><Signature xmlns="http://www.w3.org/2000/09/xmldsig#"><SignedInfo xmlns="http://www.w3.org/2000/09/xmldsig#">`,
+		},
+		"ds": testCase{
+			Prefix: "ds",
+			Start:  `<Doc xmlns="urn:example"><Foo xmlns="urn:example">xxx</Foo><ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:SignedInfo>`,
+		},
+		"other": testCase{
+			Prefix: "sig",
+			Start:  `<Doc xmlns="urn:example"><Foo xmlns="urn:example">xxx</Foo><sig:Signature xmlns:sig="http://www.w3.org/2000/09/xmldsig#"><sig:SignedInfo>`,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			s, err := dsig.NewSignature(dsig.SignOptions{Certificate: testCert, Prefix: tt.Prefix})
+			assert.NoError(t, err)
+
+			d := doc{Foo: "xxx", Signature: *s}
+			unsigned, err := xml.Marshal(d)
+			assert.NoError(t, err)
+			assert.NoError(t, d.Signature.Sign(testKey, xml.NewDecoder(bytes.NewReader(unsigned))))
+
+			signed, err := xml.Marshal(d)
+			assert.NoError(t, err)
+			assert.True(t, strings.HasPrefix(string(signed), tt.Start), string(signed))
+
+			var decoded doc
+			assert.NoError(t, xml.Unmarshal(signed, &decoded))
+			assert.Equal(t, d.Signature.SignatureValue.Value, decoded.Signature.SignatureValue.Value)
+			assert.NoError(t, decoded.Signature.Verify(testCert, xml.NewDecoder(bytes.NewReader(signed))))
+		})
+	}
+}
+
+func TestSignature_MarshalXMLEnveloping(t *testing.T) {
+	object := dsig.Object{ID: "obj", Content: []byte(`<Foo xmlns="urn:example">xxx</Foo>`)}
+	s, err := dsig.SignEnveloping(testKey, object, dsig.SignOptions{Prefix: "ds"})
+	assert.NoError(t, err)
+
+	data, err := xml.Marshal(s)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `<ds:Object Id="obj"><Foo xmlns="urn:example">xxx</Foo></ds:Object></ds:Signature>`)
+
+	var decoded dsig.Signature
+	assert.NoError(t, xml.Unmarshal(data, &decoded))
+	assert.NoError(t, decoded.Verify(testCert, xml.NewDecoder(bytes.NewReader(data))))
+}
+
+func TestNewSignature_InvalidPrefix(t *testing.T) {
+	for _, prefix := range []string{"ds:x", "1ds", "xmlns", "XML", "d s"} {
+		t.Run(prefix, func(t *testing.T) {
+			_, err := dsig.NewSignature(dsig.SignOptions{Prefix: prefix})
+			assert.Equal(t, dsig.ErrInvalidPrefix, err)
+		})
+	}
+}
+
+func TestSignature_MarshalXMLDetached(t *testing.T) {
+	s, err := dsig.SignDetached(testKey, "file.bin", strings.NewReader("xxx"), dsig.SignOptions{Prefix: "ds"})
+	assert.NoError(t, err)
+
+	data, err := xml.Marshal(s)
+	assert.NoError(t, err)
+
+	// ds:SignedInfo, once canonicalized, declares the ds prefix it uses.
+	start := strings.Index(string(data), "<ds:SignedInfo>")
+	end := strings.Index(string(data), "</ds:SignedInfo>") + len("</ds:SignedInfo>")
+	signedInfo := strings.Replace(string(data[start:end]), "<ds:SignedInfo>", `<ds:SignedInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#">`, 1)
+
+	signature, err := base64.StdEncoding.DecodeString(s.SignatureValue.Value)
+	assert.NoError(t, err)
+
+	hashed := sha256.Sum256([]byte(signedInfo))
+	assert.NoError(t, rsa.VerifyPKCS1v15(&testKey.PublicKey, crypto.SHA256, hashed[:], signature))
+}
+
+func TestSignature_UnmarshalXMLRoundTrip(t *testing.T) {
+	type testCase struct {
+		Opts   dsig.SignOptions
+		Prefix string
+		Length int
+	}
+
+	testCases := map[string]testCase{
+		"default namespace":  testCase{Opts: dsig.SignOptions{}},
+		"ds":                 testCase{Opts: dsig.SignOptions{Prefix: "ds"}, Prefix: "ds"},
+		"other":              testCase{Opts: dsig.SignOptions{Prefix: "sig"}, Prefix: "sig"},
+		"base64 line length": testCase{Opts: dsig.SignOptions{Prefix: "ds", Base64LineLength: 64}, Prefix: "ds", Length: 64},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			signed, err := dsig.SignDocument([]byte(`<root><foo>xxx</foo></root>`), testKey, testCert, tt.Opts)
+			assert.NoError(t, err)
+
+			var payload struct {
+				Signature dsig.Signature `xml:"http://www.w3.org/2000/09/xmldsig# Signature"`
+			}
+
+			assert.NoError(t, xml.Unmarshal(signed, &payload))
+			assert.Equal(t, tt.Prefix, payload.Signature.Prefix)
+			assert.Equal(t, tt.Length, payload.Signature.Base64LineLength)
+
+			// Marshaling the unmarshaled signature writes it as it was, so it
+			// still verifies in place of the original.
+			remarshaled, err := xml.Marshal(payload.Signature)
+			assert.NoError(t, err)
+
+			start := bytes.Index(signed, []byte("<foo>xxx</foo>")) + len("<foo>xxx</foo>")
+			end := bytes.LastIndex(signed, []byte("</root>"))
+			assert.Equal(t, string(signed[start:end]), string(remarshaled))
+
+			doc := string(signed[:start]) + string(remarshaled) + string(signed[end:])
+			assert.NoError(t, payload.Signature.Verify(testCert, xml.NewDecoder(strings.NewReader(doc))))
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package dsig
+
+import (
+	"encoding/xml"
+	"io"
+
+	"github.com/ucarion/c14n"
+)
+
+// progressInterval is roughly how many bytes of XML are read between calls to
+// VerifyOptions.Progress.
+const progressInterval = 64 * 1024
+
+// progressReader is a c14n.RawTokenReader that reports how much XML has been
+// read from r to a callback.
+type progressReader struct {
+	r        c14n.RawTokenReader
+	progress func(bytesProcessed int64)
+	n        int64 // bytes read so far
+	reported int64 // value of n when progress was last called
+}
+
+func (p *progressReader) RawToken() (xml.Token, error) {
+	t, err := p.r.RawToken()
+	if err == io.EOF && p.n != p.reported {
+		p.reported = p.n
+		p.progress(p.n)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	p.n += tokenSize(t)
+	if p.n-p.reported >= progressInterval {
+		p.reported = p.n
+		p.progress(p.n)
+	}
+
+	return t, nil
+}
+
+// tokenSize approximates the number of bytes that t took up in the document it
+// was read from. Entities, quoting, and whitespace inside tags are not
+// accounted for exactly.
+func tokenSize(t xml.Token) int64 {
+	nameSize := func(n xml.Name) int64 {
+		if n.Space == "" {
+			return int64(len(n.Local))
+		}
+
+		return int64(len(n.Space) + 1 + len(n.Local))
+	}
+
+	switch t := t.(type) {
+	case xml.StartElement:
+		size := nameSize(t.Name) + 2 // "<" and ">"
+		for _, attr := range t.Attr {
+			size += nameSize(attr.Name) + int64(len(attr.Value)) + 4 // ` ="` and `"`
+		}
+
+		return size
+	case xml.EndElement:
+		return nameSize(t.Name) + 3 // "</" and ">"
+	case xml.CharData:
+		return int64(len(t))
+	case xml.Comment:
+		return int64(len(t)) + 7 // "<!--" and "-->"
+	case xml.ProcInst:
+		return int64(len(t.Target)+len(t.Inst)) + 5 // "<?", " ", and "?>"
+	case xml.Directive:
+		return int64(len(t)) + 3 // "<!" and ">"
+	default:
+		return 0
+	}
+}
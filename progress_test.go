@@ -0,0 +1,48 @@
+package dsig_test
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/dsig"
+)
+
+func TestVerifyWithOptions_Progress(t *testing.T) {
+	type testCase struct {
+		Items    int
+		MinCalls int
+		MaxCalls int
+	}
+
+	testCases := map[string]testCase{
+		"small": testCase{Items: 1, MinCalls: 1, MaxCalls: 1},
+		"large": testCase{Items: 20000, MinCalls: 5, MaxCalls: 100},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			items := strings.Repeat(`<item a="b">some text</item>`, tt.Items)
+			doc := signTestDocument(t, `<root>`+items+testSignatureFormat+`</root>`, base64.StdEncoding)
+
+			var calls []int64
+			opts := dsig.VerifyOptions{
+				Progress: func(bytesProcessed int64) {
+					calls = append(calls, bytesProcessed)
+				},
+			}
+
+			assert.NoError(t, verifyTestDocumentWithOptions(t, doc, opts))
+			assert.True(t, len(calls) >= tt.MinCalls && len(calls) <= tt.MaxCalls, "%d calls", len(calls))
+
+			for i := 1; i < len(calls); i++ {
+				assert.True(t, calls[i] > calls[i-1], "call %d: %d after %d", i, calls[i], calls[i-1])
+			}
+
+			// The final call is an estimate of the size of the whole document.
+			last := calls[len(calls)-1]
+			assert.InDelta(t, len(doc), last, float64(len(doc))/10)
+		})
+	}
+}
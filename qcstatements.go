@@ -0,0 +1,150 @@
+package dsig
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// OIDQCStatements is the OID of the QCStatements certificate extension, defined
+// in RFC 3739.
+var OIDQCStatements = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 3}
+
+// OIDQcCompliance is the OID of the QcCompliance statement, defined in ETSI EN
+// 319 412-5. It asserts that a certificate is an EU qualified certificate.
+var OIDQcCompliance = asn1.ObjectIdentifier{0, 4, 0, 1862, 1, 1}
+
+// OIDQcType is the OID of the QcType statement, defined in ETSI EN 319 412-5.
+// Its contents are a list of the types of the certificate, such as
+// OIDQcTypeESeal.
+var OIDQcType = asn1.ObjectIdentifier{0, 4, 0, 1862, 1, 6}
+
+// OIDQcTypeESign is the QcType of certificates for electronic signatures.
+var OIDQcTypeESign = asn1.ObjectIdentifier{0, 4, 0, 1862, 1, 6, 1}
+
+// OIDQcTypeESeal is the QcType of certificates for electronic seals.
+var OIDQcTypeESeal = asn1.ObjectIdentifier{0, 4, 0, 1862, 1, 6, 2}
+
+// OIDQcTypeWeb is the QcType of certificates for website authentication.
+var OIDQcTypeWeb = asn1.ObjectIdentifier{0, 4, 0, 1862, 1, 6, 3}
+
+// ErrBadQCStatements is returned by VerifyWithOptions if
+// VerifyOptions.QCStatements is set and the certificate's QCStatements
+// extension can't be parsed.
+var ErrBadQCStatements = errors.New("dsig: malformed QCStatements extension")
+
+// QCStatementsPolicy describes the QCStatements a certificate must have.
+type QCStatementsPolicy struct {
+	// Statements are the OIDs of the statements that must be present, such as
+	// OIDQcCompliance.
+	Statements []asn1.ObjectIdentifier
+
+	// Types are the QcTypes that the certificate's QcType statement must list,
+	// such as OIDQcTypeESeal. If Types is non-empty, the QcType statement is
+	// required even if it isn't in Statements.
+	Types []asn1.ObjectIdentifier
+}
+
+// MissingQCStatementsError is returned by VerifyWithOptions if
+// VerifyOptions.QCStatements is set and the certificate doesn't satisfy it.
+//
+// Statements and Types are the required statements and QcTypes that the
+// certificate lacks.
+type MissingQCStatementsError struct {
+	Statements []asn1.ObjectIdentifier
+	Types      []asn1.ObjectIdentifier
+}
+
+func (e *MissingQCStatementsError) Error() string {
+	var missing []string
+	for _, oid := range e.Statements {
+		missing = append(missing, "statement "+oid.String())
+	}
+
+	for _, oid := range e.Types {
+		missing = append(missing, "type "+oid.String())
+	}
+
+	return fmt.Sprintf("dsig: certificate is missing QCStatements: %s", strings.Join(missing, ", "))
+}
+
+// qcStatement is a QCStatement from RFC 3739:
+//
+//  QCStatement ::= SEQUENCE {
+//    statementId   OBJECT IDENTIFIER,
+//    statementInfo ANY DEFINED BY statementId OPTIONAL }
+type qcStatement struct {
+	ID   asn1.ObjectIdentifier
+	Info asn1.RawValue `asn1:"optional"`
+}
+
+// check returns an error if cert doesn't satisfy p. cert may be nil, in which
+// case nothing is satisfied.
+func (p *QCStatementsPolicy) check(cert *x509.Certificate) error {
+	var statements []qcStatement
+	if cert != nil {
+		for _, ext := range cert.Extensions {
+			if !ext.Id.Equal(OIDQCStatements) {
+				continue
+			}
+
+			rest, err := asn1.Unmarshal(ext.Value, &statements)
+			if err != nil || len(rest) != 0 {
+				return ErrBadQCStatements
+			}
+		}
+	}
+
+	var ids, types []asn1.ObjectIdentifier
+	for _, s := range statements {
+		ids = append(ids, s.ID)
+		if !s.ID.Equal(OIDQcType) {
+			continue
+		}
+
+		// QcType-statement ::= SEQUENCE OF OBJECT IDENTIFIER
+		var t []asn1.ObjectIdentifier
+		rest, err := asn1.Unmarshal(s.Info.FullBytes, &t)
+		if err != nil || len(rest) != 0 {
+			return ErrBadQCStatements
+		}
+
+		types = append(types, t...)
+	}
+
+	required := p.Statements
+	if len(p.Types) > 0 {
+		required = append(append([]asn1.ObjectIdentifier{}, required...), OIDQcType)
+	}
+
+	missing := &MissingQCStatementsError{}
+	for _, oid := range required {
+		if !containsOID(ids, oid) && !containsOID(missing.Statements, oid) {
+			missing.Statements = append(missing.Statements, oid)
+		}
+	}
+
+	for _, oid := range p.Types {
+		if !containsOID(types, oid) {
+			missing.Types = append(missing.Types, oid)
+		}
+	}
+
+	if len(missing.Statements) > 0 || len(missing.Types) > 0 {
+		return missing
+	}
+
+	return nil
+}
+
+func containsOID(oids []asn1.ObjectIdentifier, oid asn1.ObjectIdentifier) bool {
+	for _, o := range oids {
+		if o.Equal(oid) {
+			return true
+		}
+	}
+
+	return false
+}
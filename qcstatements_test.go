@@ -0,0 +1,180 @@
+package dsig_test
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/dsig"
+)
+
+type testQCStatement struct {
+	ID   asn1.ObjectIdentifier
+	Info asn1.RawValue `asn1:"optional"`
+}
+
+// qcStatementsExtension returns a QCStatements extension with a QcCompliance
+// statement if compliance is true, and a QcType statement listing types if
+// types is non-nil.
+func qcStatementsExtension(t *testing.T, compliance bool, types []asn1.ObjectIdentifier) pkix.Extension {
+	var statements []testQCStatement
+	if compliance {
+		statements = append(statements, testQCStatement{ID: dsig.OIDQcCompliance})
+	}
+
+	if types != nil {
+		info, err := asn1.Marshal(types)
+		assert.NoError(t, err)
+		statements = append(statements, testQCStatement{ID: dsig.OIDQcType, Info: asn1.RawValue{FullBytes: info}})
+	}
+
+	value, err := asn1.Marshal(statements)
+	assert.NoError(t, err)
+
+	return pkix.Extension{Id: dsig.OIDQCStatements, Value: value}
+}
+
+// certWithExtensions returns a certificate for testKey with the given extra
+// extensions.
+func certWithExtensions(t *testing.T, extensions []pkix.Extension) *x509.Certificate {
+	template := x509.Certificate{
+		SerialNumber:    big.NewInt(1),
+		Subject:         pkix.Name{CommonName: "www.example.com"},
+		NotBefore:       time.Now().Add(-time.Hour),
+		NotAfter:        time.Now().Add(time.Hour),
+		ExtraExtensions: extensions,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &testKey.PublicKey, testKey)
+	assert.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+
+	return cert
+}
+
+func TestVerifyWithOptions_QCStatements(t *testing.T) {
+	doc := signTestDocument(t, `<root><foo>xxx</foo>`+testSignatureFormat+`</root>`, base64.StdEncoding)
+
+	var payload struct {
+		Signature dsig.Signature `xml:"http://www.w3.org/2000/09/xmldsig# Signature"`
+	}
+
+	assert.NoError(t, xml.Unmarshal([]byte(doc), &payload))
+
+	eseal := &dsig.QCStatementsPolicy{
+		Statements: []asn1.ObjectIdentifier{dsig.OIDQcCompliance},
+		Types:      []asn1.ObjectIdentifier{dsig.OIDQcTypeESeal},
+	}
+
+	type testCase struct {
+		Extensions []pkix.Extension
+		Policy     *dsig.QCStatementsPolicy
+		Err        error
+	}
+
+	testCases := map[string]testCase{
+		"no policy": testCase{
+			Extensions: nil,
+			Policy:     nil,
+			Err:        nil,
+		},
+		"qualified eseal": testCase{
+			Extensions: []pkix.Extension{qcStatementsExtension(t, true, []asn1.ObjectIdentifier{dsig.OIDQcTypeESeal})},
+			Policy:     eseal,
+			Err:        nil,
+		},
+		"several types": testCase{
+			Extensions: []pkix.Extension{qcStatementsExtension(t, true, []asn1.ObjectIdentifier{dsig.OIDQcTypeESign, dsig.OIDQcTypeESeal})},
+			Policy:     eseal,
+			Err:        nil,
+		},
+		"missing compliance": testCase{
+			Extensions: []pkix.Extension{qcStatementsExtension(t, false, []asn1.ObjectIdentifier{dsig.OIDQcTypeESeal})},
+			Policy:     eseal,
+			Err: &dsig.MissingQCStatementsError{
+				Statements: []asn1.ObjectIdentifier{dsig.OIDQcCompliance},
+			},
+		},
+		"wrong type": testCase{
+			Extensions: []pkix.Extension{qcStatementsExtension(t, true, []asn1.ObjectIdentifier{dsig.OIDQcTypeESign})},
+			Policy:     eseal,
+			Err: &dsig.MissingQCStatementsError{
+				Types: []asn1.ObjectIdentifier{dsig.OIDQcTypeESeal},
+			},
+		},
+		"no extension": testCase{
+			Extensions: nil,
+			Policy:     eseal,
+			Err: &dsig.MissingQCStatementsError{
+				Statements: []asn1.ObjectIdentifier{dsig.OIDQcCompliance, dsig.OIDQcType},
+				Types:      []asn1.ObjectIdentifier{dsig.OIDQcTypeESeal},
+			},
+		},
+		"malformed extension": testCase{
+			Extensions: []pkix.Extension{pkix.Extension{Id: dsig.OIDQCStatements, Value: []byte{0x30, 0x03, 0x06}}},
+			Policy:     eseal,
+			Err:        dsig.ErrBadQCStatements,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			cert := certWithExtensions(t, tt.Extensions)
+			opts := dsig.VerifyOptions{QCStatements: tt.Policy}
+			err := payload.Signature.VerifyWithOptions(cert, xml.NewDecoder(strings.NewReader(doc)), opts)
+			assert.Equal(t, tt.Err, err)
+		})
+	}
+}
+
+func TestVerifyWithTrustStore_QCStatements(t *testing.T) {
+	doc := signTestDocument(t, `<root><foo>xxx</foo>`+testSignatureFormat+`</root>`, base64.StdEncoding)
+
+	var payload struct {
+		Signature dsig.Signature `xml:"http://www.w3.org/2000/09/xmldsig# Signature"`
+	}
+
+	assert.NoError(t, xml.Unmarshal([]byte(doc), &payload))
+
+	opts := dsig.VerifyOptions{
+		QCStatements: &dsig.QCStatementsPolicy{
+			Statements: []asn1.ObjectIdentifier{dsig.OIDQcCompliance},
+		},
+	}
+
+	// A bare public key has no certificate, and so can't satisfy the policy.
+	var keys dsig.TrustStore
+	keys.AddPublicKey(testCert.PublicKey)
+
+	_, err := payload.Signature.VerifyWithTrustStore(&keys, xml.NewDecoder(strings.NewReader(doc)), opts)
+
+	var missingErr *dsig.MissingQCStatementsError
+	assert.True(t, errors.As(err, &missingErr))
+
+	var certs dsig.TrustStore
+	certs.AddPublicKey(testCert.PublicKey)
+	certs.AddCertificate(certWithExtensions(t, []pkix.Extension{qcStatementsExtension(t, true, nil)}))
+
+	_, err = payload.Signature.VerifyWithTrustStore(&certs, xml.NewDecoder(strings.NewReader(doc)), opts)
+	assert.NoError(t, err)
+}
+
+func TestMissingQCStatementsError_Error(t *testing.T) {
+	err := &dsig.MissingQCStatementsError{
+		Statements: []asn1.ObjectIdentifier{dsig.OIDQcCompliance},
+		Types:      []asn1.ObjectIdentifier{dsig.OIDQcTypeESeal},
+	}
+
+	assert.Equal(t, "dsig: certificate is missing QCStatements: statement 0.4.0.1862.1.1, type 0.4.0.1862.1.6.2", err.Error())
+}
@@ -0,0 +1,120 @@
+package dsig
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+)
+
+// ebbpNamespace is the XML namespace of ebXML Business Process signals, which
+// ebMS 3.0 and AS4 receipts use to acknowledge a message.
+var ebbpNamespace = "http://docs.oasis-open.org/ebxml-bp/ebbp-signals-2.0"
+
+// ErrReceiptMismatch is returned by MatchNonRepudiationReceipt if a receipt
+// doesn't echo the digests of the message it's compared against.
+var ErrReceiptMismatch = errors.New("dsig: receipt does not match sent references")
+
+// MatchNonRepudiationReceipt checks that receipt, an ebMS 3.0 or AS4
+// non-repudiation receipt such as those exchanged in Peppol, acknowledges a
+// message whose signature had the References sent.
+//
+// Such a receipt has an ebbp:NonRepudiationInformation with an
+// ebbp:MessagePartNRInformation for each part of the message, each holding a
+// copy of a ds:Reference of the message's signature. MatchNonRepudiationReceipt
+// returns ErrReceiptMismatch unless the receipt has exactly one
+// ebbp:NonRepudiationInformation, and its References correspond one-to-one to
+// sent, with the same URI, DigestMethod, and digest. Digests are compared after
+// decoding them from base64, so they may be wrapped differently.
+//
+// sent are the References of the signature on the message that was sent, such
+// as SignedInfo.References after calling Sign, or the References of the
+// ds:Signature that SignDocument inserted. They need to be kept until the
+// receipt arrives.
+//
+// MatchNonRepudiationReceipt doesn't verify the receipt's own signature, and
+// so says nothing about who sent it. Verify the receipt first: its WS-Security
+// signature refers to the eb:Messaging header by ID, and so needs
+// VerifyOptions.AllowArbitraryReferences. Then check that the eb:Messaging
+// header, which contains the ebbp:NonRepudiationInformation, is one of its
+// ReferencedElements.
+func MatchNonRepudiationReceipt(receipt []byte, sent []Reference) error {
+	var echoed []Reference
+	found := false
+
+	decoder := NewDecoder(bytes.NewReader(receipt))
+	for {
+		t, err := decoder.Token()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+
+			return err
+		}
+
+		start, ok := t.(xml.StartElement)
+		if !ok || start.Name.Space != ebbpNamespace || start.Name.Local != "NonRepudiationInformation" {
+			continue
+		}
+
+		// A second copy could be signed while the first is not, or the other way
+		// around, and so which one was meant is ambiguous.
+		if found {
+			return ErrReceiptMismatch
+		}
+
+		var info nonRepudiationInformation
+		if err := decoder.DecodeElement(&info, &start); err != nil {
+			return err
+		}
+
+		for _, part := range info.MessageParts {
+			echoed = append(echoed, part.References...)
+		}
+
+		found = true
+	}
+
+	if !found || len(echoed) != len(sent) {
+		return ErrReceiptMismatch
+	}
+
+	matched := make([]bool, len(echoed))
+	for _, want := range sent {
+		wantDigest, err := decodeBase64(want.DigestValue)
+		if err != nil {
+			return err
+		}
+
+		ok := false
+		for i, got := range echoed {
+			if matched[i] || got.URI != want.URI || got.DigestMethod.Algorithm != want.DigestMethod.Algorithm {
+				continue
+			}
+
+			gotDigest, err := decodeBase64(got.DigestValue)
+			if err != nil {
+				return err
+			}
+
+			if bytes.Equal(gotDigest, wantDigest) {
+				matched[i] = true
+				ok = true
+				break
+			}
+		}
+
+		if !ok {
+			return ErrReceiptMismatch
+		}
+	}
+
+	return nil
+}
+
+type nonRepudiationInformation struct {
+	MessageParts []struct {
+		References []Reference `xml:"http://www.w3.org/2000/09/xmldsig# Reference"`
+	} `xml:"http://docs.oasis-open.org/ebxml-bp/ebbp-signals-2.0 MessagePartNRInformation"`
+}
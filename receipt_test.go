@@ -0,0 +1,157 @@
+package dsig_test
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/dsig"
+)
+
+// as4Envelope is a SOAP envelope of an AS4 message, with %s verbs for the
+// content of its eb:Messaging header and of its body. The header and the body
+// can be referred to by their wsu:Id.
+const as4Envelope = `<S12:Envelope xmlns:S12="http://www.w3.org/2003/05/soap-envelope" xmlns:eb="http://docs.oasis-open.org/ebxml-msg/ebms/v3.0/ns/core/200704/" xmlns:wsu="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd"><S12:Header><eb:Messaging wsu:Id="messaging">%s</eb:Messaging></S12:Header><S12:Body wsu:Id="body">%s</S12:Body></S12:Envelope>`
+
+// as4Receipt returns the eb:SignalMessage of a receipt whose
+// ebbp:NonRepudiationInformation echoes refs.
+func as4Receipt(t *testing.T, refs []dsig.Reference) string {
+	var parts strings.Builder
+	for _, ref := range refs {
+		data, err := xml.Marshal(ref)
+		assert.NoError(t, err)
+
+		fmt.Fprintf(&parts, "<ebbp:MessagePartNRInformation>%s</ebbp:MessagePartNRInformation>", data)
+	}
+
+	return `<eb:SignalMessage><eb:MessageInfo><eb:MessageId>receipt-1@example.com</eb:MessageId><eb:RefToMessageId>message-1@example.com</eb:RefToMessageId></eb:MessageInfo><eb:Receipt><ebbp:NonRepudiationInformation xmlns:ebbp="http://docs.oasis-open.org/ebxml-bp/ebbp-signals-2.0">` + parts.String() + `</ebbp:NonRepudiationInformation></eb:Receipt></eb:SignalMessage>`
+}
+
+// signAS4 signs the eb:Messaging header and body of an AS4 message, and returns
+// the signed message along with its signature.
+func signAS4(t *testing.T, messaging, body string) (string, dsig.Signature) {
+	signed, err := dsig.SignDocument([]byte(fmt.Sprintf(as4Envelope, messaging, body)), testKey, testCert, dsig.SignOptions{
+		References: []dsig.ReferenceOptions{{URI: "#messaging"}, {URI: "#body"}},
+	})
+	assert.NoError(t, err)
+
+	var envelope struct {
+		Signature dsig.Signature `xml:"http://www.w3.org/2000/09/xmldsig# Signature"`
+	}
+
+	assert.NoError(t, xml.Unmarshal(signed, &envelope))
+	return string(signed), envelope.Signature
+}
+
+func TestMatchNonRepudiationReceipt(t *testing.T) {
+	// The sender keeps the References of the message it signs.
+	message, sig := signAS4(t, `<eb:UserMessage><eb:MessageInfo><eb:MessageId>message-1@example.com</eb:MessageId></eb:MessageInfo></eb:UserMessage>`, `<Invoice xmlns="urn:oasis:names:specification:ubl:schema:xsd:Invoice-2"><ID>INV-1</ID></Invoice>`)
+	sent := sig.SignedInfo.References
+
+	// The recipient verifies the message, and echoes the digests it computed.
+	result, err := sig.VerifyWithResult(testCert, xml.NewDecoder(strings.NewReader(message)), dsig.VerifyOptions{AllowArbitraryReferences: true})
+	assert.NoError(t, err)
+
+	var echoed []dsig.Reference
+	for i, element := range result.ReferencedElements {
+		assert.Equal(t, referenceDigest(t, sent[i]), element.Digest)
+		echoed = append(echoed, dsig.Reference{
+			URI:          element.URI,
+			DigestMethod: dsig.DigestMethod{Algorithm: element.DigestMethod},
+			DigestValue:  base64.StdEncoding.EncodeToString(element.Digest),
+		})
+	}
+
+	receipt, receiptSignature := signAS4(t, as4Receipt(t, echoed), "")
+
+	// The sender verifies the receipt, checks that it signs the header with the
+	// receipt in it, and then matches the digests.
+	result, err = receiptSignature.VerifyWithResult(testCert, xml.NewDecoder(strings.NewReader(receipt)), dsig.VerifyOptions{AllowArbitraryReferences: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "Envelope>Header>Messaging", result.ReferencedElements[0].Path)
+
+	assert.NoError(t, dsig.MatchNonRepudiationReceipt([]byte(receipt), sent))
+
+	// A receipt for a different message doesn't match.
+	_, other := signAS4(t, `<eb:UserMessage><eb:MessageInfo><eb:MessageId>message-2@example.com</eb:MessageId></eb:MessageInfo></eb:UserMessage>`, `<Invoice xmlns="urn:oasis:names:specification:ubl:schema:xsd:Invoice-2"><ID>INV-2</ID></Invoice>`)
+	assert.Equal(t, dsig.ErrReceiptMismatch, dsig.MatchNonRepudiationReceipt([]byte(receipt), other.SignedInfo.References))
+}
+
+func TestMatchNonRepudiationReceipt_Echoed(t *testing.T) {
+	_, sig := signAS4(t, `<eb:UserMessage></eb:UserMessage>`, `<Invoice>INV-1</Invoice>`)
+	sent := sig.SignedInfo.References
+
+	// modify returns a copy of sent, with f applied to the copy of sent[i].
+	modify := func(i int, f func(ref *dsig.Reference)) []dsig.Reference {
+		refs := append([]dsig.Reference(nil), sent...)
+		f(&refs[i])
+		return refs
+	}
+
+	type testCase struct {
+		receipt string
+		err     error
+	}
+
+	testCases := map[string]testCase{
+		"ok": testCase{
+			receipt: as4Receipt(t, sent),
+		},
+		"reordered": testCase{
+			receipt: as4Receipt(t, []dsig.Reference{sent[1], sent[0]}),
+		},
+		"wrapped digest": testCase{
+			receipt: as4Receipt(t, modify(0, func(ref *dsig.Reference) {
+				ref.DigestValue = ref.DigestValue[:10] + "\n" + ref.DigestValue[10:]
+			})),
+		},
+		"different digest": testCase{
+			receipt: as4Receipt(t, modify(0, func(ref *dsig.Reference) {
+				ref.DigestValue = sent[1].DigestValue
+			})),
+			err: dsig.ErrReceiptMismatch,
+		},
+		"different uri": testCase{
+			receipt: as4Receipt(t, modify(1, func(ref *dsig.Reference) {
+				ref.URI = "#other"
+			})),
+			err: dsig.ErrReceiptMismatch,
+		},
+		"different digest method": testCase{
+			receipt: as4Receipt(t, modify(1, func(ref *dsig.Reference) {
+				ref.DigestMethod.Algorithm = dsig.DigestMethodAlgorithmSHA1
+			})),
+			err: dsig.ErrReceiptMismatch,
+		},
+		"missing part": testCase{
+			receipt: as4Receipt(t, sent[:1]),
+			err:     dsig.ErrReceiptMismatch,
+		},
+		"repeated part": testCase{
+			receipt: as4Receipt(t, []dsig.Reference{sent[0], sent[0]}),
+			err:     dsig.ErrReceiptMismatch,
+		},
+		"extra part": testCase{
+			receipt: as4Receipt(t, append(append([]dsig.Reference(nil), sent...), sent[0])),
+			err:     dsig.ErrReceiptMismatch,
+		},
+		"no non-repudiation information": testCase{
+			receipt: `<eb:SignalMessage><eb:Receipt></eb:Receipt></eb:SignalMessage>`,
+			err:     dsig.ErrReceiptMismatch,
+		},
+		"two non-repudiation informations": testCase{
+			receipt: as4Receipt(t, sent) + as4Receipt(t, sent),
+			err:     dsig.ErrReceiptMismatch,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			receipt := fmt.Sprintf(as4Envelope, tt.receipt, "")
+			assert.Equal(t, tt.err, dsig.MatchNonRepudiationReceipt([]byte(receipt), sent))
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package dsig
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+// Recorder lets a document be unmarshaled and verified from a single parse.
+//
+// A Recorder implements xml.TokenReader, so it can be handed to
+// xml.NewTokenDecoder. As the resulting xml.Decoder reads tokens, the Recorder
+// retains a copy of each of them. Tokens then replays those same tokens to
+// Verify. For example:
+//
+//  rec := dsig.NewRecorder(r)
+//
+//  var foo Foo
+//  if err := xml.NewTokenDecoder(rec).Decode(&foo); err != nil {
+//    return err
+//  }
+//
+//  if err := foo.Signature.Verify(cert, rec.Tokens()); err != nil {
+//    return err
+//  }
+//
+// Because the signature is verified against the very tokens that were
+// unmarshaled, this also guarantees that the data being verified is the data
+// that was parsed.
+//
+// Tokens only replays what has been read so far. xml.Decoder's Decode stops
+// reading at the end of the root element, which is all that Verify needs.
+type Recorder struct {
+	decoder *xml.Decoder
+	tokens  []xml.Token
+}
+
+// NewRecorder creates a Recorder that reads a document from r.
+func NewRecorder(r io.Reader) *Recorder {
+	return &Recorder{decoder: xml.NewDecoder(r)}
+}
+
+// Token implements xml.TokenReader.
+//
+// Token returns tokens without resolving their namespaces, as described in the
+// documentation for TokenReader. An xml.Decoder created with
+// xml.NewTokenDecoder resolves them itself.
+func (r *Recorder) Token() (xml.Token, error) {
+	t, err := r.decoder.RawToken()
+	if err != nil {
+		return nil, err
+	}
+
+	// The decoder resolving namespaces modifies the tokens it's given, so the
+	// token recorded and the token returned must not share memory.
+	r.tokens = append(r.tokens, xml.CopyToken(t))
+	return xml.CopyToken(t), nil
+}
+
+// Tokens returns a TokenReader that replays the tokens r has read so far.
+//
+// Tokens can be called several times; each returned TokenReader starts from
+// the beginning of the document.
+func (r *Recorder) Tokens() TokenReader {
+	replay := recorderReplay(r.tokens)
+	return &replay
+}
+
+type recorderReplay []xml.Token
+
+func (r *recorderReplay) RawToken() (xml.Token, error) {
+	if len(*r) == 0 {
+		return nil, io.EOF
+	}
+
+	t := (*r)[0]
+	*r = (*r)[1:]
+	return xml.CopyToken(t), nil
+}
+
+// Token is the same as RawToken. It lets a replay be decoded with
+// xml.NewTokenDecoder, which resolves namespaces itself.
+func (r *recorderReplay) Token() (xml.Token, error) {
+	return r.RawToken()
+}
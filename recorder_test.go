@@ -0,0 +1,52 @@
+package dsig_test
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/dsig"
+)
+
+func TestRecorder(t *testing.T) {
+	doc := signTestDocument(t, `<root xmlns="http://example.com"><foo>xxx</foo>`+testSignatureFormat+`</root>`, base64.StdEncoding)
+
+	type testCase struct {
+		Doc string
+		Foo string
+		Err error
+	}
+
+	testCases := map[string]testCase{
+		"valid": testCase{
+			Doc: doc,
+			Foo: "xxx",
+			Err: nil,
+		},
+		"tampered": testCase{
+			Doc: strings.Replace(doc, "xxx", "yyy", 1),
+			Foo: "yyy",
+			Err: dsig.ErrBadDigest,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var payload struct {
+				XMLName   xml.Name       `xml:"http://example.com root"`
+				Foo       string         `xml:"http://example.com foo"`
+				Signature dsig.Signature `xml:"http://www.w3.org/2000/09/xmldsig# Signature"`
+			}
+
+			rec := dsig.NewRecorder(strings.NewReader(tt.Doc))
+			assert.NoError(t, xml.NewTokenDecoder(rec).Decode(&payload))
+			assert.Equal(t, tt.Foo, payload.Foo)
+
+			// Verifying twice checks that replaying is repeatable.
+			assert.Equal(t, tt.Err, payload.Signature.Verify(testCert, rec.Tokens()))
+			assert.Equal(t, tt.Err, payload.Signature.Verify(testCert, rec.Tokens()))
+		})
+	}
+}
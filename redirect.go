@@ -0,0 +1,53 @@
+package dsig
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io"
+	"io/ioutil"
+)
+
+// ErrRedirectMessageTooLarge is returned by InflateRedirectMessage if the
+// inflated message is larger than MaxRedirectMessageSize.
+var ErrRedirectMessageTooLarge = errors.New("dsig: inflated redirect message is too large")
+
+// MaxRedirectMessageSize is the largest message, in bytes, that
+// InflateRedirectMessage will inflate. DEFLATE can compress repetitive data by
+// a factor of about a thousand, so a short query parameter can otherwise
+// inflate to an enormous document.
+const MaxRedirectMessageSize = 1 << 20
+
+// InflateRedirectMessage decodes a SAML message delivered with the SAML 2.0
+// HTTP-Redirect binding, and returns the message's XML.
+//
+// value is the value of the SAMLRequest or SAMLResponse query parameter, after
+// it has been URL-decoded, as it is by url.Values. The binding encodes the
+// message with base64, after compressing it with DEFLATE.
+//
+// The HTTP-Redirect binding does not sign messages with XML signatures.
+// Instead, the SigAlg and Signature query parameters carry a signature over the
+// query string itself, and this package does not verify those. A message
+// delivered this way usually has no ds:Signature at all, so passing the result
+// of InflateRedirectMessage to Verify only makes sense if the sender also
+// signed the XML, such as a SAMLResponse whose assertion is signed.
+func InflateRedirectMessage(value string) ([]byte, error) {
+	compressed, err := decodeBase64(value)
+	if err != nil {
+		return nil, err
+	}
+
+	r := flate.NewReader(bytes.NewReader(compressed))
+	defer r.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(r, MaxRedirectMessageSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) > MaxRedirectMessageSize {
+		return nil, ErrRedirectMessageTooLarge
+	}
+
+	return data, nil
+}
@@ -0,0 +1,68 @@
+package dsig_test
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/dsig"
+)
+
+// deflateRedirectMessage encodes data as the SAML HTTP-Redirect binding does.
+func deflateRedirectMessage(t *testing.T, data string) string {
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.BestCompression)
+	assert.NoError(t, err)
+
+	_, err = w.Write([]byte(data))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func TestInflateRedirectMessage(t *testing.T) {
+	doc := signTestDocument(t, testAssertionFormat, base64.StdEncoding)
+
+	data, err := dsig.InflateRedirectMessage(deflateRedirectMessage(t, doc))
+	assert.NoError(t, err)
+	assert.Equal(t, doc, string(data))
+
+	// The inflated XML can be verified like any other document.
+	err = dsig.VerifyAssertion(testCert, data, dsig.AssertionOptions{Audience: "https://sp.example.com"})
+	assert.NoError(t, err)
+}
+
+func TestInflateRedirectMessage_Errors(t *testing.T) {
+	type testCase struct {
+		Value string
+	}
+
+	testCases := map[string]testCase{
+		"bad base64": testCase{
+			Value: "!!!",
+		},
+		"not deflated": testCase{
+			Value: base64.StdEncoding.EncodeToString([]byte{0xff, 0xff, 0xff}),
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := dsig.InflateRedirectMessage(tt.Value)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestInflateRedirectMessage_TooLarge(t *testing.T) {
+	_, err := dsig.InflateRedirectMessage(deflateRedirectMessage(t, strings.Repeat("x", dsig.MaxRedirectMessageSize+1)))
+	assert.Equal(t, dsig.ErrRedirectMessageTooLarge, err)
+
+	data, err := dsig.InflateRedirectMessage(deflateRedirectMessage(t, strings.Repeat("x", dsig.MaxRedirectMessageSize)))
+	assert.NoError(t, err)
+	assert.Len(t, data, dsig.MaxRedirectMessageSize)
+}
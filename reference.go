@@ -0,0 +1,268 @@
+package dsig
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ucarion/dsig/internal/canon"
+	"github.com/ucarion/dsig/internal/sigsplit"
+)
+
+// ErrUnsupportedReference is returned, wrapped in an
+// *UnsupportedReferenceError, by Verify if the signature's Reference has a URI
+// that this package does not support.
+var ErrUnsupportedReference = errors.New("dsig: unsupported reference uri")
+
+// ErrReferenceNotFound is returned by Verify if the signature's Reference
+// refers to an ID that no element in the document has.
+var ErrReferenceNotFound = errors.New("dsig: referenced element not found")
+
+// ErrDuplicateID is returned by Verify if the signature's Reference refers to
+// an ID that more than one element in the document has.
+//
+// Duplicate IDs are a common ingredient of signature wrapping attacks, where a
+// signed element is hidden elsewhere in the document and a forged element with
+// the same ID is put in its place. Rather than guess which element was meant,
+// Verify rejects the document.
+var ErrDuplicateID = errors.New("dsig: more than one element with referenced id")
+
+// ErrReferenceNotEnveloping is returned by Verify if the signature's Reference
+// refers by ID to an element that doesn't contain the signature, such as a
+// sibling of it, and VerifyOptions.AllowArbitraryReferences isn't set.
+//
+// Such a signature covers only part of the document, and says nothing about
+// where in the document that part is. See
+// VerifyOptions.AllowArbitraryReferences.
+var ErrReferenceNotEnveloping = errors.New("dsig: referenced element does not contain signature")
+
+// ErrSignatureMisplaced is returned by Verify if the signature refers by ID to
+// an element that contains it, but isn't an immediate child of that element,
+// or if it's an enveloping signature that is nested deeper than a child of the
+// root element, and VerifyOptions.AllowArbitraryReferences isn't set.
+//
+// In either case, the signed data doesn't say where the signature is, and so a
+// signature found deeper in the document may have been wrapped in content that
+// was never signed.
+var ErrSignatureMisplaced = errors.New("dsig: signature not in enveloped or enveloping position")
+
+// ErrDuplicateSignature is returned by Verify if the document contains more
+// than one copy of the signature being verified, with the same Reference URI
+// and SignatureValue. A signature wrapping attack can add such a copy, so that
+// a signature over one part of the document appears to be over another, and so
+// Verify can't tell which copy is genuine.
+var ErrDuplicateSignature = errors.New("dsig: signature appears more than once")
+
+// UnsupportedReferenceError is returned by Verify if the signature's Reference
+// has a URI that this package does not support. URI is the URI, exactly as it
+// appeared in the Reference.
+type UnsupportedReferenceError struct {
+	URI string
+}
+
+func (e *UnsupportedReferenceError) Error() string {
+	return fmt.Sprintf("%v: %q", ErrUnsupportedReference, e.URI)
+}
+
+// Unwrap returns ErrUnsupportedReference.
+func (e *UnsupportedReferenceError) Unwrap() error {
+	return ErrUnsupportedReference
+}
+
+// id returns the ID of the element that r refers to, or the empty string if r
+// refers to the whole document.
+//
+// Bare-name references, like "#foo", and the equivalent XPointer, like
+// "#xpointer(id('foo'))", are supported. The empty URI, or no URI at all,
+// refers to the whole document, as does the XPointer "#xpointer(/)".
+func (r *Reference) id() (string, error) {
+	if r.URI == "" || r.URI == "#xpointer(/)" {
+		return "", nil
+	}
+
+	if !strings.HasPrefix(r.URI, "#") || len(r.URI) == 1 {
+		return "", &UnsupportedReferenceError{URI: r.URI}
+	}
+
+	fragment := r.URI[1:]
+	if !strings.HasPrefix(fragment, "xpointer(") {
+		return fragment, nil
+	}
+
+	for _, quote := range []string{"'", `"`} {
+		prefix := "xpointer(id(" + quote
+		suffix := quote + "))"
+
+		if strings.HasPrefix(fragment, prefix) && strings.HasSuffix(fragment, suffix) && len(fragment) > len(prefix)+len(suffix) {
+			id := fragment[len(prefix) : len(fragment)-len(suffix)]
+			if !strings.ContainsAny(id, `'"`) {
+				return id, nil
+			}
+		}
+	}
+
+	return "", &UnsupportedReferenceError{URI: r.URI}
+}
+
+// withComments returns whether the data r refers to should be canonicalized
+// with comments.
+//
+// The empty URI and bare-name references remove comments from the data they
+// refer to, so comments are never digested for them, even if a "with comments"
+// canonicalization transform is listed. XPointer references keep comments, and
+// so for those the comments are digested if such a transform is listed.
+func (r *Reference) withComments() bool {
+	if !strings.HasPrefix(r.URI, "#xpointer(") {
+		return false
+	}
+
+	for _, t := range r.Transforms {
+		if t.Algorithm == CanonicalizationMethodAlgorithmExclusiveWithComments || t.Algorithm == CanonicalizationMethodAlgorithmInclusiveWithComments {
+			return true
+		}
+	}
+
+	return false
+}
+
+// canonOptions returns the options that the data r refers to is canonicalized
+// with. The data is canonicalized with Exclusive Canonical XML if r has an
+// Exclusive Canonical XML transform, taking the InclusiveNamespaces from it,
+// and otherwise with Canonical XML 1.0.
+//
+// Canonical XML 1.0 is used even if r has no canonicalization transform at
+// all, as in the signatures of Chilean SII tax documents: XML-DSig converts the
+// node-set that a same-document Reference selects to octets with it.
+func (r *Reference) canonOptions() canon.Options {
+	opts := canon.Options{WithComments: r.withComments(), Inclusive: true}
+	for _, t := range r.Transforms {
+		switch t.Algorithm {
+		case CanonicalizationMethodAlgorithmExclusive, CanonicalizationMethodAlgorithmExclusiveWithComments:
+			opts.InclusivePrefixes = t.InclusiveNamespaces.prefixes()
+			opts.Inclusive = false
+		case CanonicalizationMethodAlgorithmInclusive, CanonicalizationMethodAlgorithmInclusiveWithComments:
+			opts.Inclusive = true
+		}
+	}
+
+	return opts
+}
+
+// verifyDigest checks the DigestValue of r, which is one of the References of
+// a signature other than the one it was found by. tokens are the tokens of the
+// document, and splitOpts are the options that the other Reference was split
+// with.
+//
+// Each Reference is digested on its own, so RequireFullCoverage, which
+// considers only the data referred to by that other Reference, doesn't apply.
+//
+// verifyDigest returns the element that r refers to.
+func (r *Reference) verifyDigest(tokens []xml.Token, splitOpts sigsplit.Options, opts VerifyOptions) (ReferencedElement, error) {
+	id, err := r.id()
+	if err != nil {
+		return ReferencedElement{}, err
+	}
+
+	digestHash, err := r.DigestMethod.hash()
+	if err != nil {
+		return ReferencedElement{}, err
+	}
+
+	outer := r.canonOptions()
+	outer.NormalizePrefixes = splitOpts.Outer.NormalizePrefixes
+
+	splitOpts.Outer = outer
+	splitOpts.ID = id
+	splitOpts.ReferenceURI = r.URI
+	splitOpts.RequireFullCoverage = false
+
+	replay := recorderReplay(tokens)
+	split, err := sigsplit.SplitOuter(r.applyCustomTransforms(&replay), splitOpts)
+	if err != nil {
+		return ReferencedElement{}, splitError(err)
+	}
+
+	toDigest := split.Outer
+	if opts.ValidateUTF8 && !utf8.Valid(toDigest) {
+		return ReferencedElement{}, ErrInvalidUTF8
+	}
+
+	expectedDigest, err := decodeBase64(r.DigestValue)
+	if err != nil {
+		return ReferencedElement{}, err
+	}
+
+	h := opts.newHash(digestHash)
+	h.Write(toDigest)
+	digest := h.Sum(nil)
+	if !bytes.Equal(expectedDigest, digest) {
+		return ReferencedElement{}, ErrBadDigest
+	}
+
+	return newReferencedElement(r, split, digest), nil
+}
+
+// splitError converts errors about references from sigsplit into the
+// equivalent errors from this package.
+func splitError(err error) error {
+	switch err {
+	case sigsplit.ErrIDNotFound:
+		return ErrReferenceNotFound
+	case sigsplit.ErrDuplicateID:
+		return ErrDuplicateID
+	case sigsplit.ErrUncoveredContent:
+		return ErrUnsignedContentPresent
+	case sigsplit.ErrSignatureNotFound:
+		return ErrSignatureNotFound
+	case sigsplit.ErrNotEnveloped:
+		return ErrReferenceNotEnveloping
+	case sigsplit.ErrSignatureMisplaced:
+		return ErrSignatureMisplaced
+	case sigsplit.ErrDuplicateSignature:
+		return ErrDuplicateSignature
+	default:
+		return err
+	}
+}
+
+// external returns whether r refers to data outside of the document that its
+// signature is in, rather than to the whole document or to an element of it.
+func (r *Reference) external() bool {
+	return r.URI != "" && !strings.HasPrefix(r.URI, "#")
+}
+
+// verifyExternalDigest checks the DigestValue of r, which refers to data
+// outside of the document, against the data that opts.Resolver returns for its
+// URI. The data is digested as-is, so r must have no transforms.
+func (r *Reference) verifyExternalDigest(opts VerifyOptions) (ReferencedElement, error) {
+	if len(r.Transforms) != 0 {
+		return ReferencedElement{}, ErrUnsupportedTransform
+	}
+
+	digestHash, err := r.DigestMethod.hash()
+	if err != nil {
+		return ReferencedElement{}, err
+	}
+
+	expectedDigest, err := decodeBase64(r.DigestValue)
+	if err != nil {
+		return ReferencedElement{}, err
+	}
+
+	content, err := opts.Resolver(r.URI)
+	if err != nil {
+		return ReferencedElement{}, err
+	}
+
+	h := opts.newHash(digestHash)
+	h.Write(content)
+	digest := h.Sum(nil)
+	if !bytes.Equal(expectedDigest, digest) {
+		return ReferencedElement{}, ErrBadDigest
+	}
+
+	return ReferencedElement{URI: r.URI, DigestMethod: r.DigestMethod.Algorithm, Digest: digest}, nil
+}
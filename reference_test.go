@@ -0,0 +1,595 @@
+package dsig_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/dsig"
+	"github.com/ucarion/dsig/internal/canon"
+	"github.com/ucarion/dsig/internal/sigsplit"
+)
+
+// signatureWithURI returns testSignatureFormat, with its Reference URI
+// replaced by uri. uri is inserted into an attribute as-is, so it must already
+// be escaped.
+func signatureWithURI(uri string) string {
+	return strings.Replace(testSignatureFormat, `URI=""`, `URI="`+uri+`"`, 1)
+}
+
+func TestVerify_ReferenceID(t *testing.T) {
+	type testCase struct {
+		URI     string
+		ID      string
+		Payload string
+		Opts    dsig.VerifyOptions
+	}
+
+	// The referenced element only contains the signature in some of these cases,
+	// so the others need AllowArbitraryReferences.
+	arbitrary := dsig.VerifyOptions{AllowArbitraryReferences: true}
+
+	testCases := map[string]testCase{
+		"bare name": testCase{
+			URI:     "#bareId",
+			ID:      "bareId",
+			Payload: `<root ID="bareId"><foo>xxx</foo>SIGNATURE</root>`,
+		},
+		"xpointer single quotes": testCase{
+			URI:     "#xpointer(id('bareId'))",
+			ID:      "bareId",
+			Payload: `<root ID="bareId"><foo>xxx</foo>SIGNATURE</root>`,
+		},
+		"xpointer double quotes": testCase{
+			URI:     "#xpointer(id(&quot;bareId&quot;))",
+			ID:      "bareId",
+			Payload: `<root ID="bareId"><foo>xxx</foo>SIGNATURE</root>`,
+		},
+		"special characters": testCase{
+			URI:     "#_0e8f-4a.b_c",
+			ID:      "_0e8f-4a.b_c",
+			Payload: `<root ID="_0e8f-4a.b_c"><foo>xxx</foo>SIGNATURE</root>`,
+		},
+		"lowercase id attribute": testCase{
+			URI:     "#bareId",
+			ID:      "bareId",
+			Payload: `<root id="bareId"><foo>xxx</foo>SIGNATURE</root>`,
+		},
+		"not the root": testCase{
+			URI:     "#bareId",
+			ID:      "bareId",
+			Payload: `<root><foo Id="bareId">xxx</foo>SIGNATURE</root>`,
+			Opts:    arbitrary,
+		},
+		"prefix declared on ancestor": testCase{
+			URI:     "#bareId",
+			ID:      "bareId",
+			Payload: `<root xmlns:a="http://example.com/a"><wrapper><a:foo Id="bareId"><a:bar>xxx</a:bar></a:foo></wrapper>SIGNATURE</root>`,
+			Opts:    arbitrary,
+		},
+		"prefixed attribute declared on ancestor": testCase{
+			URI:     "#bareId",
+			ID:      "bareId",
+			Payload: `<root xmlns:xlink="http://www.w3.org/1999/xlink"><foo Id="bareId"><bar xlink:href="http://example.com">xxx</bar></foo>SIGNATURE</root>`,
+			Opts:    arbitrary,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			format := strings.Replace(tt.Payload, "SIGNATURE", signatureWithURI(tt.URI), 1)
+			doc := signTestDocumentWithOptions(t, format, base64.StdEncoding, sigsplit.Options{ID: tt.ID})
+			assert.NoError(t, verifyTestDocumentWithOptions(t, doc, tt.Opts))
+
+			// The referenced element is digested.
+			assert.Equal(t, dsig.ErrBadDigest, verifyTestDocumentWithOptions(t, strings.Replace(doc, "xxx", "yyy", 1), tt.Opts))
+		})
+	}
+}
+
+func TestVerify_ReferenceXPointerComments(t *testing.T) {
+	type testCase struct {
+		URI          string
+		ID           string
+		WithComments bool // whether the reference lists a "with comments" transform
+		Digested     bool // whether comments are expected to be digested
+	}
+
+	testCases := map[string]testCase{
+		"whole document xpointer with comments": testCase{
+			URI:          "#xpointer(/)",
+			WithComments: true,
+			Digested:     true,
+		},
+		"whole document xpointer without comments": testCase{
+			URI:          "#xpointer(/)",
+			WithComments: false,
+			Digested:     false,
+		},
+		"id xpointer with comments": testCase{
+			URI:          "#xpointer(id('bareId'))",
+			ID:           "bareId",
+			WithComments: true,
+			Digested:     true,
+		},
+		"empty uri with comments": testCase{
+			URI:          "",
+			WithComments: true,
+			Digested:     false,
+		},
+		"bare name with comments": testCase{
+			URI:          "#bareId",
+			ID:           "bareId",
+			WithComments: true,
+			Digested:     false,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			signature := signatureWithURI(tt.URI)
+			if tt.WithComments {
+				signature = strings.Replace(signature, `<ds:Transform Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#">`, `<ds:Transform Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#WithComments">`, 1)
+			}
+
+			format := `<root ID="bareId"><foo>xxx<!-- comment --></foo>` + signature + `</root>`
+			doc := signTestDocumentWithOptions(t, format, base64.StdEncoding, sigsplit.Options{
+				Outer:        canon.Options{WithComments: tt.Digested},
+				ID:           tt.ID,
+				ReferenceURI: tt.URI,
+			})
+
+			assert.NoError(t, verifyTestDocument(t, doc))
+
+			changed := verifyTestDocument(t, strings.Replace(doc, "<!-- comment -->", "<!-- changed -->", 1))
+			if tt.Digested {
+				assert.Equal(t, dsig.ErrBadDigest, changed)
+			} else {
+				assert.NoError(t, changed)
+			}
+		})
+	}
+}
+
+func TestVerify_ReferenceIDScope(t *testing.T) {
+	format := `<root><foo Id="bareId">xxx</foo><bar>yyy</bar>` + signatureWithURI("#bareId") + `</root>`
+	doc := signTestDocumentWithOptions(t, format, base64.StdEncoding, sigsplit.Options{ID: "bareId"})
+	opts := dsig.VerifyOptions{AllowArbitraryReferences: true}
+
+	// Only the referenced element is covered by the signature, so changing the
+	// rest of the document does not affect Verify.
+	assert.NoError(t, verifyTestDocumentWithOptions(t, strings.Replace(doc, "yyy", "zzz", 1), opts))
+	assert.Equal(t, dsig.ErrBadDigest, verifyTestDocumentWithOptions(t, strings.Replace(doc, "xxx", "zzz", 1), opts))
+}
+
+func TestVerify_ReferenceNotEnveloping(t *testing.T) {
+	// The signature covers only the Stamp, so the Amount beside it is unsigned.
+	format := `<root><Stamp ID="s1">approved</Stamp><Amount>10</Amount>` + signatureWithURI("#s1") + `</root>`
+	doc := signTestDocumentWithOptions(t, format, base64.StdEncoding, sigsplit.Options{ID: "s1"})
+	tampered := strings.Replace(doc, "<Amount>10</Amount>", "<Amount>1000000</Amount>", 1)
+
+	// By default, a Reference to an element that doesn't contain the signature
+	// is rejected, however the rest of the document looks.
+	assert.Equal(t, dsig.ErrReferenceNotEnveloping, verifyTestDocument(t, doc))
+	assert.Equal(t, dsig.ErrReferenceNotEnveloping, verifyTestDocument(t, tampered))
+
+	// With AllowArbitraryReferences, the tampered document verifies, and it's up
+	// to the caller to only trust the element that was verified.
+	var payload struct {
+		Signature dsig.Signature `xml:"http://www.w3.org/2000/09/xmldsig# Signature"`
+	}
+
+	assert.NoError(t, xml.Unmarshal([]byte(tampered), &payload))
+
+	result, err := payload.Signature.VerifyWithResult(testCert, xml.NewDecoder(strings.NewReader(tampered)), dsig.VerifyOptions{AllowArbitraryReferences: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []dsig.ReferencedElement{{
+		URI:          "#s1",
+		Path:         "root>Stamp",
+		Name:         xml.Name{Local: "Stamp"},
+		DigestMethod: dsig.DigestMethodAlgorithmSHA256,
+		Digest:       referenceDigest(t, *payload.Signature.SignedInfo.Reference()),
+	}}, result.ReferencedElements)
+
+	// An element that contains the signature is accepted by default.
+	format = `<root><Stamp ID="s1">approved` + signatureWithURI("#s1") + `</Stamp></root>`
+	doc = signTestDocumentWithOptions(t, format, base64.StdEncoding, sigsplit.Options{ID: "s1", ReferenceURI: "#s1"})
+
+	var enveloped struct {
+		Stamp struct {
+			Signature dsig.Signature `xml:"http://www.w3.org/2000/09/xmldsig# Signature"`
+		}
+	}
+
+	assert.NoError(t, xml.Unmarshal([]byte(doc), &enveloped))
+
+	result, err = enveloped.Stamp.Signature.VerifyWithResult(testCert, xml.NewDecoder(strings.NewReader(doc)), dsig.VerifyOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []dsig.ReferencedElement{{
+		URI:          "#s1",
+		Path:         "root>Stamp",
+		Name:         xml.Name{Local: "Stamp"},
+		DigestMethod: dsig.DigestMethodAlgorithmSHA256,
+		Digest:       referenceDigest(t, *enveloped.Stamp.Signature.SignedInfo.Reference()),
+	}}, result.ReferencedElements)
+}
+
+func TestVerify_ReferencePrefixedAttribute(t *testing.T) {
+	format := `<root xmlns:xlink="http://www.w3.org/1999/xlink"><foo Id="bareId"><bar xlink:href="http://example.com">xxx</bar></foo>` + signatureWithURI("#bareId") + `</root>`
+	doc := signTestDocumentWithOptions(t, format, base64.StdEncoding, sigsplit.Options{ID: "bareId"})
+	opts := dsig.VerifyOptions{AllowArbitraryReferences: true}
+	assert.NoError(t, verifyTestDocumentWithOptions(t, doc, opts))
+
+	// The attribute's namespace is signed along with it, even though it's
+	// declared outside of the referenced element.
+	rebound := strings.Replace(doc, "http://www.w3.org/1999/xlink", "http://example.com/not-xlink", 1)
+	assert.Equal(t, dsig.ErrBadDigest, verifyTestDocumentWithOptions(t, rebound, opts))
+}
+
+func TestVerify_ReferenceDefaultNamespaceReset(t *testing.T) {
+	format := `<root xmlns="http://example.com/a"><foo Id="bareId"><bar xmlns="">xxx</bar></foo>` + signatureWithURI("#bareId") + `</root>`
+	doc := signTestDocumentWithOptions(t, format, base64.StdEncoding, sigsplit.Options{ID: "bareId"})
+
+	var payload struct {
+		Signature dsig.Signature `xml:"http://www.w3.org/2000/09/xmldsig# Signature"`
+	}
+
+	assert.NoError(t, xml.Unmarshal([]byte(doc), &payload))
+
+	opts := dsig.VerifyOptions{AllowArbitraryReferences: true}
+	result, err := payload.Signature.VerifyWithResult(testCert, xml.NewDecoder(strings.NewReader(doc)), opts)
+	assert.NoError(t, err)
+	assert.Equal(t, `<foo xmlns="http://example.com/a" Id="bareId"><bar xmlns="">xxx</bar></foo>`, string(result.SignedData))
+
+	digest := sha256.Sum256(result.SignedData)
+	assert.Equal(t, digest[:], result.Digest)
+
+	// Without the reset, bar is in the default namespace, which changes the
+	// signed content.
+	assert.Equal(t, dsig.ErrBadDigest, verifyTestDocumentWithOptions(t, strings.Replace(doc, `<bar xmlns="">`, `<bar>`, 1), opts))
+}
+
+func TestVerify_ReferenceErrors(t *testing.T) {
+	type testCase struct {
+		URI     string
+		Payload string
+		Err     error
+	}
+
+	testCases := map[string]testCase{
+		"not found": testCase{
+			URI:     "#bareId",
+			Payload: `<root ID="otherId">SIGNATURE</root>`,
+			Err:     dsig.ErrReferenceNotFound,
+		},
+		"duplicate": testCase{
+			URI:     "#bareId",
+			Payload: `<root><foo ID="bareId" /><bar ID="bareId" />SIGNATURE</root>`,
+			Err:     dsig.ErrDuplicateID,
+		},
+		"unsupported xpointer": testCase{
+			URI:     "#xpointer(//foo)",
+			Payload: `<root>SIGNATURE</root>`,
+			Err:     &dsig.UnsupportedReferenceError{URI: "#xpointer(//foo)"},
+		},
+		"unsupported xpointer function": testCase{
+			URI:     "#xpointer(id('a')/child::*)",
+			Payload: `<root>SIGNATURE</root>`,
+			Err:     &dsig.UnsupportedReferenceError{URI: "#xpointer(id('a')/child::*)"},
+		},
+		"empty fragment": testCase{
+			URI:     "#",
+			Payload: `<root>SIGNATURE</root>`,
+			Err:     &dsig.UnsupportedReferenceError{URI: "#"},
+		},
+		"external": testCase{
+			URI:     "http://example.com/doc.xml",
+			Payload: `<root>SIGNATURE</root>`,
+			Err:     &dsig.UnsupportedReferenceError{URI: "http://example.com/doc.xml"},
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			doc := strings.Replace(tt.Payload, "SIGNATURE", signatureWithURI(tt.URI), 1)
+			err := verifyTestDocument(t, doc)
+			assert.Equal(t, tt.Err, err)
+
+			if _, ok := tt.Err.(*dsig.UnsupportedReferenceError); ok {
+				assert.True(t, errors.Is(err, dsig.ErrUnsupportedReference))
+			}
+		})
+	}
+}
+
+func TestVerifyWithOptions_RequireFullCoverage(t *testing.T) {
+	type testCase struct {
+		URI     string
+		ID      string
+		Payload string
+		Err     error
+	}
+
+	testCases := map[string]testCase{
+		"whole document": testCase{
+			URI:     "",
+			Payload: `<root><foo>xxx</foo>SIGNATURE</root>`,
+			Err:     nil,
+		},
+		"id on root": testCase{
+			URI:     "#bareId",
+			ID:      "bareId",
+			Payload: "<!-- comment -->\n<root ID=\"bareId\"><foo>xxx</foo>SIGNATURE</root>\n<?pi?>",
+			Err:     nil,
+		},
+		"unsigned sibling": testCase{
+			URI:     "#bareId",
+			ID:      "bareId",
+			Payload: `<root><foo ID="bareId">xxx</foo><bar />SIGNATURE</root>`,
+			Err:     dsig.ErrUnsignedContentPresent,
+		},
+		"unsigned text": testCase{
+			URI:     "#bareId",
+			ID:      "bareId",
+			Payload: `<root>  <foo ID="bareId">xxx</foo>bar SIGNATURE</root>`,
+			Err:     dsig.ErrUnsignedContentPresent,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			format := strings.Replace(tt.Payload, "SIGNATURE", signatureWithURI(tt.URI), 1)
+			doc := signTestDocumentWithOptions(t, format, base64.StdEncoding, sigsplit.Options{ID: tt.ID})
+			assert.NoError(t, verifyTestDocumentWithOptions(t, doc, dsig.VerifyOptions{AllowArbitraryReferences: true}))
+
+			err := verifyTestDocumentWithOptions(t, doc, dsig.VerifyOptions{AllowArbitraryReferences: true, RequireFullCoverage: true})
+			assert.Equal(t, tt.Err, err)
+		})
+	}
+}
+
+// testSOAPFormat is a SOAP message whose body is signed by a WS-Security
+// signature in its header. It has the same verbs as testSignatureFormat. The
+// body doesn't contain the signature, so it's verified with
+// AllowArbitraryReferences.
+var testSOAPFormat = strings.NewReplacer("\n", "", "SIGNATURE", signatureWithURI("#body")).Replace(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/" xmlns:wsu="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd">
+<soap:Header>
+<wsse:Security xmlns:wsse="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd">
+<wsu:Timestamp wsu:Id="ts"><wsu:Created>2020-01-01T00:00:00Z</wsu:Created></wsu:Timestamp>
+SIGNATURE
+</wsse:Security>
+</soap:Header>
+<soap:Body wsu:Id="body">
+<m:GetPrice xmlns:m="http://example.com/prices"><m:Item>xxx</m:Item></m:GetPrice>
+</soap:Body>
+</soap:Envelope>`)
+
+func verifySOAPDocument(t *testing.T, doc string) error {
+	var envelope struct {
+		Signature dsig.Signature `xml:"Header>Security>Signature"`
+	}
+
+	assert.NoError(t, xml.Unmarshal([]byte(doc), &envelope))
+
+	result, err := envelope.Signature.VerifyWithResult(testCert, xml.NewDecoder(strings.NewReader(doc)), dsig.VerifyOptions{AllowArbitraryReferences: true})
+	if err != nil {
+		return err
+	}
+
+	// Only the body is signed, so that's all that a caller should trust.
+	assert.Equal(t, "Envelope>Body", result.ReferencedElements[0].Path)
+	return nil
+}
+
+func TestVerify_ReferenceForward(t *testing.T) {
+	opts := sigsplit.Options{ID: "body", ReferenceURI: "#body"}
+	doc := signTestDocumentWithOptions(t, testSOAPFormat, base64.StdEncoding, opts)
+	assert.NoError(t, verifySOAPDocument(t, doc))
+
+	// The body doesn't contain the signature, so it's rejected by default.
+	var envelope struct {
+		Signature dsig.Signature `xml:"Header>Security>Signature"`
+	}
+
+	assert.NoError(t, xml.Unmarshal([]byte(doc), &envelope))
+	assert.Equal(t, dsig.ErrReferenceNotEnveloping, envelope.Signature.Verify(testCert, xml.NewDecoder(strings.NewReader(doc))))
+
+	// Only the body is signed.
+	assert.NoError(t, verifySOAPDocument(t, strings.Replace(doc, "2020", "2021", 1)))
+	assert.Equal(t, dsig.ErrBadDigest, verifySOAPDocument(t, strings.Replace(doc, "xxx", "yyy", 1)))
+
+	// The body is digested along with the namespaces it uses from the envelope.
+	rebound := strings.Replace(doc, `xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"`, `xmlns:soap="http://www.w3.org/2003/05/soap-envelope"`, 1)
+	assert.Equal(t, dsig.ErrBadDigest, verifySOAPDocument(t, rebound))
+}
+
+func TestVerify_ReferenceForwardErrors(t *testing.T) {
+	opts := sigsplit.Options{ID: "body", ReferenceURI: "#body"}
+	doc := signTestDocumentWithOptions(t, testSOAPFormat, base64.StdEncoding, opts)
+
+	type testCase struct {
+		Doc string
+		Err error
+	}
+
+	testCases := map[string]testCase{
+		"body missing": testCase{
+			Doc: strings.Replace(doc, `wsu:Id="body"`, `wsu:Id="other"`, 1),
+			Err: dsig.ErrReferenceNotFound,
+		},
+		"duplicate body": testCase{
+			Doc: strings.Replace(doc, `wsu:Id="ts"`, `wsu:Id="body"`, 1),
+			Err: dsig.ErrDuplicateID,
+		},
+		"qualified id in other namespace": testCase{
+			Doc: strings.Replace(doc, `<soap:Body wsu:Id="body">`, `<soap:Body soap:Id="body">`, 1),
+			Err: dsig.ErrReferenceNotFound,
+		},
+		"signature with other reference": testCase{
+			Doc: strings.Replace(doc, `#body`, `#ts`, 1),
+			Err: dsig.ErrSignatureNotFound,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var envelope struct {
+				Signature dsig.Signature `xml:"Header>Security>Signature"`
+			}
+
+			// The signature is decoded from the original document, so that only the
+			// document being verified changes.
+			assert.NoError(t, xml.Unmarshal([]byte(doc), &envelope))
+			err := envelope.Signature.VerifyWithOptions(testCert, xml.NewDecoder(strings.NewReader(tt.Doc)), dsig.VerifyOptions{AllowArbitraryReferences: true})
+			assert.Equal(t, tt.Err, err)
+		})
+	}
+}
+
+func TestVerify_EnvelopedAlongsideOtherSignature(t *testing.T) {
+	// The inner signature covers only the element with ID "x". The outer one
+	// covers the whole document, including the inner signature.
+	inner := signTestDocumentWithOptions(t, `<root><x ID="x">xxx</x>`+signatureWithURI("#x")+`</root>`, base64.StdEncoding, sigsplit.Options{ID: "x", ReferenceURI: "#x"})
+	innerSignature := inner[strings.Index(inner, "<ds:Signature"):strings.Index(inner, "</root>")]
+
+	doc := signTestDocument(t, `<root><x ID="x">xxx</x>`+innerSignature+testSignatureFormat+`</root>`, base64.StdEncoding)
+
+	verify := func(doc string) (error, error) {
+		var payload struct {
+			Signatures []dsig.Signature `xml:"http://www.w3.org/2000/09/xmldsig# Signature"`
+		}
+
+		assert.NoError(t, xml.Unmarshal([]byte(doc), &payload))
+		assert.Len(t, payload.Signatures, 2)
+
+		innerErr := payload.Signatures[0].VerifyWithOptions(testCert, xml.NewDecoder(strings.NewReader(doc)), dsig.VerifyOptions{AllowArbitraryReferences: true})
+		outerErr := payload.Signatures[1].Verify(testCert, xml.NewDecoder(strings.NewReader(doc)))
+		return innerErr, outerErr
+	}
+
+	innerErr, outerErr := verify(doc)
+	assert.NoError(t, innerErr)
+	assert.NoError(t, outerErr)
+
+	// Only the outer signature is removed when verifying it, so the inner
+	// signature is part of what it covers.
+	innerValue := innerSignature[strings.Index(innerSignature, "<ds:SignatureValue>"):]
+	tampered := strings.Replace(doc, innerValue, strings.Replace(innerValue, "<ds:SignatureValue>", "<ds:SignatureValue>AAAA", 1), 1)
+
+	innerErr, outerErr = verify(tampered)
+	assert.Error(t, innerErr)
+	assert.Equal(t, dsig.ErrBadDigest, outerErr)
+}
+
+func TestSignedInfo_EachReference(t *testing.T) {
+	signedInfo := dsig.SignedInfo{References: []dsig.Reference{{URI: "#a"}, {URI: "#b"}, {URI: "#c"}}}
+
+	var uris []string
+	assert.NoError(t, signedInfo.EachReference(func(ref dsig.Reference) error {
+		uris = append(uris, ref.URI)
+		return nil
+	}))
+
+	assert.Equal(t, []string{"#a", "#b", "#c"}, uris)
+
+	errStop := errors.New("stop")
+	uris = nil
+	assert.Equal(t, errStop, signedInfo.EachReference(func(ref dsig.Reference) error {
+		uris = append(uris, ref.URI)
+		if ref.URI == "#b" {
+			return errStop
+		}
+
+		return nil
+	}))
+
+	assert.Equal(t, []string{"#a", "#b"}, uris)
+}
+
+// manifestDocument returns a signed document with n elements, and a signature
+// with a Reference to each of them, like a manifest of archived files.
+//
+// Signing and verifying split the document once per Reference, so they take
+// time quadratic in n; manifestSignature is cheaper for large n.
+func manifestDocument(b *testing.B, n int) []byte {
+	var doc strings.Builder
+	var refs []dsig.ReferenceOptions
+	doc.WriteString("<manifest>")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&doc, `<file ID="f%d">file-%d.bin</file>`, i, i)
+		refs = append(refs, dsig.ReferenceOptions{URI: fmt.Sprintf("#f%d", i)})
+	}
+
+	doc.WriteString("</manifest>")
+
+	signed, err := dsig.SignDocument([]byte(doc.String()), testKey, testCert, dsig.SignOptions{References: refs})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	return signed
+}
+
+// manifestSignature returns an unsigned ds:Signature with n References, with
+// placeholder digests.
+func manifestSignature(n int) []byte {
+	var sig strings.Builder
+	sig.WriteString(`<ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:SignedInfo>`)
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&sig, `<ds:Reference URI="#f%d"><ds:DigestMethod Algorithm="http://www.w3.org/2001/04/xmlenc#sha256" /><ds:DigestValue>AAAA</ds:DigestValue></ds:Reference>`, i)
+	}
+
+	sig.WriteString(`</ds:SignedInfo></ds:Signature>`)
+	return []byte(sig.String())
+}
+
+func BenchmarkSignedInfo_EachReference(b *testing.B) {
+	sig := manifestSignature(5000)
+	b.SetBytes(int64(len(sig)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		var s dsig.Signature
+		if err := xml.Unmarshal(sig, &s); err != nil {
+			b.Fatal(err)
+		}
+
+		n := 0
+		s.SignedInfo.EachReference(func(ref dsig.Reference) error {
+			n++
+			return nil
+		})
+
+		if n != 5000 {
+			b.Fatalf("got %d references", n)
+		}
+	}
+}
+
+func BenchmarkVerify_ManyReferences(b *testing.B) {
+	doc := manifestDocument(b, 500)
+
+	var payload struct {
+		Signature dsig.Signature `xml:"http://www.w3.org/2000/09/xmldsig# Signature"`
+	}
+
+	if err := xml.Unmarshal(doc, &payload); err != nil {
+		b.Fatal(err)
+	}
+
+	b.SetBytes(int64(len(doc)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		decoder := xml.NewDecoder(bytes.NewReader(doc))
+		if err := payload.Signature.VerifyWithOptions(testCert, decoder, dsig.VerifyOptions{AllowArbitraryReferences: true}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
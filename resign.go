@@ -0,0 +1,171 @@
+package dsig
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/xml"
+	"io"
+
+	"github.com/ucarion/dsig/internal/sigsplit"
+)
+
+// Resign replaces the existing signature in doc with a new one, signed with
+// signer, and returns the resulting document. This is useful for documents
+// that were signed by someone else, and then modified.
+//
+// The signature replaced is the enveloped one: a ds:Signature that is a child
+// of the root element and signs the whole document, or that is a child of the
+// element its Reference refers to by ID, with opts.IDAttribute. Other
+// ds:Signature elements, such as a signature over some other element, or a
+// counter-signature inside a ds:Object, are left as they are. If doc has no
+// such ds:Signature, Resign returns ErrSignatureNotFound, and if it has more
+// than one, it returns ErrMultipleSignatures.
+//
+// The old ds:Signature is removed, and the new one is inserted in its place;
+// everything else in doc is preserved byte-for-byte.
+//
+// The new signature is created by NewSignature with opts, and so its digest,
+// signature, and canonicalization algorithms are those of opts, regardless of
+// what the old signature used. The old signature's ds:Object elements are
+// copied into the new one. If neither opts.References nor opts.ReferenceID is
+// set, the new signature has References with the same URIs, Types, and
+// Transforms as the old one, so that it signs the same content in the same
+// way; if the old signature has an XSLT transform, which Transform doesn't
+// retain, Resign returns ErrUnsupportedTransform. cert is handled as it is by
+// SignDocument.
+func Resign(doc []byte, signer crypto.Signer, cert *x509.Certificate, opts SignOptions) ([]byte, error) {
+	before, old, after, err := cutEnvelopedSignature(doc, opts.IDAttribute)
+	if err != nil {
+		return nil, err
+	}
+
+	carryReferences := len(opts.References) == 0 && opts.ReferenceID == ""
+	if carryReferences {
+		for _, ref := range old.SignedInfo.References {
+			for _, t := range ref.Transforms {
+				if t.Algorithm == TransformAlgorithmXSLT {
+					return nil, ErrUnsupportedTransform
+				}
+			}
+
+			opts.References = append(opts.References, ReferenceOptions{URI: ref.URI, Type: ref.Type})
+		}
+	}
+
+	if cert != nil && opts.Certificate == nil && len(opts.CertificateChain) == 0 {
+		opts.Certificate = cert
+	}
+
+	s, err := NewSignature(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if carryReferences {
+		for i, ref := range old.SignedInfo.References {
+			if len(ref.Transforms) > 0 {
+				s.SignedInfo.References[i].Transforms = append([]Transform(nil), ref.Transforms...)
+			}
+		}
+	}
+
+	s.Objects = old.Objects
+	return signSpliced(before, after, s, signer)
+}
+
+// cutEnvelopedSignature is like cutSignature, but splits doc around its
+// enveloped ds:Signature element, as described by Resign. idAttr is the ID
+// attribute, as with SignOptions.IDAttribute.
+func cutEnvelopedSignature(doc []byte, idAttr xml.Name) ([]byte, *Signature, []byte, error) {
+	type cut struct {
+		start, end int64
+		sig        *Signature
+	}
+
+	var cuts []cut
+
+	// parents are the start tags of the elements enclosing the current token.
+	var parents []xml.StartElement
+	decoder := xml.NewDecoder(bytes.NewReader(doc))
+	for {
+		offset := decoder.InputOffset()
+		t, err := decoder.Token()
+		if err != nil {
+			if err != io.EOF {
+				return nil, nil, nil, err
+			}
+
+			break
+		}
+
+		switch t := t.(type) {
+		case xml.StartElement:
+			if t.Name.Space != namespace || t.Name.Local != "Signature" {
+				parents = append(parents, t.Copy())
+				continue
+			}
+
+			// ds:Signature elements are consumed whole, so any signatures inside
+			// of them are never considered.
+			var s Signature
+			if err := decoder.DecodeElement(&s, &t); err != nil {
+				return nil, nil, nil, err
+			}
+
+			if len(parents) == 0 {
+				continue
+			}
+
+			id, err := s.SignedInfo.Reference().id()
+			if err != nil {
+				continue
+			}
+
+			if (id == "" && len(parents) == 1) || (id != "" && sigsplit.HasID(parents[len(parents)-1], id, idAttr, nil)) {
+				cuts = append(cuts, cut{start: offset, end: decoder.InputOffset(), sig: &s})
+			}
+		case xml.EndElement:
+			parents = parents[:len(parents)-1]
+		}
+	}
+
+	switch len(cuts) {
+	case 0:
+		return nil, nil, nil, ErrSignatureNotFound
+	case 1:
+		return doc[:cuts[0].start], cuts[0].sig, doc[cuts[0].end:], nil
+	default:
+		return nil, nil, nil, ErrMultipleSignatures
+	}
+}
+
+// cutSignature splits doc around its first ds:Signature element, and returns
+// the parts of doc before and after it, along with the unmarshaled element.
+func cutSignature(doc []byte) ([]byte, *Signature, []byte, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(doc))
+	for {
+		offset := decoder.InputOffset()
+		t, err := decoder.Token()
+		if err != nil {
+			if err == io.EOF {
+				return nil, nil, nil, ErrSignatureNotFound
+			}
+
+			return nil, nil, nil, err
+		}
+
+		start, ok := t.(xml.StartElement)
+		if !ok || start.Name.Space != namespace || start.Name.Local != "Signature" {
+			continue
+		}
+
+		var s Signature
+		if err := decoder.DecodeElement(&s, &start); err != nil {
+			return nil, nil, nil, err
+		}
+
+		end := decoder.InputOffset()
+		return doc[:offset], &s, doc[end:], nil
+	}
+}
@@ -0,0 +1,133 @@
+package dsig_test
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/dsig"
+)
+
+func TestResign(t *testing.T) {
+	upstream, err := dsig.SignDocument([]byte("<root>\n  <foo>xxx</foo>\n  <bar>yyy</bar>\n</root>"), testKey, testCert, dsig.SignOptions{DigestAlgorithm: dsig.DigestMethodAlgorithmSHA1})
+	assert.NoError(t, err)
+
+	// Move the signature between foo and bar, to check that it's replaced where
+	// it is rather than moved to the end.
+	sig := signatureElement.FindString(string(upstream))
+	upstream = []byte(strings.Replace(strings.Replace(string(upstream), sig, "", 1), "<bar>", sig+"<bar>", 1))
+	assert.Equal(t, []error{nil}, dsig.VerifyBatch(testCert, [][]byte{upstream}))
+
+	modified := strings.Replace(string(upstream), "xxx", "zzz", 1)
+	assert.Equal(t, []error{dsig.ErrBadDigest}, dsig.VerifyBatch(testCert, [][]byte{[]byte(modified)}))
+
+	key, cert := generateTestCert()
+	resigned, err := dsig.Resign([]byte(modified), key, cert, dsig.SignOptions{Prefix: "ds"})
+	assert.NoError(t, err)
+
+	assert.Equal(t, "<root>\n  <foo>zzz</foo>\n  <bar>yyy</bar>\n</root>", signatureElement.ReplaceAllString(string(resigned), ""))
+	assert.Contains(t, string(resigned), "</ds:Signature><bar>")
+	assert.Equal(t, []error{nil}, dsig.VerifyBatch(cert, [][]byte{resigned}))
+
+	var doc struct {
+		Signature dsig.Signature
+	}
+
+	assert.NoError(t, xml.Unmarshal(resigned, &doc))
+	assert.Equal(t, dsig.DigestMethodAlgorithmSHA256, doc.Signature.SignedInfo.Reference().DigestMethod.Algorithm)
+}
+
+func TestResign_ReferenceURI(t *testing.T) {
+	// The old signature uses a prefix declared on the root, and refers to the
+	// assertion by its ID. Resign doesn't check the old signature, so it needn't
+	// be valid.
+	doc := `<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><saml:Assertion xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="assertion"><ds:Signature><ds:SignedInfo><ds:Reference URI="#assertion"><ds:DigestValue>xxx</ds:DigestValue></ds:Reference></ds:SignedInfo><ds:SignatureValue>xxx</ds:SignatureValue></ds:Signature><saml:Subject>alice</saml:Subject></saml:Assertion></samlp:Response>`
+
+	resigned, err := dsig.Resign([]byte(doc), testKey, testCert, dsig.SignOptions{Prefix: "ds", IDAttribute: xml.Name{Local: "ID"}})
+	assert.NoError(t, err)
+	assert.Contains(t, string(resigned), `ID="assertion"><ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:SignedInfo>`)
+	assert.Contains(t, string(resigned), `<ds:Reference URI="#assertion">`)
+
+	var sig dsig.Signature
+	assert.NoError(t, xml.Unmarshal([]byte(signatureElement.FindString(string(resigned))), &sig))
+
+	verify := func(doc string) error {
+		return sig.VerifyWithOptions(testCert, xml.NewDecoder(strings.NewReader(doc)), dsig.VerifyOptions{IDAttribute: xml.Name{Local: "ID"}})
+	}
+
+	assert.NoError(t, verify(string(resigned)))
+	assert.Equal(t, dsig.ErrBadDigest, verify(strings.Replace(string(resigned), "alice", "mallory", 1)))
+}
+
+func TestResign_EnvelopedOnly(t *testing.T) {
+	// A signature over #foo that isn't inside of it, and a counter-signature,
+	// come before the enveloped signature. Neither is replaced.
+	other := `<ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:SignedInfo><ds:Reference URI="#foo"></ds:Reference></ds:SignedInfo><ds:SignatureValue>other</ds:SignatureValue></ds:Signature>`
+	counter := `<ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:SignedInfo><ds:Reference URI=""></ds:Reference></ds:SignedInfo><ds:SignatureValue>counter</ds:SignatureValue></ds:Signature>`
+	enveloped := `<ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:SignedInfo><ds:Reference URI=""></ds:Reference></ds:SignedInfo><ds:SignatureValue>old</ds:SignatureValue><ds:Object>` + counter + `</ds:Object></ds:Signature>`
+	doc := `<root><header>` + other + `</header><foo ID="foo">xxx</foo>` + enveloped + `</root>`
+
+	resigned, err := dsig.Resign([]byte(doc), testKey, testCert, dsig.SignOptions{Prefix: "ds"})
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(resigned), `<root><header>`+other+`</header><foo ID="foo">xxx</foo><ds:Signature `))
+	assert.Contains(t, string(resigned), `<ds:Object>`+counter+`</ds:Object></ds:Signature></root>`)
+	assert.NotContains(t, string(resigned), "old")
+
+	var payload struct {
+		Signature dsig.Signature `xml:"http://www.w3.org/2000/09/xmldsig# Signature"`
+	}
+
+	assert.NoError(t, xml.Unmarshal(resigned, &payload))
+	assert.NoError(t, payload.Signature.Verify(testCert, xml.NewDecoder(strings.NewReader(string(resigned)))))
+}
+
+func TestResign_CarriesOver(t *testing.T) {
+	// The old signature's Reference has a Type, and an InclusiveNamespaces
+	// PrefixList on its canonicalization transform, and the signature has a
+	// ds:Object. The old signature needn't be valid.
+	old := `<ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:SignedInfo><ds:Reference URI="" Type="urn:example:type"><ds:Transforms><ds:Transform Algorithm="http://www.w3.org/2000/09/xmldsig#enveloped-signature"></ds:Transform><ds:Transform Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"><ec:InclusiveNamespaces xmlns:ec="http://www.w3.org/2001/10/xml-exc-c14n#" PrefixList="xs"></ec:InclusiveNamespaces></ds:Transform></ds:Transforms></ds:Reference></ds:SignedInfo><ds:SignatureValue>xxx</ds:SignatureValue><ds:Object Id="obj">hello</ds:Object></ds:Signature>`
+	doc := `<root xmlns:xs="http://www.w3.org/2001/XMLSchema"><foo>xxx</foo>` + old + `</root>`
+
+	resigned, err := dsig.Resign([]byte(doc), testKey, testCert, dsig.SignOptions{Prefix: "ds"})
+	assert.NoError(t, err)
+
+	var payload struct {
+		Signature dsig.Signature `xml:"http://www.w3.org/2000/09/xmldsig# Signature"`
+	}
+
+	assert.NoError(t, xml.Unmarshal(resigned, &payload))
+
+	ref := payload.Signature.SignedInfo.Reference()
+	assert.Equal(t, "urn:example:type", ref.Type)
+	assert.Equal(t, 2, len(ref.Transforms))
+	assert.Equal(t, dsig.TransformAlgorithmEnveloped, ref.Transforms[0].Algorithm)
+	assert.Equal(t, &dsig.InclusiveNamespaces{PrefixList: "xs"}, ref.Transforms[1].InclusiveNamespaces)
+
+	assert.Equal(t, 1, len(payload.Signature.Objects))
+	assert.Equal(t, "obj", payload.Signature.Objects[0].ID)
+	assert.Equal(t, "hello", string(payload.Signature.Objects[0].Content))
+
+	assert.NoError(t, payload.Signature.Verify(testCert, xml.NewDecoder(strings.NewReader(string(resigned)))))
+}
+
+func TestResign_Errors(t *testing.T) {
+	_, err := dsig.Resign([]byte(`<root><foo>xxx</foo></root>`), testKey, testCert, dsig.SignOptions{})
+	assert.Equal(t, dsig.ErrSignatureNotFound, err)
+
+	_, err = dsig.Resign([]byte(`<root><Signature xmlns="http://www.w3.org/2000/09/xmldsig#">`), testKey, testCert, dsig.SignOptions{})
+	assert.Error(t, err)
+
+	_, err = dsig.Resign([]byte(`<root><Signature xmlns="http://www.w3.org/2000/09/xmldsig#"></Signature></root>`), testKey, testCert, dsig.SignOptions{DigestAlgorithm: "xxx"})
+	assert.Equal(t, dsig.ErrBadDigestAlgorithm, err)
+
+	_, err = dsig.Resign([]byte(`<root><foo><Signature xmlns="http://www.w3.org/2000/09/xmldsig#"></Signature></foo></root>`), testKey, testCert, dsig.SignOptions{})
+	assert.Equal(t, dsig.ErrSignatureNotFound, err)
+
+	_, err = dsig.Resign([]byte(`<root><Signature xmlns="http://www.w3.org/2000/09/xmldsig#"></Signature><Signature xmlns="http://www.w3.org/2000/09/xmldsig#"></Signature></root>`), testKey, testCert, dsig.SignOptions{})
+	assert.Equal(t, dsig.ErrMultipleSignatures, err)
+
+	xslt := `<root><Signature xmlns="http://www.w3.org/2000/09/xmldsig#"><SignedInfo><Reference URI=""><Transforms><Transform Algorithm="http://www.w3.org/TR/1999/REC-xslt-19991116"></Transform></Transforms></Reference></SignedInfo></Signature></root>`
+	_, err = dsig.Resign([]byte(xslt), testKey, testCert, dsig.SignOptions{})
+	assert.Equal(t, dsig.ErrUnsupportedTransform, err)
+}
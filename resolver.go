@@ -0,0 +1,61 @@
+package dsig
+
+import (
+	"errors"
+	"io/fs"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Resolver resolves the URI of a Reference to the data that the Reference
+// refers to.
+//
+// Resolvers are used by VerifyDetached for detached signatures, where the
+// signed data lives outside of the XML document containing the Signature.
+type Resolver func(uri string) ([]byte, error)
+
+// ErrBadReferenceURI is returned by a Resolver if the URI it's asked to resolve
+// is malformed, or refers to data the Resolver is not willing to return.
+var ErrBadReferenceURI = errors.New("dsig: invalid or disallowed reference URI")
+
+// FSResolver returns a Resolver that looks up relative URIs as files in fsys.
+//
+// The URI is percent-decoded per RFC 3986 and cleaned before being looked up.
+// URIs that are absolute (having a scheme or a host), that are absolute paths,
+// that have a query or fragment, or that contain ".." segments (including
+// percent-encoded ones, like "%2e%2e") are rejected with ErrBadReferenceURI.
+//
+// Because *zip.Reader implements fs.FS, FSResolver can be used to resolve
+// References in ZIP-based package formats, such as ODF.
+func FSResolver(fsys fs.FS) Resolver {
+	return func(uri string) ([]byte, error) {
+		u, err := url.Parse(uri)
+		if err != nil {
+			return nil, ErrBadReferenceURI
+		}
+
+		if u.Scheme != "" || u.Host != "" || u.Opaque != "" || u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+			return nil, ErrBadReferenceURI
+		}
+
+		// u.Path is already percent-decoded, so traversal attempts that were
+		// percent-encoded are caught here too.
+		if u.Path == "" || strings.HasPrefix(u.Path, "/") || strings.Contains(u.Path, "\\") {
+			return nil, ErrBadReferenceURI
+		}
+
+		for _, segment := range strings.Split(u.Path, "/") {
+			if segment == ".." {
+				return nil, ErrBadReferenceURI
+			}
+		}
+
+		name := path.Clean(u.Path)
+		if !fs.ValidPath(name) {
+			return nil, ErrBadReferenceURI
+		}
+
+		return fs.ReadFile(fsys, name)
+	}
+}
@@ -0,0 +1,75 @@
+package dsig_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/dsig"
+)
+
+func TestFSResolver(t *testing.T) {
+	fsys := fstest.MapFS{
+		"content.xml":          &fstest.MapFile{Data: []byte("<content />")},
+		"Pictures/image 1.png": &fstest.MapFile{Data: []byte("png")},
+	}
+
+	type testCase struct {
+		URI  string
+		Data string
+		Err  error
+	}
+
+	testCases := map[string]testCase{
+		"plain":                 testCase{URI: "content.xml", Data: "<content />"},
+		"dot segment":           testCase{URI: "./content.xml", Data: "<content />"},
+		"percent-encoded":       testCase{URI: "Pictures/image%201.png", Data: "png"},
+		"dot dot":               testCase{URI: "../content.xml", Err: dsig.ErrBadReferenceURI},
+		"inner dot dot":         testCase{URI: "Pictures/../content.xml", Err: dsig.ErrBadReferenceURI},
+		"encoded dot dot":       testCase{URI: "%2e%2e/content.xml", Err: dsig.ErrBadReferenceURI},
+		"encoded slash dot dot": testCase{URI: "Pictures%2f..%2fcontent.xml", Err: dsig.ErrBadReferenceURI},
+		"absolute path":         testCase{URI: "/content.xml", Err: dsig.ErrBadReferenceURI},
+		"absolute uri":          testCase{URI: "file:///etc/passwd", Err: dsig.ErrBadReferenceURI},
+		"network path":          testCase{URI: "//example.com/content.xml", Err: dsig.ErrBadReferenceURI},
+		"backslash":             testCase{URI: "Pictures\\..\\content.xml", Err: dsig.ErrBadReferenceURI},
+		"fragment":              testCase{URI: "#foo", Err: dsig.ErrBadReferenceURI},
+		"empty":                 testCase{URI: "", Err: dsig.ErrBadReferenceURI},
+		"bad escape":            testCase{URI: "%zz", Err: dsig.ErrBadReferenceURI},
+		"not found":             testCase{URI: "missing.xml", Err: fs.ErrNotExist},
+	}
+
+	resolve := dsig.FSResolver(fsys)
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			data, err := resolve(tt.URI)
+			if tt.Err == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.True(t, errors.Is(err, tt.Err), "expected %v, got %v", tt.Err, err)
+			}
+
+			assert.Equal(t, tt.Data, string(data))
+		})
+	}
+}
+
+func TestFSResolver_Zip(t *testing.T) {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	f, err := w.Create("META-INF/manifest.xml")
+	assert.NoError(t, err)
+	_, err = f.Write([]byte("<manifest />"))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.NoError(t, err)
+
+	data, err := dsig.FSResolver(r)("META-INF/manifest.xml")
+	assert.NoError(t, err)
+	assert.Equal(t, "<manifest />", string(data))
+}
@@ -0,0 +1,101 @@
+package dsig
+
+import (
+	"encoding/xml"
+	"strings"
+
+	"github.com/ucarion/dsig/internal/sigsplit"
+)
+
+// VerifyResult describes a signature that VerifyWithResult found to be valid.
+//
+// A VerifyResult contains no maps, and its fields are fully determined by the
+// signature and the data it was verified against. Comparing VerifyResults, or
+// serializing them for golden tests, gives the same results from run to run.
+type VerifyResult struct {
+	// CanonicalizationMethod is the URI of the c14n algorithm that was used to
+	// canonicalize the signature's SignedInfo.
+	CanonicalizationMethod string
+
+	// SignatureMethod is the URI of the algorithm that the signature was
+	// verified with.
+	SignatureMethod string
+
+	// DigestMethod is the URI of the algorithm that the signed data was digested
+	// with.
+	DigestMethod string
+
+	// Digest is the digest of the signed data, which matched the signature's
+	// DigestValue.
+	Digest []byte
+
+	// SignedData is the canonicalized data that was digested: the whole
+	// document, or the element the signature's Reference refers to, without the
+	// signature itself. If the signature has several References, DigestMethod,
+	// Digest, and SignedData describe the first of them.
+	//
+	// Canonicalization drops comments, so the signature says nothing about them,
+	// and an attacker can insert them into signed text without breaking the
+	// signature. A signed "user@corp.com.evil.com" can be turned into
+	// "user@corp.com<!---->.evil.com", which code that only reads the first text
+	// node would take to be "user@corp.com". SignedData never contains comments
+	// and has no such ambiguity, so applications that read the signed content
+	// from SignedData, rather than from the original document, see exactly what
+	// was signed.
+	SignedData []byte
+
+	// SignedInfo is the canonicalized ds:SignedInfo that the signature was
+	// verified against.
+	//
+	// These are exactly the bytes that were hashed and checked against the
+	// SignatureValue, so archiving them alongside the SignatureValue lets the
+	// signature be checked again later without the original document.
+	SignedInfo []byte
+
+	// ReferencedElements describes the element that each of the signature's
+	// References refers to, in the same order as the References.
+	//
+	// A signature says nothing about where in the document the data it covers
+	// is. Applications that go on to read signed data out of the document should
+	// check that it comes from one of these elements; see
+	// VerifyOptions.AllowArbitraryReferences.
+	ReferencedElements []ReferencedElement
+}
+
+// ReferencedElement describes the element whose content one of a signature's
+// References covers.
+type ReferencedElement struct {
+	// URI is the URI of the Reference.
+	URI string
+
+	// Path is the local names of the elements from the root of the document down
+	// to the referenced element, in the same "a>b>c" syntax as VerifyField. For
+	// a Reference to the whole document, it's the local name of the root
+	// element.
+	Path string
+
+	// Name is the name of the referenced element, with its namespace URI as its
+	// Space.
+	Name xml.Name
+
+	// DigestMethod is the URI of the algorithm that the Reference's data was
+	// digested with, and Digest is the digest, which matched its DigestValue.
+	//
+	// Receipts that echo the digests of a message's References, such as ebMS and
+	// AS4 non-repudiation receipts, can be compared against these; see
+	// MatchNonRepudiationReceipt.
+	DigestMethod string
+	Digest       []byte
+}
+
+// newReferencedElement returns the ReferencedElement for ref, which split was
+// split out for, and whose data had the given digest.
+func newReferencedElement(ref *Reference, split *sigsplit.Result, digest []byte) ReferencedElement {
+	return ReferencedElement{
+		URI:          ref.URI,
+		Path:         strings.Join(split.Path, ">"),
+		Name:         split.Name,
+		DigestMethod: ref.DigestMethod.Algorithm,
+		Digest:       digest,
+	}
+}
@@ -0,0 +1,157 @@
+package dsig_test
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/dsig"
+)
+
+func TestVerifyWithResult(t *testing.T) {
+	doc := signTestDocument(t, `<root xmlns:a="http://example.com/a" xmlns:b="http://example.com/b" xmlns:c="http://example.com/c"><foo>xxx</foo>`+testSignatureFormat+`</root>`, base64.StdEncoding)
+
+	var payload struct {
+		Signature dsig.Signature `xml:"http://www.w3.org/2000/09/xmldsig# Signature"`
+	}
+
+	assert.NoError(t, xml.Unmarshal([]byte(doc), &payload))
+
+	digest := sha256.Sum256([]byte(`<root><foo>xxx</foo></root>`))
+	expected := &dsig.VerifyResult{
+		CanonicalizationMethod: dsig.CanonicalizationMethodAlgorithmExclusive,
+		SignatureMethod:        dsig.SignatureMethodAlgorithmSHA256,
+		DigestMethod:           dsig.DigestMethodAlgorithmSHA256,
+		Digest:                 digest[:],
+		SignedData:             []byte(`<root><foo>xxx</foo></root>`),
+		ReferencedElements: []dsig.ReferencedElement{{
+			URI:          "",
+			Path:         "root",
+			Name:         xml.Name{Local: "root"},
+			DigestMethod: dsig.DigestMethodAlgorithmSHA256,
+			Digest:       digest[:],
+		}},
+	}
+
+	// Run this a few times, to make sure that the result doesn't vary from run
+	// to run.
+	for i := 0; i < 10; i++ {
+		result, err := payload.Signature.VerifyWithResult(testCert, xml.NewDecoder(strings.NewReader(doc)), dsig.VerifyOptions{})
+		assert.NoError(t, err)
+
+		// SignedInfo is checked by TestVerifyWithResult_SignedInfo.
+		result.SignedInfo = nil
+		assert.Equal(t, expected, result)
+	}
+}
+
+func TestVerifyWithResult_SignedInfo(t *testing.T) {
+	doc := signTestDocument(t, `<root xmlns:a="http://example.com/a"><foo>xxx</foo>`+testSignatureFormat+`</root>`, base64.StdEncoding)
+
+	var payload struct {
+		Signature dsig.Signature `xml:"http://www.w3.org/2000/09/xmldsig# Signature"`
+	}
+
+	assert.NoError(t, xml.Unmarshal([]byte(doc), &payload))
+
+	result, err := payload.Signature.VerifyWithResult(testCert, xml.NewDecoder(strings.NewReader(doc)), dsig.VerifyOptions{})
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(result.SignedInfo), `<ds:SignedInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#">`))
+
+	// The archived SignedInfo can be checked against the SignatureValue
+	// without the original document.
+	sig, err := base64.StdEncoding.DecodeString(payload.Signature.SignatureValue.Value)
+	assert.NoError(t, err)
+
+	hash := sha256.Sum256(result.SignedInfo)
+	assert.NoError(t, rsa.VerifyPKCS1v15(testCert.PublicKey.(*rsa.PublicKey), crypto.SHA256, hash[:], sig))
+}
+
+func TestVerifyWithResult_Invalid(t *testing.T) {
+	doc := signTestDocument(t, `<root><foo>xxx</foo>`+testSignatureFormat+`</root>`, base64.StdEncoding)
+
+	var payload struct {
+		Signature dsig.Signature `xml:"http://www.w3.org/2000/09/xmldsig# Signature"`
+	}
+
+	assert.NoError(t, xml.Unmarshal([]byte(doc), &payload))
+
+	type testCase struct {
+		Doc            string
+		SignatureValue string
+		Err            error
+	}
+
+	testCases := map[string]testCase{
+		"bad digest": testCase{
+			Doc:            strings.Replace(doc, "xxx", "yyy", 1),
+			SignatureValue: payload.Signature.SignatureValue.Value,
+			Err:            dsig.ErrBadDigest,
+		},
+		"bad signature": testCase{
+			Doc:            doc,
+			SignatureValue: base64.StdEncoding.EncodeToString(make([]byte, 256)),
+			Err:            rsa.ErrVerification,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			sig := payload.Signature
+			sig.SignatureValue.Value = tt.SignatureValue
+
+			// Errors are sentinel values, so they can be compared directly.
+			result, err := sig.VerifyWithResult(testCert, xml.NewDecoder(strings.NewReader(tt.Doc)), dsig.VerifyOptions{})
+			assert.Nil(t, result)
+			assert.Equal(t, tt.Err, err)
+		})
+	}
+}
+
+func TestVerifyWithResult_SignedData(t *testing.T) {
+	format := strings.NewReplacer("\n", "", "SIGNATURE", testSignatureFormat).Replace(`<saml:Assertion xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="_a1">
+<saml:Subject><saml:NameID>user@corp.com.evil.com</saml:NameID></saml:Subject>
+SIGNATURE
+</saml:Assertion>`)
+
+	// The attacker legitimately obtains a signed assertion for a user they
+	// control, and then splits its NameID with a comment.
+	doc := signTestDocument(t, format, base64.StdEncoding)
+	doc = strings.Replace(doc, "user@corp.com.evil.com", "user@corp.com<!---->.evil.com", 1)
+
+	var payload struct {
+		Signature dsig.Signature `xml:"http://www.w3.org/2000/09/xmldsig# Signature"`
+	}
+
+	assert.NoError(t, xml.Unmarshal([]byte(doc), &payload))
+
+	result, err := payload.Signature.VerifyWithResult(testCert, xml.NewDecoder(strings.NewReader(doc)), dsig.VerifyOptions{})
+	assert.NoError(t, err)
+
+	// firstNameIDText is what a naive consumer would take the NameID to be.
+	firstNameIDText := func(data []byte) string {
+		decoder := xml.NewDecoder(strings.NewReader(string(data)))
+		inNameID := false
+		for {
+			tok, err := decoder.Token()
+			assert.NoError(t, err)
+
+			switch tok := tok.(type) {
+			case xml.StartElement:
+				inNameID = tok.Name.Local == "NameID"
+			case xml.CharData:
+				if inNameID {
+					return string(tok)
+				}
+			}
+		}
+	}
+
+	assert.Equal(t, "user@corp.com", firstNameIDText([]byte(doc)))
+	assert.Equal(t, "user@corp.com.evil.com", firstNameIDText(result.SignedData))
+}
@@ -0,0 +1,263 @@
+package dsig
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/xml"
+	"errors"
+	"time"
+)
+
+// ErrBadAudience is returned by VerifyAssertion if the assertion is not
+// intended for the expected audience.
+var ErrBadAudience = errors.New("dsig: assertion audience does not match")
+
+// ErrBadRecipient is returned by VerifyAssertion if the assertion is not
+// intended for the expected recipient.
+var ErrBadRecipient = errors.New("dsig: assertion recipient does not match")
+
+// ErrAssertionNotYetValid is returned by VerifyAssertion if the assertion's
+// NotBefore is in the future.
+var ErrAssertionNotYetValid = errors.New("dsig: assertion is not yet valid")
+
+// ErrAssertionExpired is returned by VerifyAssertion if the assertion's
+// NotOnOrAfter is in the past.
+var ErrAssertionExpired = errors.New("dsig: assertion has expired")
+
+// ErrNameIDNotFound is returned by VerifyAssertionNameID if the assertion's
+// saml:Subject has no saml:NameID.
+var ErrNameIDNotFound = errors.New("dsig: assertion has no NameID")
+
+// ErrAssertionNotSigned is returned by VerifyAssertion if the assertion's
+// signature refers to something other than the whole assertion, and so might
+// not cover the parts of it that are checked.
+var ErrAssertionNotSigned = errors.New("dsig: assertion is not covered by signature")
+
+// ErrNameIDNotSigned is the same as ErrAssertionNotSigned.
+//
+// Deprecated: VerifyAssertion and VerifyAssertionNameID both return
+// ErrAssertionNotSigned, which ErrNameIDNotSigned is equal to.
+var ErrNameIDNotSigned = ErrAssertionNotSigned
+
+// AssertionOptions describes the checks VerifyAssertion performs on a SAML
+// assertion, beyond verifying its signature.
+type AssertionOptions struct {
+	// Audience, if non-empty, must be listed as a saml:Audience in every
+	// saml:AudienceRestriction of the assertion. The assertion must have at least
+	// one saml:AudienceRestriction.
+	Audience string
+
+	// Recipient, if non-empty, must be the Recipient of one of the assertion's
+	// saml:SubjectConfirmationData elements.
+	Recipient string
+
+	// Clock returns the current time, against which the assertion's NotBefore
+	// and NotOnOrAfter are checked. If nil, time.Now is used.
+	Clock func() time.Time
+
+	// Skew is how far the assertion's NotBefore and NotOnOrAfter may be off from
+	// the time returned by Clock, to allow for clock differences between the
+	// assertion's issuer and its consumer.
+	Skew time.Duration
+}
+
+func (o *AssertionOptions) now() time.Time {
+	if o.Clock == nil {
+		return time.Now()
+	}
+
+	return o.Clock()
+}
+
+// VerifyAssertion verifies the signature on a SAML 2.0 assertion, and then
+// checks that the assertion is currently valid and is intended for the audience
+// and recipient described by opts.
+//
+// data must be a saml:Assertion element, with its ds:Signature as an immediate
+// child. The signature is verified with cert exactly as Verify would. The
+// assertion's audience and recipient are only checked if the signature is
+// valid. data is read with the default limits of NewDecoder.
+//
+// The signature must cover the whole assertion, either with an empty Reference
+// URI or with one that refers to the assertion's ID. Otherwise, what's signed
+// may be only part of the assertion, or another assertion that a forged one
+// wraps, and VerifyAssertion returns ErrAssertionNotSigned.
+//
+// The NotBefore and NotOnOrAfter of the assertion's saml:Conditions are always
+// checked, as are those of the saml:SubjectConfirmationData whose Recipient
+// matches opts.Recipient. If any of these rule out the current time, allowing
+// for opts.Skew, VerifyAssertion returns ErrAssertionNotYetValid or
+// ErrAssertionExpired.
+//
+// VerifyAssertion is a convenience for the most common SAML flow. It does not
+// implement the rest of SAML's processing rules; for a complete implementation
+// of SAML, consider using github.com/ucarion/saml.
+func VerifyAssertion(cert *x509.Certificate, data []byte, opts AssertionOptions) error {
+	_, err := verifyAssertion(cert, data, opts)
+	return err
+}
+
+// NameID is the saml:NameID that identifies the subject of a SAML assertion.
+type NameID struct {
+	// Value is the text of the saml:NameID element.
+	Value string
+
+	// Format is the Format attribute of the saml:NameID element, if any.
+	Format string
+}
+
+// VerifyAssertionNameID verifies a SAML 2.0 assertion exactly as
+// VerifyAssertion does, and then returns the saml:NameID of the assertion's
+// saml:Subject.
+//
+// The NameID is only returned if the assertion is valid; otherwise, the
+// returned NameID is nil. If the assertion has no saml:NameID, for instance
+// because it uses a saml:EncryptedID instead, VerifyAssertionNameID returns
+// ErrNameIDNotFound.
+//
+// The Value of the NameID is all of the text within the saml:NameID element,
+// including any text that follows a comment within it. This is the same text
+// that was digested when verifying the signature.
+func VerifyAssertionNameID(cert *x509.Certificate, data []byte, opts AssertionOptions) (*NameID, error) {
+	assertion, err := verifyAssertion(cert, data, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if assertion.Subject.NameID == nil {
+		return nil, ErrNameIDNotFound
+	}
+
+	return &NameID{Value: assertion.Subject.NameID.Value, Format: assertion.Subject.NameID.Format}, nil
+}
+
+// verifyAssertion does the work of VerifyAssertion, returning the assertion if
+// it's valid.
+func verifyAssertion(cert *x509.Certificate, data []byte, opts AssertionOptions) (*samlAssertion, error) {
+	var assertion samlAssertion
+	if err := NewDecoder(bytes.NewReader(data)).Decode(&assertion); err != nil {
+		return nil, err
+	}
+
+	if uri := assertion.Signature.SignedInfo.Reference().URI; uri != "" && uri != "#"+assertion.ID {
+		return nil, ErrAssertionNotSigned
+	}
+
+	if err := assertion.Signature.Verify(cert, NewDecoder(bytes.NewReader(data))); err != nil {
+		return nil, err
+	}
+
+	if err := assertion.check(opts); err != nil {
+		return nil, err
+	}
+
+	return &assertion, nil
+}
+
+type samlAssertion struct {
+	XMLName    xml.Name       `xml:"urn:oasis:names:tc:SAML:2.0:assertion Assertion"`
+	ID         string         `xml:",attr"`
+	Signature  Signature      `xml:"http://www.w3.org/2000/09/xmldsig# Signature"`
+	Subject    samlSubject    `xml:"urn:oasis:names:tc:SAML:2.0:assertion Subject"`
+	Conditions samlConditions `xml:"urn:oasis:names:tc:SAML:2.0:assertion Conditions"`
+}
+
+type samlSubject struct {
+	NameID *struct {
+		Value  string `xml:",chardata"`
+		Format string `xml:",attr"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:assertion NameID"`
+
+	SubjectConfirmations []struct {
+		SubjectConfirmationData struct {
+			Recipient string `xml:",attr"`
+			samlValidity
+		} `xml:"urn:oasis:names:tc:SAML:2.0:assertion SubjectConfirmationData"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:assertion SubjectConfirmation"`
+}
+
+type samlConditions struct {
+	samlValidity
+	AudienceRestrictions []struct {
+		Audiences []string `xml:"urn:oasis:names:tc:SAML:2.0:assertion Audience"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:assertion AudienceRestriction"`
+}
+
+// samlValidity is the window of time in which an element of an assertion is
+// valid. Either end of the window may be absent.
+type samlValidity struct {
+	NotBefore    time.Time `xml:",attr"`
+	NotOnOrAfter time.Time `xml:",attr"`
+}
+
+// check returns an error if now is outside of v, allowing for skew.
+func (v *samlValidity) check(now time.Time, skew time.Duration) error {
+	if !v.NotBefore.IsZero() && now.Before(v.NotBefore.Add(-skew)) {
+		return ErrAssertionNotYetValid
+	}
+
+	if !v.NotOnOrAfter.IsZero() && !now.Before(v.NotOnOrAfter.Add(skew)) {
+		return ErrAssertionExpired
+	}
+
+	return nil
+}
+
+// check performs the SAML-level checks on an assertion whose signature has
+// already been verified.
+func (a *samlAssertion) check(opts AssertionOptions) error {
+	now := opts.now()
+	if err := a.Conditions.check(now, opts.Skew); err != nil {
+		return err
+	}
+
+	if opts.Audience != "" {
+		if len(a.Conditions.AudienceRestrictions) == 0 {
+			return ErrBadAudience
+		}
+
+		for _, restriction := range a.Conditions.AudienceRestrictions {
+			if !containsString(restriction.Audiences, opts.Audience) {
+				return ErrBadAudience
+			}
+		}
+	}
+
+	if opts.Recipient != "" {
+		var validityErr error
+		ok := false
+		for _, confirmation := range a.Subject.SubjectConfirmations {
+			data := confirmation.SubjectConfirmationData
+			if data.Recipient != opts.Recipient {
+				continue
+			}
+
+			if err := data.check(now, opts.Skew); err != nil {
+				validityErr = err
+				continue
+			}
+
+			ok = true
+		}
+
+		if !ok {
+			if validityErr != nil {
+				return validityErr
+			}
+
+			return ErrBadRecipient
+		}
+	}
+
+	return nil
+}
+
+func containsString(a []string, s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,237 @@
+package dsig_test
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/dsig"
+	"github.com/ucarion/dsig/internal/sigsplit"
+)
+
+// testAssertionFormat is a SAML assertion containing testSignatureFormat, and
+// so it has the same verbs as testSignatureFormat.
+var testAssertionFormat = strings.NewReplacer("\n", "", "SIGNATURE", testSignatureFormat).Replace(`<saml:Assertion xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="_a1" Version="2.0">
+<saml:Issuer>http://idp.example.com</saml:Issuer>
+SIGNATURE
+<saml:Subject>
+<saml:NameID Format="urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress">jdoe@example.com</saml:NameID>
+<saml:SubjectConfirmation Method="urn:oasis:names:tc:SAML:2.0:cm:bearer">
+<saml:SubjectConfirmationData Recipient="https://sp.example.com/acs"></saml:SubjectConfirmationData>
+</saml:SubjectConfirmation>
+</saml:Subject>
+<saml:Conditions>
+<saml:AudienceRestriction>
+<saml:Audience>https://sp.example.com</saml:Audience>
+</saml:AudienceRestriction>
+</saml:Conditions>
+</saml:Assertion>`)
+
+func TestVerifyAssertion(t *testing.T) {
+	doc := signTestDocument(t, testAssertionFormat, base64.StdEncoding)
+
+	type testCase struct {
+		Doc     string
+		Options dsig.AssertionOptions
+		Err     error
+	}
+
+	testCases := map[string]testCase{
+		"no checks": testCase{
+			Doc:     doc,
+			Options: dsig.AssertionOptions{},
+			Err:     nil,
+		},
+		"audience and recipient": testCase{
+			Doc:     doc,
+			Options: dsig.AssertionOptions{Audience: "https://sp.example.com", Recipient: "https://sp.example.com/acs"},
+			Err:     nil,
+		},
+		"wrong audience": testCase{
+			Doc:     doc,
+			Options: dsig.AssertionOptions{Audience: "https://evil.example.com"},
+			Err:     dsig.ErrBadAudience,
+		},
+		"wrong recipient": testCase{
+			Doc:     doc,
+			Options: dsig.AssertionOptions{Recipient: "https://evil.example.com/acs"},
+			Err:     dsig.ErrBadRecipient,
+		},
+		"tampered": testCase{
+			Doc:     strings.Replace(doc, "https://sp.example.com<", "https://evil.example.com<", 1),
+			Options: dsig.AssertionOptions{Audience: "https://evil.example.com"},
+			Err:     dsig.ErrBadDigest,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tt.Err, dsig.VerifyAssertion(testCert, []byte(tt.Doc), tt.Options))
+		})
+	}
+}
+
+func TestVerifyAssertion_Wrapped(t *testing.T) {
+	// The IdP's signature is an enveloping one, over a ds:Object containing the
+	// real assertion.
+	signed := strings.Replace(testAssertionFormat, testSignatureFormat, "", 1)
+	s, err := dsig.SignEnveloping(testKey, dsig.Object{ID: "obj", Content: []byte(signed)}, dsig.SignOptions{Certificate: testCert})
+	assert.NoError(t, err)
+
+	signature, err := xml.Marshal(s)
+	assert.NoError(t, err)
+
+	// An attacker wraps it in a forged assertion about another subject. The
+	// signature is an immediate child of the forged assertion, and its
+	// ds:Object is unchanged, so the signature itself still verifies.
+	forged := strings.NewReplacer(
+		`ID="_a1"`, `ID="_evil"`,
+		"jdoe@", "admin@",
+		"SIGNATURE", string(signature),
+	).Replace(strings.Replace(testAssertionFormat, testSignatureFormat, "SIGNATURE", 1))
+
+	var payload struct {
+		Signature dsig.Signature `xml:"http://www.w3.org/2000/09/xmldsig# Signature"`
+	}
+
+	assert.NoError(t, xml.Unmarshal([]byte(forged), &payload))
+	assert.NoError(t, payload.Signature.Verify(testCert, xml.NewDecoder(strings.NewReader(forged))))
+
+	// But the signature doesn't cover the forged assertion, and so every SAML
+	// entry point rejects it.
+	assert.Equal(t, dsig.ErrAssertionNotSigned, dsig.VerifyAssertion(testCert, []byte(forged), dsig.AssertionOptions{}))
+
+	nameID, err := dsig.VerifyAssertionNameID(testCert, []byte(forged), dsig.AssertionOptions{})
+	assert.Equal(t, dsig.ErrAssertionNotSigned, err)
+	assert.Nil(t, nameID)
+}
+
+func TestVerifyAssertion_Validity(t *testing.T) {
+	format := strings.NewReplacer(
+		`<saml:SubjectConfirmationData `, `<saml:SubjectConfirmationData NotOnOrAfter="2020-01-01T00:10:00Z" `,
+		`<saml:Conditions>`, `<saml:Conditions NotBefore="2020-01-01T00:00:00Z" NotOnOrAfter="2020-01-01T01:00:00Z">`,
+	).Replace(testAssertionFormat)
+
+	doc := signTestDocument(t, format, base64.StdEncoding)
+	clock := func(s string) func() time.Time {
+		return func() time.Time {
+			now, err := time.Parse(time.RFC3339, s)
+			assert.NoError(t, err)
+			return now
+		}
+	}
+
+	type testCase struct {
+		Options dsig.AssertionOptions
+		Err     error
+	}
+
+	testCases := map[string]testCase{
+		"valid": testCase{
+			Options: dsig.AssertionOptions{Clock: clock("2020-01-01T00:05:00Z")},
+			Err:     nil,
+		},
+		"not yet valid": testCase{
+			Options: dsig.AssertionOptions{Clock: clock("2019-12-31T23:59:00Z")},
+			Err:     dsig.ErrAssertionNotYetValid,
+		},
+		"not yet valid, within skew": testCase{
+			Options: dsig.AssertionOptions{Clock: clock("2019-12-31T23:59:00Z"), Skew: 2 * time.Minute},
+			Err:     nil,
+		},
+		"expired": testCase{
+			Options: dsig.AssertionOptions{Clock: clock("2020-01-01T01:00:00Z")},
+			Err:     dsig.ErrAssertionExpired,
+		},
+		"expired, within skew": testCase{
+			Options: dsig.AssertionOptions{Clock: clock("2020-01-01T01:00:00Z"), Skew: time.Minute},
+			Err:     nil,
+		},
+		"expired, beyond skew": testCase{
+			Options: dsig.AssertionOptions{Clock: clock("2020-01-01T01:01:00Z"), Skew: time.Minute},
+			Err:     dsig.ErrAssertionExpired,
+		},
+		"confirmation expired": testCase{
+			Options: dsig.AssertionOptions{Clock: clock("2020-01-01T00:20:00Z"), Recipient: "https://sp.example.com/acs"},
+			Err:     dsig.ErrAssertionExpired,
+		},
+		"confirmation expired, other recipient": testCase{
+			Options: dsig.AssertionOptions{Clock: clock("2020-01-01T00:20:00Z"), Recipient: "https://evil.example.com/acs"},
+			Err:     dsig.ErrBadRecipient,
+		},
+		"confirmation expired, not checked": testCase{
+			Options: dsig.AssertionOptions{Clock: clock("2020-01-01T00:20:00Z")},
+			Err:     nil,
+		},
+		"default clock": testCase{
+			Options: dsig.AssertionOptions{},
+			Err:     dsig.ErrAssertionExpired,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tt.Err, dsig.VerifyAssertion(testCert, []byte(doc), tt.Options))
+		})
+	}
+}
+
+func TestVerifyAssertionNameID(t *testing.T) {
+	doc := signTestDocument(t, testAssertionFormat, base64.StdEncoding)
+	email := &dsig.NameID{Value: "jdoe@example.com", Format: "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"}
+
+	byID := strings.Replace(testAssertionFormat, `URI=""`, `URI="#_a1"`, 1)
+	bySubject := strings.NewReplacer(`URI=""`, `URI="#s1"`, "<saml:Subject>", `<saml:Subject ID="s1">`).Replace(testAssertionFormat)
+	noNameID := strings.Replace(testAssertionFormat, `<saml:NameID Format="urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress">jdoe@example.com</saml:NameID>`, "", 1)
+
+	type testCase struct {
+		Doc     string
+		Options dsig.AssertionOptions
+		NameID  *dsig.NameID
+		Err     error
+	}
+
+	testCases := map[string]testCase{
+		"valid": testCase{
+			Doc:     doc,
+			Options: dsig.AssertionOptions{Audience: "https://sp.example.com"},
+			NameID:  email,
+		},
+		"reference by assertion id": testCase{
+			Doc:    signTestDocumentWithOptions(t, byID, base64.StdEncoding, sigsplit.Options{ID: "_a1", ReferenceURI: "#_a1"}),
+			NameID: email,
+		},
+		"reference to part of assertion": testCase{
+			Doc: signTestDocumentWithOptions(t, bySubject, base64.StdEncoding, sigsplit.Options{ID: "s1", ReferenceURI: "#s1"}),
+			Err: dsig.ErrAssertionNotSigned,
+		},
+		"comment in name id": testCase{
+			Doc:    signTestDocument(t, strings.Replace(testAssertionFormat, "jdoe@", "jdoe<!-- comment -->@", 1), base64.StdEncoding),
+			NameID: email,
+		},
+		"no name id": testCase{
+			Doc: signTestDocument(t, noNameID, base64.StdEncoding),
+			Err: dsig.ErrNameIDNotFound,
+		},
+		"tampered": testCase{
+			Doc: strings.Replace(doc, "jdoe@", "admin@", 1),
+			Err: dsig.ErrBadDigest,
+		},
+		"wrong audience": testCase{
+			Doc:     doc,
+			Options: dsig.AssertionOptions{Audience: "https://other.example.com"},
+			Err:     dsig.ErrBadAudience,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			nameID, err := dsig.VerifyAssertionNameID(testCert, []byte(tt.Doc), tt.Options)
+			assert.Equal(t, tt.Err, err)
+			assert.Equal(t, tt.NameID, nameID)
+		})
+	}
+}
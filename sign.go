@@ -0,0 +1,458 @@
+package dsig
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"io"
+
+	"github.com/ucarion/c14n"
+	"github.com/ucarion/dsig/internal/sigsplit"
+)
+
+// SignOptions controls the ds:Signature that NewSignature creates.
+//
+// The zero value of SignOptions creates an RSA-SHA256 signature with a SHA256
+// digest.
+type SignOptions struct {
+	// DigestAlgorithm is the URI of the algorithm used to digest the signed
+	// data, one of the DigestMethodAlgorithm values. If empty,
+	// DigestMethodAlgorithmSHA256 is used.
+	DigestAlgorithm string
+
+	// SignatureAlgorithm is the URI of the algorithm used to sign
+	// ds:SignedInfo, one of the SignatureMethodAlgorithm values. If empty,
+	// SignatureMethodAlgorithmSHA256 is used.
+	//
+	// It's independent of DigestAlgorithm, so a signature may, for instance,
+	// use RSA-SHA256 with a SHA1 digest. Every supported signature algorithm is
+	// an RSA algorithm, and Sign rejects keys that aren't RSA keys.
+	SignatureAlgorithm string
+
+	// CanonicalizationAlgorithm is the URI of the algorithm used to canonicalize
+	// ds:SignedInfo, and of the canonicalization Transform of the default
+	// References, one of the CanonicalizationMethodAlgorithm values. If empty,
+	// CanonicalizationMethodAlgorithmExclusive is used. Use
+	// CanonicalizationMethodAlgorithmInclusive for counterparties that only
+	// accept Canonical XML 1.0.
+	//
+	// If CanonicalizationAlgorithm isn't supported, NewSignature returns
+	// ErrBadCanonicalizationAlgorithm.
+	CanonicalizationAlgorithm string
+
+	// Certificate, if non-nil, is included in the signature's KeyInfo as a
+	// ds:X509Certificate, so that consumers can tell which key signed the
+	// document. It should be the certificate of the key passed to Sign.
+	//
+	// KeyInfo comes after SignatureValue in the ds:Signature element, and isn't
+	// part of ds:SignedInfo, so it isn't covered by the signature.
+	Certificate *x509.Certificate
+
+	// CertificateChain, if non-empty, is included in the signature's KeyInfo
+	// instead of Certificate, for consumers that need intermediate certificates
+	// to validate the signing certificate. It must start with the certificate of
+	// the key passed to Sign, followed by the certificates that issued it, in
+	// order.
+	//
+	// Each certificate becomes a ds:X509Certificate in a single ds:X509Data. A
+	// CertificateChain of one certificate is the same as setting Certificate.
+	CertificateChain []*x509.Certificate
+
+	// ReferenceID, if non-empty, makes the signature's Reference refer to the
+	// element with this ID, with a URI like "#foo", instead of to the whole
+	// document. Only that element is digested, without the signature if the
+	// signature is inside of it. Sign returns ErrReferenceNotFound if no element
+	// has the ID, and ErrDuplicateID if more than one does.
+	//
+	// ReferenceID is ignored if References is non-empty.
+	ReferenceID string
+
+	// IDAttribute, if non-zero, is the only attribute that Sign looks in for the
+	// ID that a Reference refers to, such as ID for SAML, or wsu:Id, with the
+	// WS-Security utility namespace URI as its Space, for WS-Security. If zero,
+	// the ID, Id, id, and wsu:Id attributes are all looked in, as Verify does.
+	IDAttribute xml.Name
+
+	// InsertAfter, if non-zero, makes SignDocument insert the ds:Signature
+	// right after the first child of the signed element with this name, rather
+	// than as its last child. SAML, for instance, requires the ds:Signature of
+	// an assertion or protocol message to come right after its saml:Issuer, so
+	// use xml.Name{Space: "urn:oasis:names:tc:SAML:2.0:assertion", Local:
+	// "Issuer"} there. Space is a namespace URI, not a prefix. If the element
+	// has no such child, SignDocument returns ErrInsertionPointNotFound.
+	//
+	// InsertAfter is only used by SignDocument.
+	InsertAfter xml.Name
+
+	// References, if non-empty, are the References of the signature, in order.
+	// Each is digested separately, and all of them are covered by the signature.
+	// If empty, the signature has a single Reference to the whole document.
+	References []ReferenceOptions
+
+	// Prefix is the namespace prefix used for the elements of the signature when
+	// it's marshaled, such as "ds". If empty, the XML-DSig namespace is made the
+	// default namespace instead. See Signature.MarshalXML.
+	//
+	// If Prefix isn't a valid prefix, NewSignature returns ErrInvalidPrefix.
+	Prefix string
+
+	// InclusivePrefixes, if non-empty, is the InclusiveNamespaces PrefixList
+	// that ds:SignedInfo and the data of each Reference are canonicalized with,
+	// such as []string{"xs", "xsi", "saml"} for a SAML document with xsi:type
+	// attributes. "#default" stands for the default namespace. It's written into
+	// the CanonicalizationMethod and into each Exclusive Canonical XML
+	// Transform.
+	//
+	// If a prefix isn't "#default" or a valid prefix, NewSignature returns
+	// ErrInvalidPrefix.
+	InclusivePrefixes []string
+
+	// Base64LineLength, if positive, is the length that the base64 text of the
+	// SignatureValue, DigestValues, and X509Certificates of the signature is
+	// wrapped at, such as 76 to match openssl. If zero, each is written on a
+	// single line.
+	Base64LineLength int
+}
+
+// ReferenceOptions describes one of the References of a signature that
+// NewSignature creates.
+type ReferenceOptions struct {
+	// URI is the URI of the Reference, such as "#foo" to sign the element whose
+	// ID is "foo", or the empty string to sign the whole document.
+	URI string
+
+	// Type is the Type of the Reference, such as ReferenceTypeSignatureValue. It
+	// only describes the referenced data, and doesn't change how it's digested.
+	Type string
+
+	// DigestAlgorithm is the URI of the algorithm used to digest the referenced
+	// data. If empty, SignOptions.DigestAlgorithm is used.
+	DigestAlgorithm string
+
+	// Transforms are the URIs of the transforms of the Reference, in order. If
+	// empty, the enveloped signature transform followed by
+	// SignOptions.CanonicalizationAlgorithm is used, as it is for the default
+	// Reference.
+	Transforms []string
+}
+
+// NewSignature returns an unsigned Signature, ready to be put into a document
+// and signed with Sign.
+//
+// The signature is an enveloped signature of the whole document, with an
+// empty Reference URI, canonicalized with Exclusive Canonical XML, unless
+// opts.References or opts.CanonicalizationAlgorithm says otherwise. Its digest
+// and signature algorithms are chosen by opts. If a digest algorithm isn't
+// supported, NewSignature returns ErrBadDigestAlgorithm, and if
+// opts.SignatureAlgorithm isn't supported, it returns ErrBadSignatureAlgorithm.
+//
+// Because xml.Marshal produces the same output for the same struct, the
+// simplest way to use NewSignature is to embed the Signature in a struct,
+// marshal the struct once to sign it, and marshal it again to produce the
+// signed document:
+//
+//  sig, err := dsig.NewSignature(dsig.SignOptions{})
+//  foo := Foo{Bar: "baz", Signature: *sig}
+//
+//  unsigned, err := xml.Marshal(foo)
+//  err = foo.Signature.Sign(key, xml.NewDecoder(bytes.NewReader(unsigned)))
+//
+//  signed, err := xml.Marshal(foo)
+func NewSignature(opts SignOptions) (*Signature, error) {
+	digestAlgorithm := opts.DigestAlgorithm
+	if digestAlgorithm == "" {
+		digestAlgorithm = DigestMethodAlgorithmSHA256
+	}
+
+	canonicalizationMethod := CanonicalizationMethod{Algorithm: opts.CanonicalizationAlgorithm}
+	switch canonicalizationMethod.Algorithm {
+	case "":
+		canonicalizationMethod.Algorithm = CanonicalizationMethodAlgorithmExclusive
+	case CanonicalizationMethodAlgorithmExclusive, CanonicalizationMethodAlgorithmExclusiveWithComments,
+		CanonicalizationMethodAlgorithmInclusive, CanonicalizationMethodAlgorithmInclusiveWithComments:
+	default:
+		return nil, ErrBadCanonicalizationAlgorithm
+	}
+
+	specs := opts.References
+	if len(specs) == 0 {
+		specs = []ReferenceOptions{{}}
+		if opts.ReferenceID != "" {
+			specs[0].URI = "#" + opts.ReferenceID
+		}
+	}
+
+	var references []Reference
+	for _, spec := range specs {
+		digestMethod := DigestMethod{Algorithm: spec.DigestAlgorithm}
+		if digestMethod.Algorithm == "" {
+			digestMethod.Algorithm = digestAlgorithm
+		}
+
+		if _, err := digestMethod.hash(); err != nil {
+			return nil, err
+		}
+
+		transforms := []Transform{
+			{Algorithm: TransformAlgorithmEnveloped},
+			{Algorithm: canonicalizationMethod.Algorithm},
+		}
+
+		if len(spec.Transforms) > 0 {
+			transforms = nil
+			for _, algorithm := range spec.Transforms {
+				transforms = append(transforms, Transform{Algorithm: algorithm})
+			}
+		}
+
+		references = append(references, Reference{
+			URI:          spec.URI,
+			Type:         spec.Type,
+			Transforms:   transforms,
+			DigestMethod: digestMethod,
+		})
+	}
+
+	signatureMethod := SignatureMethod{Algorithm: opts.SignatureAlgorithm}
+	if signatureMethod.Algorithm == "" {
+		signatureMethod.Algorithm = SignatureMethodAlgorithmSHA256
+	}
+
+	if _, err := signatureMethod.hash(); err != nil {
+		return nil, err
+	}
+
+	if opts.Prefix != "" && !validPrefix(opts.Prefix) {
+		return nil, ErrInvalidPrefix
+	}
+
+	inclusive, err := newInclusiveNamespaces(opts.InclusivePrefixes)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range references {
+		for j := range references[i].Transforms {
+			switch references[i].Transforms[j].Algorithm {
+			case CanonicalizationMethodAlgorithmExclusive, CanonicalizationMethodAlgorithmExclusiveWithComments:
+				references[i].Transforms[j].InclusiveNamespaces = inclusive
+			}
+		}
+	}
+
+	// InclusiveNamespaces is a parameter of Exclusive Canonical XML only.
+	switch canonicalizationMethod.Algorithm {
+	case CanonicalizationMethodAlgorithmExclusive, CanonicalizationMethodAlgorithmExclusiveWithComments:
+		canonicalizationMethod.InclusiveNamespaces = inclusive
+	}
+
+	chain := opts.CertificateChain
+	if len(chain) == 0 && opts.Certificate != nil {
+		chain = []*x509.Certificate{opts.Certificate}
+	}
+
+	var keyInfo *KeyInfo
+	if len(chain) > 0 {
+		var data X509Data
+		for _, cert := range chain {
+			data.X509Certificates = append(data.X509Certificates, wrapBase64(base64.StdEncoding.EncodeToString(cert.Raw), opts.Base64LineLength))
+		}
+
+		keyInfo = &KeyInfo{X509Data: []X509Data{data}}
+	}
+
+	return &Signature{
+		SignedInfo: SignedInfo{
+			CanonicalizationMethod: canonicalizationMethod,
+			SignatureMethod:        signatureMethod,
+			References:             references,
+		},
+		KeyInfo:          keyInfo,
+		Prefix:           opts.Prefix,
+		IDAttribute:      opts.IDAttribute,
+		Base64LineLength: opts.Base64LineLength,
+	}, nil
+}
+
+// Sign uses key to compute the DigestValue and SignatureValue of s for the
+// token sequence r, and stores them in s.
+//
+// r must be the document as it will be sent, with s already in place as a
+// ds:Signature element. The algorithms, Reference URI, and transforms are taken
+// from s, and the ds:SignedInfo in r must agree with them; otherwise, Sign
+// returns a *SignedInfoMismatchError. The ds:DigestValue and
+// ds:SignatureValue in r are placeholders: their content is ignored, and may
+// be empty.
+//
+// Sign does not modify the document. Once Sign returns, write
+// s.SignedInfo.Reference().DigestValue and s.SignatureValue.Value into the
+// placeholders, changing nothing else, and the result will verify with Verify.
+// For example:
+//
+//  format := `<Foo><Bar>baz</Bar><ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#">...<ds:DigestValue>%s</ds:DigestValue>...<ds:SignatureValue>%s</ds:SignatureValue></ds:Signature></Foo>`
+//
+//  var foo Foo
+//  xml.Unmarshal([]byte(format), &foo)
+//  foo.Signature.Sign(key, xml.NewDecoder(strings.NewReader(format)))
+//
+//  signed := fmt.Sprintf(format, foo.Signature.SignedInfo.Reference().DigestValue, foo.Signature.SignatureValue.Value)
+//
+// Sign supports the same algorithms, references, and transforms as Verify, and
+// returns the same errors as Verify for those it doesn't support. The digest
+// and signature are encoded with standard, padded base64.
+//
+// Sign is equivalent to SignWithSigner with key as the signer.
+func (s *Signature) Sign(key *rsa.PrivateKey, r c14n.RawTokenReader) error {
+	return s.SignWithSigner(key, r)
+}
+
+// SignWithSigner is like Sign, but creates the signature with signer, which
+// lets the private key be kept in a hardware security module or a cloud key
+// management service.
+//
+// The canonicalized ds:SignedInfo is hashed locally, and only the hash is
+// passed to signer, along with the hash function as its crypto.SignerOpts.
+// signer must produce an RSA PKCS #1 v1.5 signature, as *rsa.PrivateKey does;
+// if its public key is not an RSA key, SignWithSigner returns
+// ErrPublicKeyNotRSA.
+func (s *Signature) SignWithSigner(signer crypto.Signer, r c14n.RawTokenReader) error {
+	digestHashes, signatureHash, ids, err := s.signingParams(signer)
+	if err != nil {
+		return err
+	}
+
+	// The document is split once per Reference to compute its digest, and again
+	// to compute the ds:SignedInfo with those digests in it.
+	var tokens []xml.Token
+	for {
+		t, err := r.RawToken()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+
+			return err
+		}
+
+		tokens = append(tokens, xml.CopyToken(t))
+	}
+
+	var digestValues []string
+	for i := range s.SignedInfo.References {
+		ref := &s.SignedInfo.References[i]
+
+		replay := recorderReplay(tokens)
+		split, err := sigsplit.SplitOuter(ref.applyCustomTransforms(&replay), sigsplit.Options{
+			Outer:        ref.canonOptions(),
+			ID:                  ids[i],
+			IDAttribute:         s.IDAttribute,
+			ReferenceURI:        ref.URI,
+			MatchSignatureValue: s.matchSignatureValue(),
+		})
+		if err != nil {
+			return splitError(err)
+		}
+
+		h := digestHashes[i].New()
+		h.Write(split.Outer)
+		digestValues = append(digestValues, wrapBase64(base64.StdEncoding.EncodeToString(h.Sum(nil)), s.Base64LineLength))
+	}
+
+	return s.signDigests(signer, tokens, ids[0], signatureHash, digestValues)
+}
+
+// signingParams checks that s can be signed with signer, and returns the hash
+// functions of the digests of its References, the hash function of its
+// SignatureMethod, and the IDs that its References refer to.
+func (s *Signature) signingParams(signer crypto.Signer) ([]crypto.Hash, crypto.Hash, []string, error) {
+	if _, ok := signer.Public().(*rsa.PublicKey); !ok {
+		return nil, 0, nil, ErrPublicKeyNotRSA
+	}
+
+	// A signature without a Reference has no digest algorithm.
+	if len(s.SignedInfo.References) == 0 {
+		return nil, 0, nil, ErrBadDigestAlgorithm
+	}
+
+	var digestHashes []crypto.Hash
+	for _, ref := range s.SignedInfo.References {
+		digestHash, err := ref.DigestMethod.hash()
+		if err != nil {
+			return nil, 0, nil, err
+		}
+
+		digestHashes = append(digestHashes, digestHash)
+	}
+
+	signatureHash, err := s.SignedInfo.SignatureMethod.hash()
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	var ids []string
+	for _, ref := range s.SignedInfo.References {
+		for _, t := range ref.Transforms {
+			if err := t.check(); err != nil {
+				return nil, 0, nil, err
+			}
+		}
+
+		id, err := ref.id()
+		if err != nil {
+			return nil, 0, nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return digestHashes, signatureHash, ids, nil
+}
+
+// signDigests computes the SignatureValue of s, given the digestValues of its
+// References, with signer, and stores them all in s. tokens are the tokens of
+// a document with s in it, from which ds:SignedInfo is canonicalized; id is
+// the ID that the first Reference refers to.
+func (s *Signature) signDigests(signer crypto.Signer, tokens []xml.Token, id string, signatureHash crypto.Hash, digestValues []string) error {
+	// The ds:Signature being signed is found by the URI of its first Reference,
+	// and its SignatureValue, as it is by Verify. It hasn't been signed yet, so
+	// that tells it apart from any other signature with the same URI.
+	replay := recorderReplay(tokens)
+	_, toSign, err := sigsplit.SplitSignature(s.SignedInfo.References[0].applyCustomTransforms(&replay), sigsplit.Options{
+		Inner:               s.SignedInfo.CanonicalizationMethod.options(),
+		ID:                  id,
+		IDAttribute:         s.IDAttribute,
+		ReferenceURI:        s.SignedInfo.References[0].URI,
+		DigestValues:        digestValues,
+		MatchSignatureValue: s.matchSignatureValue(),
+	})
+	if err != nil {
+		return splitError(err)
+	}
+
+	signedInfo := s.SignedInfo
+	signedInfo.References = append([]Reference(nil), s.SignedInfo.References...)
+	for i := range signedInfo.References {
+		signedInfo.References[i].DigestValue = digestValues[i]
+	}
+
+	if err := checkSignedInfo(&signedInfo, toSign); err != nil {
+		return err
+	}
+
+	h := signatureHash.New()
+	h.Write(toSign)
+	signature, err := signer.Sign(rand.Reader, h.Sum(nil), signatureHash)
+	if err != nil {
+		return err
+	}
+
+	for i := range s.SignedInfo.References {
+		s.SignedInfo.References[i].DigestValue = digestValues[i]
+	}
+
+	s.SignatureValue.Value = wrapBase64(base64.StdEncoding.EncodeToString(signature), s.Base64LineLength)
+	return nil
+}
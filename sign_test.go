@@ -0,0 +1,544 @@
+package dsig_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/dsig"
+)
+
+func TestSignature_Sign(t *testing.T) {
+	sha1Format := strings.NewReplacer(
+		dsig.SignatureMethodAlgorithmSHA256, dsig.SignatureMethodAlgorithmSHA1,
+		dsig.DigestMethodAlgorithmSHA256, dsig.DigestMethodAlgorithmSHA1,
+	).Replace(testSignatureFormat)
+
+	// The signature's ds prefix is declared on the root, not on the signature.
+	undeclaredFormat := strings.Replace(testSignatureFormat, ` xmlns:ds="http://www.w3.org/2000/09/xmldsig#"`, "", 1)
+
+	type testCase struct {
+		Format string
+		Opts   dsig.VerifyOptions
+	}
+
+	testCases := map[string]testCase{
+		"sha256": testCase{
+			Format: `<root><foo>xxx</foo>` + testSignatureFormat + `</root>`,
+		},
+		"sha1": testCase{
+			Format: `<root><foo>xxx</foo>` + sha1Format + `</root>`,
+		},
+		"prefixes declared on ancestors": testCase{
+			Format: `<a:root xmlns:a="http://example.com/a" xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><a:foo><a:bar>xxx</a:bar></a:foo>` + undeclaredFormat + `</a:root>`,
+		},
+		"id reference": testCase{
+			Format: `<root><foo ID="bareId">xxx</foo><bar>yyy</bar>` + signatureWithURI("#bareId") + `</root>`,
+			Opts:   dsig.VerifyOptions{AllowArbitraryReferences: true},
+		},
+		"comments": testCase{
+			Format: `<root><!-- comment --><foo>xxx</foo>` + testSignatureFormat + `</root>`,
+		},
+	}
+
+	for name, tt := range testCases {
+		for _, placeholder := range []string{"", "placeholder", "<!-- placeholder -->"} {
+			t.Run(fmt.Sprintf("%s/%q", name, placeholder), func(t *testing.T) {
+				unsigned := fmt.Sprintf(tt.Format, placeholder, placeholder)
+
+				var payload struct {
+					Signature dsig.Signature `xml:"http://www.w3.org/2000/09/xmldsig# Signature"`
+				}
+
+				assert.NoError(t, xml.Unmarshal([]byte(unsigned), &payload))
+				assert.NoError(t, payload.Signature.Sign(testKey, xml.NewDecoder(strings.NewReader(unsigned))))
+
+				doc := fmt.Sprintf(tt.Format, payload.Signature.SignedInfo.Reference().DigestValue, payload.Signature.SignatureValue.Value)
+				assert.NoError(t, verifyTestDocumentWithOptions(t, doc, tt.Opts))
+
+				assert.Equal(t, dsig.ErrBadDigest, verifyTestDocumentWithOptions(t, strings.Replace(doc, "xxx", "zzz", 1), tt.Opts))
+			})
+		}
+	}
+}
+
+func TestSignature_SignAfterExistingSignature(t *testing.T) {
+	// An existing enveloped signature over the same URI comes first. It's the
+	// placeholder SignatureValue that tells the new one apart from it.
+	existing := signTestDocument(t, `<root><foo>xxx</foo>`+testSignatureFormat+`</root>`, base64.StdEncoding)
+	existing = existing[len(`<root><foo>xxx</foo>`) : len(existing)-len(`</root>`)]
+	format := `<root><foo>xxx</foo>` + existing + testSignatureFormat + `</root>`
+
+	var sig dsig.Signature
+	assert.NoError(t, xml.Unmarshal([]byte(fmt.Sprintf(testSignatureFormat, "", "")), &sig))
+	assert.NoError(t, sig.Sign(testKey, xml.NewDecoder(strings.NewReader(fmt.Sprintf(format, "", "")))))
+
+	doc := fmt.Sprintf(format, sig.SignedInfo.Reference().DigestValue, sig.SignatureValue.Value)
+	assert.NoError(t, sig.Verify(testCert, xml.NewDecoder(strings.NewReader(doc))))
+}
+
+func TestSignature_SignErrors(t *testing.T) {
+	type testCase struct {
+		Format string
+		Err    error
+	}
+
+	testCases := map[string]testCase{
+		"unsupported digest algorithm": testCase{
+			Format: `<root>` + strings.Replace(testSignatureFormat, dsig.DigestMethodAlgorithmSHA256, "http://example.com/md5", 1) + `</root>`,
+			Err:    dsig.ErrBadDigestAlgorithm,
+		},
+		"unsupported signature algorithm": testCase{
+			Format: `<root>` + strings.Replace(testSignatureFormat, dsig.SignatureMethodAlgorithmSHA256, "http://example.com/rsa-md5", 1) + `</root>`,
+			Err:    dsig.ErrBadSignatureAlgorithm,
+		},
+		"reference not found": testCase{
+			Format: `<root>` + signatureWithURI("#bareId") + `</root>`,
+			Err:    dsig.ErrReferenceNotFound,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			unsigned := fmt.Sprintf(tt.Format, "", "")
+
+			var payload struct {
+				Signature dsig.Signature `xml:"http://www.w3.org/2000/09/xmldsig# Signature"`
+			}
+
+			assert.NoError(t, xml.Unmarshal([]byte(unsigned), &payload))
+			assert.Equal(t, tt.Err, payload.Signature.Sign(testKey, xml.NewDecoder(strings.NewReader(unsigned))))
+		})
+	}
+}
+
+func TestSignature_SignMismatch(t *testing.T) {
+	unsigned := fmt.Sprintf(`<root><foo>xxx</foo>`+testSignatureFormat+`</root>`, "", "")
+
+	var payload struct {
+		Signature dsig.Signature `xml:"http://www.w3.org/2000/09/xmldsig# Signature"`
+	}
+
+	assert.NoError(t, xml.Unmarshal([]byte(unsigned), &payload))
+
+	// The struct says SHA1, but the document says SHA256.
+	payload.Signature.SignedInfo.Reference().DigestMethod.Algorithm = dsig.DigestMethodAlgorithmSHA1
+	err := payload.Signature.Sign(testKey, xml.NewDecoder(strings.NewReader(unsigned)))
+	assert.Equal(t, &dsig.SignedInfoMismatchError{
+		Field:  "DigestMethod",
+		Struct: dsig.DigestMethodAlgorithmSHA1,
+		Signed: dsig.DigestMethodAlgorithmSHA256,
+	}, err)
+}
+
+// recordingSigner is a crypto.Signer that records the digests it's asked to
+// sign.
+type recordingSigner struct {
+	key     *rsa.PrivateKey
+	digests [][]byte
+	opts    []crypto.SignerOpts
+}
+
+func (s *recordingSigner) Public() crypto.PublicKey {
+	return s.key.Public()
+}
+
+func (s *recordingSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	s.digests = append(s.digests, digest)
+	s.opts = append(s.opts, opts)
+	return s.key.Sign(rand, digest, opts)
+}
+
+func TestSignature_SignWithSigner(t *testing.T) {
+	format := `<root><foo>xxx</foo>` + testSignatureFormat + `</root>`
+	unsigned := fmt.Sprintf(format, "", "")
+
+	var payload struct {
+		Signature dsig.Signature `xml:"http://www.w3.org/2000/09/xmldsig# Signature"`
+	}
+
+	assert.NoError(t, xml.Unmarshal([]byte(unsigned), &payload))
+
+	signer := &recordingSigner{key: testKey}
+	assert.NoError(t, payload.Signature.SignWithSigner(signer, xml.NewDecoder(strings.NewReader(unsigned))))
+
+	doc := fmt.Sprintf(format, payload.Signature.SignedInfo.Reference().DigestValue, payload.Signature.SignatureValue.Value)
+
+	var signed struct {
+		Signature dsig.Signature `xml:"http://www.w3.org/2000/09/xmldsig# Signature"`
+	}
+
+	assert.NoError(t, xml.Unmarshal([]byte(doc), &signed))
+	result, err := signed.Signature.VerifyWithResult(testCert, xml.NewDecoder(strings.NewReader(doc)), dsig.VerifyOptions{})
+	assert.NoError(t, err)
+
+	// The signer is only given the hash of the canonical ds:SignedInfo.
+	hashed := sha256.Sum256(result.SignedInfo)
+	assert.Equal(t, [][]byte{hashed[:]}, signer.digests)
+	assert.Equal(t, []crypto.SignerOpts{crypto.SHA256}, signer.opts)
+}
+
+func TestSignature_SignWithSigner_NotRSA(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	var s dsig.Signature
+	assert.Equal(t, dsig.ErrPublicKeyNotRSA, s.SignWithSigner(key, xml.NewDecoder(strings.NewReader(`<root></root>`))))
+}
+
+func TestNewSignature(t *testing.T) {
+	type foo struct {
+		XMLName   xml.Name `xml:"foo"`
+		Bar       string   `xml:"bar"`
+		Signature dsig.Signature
+	}
+
+	type testCase struct {
+		Options            dsig.SignOptions
+		DigestAlgorithm    string
+		SignatureAlgorithm string
+	}
+
+	testCases := map[string]testCase{
+		"default": testCase{
+			Options:            dsig.SignOptions{},
+			DigestAlgorithm:    dsig.DigestMethodAlgorithmSHA256,
+			SignatureAlgorithm: dsig.SignatureMethodAlgorithmSHA256,
+		},
+		"sha256": testCase{
+			Options:            dsig.SignOptions{DigestAlgorithm: dsig.DigestMethodAlgorithmSHA256, SignatureAlgorithm: dsig.SignatureMethodAlgorithmSHA256},
+			DigestAlgorithm:    dsig.DigestMethodAlgorithmSHA256,
+			SignatureAlgorithm: dsig.SignatureMethodAlgorithmSHA256,
+		},
+		"sha1": testCase{
+			Options:            dsig.SignOptions{DigestAlgorithm: dsig.DigestMethodAlgorithmSHA1, SignatureAlgorithm: dsig.SignatureMethodAlgorithmSHA1},
+			DigestAlgorithm:    dsig.DigestMethodAlgorithmSHA1,
+			SignatureAlgorithm: dsig.SignatureMethodAlgorithmSHA1,
+		},
+		"sha1 digest with rsa-sha256": testCase{
+			Options:            dsig.SignOptions{DigestAlgorithm: dsig.DigestMethodAlgorithmSHA1},
+			DigestAlgorithm:    dsig.DigestMethodAlgorithmSHA1,
+			SignatureAlgorithm: dsig.SignatureMethodAlgorithmSHA256,
+		},
+		"sha256 digest with rsa-sha1": testCase{
+			Options:            dsig.SignOptions{SignatureAlgorithm: dsig.SignatureMethodAlgorithmSHA1},
+			DigestAlgorithm:    dsig.DigestMethodAlgorithmSHA256,
+			SignatureAlgorithm: dsig.SignatureMethodAlgorithmSHA1,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			sig, err := dsig.NewSignature(tt.Options)
+			assert.NoError(t, err)
+
+			v := foo{Bar: "baz", Signature: *sig}
+			unsigned, err := xml.Marshal(v)
+			assert.NoError(t, err)
+			assert.NoError(t, v.Signature.Sign(testKey, xml.NewDecoder(strings.NewReader(string(unsigned)))))
+
+			signed, err := xml.Marshal(v)
+			assert.NoError(t, err)
+			assert.Contains(t, string(signed), `<DigestMethod xmlns="http://www.w3.org/2000/09/xmldsig#" Algorithm="`+tt.DigestAlgorithm+`">`)
+			assert.Contains(t, string(signed), `<SignatureMethod xmlns="http://www.w3.org/2000/09/xmldsig#" Algorithm="`+tt.SignatureAlgorithm+`">`)
+
+			result, err := v.Signature.VerifyWithResult(testCert, xml.NewDecoder(strings.NewReader(string(signed))), dsig.VerifyOptions{})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.DigestAlgorithm, result.DigestMethod)
+			assert.Equal(t, tt.SignatureAlgorithm, result.SignatureMethod)
+
+			assert.Equal(t, dsig.ErrBadDigest, verifyTestDocument(t, strings.Replace(string(signed), "baz", "qux", 1)))
+		})
+	}
+
+	_, err := dsig.NewSignature(dsig.SignOptions{DigestAlgorithm: "http://example.com/md5"})
+	assert.Equal(t, dsig.ErrBadDigestAlgorithm, err)
+
+	_, err = dsig.NewSignature(dsig.SignOptions{SignatureAlgorithm: "http://example.com/rsa-md5"})
+	assert.Equal(t, dsig.ErrBadSignatureAlgorithm, err)
+}
+
+func TestNewSignature_Certificate(t *testing.T) {
+	type foo struct {
+		XMLName   xml.Name `xml:"foo"`
+		Bar       string   `xml:"bar"`
+		Signature dsig.Signature
+	}
+
+	sig, err := dsig.NewSignature(dsig.SignOptions{Certificate: testCert})
+	assert.NoError(t, err)
+
+	v := foo{Bar: "baz", Signature: *sig}
+	unsigned, err := xml.Marshal(v)
+	assert.NoError(t, err)
+	assert.NoError(t, v.Signature.Sign(testKey, xml.NewDecoder(strings.NewReader(string(unsigned)))))
+
+	signed, err := xml.Marshal(v)
+	assert.NoError(t, err)
+
+	// KeyInfo comes after SignatureValue, and holds the certificate.
+	keyInfo := `<KeyInfo xmlns="http://www.w3.org/2000/09/xmldsig#"><X509Data xmlns="http://www.w3.org/2000/09/xmldsig#"><X509Certificate xmlns="http://www.w3.org/2000/09/xmldsig#">` + base64.StdEncoding.EncodeToString(testCert.Raw) + `</X509Certificate></X509Data></KeyInfo>`
+	assert.Contains(t, string(signed), `</SignatureValue>`+keyInfo+`</Signature>`)
+
+	assert.NoError(t, verifyTestDocument(t, string(signed)))
+
+	// The certificate isn't covered by the signature.
+	assert.NoError(t, verifyTestDocument(t, strings.Replace(string(signed), keyInfo, "", 1)))
+
+	// The embedded certificate can be used to verify the signature, if it's
+	// trusted.
+	var ts dsig.TrustStore
+	ts.AddCertificate(testCert)
+
+	results, err := dsig.VerifyAll(signed, &ts, dsig.VerifyOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, results, 1)
+	assert.NoError(t, results[0].Err)
+	assert.Equal(t, testCert, results[0].Certificate)
+}
+
+func TestNewSignature_CertificateChain(t *testing.T) {
+	type foo struct {
+		XMLName   xml.Name `xml:"foo"`
+		Bar       string   `xml:"bar"`
+		Signature dsig.Signature
+	}
+
+	_, intermediate := generateTestCert()
+
+	sign := func(opts dsig.SignOptions) []byte {
+		sig, err := dsig.NewSignature(opts)
+		assert.NoError(t, err)
+
+		v := foo{Bar: "baz", Signature: *sig}
+		unsigned, err := xml.Marshal(v)
+		assert.NoError(t, err)
+		assert.NoError(t, v.Signature.Sign(testKey, xml.NewDecoder(strings.NewReader(string(unsigned)))))
+
+		signed, err := xml.Marshal(v)
+		assert.NoError(t, err)
+		return signed
+	}
+
+	signed := sign(dsig.SignOptions{CertificateChain: []*x509.Certificate{testCert, intermediate}})
+
+	var v foo
+	assert.NoError(t, xml.Unmarshal(signed, &v))
+	assert.Len(t, v.Signature.KeyInfo.X509Data, 1)
+	assert.Equal(t, []string{
+		base64.StdEncoding.EncodeToString(testCert.Raw),
+		base64.StdEncoding.EncodeToString(intermediate.Raw),
+	}, v.Signature.KeyInfo.X509Data[0].X509Certificates)
+
+	assert.NoError(t, verifyTestDocument(t, string(signed)))
+
+	// The intermediate is in KeyInfo, but only the leaf's key made the
+	// signature.
+	var ts dsig.TrustStore
+	ts.AddCertificate(intermediate)
+	ts.AddCertificate(testCert)
+
+	results, err := dsig.VerifyAll(signed, &ts, dsig.VerifyOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, results, 1)
+	assert.NoError(t, results[0].Err)
+	assert.Equal(t, testCert, results[0].Certificate)
+
+	// A chain of one is the same as a single certificate.
+	one := sign(dsig.SignOptions{CertificateChain: []*x509.Certificate{testCert}})
+	single := sign(dsig.SignOptions{Certificate: testCert})
+	assert.Equal(t, string(single), string(one))
+}
+
+func TestNewSignature_References(t *testing.T) {
+	type part struct {
+		ID    string `xml:"ID,attr"`
+		Value string `xml:",chardata"`
+	}
+
+	type envelope struct {
+		XMLName   xml.Name `xml:"Envelope"`
+		Timestamp part     `xml:"Timestamp"`
+		Assertion part     `xml:"Assertion"`
+		Body      part     `xml:"Body"`
+		Signature dsig.Signature
+	}
+
+	sig, err := dsig.NewSignature(dsig.SignOptions{
+		References: []dsig.ReferenceOptions{
+			{URI: "#body", Transforms: []string{dsig.CanonicalizationMethodAlgorithmExclusive}},
+			{URI: "#ts", DigestAlgorithm: dsig.DigestMethodAlgorithmSHA1},
+			{URI: "#assertion"},
+		},
+	})
+	assert.NoError(t, err)
+
+	v := envelope{
+		Timestamp: part{ID: "ts", Value: "2020-01-01T00:00:00Z"},
+		Assertion: part{ID: "assertion", Value: "alice"},
+		Body:      part{ID: "body", Value: "xxx"},
+		Signature: *sig,
+	}
+
+	unsigned, err := xml.Marshal(v)
+	assert.NoError(t, err)
+	assert.NoError(t, v.Signature.Sign(testKey, xml.NewDecoder(strings.NewReader(string(unsigned)))))
+
+	signed, err := xml.Marshal(v)
+	assert.NoError(t, err)
+
+	var decoded envelope
+	assert.NoError(t, xml.Unmarshal(signed, &decoded))
+	assert.Len(t, decoded.Signature.SignedInfo.References, 3)
+
+	for i, want := range []struct {
+		URI             string
+		DigestAlgorithm string
+		Transforms      int
+	}{
+		{URI: "#body", DigestAlgorithm: dsig.DigestMethodAlgorithmSHA256, Transforms: 1},
+		{URI: "#ts", DigestAlgorithm: dsig.DigestMethodAlgorithmSHA1, Transforms: 2},
+		{URI: "#assertion", DigestAlgorithm: dsig.DigestMethodAlgorithmSHA256, Transforms: 2},
+	} {
+		ref := decoded.Signature.SignedInfo.References[i]
+		assert.Equal(t, want.URI, ref.URI)
+		assert.Equal(t, want.DigestAlgorithm, ref.DigestMethod.Algorithm)
+		assert.Len(t, ref.Transforms, want.Transforms)
+		assert.Equal(t, v.Signature.SignedInfo.References[i].DigestValue, ref.DigestValue)
+	}
+
+	// None of the referenced elements contain the signature.
+	opts := dsig.VerifyOptions{AllowArbitraryReferences: true}
+	assert.Equal(t, dsig.ErrReferenceNotEnveloping, decoded.Signature.Verify(testCert, xml.NewDecoder(strings.NewReader(string(signed)))))
+	assert.NoError(t, decoded.Signature.VerifyWithOptions(testCert, xml.NewDecoder(strings.NewReader(string(signed))), opts))
+
+	// Each of the referenced elements is covered by its own digest.
+	for _, tampered := range []string{
+		strings.Replace(string(signed), "xxx", "yyy", 1),
+		strings.Replace(string(signed), "2020", "2030", 1),
+		strings.Replace(string(signed), "alice", "mallory", 1),
+	} {
+		assert.Equal(t, dsig.ErrBadDigest, decoded.Signature.VerifyWithOptions(testCert, xml.NewDecoder(strings.NewReader(tampered)), opts))
+	}
+}
+
+func TestNewSignature_IDs(t *testing.T) {
+	type foo struct {
+		XMLName   xml.Name `xml:"foo"`
+		Bar       string   `xml:"bar"`
+		Signature dsig.Signature
+	}
+
+	sig, err := dsig.NewSignature(dsig.SignOptions{})
+	assert.NoError(t, err)
+
+	sig.ID = "signature"
+	sig.SignedInfo.ID = "signed-info"
+	sig.SignedInfo.References[0].ID = "reference"
+	sig.SignatureValue.ID = "signature-value"
+
+	v := foo{Bar: "baz", Signature: *sig}
+	unsigned, err := xml.Marshal(v)
+	assert.NoError(t, err)
+	assert.NoError(t, v.Signature.Sign(testKey, xml.NewDecoder(strings.NewReader(string(unsigned)))))
+
+	signed, err := xml.Marshal(v)
+	assert.NoError(t, err)
+	assert.Contains(t, string(signed), `<Signature xmlns="http://www.w3.org/2000/09/xmldsig#" Id="signature">`)
+	assert.Contains(t, string(signed), `<SignedInfo xmlns="http://www.w3.org/2000/09/xmldsig#" Id="signed-info">`)
+	assert.Contains(t, string(signed), `<Reference xmlns="http://www.w3.org/2000/09/xmldsig#" Id="reference">`)
+	assert.Contains(t, string(signed), `<SignatureValue Id="signature-value">`)
+
+	var decoded foo
+	assert.NoError(t, xml.Unmarshal(signed, &decoded))
+	assert.Equal(t, "signature", decoded.Signature.ID)
+	assert.Equal(t, "signed-info", decoded.Signature.SignedInfo.ID)
+	assert.Equal(t, "reference", decoded.Signature.SignedInfo.Reference().ID)
+	assert.Equal(t, "signature-value", decoded.Signature.SignatureValue.ID)
+	assert.Equal(t, v.Signature.SignatureValue.Value, decoded.Signature.SignatureValue.Value)
+
+	assert.NoError(t, verifyTestDocument(t, string(signed)))
+
+	// The Ids inside of ds:SignedInfo are covered by the signature; the others
+	// aren't.
+	assert.Equal(t, rsa.ErrVerification, verifyTestDocument(t, strings.Replace(string(signed), `Id="signed-info"`, `Id="other"`, 1)))
+	assert.Equal(t, rsa.ErrVerification, verifyTestDocument(t, strings.Replace(string(signed), `Id="reference"`, `Id="other"`, 1)))
+	assert.NoError(t, verifyTestDocument(t, strings.Replace(string(signed), `Id="signature-value"`, `Id="other"`, 1)))
+}
+
+func TestNewSignature_CanonicalizationAlgorithm(t *testing.T) {
+	doc := `<root xmlns:a="urn:a" xmlns:b="urn:b" xml:lang="en"><foo a:x="1">xxx</foo><bar ID="bar">yyy</bar></root>`
+
+	type testCase struct {
+		Algorithm   string
+		ReferenceID string
+		SignedData  string
+		SignedInfo  string
+	}
+
+	// The expected SignedData for the whole document is the output of
+	// xmllint --c14n and xmllint --exc-c14n. For a document subset, Canonical
+	// XML 1.0 also renders the namespaces and xml:* attributes inherited from
+	// outside of the subset.
+	testCases := map[string]testCase{
+		"exclusive": testCase{
+			Algorithm:  "",
+			SignedData: `<root xml:lang="en"><foo xmlns:a="urn:a" a:x="1">xxx</foo><bar ID="bar">yyy</bar></root>`,
+			SignedInfo: `<ds:SignedInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:CanonicalizationMethod Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#">`,
+		},
+		"inclusive": testCase{
+			Algorithm:  dsig.CanonicalizationMethodAlgorithmInclusive,
+			SignedData: `<root xmlns:a="urn:a" xmlns:b="urn:b" xml:lang="en"><foo a:x="1">xxx</foo><bar ID="bar">yyy</bar></root>`,
+			SignedInfo: `<ds:SignedInfo xmlns:a="urn:a" xmlns:b="urn:b" xmlns:ds="http://www.w3.org/2000/09/xmldsig#" xml:lang="en"><ds:CanonicalizationMethod Algorithm="http://www.w3.org/TR/2001/REC-xml-c14n-20010315">`,
+		},
+		"exclusive subset": testCase{
+			Algorithm:   "",
+			ReferenceID: "bar",
+			SignedData:  `<bar ID="bar">yyy</bar>`,
+			SignedInfo:  `<ds:SignedInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:CanonicalizationMethod Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#">`,
+		},
+		"inclusive subset": testCase{
+			Algorithm:   dsig.CanonicalizationMethodAlgorithmInclusive,
+			ReferenceID: "bar",
+			SignedData:  `<bar xmlns:a="urn:a" xmlns:b="urn:b" ID="bar" xml:lang="en">yyy</bar>`,
+			SignedInfo:  `<ds:SignedInfo xmlns:a="urn:a" xmlns:b="urn:b" xmlns:ds="http://www.w3.org/2000/09/xmldsig#" xml:lang="en"><ds:CanonicalizationMethod Algorithm="http://www.w3.org/TR/2001/REC-xml-c14n-20010315">`,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			signed, err := dsig.SignDocument([]byte(doc), testKey, testCert, dsig.SignOptions{Prefix: "ds", ReferenceID: tt.ReferenceID, CanonicalizationAlgorithm: tt.Algorithm})
+			assert.NoError(t, err)
+
+			var sig dsig.Signature
+			assert.NoError(t, xml.Unmarshal([]byte(signatureElement.FindString(string(signed))), &sig))
+
+			algorithm := tt.Algorithm
+			if algorithm == "" {
+				algorithm = dsig.CanonicalizationMethodAlgorithmExclusive
+			}
+
+			assert.Equal(t, algorithm, sig.SignedInfo.CanonicalizationMethod.Algorithm)
+			assert.Equal(t, algorithm, sig.SignedInfo.Reference().Transforms[1].Algorithm)
+
+			result, err := sig.VerifyWithResult(testCert, xml.NewDecoder(strings.NewReader(string(signed))), dsig.VerifyOptions{})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.SignedData, string(result.SignedData))
+			assert.True(t, strings.HasPrefix(string(result.SignedInfo), tt.SignedInfo), string(result.SignedInfo))
+		})
+	}
+
+	_, err := dsig.NewSignature(dsig.SignOptions{CanonicalizationAlgorithm: "http://www.w3.org/2006/12/xml-c14n11"})
+	assert.Equal(t, dsig.ErrBadCanonicalizationAlgorithm, err)
+}
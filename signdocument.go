@@ -0,0 +1,216 @@
+package dsig
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/xml"
+	"errors"
+	"io"
+
+	"github.com/ucarion/dsig/internal/sigsplit"
+	"github.com/ucarion/dsig/internal/stack"
+)
+
+// ErrAlreadySigned is returned by SignDocument and SignStream if the element
+// they would insert the ds:Signature into already has a ds:Signature as a
+// child. The enveloped signature transform of each would remove only itself,
+// and not the other, so the new signature would invalidate the existing one.
+// AddSignature adds a signature alongside the existing one instead, and Resign
+// replaces it.
+var ErrAlreadySigned = errors.New("dsig: element already has a signature")
+
+// ErrInsertionPointNotFound is returned by SignDocument if
+// SignOptions.InsertAfter is set, but the element the ds:Signature would be
+// inserted into has no child with that name.
+var ErrInsertionPointNotFound = errors.New("dsig: element to insert signature after not found")
+
+// SignDocument signs doc, an XML document, with an enveloped signature over
+// the whole document, and returns the document with the ds:Signature inserted
+// as the last child of its root element.
+//
+// If opts.ReferenceID is set, and opts.References isn't, only the element with
+// that ID is signed, and the ds:Signature is inserted as its last child
+// instead. SAML puts the ds:Signature of an assertion right after its
+// saml:Issuer rather than last, and schema-validating SAML consumers reject it
+// anywhere else; set opts.InsertAfter to the name of saml:Issuer for that.
+//
+// The signature is created by NewSignature with opts, and signed with signer as
+// with SignWithSigner. If cert is non-nil, it's included in the signature's
+// KeyInfo, unless opts already has a Certificate or CertificateChain. Set
+// opts.Prefix to "ds" to have the signature written as ds:Signature; otherwise,
+// the XML-DSig namespace is declared as the default namespace on it.
+//
+// If the element the ds:Signature would be inserted into already has one,
+// SignDocument returns ErrAlreadySigned.
+//
+// Apart from the inserted ds:Signature, the returned document is byte-for-byte
+// the same as doc, except that an empty root element like <foo/> is written as
+// <foo></foo> so that it can contain the signature. The result can be
+// unmarshaled and verified with Verify.
+//
+// The output is deterministic: signing the same doc with the same key and opts
+// always returns the same bytes. The ds:Signature's elements and attributes are
+// always written in the same order, any namespace declarations it needs are
+// sorted by prefix, and no whitespace or indentation is added, apart from the
+// line breaks that opts.Base64LineLength asks for. RSA PKCS #1 v1.5 signatures
+// use no random salt, so the SignatureValue is the same every time too.
+func SignDocument(doc []byte, signer crypto.Signer, cert *x509.Certificate, opts SignOptions) ([]byte, error) {
+	id := ""
+	if len(opts.References) == 0 {
+		id = opts.ReferenceID
+	}
+
+	before, after, err := splitAtInsertionPoint(doc, id, opts.IDAttribute, opts.InsertAfter)
+	if err != nil {
+		return nil, err
+	}
+
+	if cert != nil && opts.Certificate == nil && len(opts.CertificateChain) == 0 {
+		opts.Certificate = cert
+	}
+
+	s, err := NewSignature(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return signSpliced(before, after, s, signer)
+}
+
+// splitAtInsertionPoint splits doc where a ds:Signature is to be inserted
+// into the first element with the given ID in idAttr, as with
+// SignOptions.IDAttribute, or into the root element if id is empty.
+//
+// If insertAfter is zero, doc is split just before the element's end tag. If
+// the element is an empty-element tag, like <foo/>, it's rewritten as a start
+// tag and an end tag, like <foo></foo>, and doc is split between them.
+// Otherwise, doc is split just after the element's first child named
+// insertAfter, or splitAtInsertionPoint returns ErrInsertionPointNotFound if it
+// has no such child.
+//
+// If no element has the ID, splitAtInsertionPoint returns
+// ErrReferenceNotFound. If the element already has a ds:Signature child, it
+// returns ErrAlreadySigned.
+func splitAtInsertionPoint(doc []byte, id string, idAttr xml.Name, insertAfter xml.Name) ([]byte, []byte, error) {
+	// targetDepth is the depth of the element to split at, or 0 if it hasn't
+	// been found yet.
+	targetDepth := 0
+	if id == "" {
+		targetDepth = 1
+	}
+
+	// split is the offset just after the child named insertAfter, or -1 if it
+	// hasn't been found yet. The rest of the element is still scanned, so that
+	// a ds:Signature after that child is reported.
+	split := -1
+
+	// inInsertAfter is whether the decoder is inside of the child named
+	// insertAfter.
+	inInsertAfter := false
+
+	names := stack.Stack{}
+	decoder := xml.NewDecoder(bytes.NewReader(doc))
+	for {
+		offset := decoder.InputOffset()
+		t, err := decoder.RawToken()
+		if err != nil {
+			if err == io.EOF {
+				if targetDepth == 0 {
+					return nil, nil, ErrReferenceNotFound
+				}
+
+				return nil, nil, io.ErrUnexpectedEOF
+			}
+
+			return nil, nil, err
+		}
+
+		switch t := t.(type) {
+		case xml.StartElement:
+			names.Push(sigsplit.DeclaredNamespaces(t))
+			if targetDepth == 0 && sigsplit.HasID(t, id, idAttr, &names) {
+				targetDepth = names.Len()
+			}
+
+			if targetDepth == 0 || names.Len() != targetDepth+1 {
+				continue
+			}
+
+			space := names.Get(t.Name.Space)
+			if space == namespace && t.Name.Local == "Signature" {
+				return nil, nil, ErrAlreadySigned
+			}
+
+			if split == -1 && insertAfter.Local != "" && space == insertAfter.Space && t.Name.Local == insertAfter.Local {
+				inInsertAfter = true
+			}
+		case xml.EndElement:
+			depth := names.Len()
+			names.Pop()
+			if inInsertAfter && depth == targetDepth+1 {
+				// The end of an empty-element tag is reported after its "/>", so
+				// this is just after the child either way.
+				split = int(decoder.InputOffset())
+				inInsertAfter = false
+				continue
+			}
+
+			if depth != targetDepth {
+				continue
+			}
+
+			if insertAfter.Local != "" {
+				if split == -1 {
+					return nil, nil, ErrInsertionPointNotFound
+				}
+
+				return doc[:split], doc[split:], nil
+			}
+
+			if bytes.HasPrefix(doc[offset:], []byte("</")) {
+				return doc[:offset], doc[offset:], nil
+			}
+
+			// The end of an empty-element tag is reported at the end of the tag,
+			// after its "/>".
+			name := t.Name.Local
+			if t.Name.Space != "" {
+				name = t.Name.Space + ":" + name
+			}
+
+			before := append(append([]byte{}, doc[:offset-2]...), '>')
+			after := append([]byte("</"+name+">"), doc[offset:]...)
+			return before, after, nil
+		}
+	}
+}
+
+// signSpliced signs s, which is to be put between before and after, with
+// signer, and returns the resulting document.
+func signSpliced(before, after []byte, s *Signature, signer crypto.Signer) ([]byte, error) {
+	unsigned, err := spliceSignature(before, after, s)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.SignWithSigner(signer, xml.NewDecoder(bytes.NewReader(unsigned))); err != nil {
+		return nil, err
+	}
+
+	return spliceSignature(before, after, s)
+}
+
+// spliceSignature returns s, marshaled, between before and after.
+func spliceSignature(before, after []byte, s *Signature) ([]byte, error) {
+	data, err := xml.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	out.Write(before)
+	out.Write(data)
+	out.Write(after)
+	return out.Bytes(), nil
+}
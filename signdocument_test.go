@@ -0,0 +1,301 @@
+package dsig_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/xml"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/dsig"
+)
+
+// signatureElement matches a marshaled ds:Signature, with or without a prefix.
+var signatureElement = regexp.MustCompile(`<(ds:)?Signature .*</(ds:)?Signature>`)
+
+func TestSignDocument(t *testing.T) {
+	type testCase struct {
+		Doc      string
+		Prefix   string
+		Unsigned string
+	}
+
+	testCases := map[string]testCase{
+		"default namespace signature": testCase{
+			Doc:      "<?xml version=\"1.0\"?>\n<root attr='1'>\n  <foo>xxx</foo>\n</root>\n",
+			Unsigned: "<?xml version=\"1.0\"?>\n<root attr='1'>\n  <foo>xxx</foo>\n</root>\n",
+		},
+		"ds prefix": testCase{
+			Doc:      "<root>\n  <foo>xxx</foo>\n  <!-- comment -->\n</root>",
+			Prefix:   "ds",
+			Unsigned: "<root>\n  <foo>xxx</foo>\n  <!-- comment -->\n</root>",
+		},
+		"default namespace root": testCase{
+			Doc:      `<root xmlns="urn:example"><foo>xxx</foo></root>`,
+			Prefix:   "ds",
+			Unsigned: `<root xmlns="urn:example"><foo>xxx</foo></root>`,
+		},
+		"prefixed root": testCase{
+			Doc:      `<a:root xmlns:a="urn:example"><a:foo>xxx</a:foo></a:root>`,
+			Unsigned: `<a:root xmlns:a="urn:example"><a:foo>xxx</a:foo></a:root>`,
+		},
+		"empty root": testCase{
+			Doc:      `<root attr="1" />`,
+			Prefix:   "ds",
+			Unsigned: `<root attr="1" ></root>`,
+		},
+		"empty prefixed root": testCase{
+			Doc:      `<a:root xmlns:a="urn:example"/>`,
+			Unsigned: `<a:root xmlns:a="urn:example"></a:root>`,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			signed, err := dsig.SignDocument([]byte(tt.Doc), testKey, testCert, dsig.SignOptions{Prefix: tt.Prefix})
+			assert.NoError(t, err)
+
+			// The signature is the last child of the root, and the rest of the
+			// document is unchanged.
+			assert.Regexp(t, signatureElement.String()+`</(a:)?root>`, string(signed))
+			assert.Equal(t, tt.Unsigned, signatureElement.ReplaceAllString(string(signed), ""))
+
+			assert.Equal(t, []error{nil}, dsig.VerifyBatch(testCert, [][]byte{signed}))
+		})
+	}
+}
+
+func TestSignDocument_Unmarshal(t *testing.T) {
+	signed, err := dsig.SignDocument([]byte(`<root><foo>xxx</foo></root>`), testKey, testCert, dsig.SignOptions{Prefix: "ds"})
+	assert.NoError(t, err)
+
+	var doc struct {
+		XMLName   xml.Name `xml:"root"`
+		Foo       string   `xml:"foo"`
+		Signature dsig.Signature
+	}
+
+	assert.NoError(t, xml.Unmarshal(signed, &doc))
+	assert.Equal(t, "xxx", doc.Foo)
+	assert.NotNil(t, doc.Signature.KeyInfo)
+	assert.NoError(t, doc.Signature.Verify(testCert, xml.NewDecoder(strings.NewReader(string(signed)))))
+}
+
+func TestSignDocument_Errors(t *testing.T) {
+	_, err := dsig.SignDocument([]byte(`<root><foo>xxx</foo>`), testKey, nil, dsig.SignOptions{})
+	assert.Error(t, err)
+
+	_, err = dsig.SignDocument([]byte(``), testKey, nil, dsig.SignOptions{})
+	assert.Error(t, err)
+
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	_, err = dsig.SignDocument([]byte(`<root />`), ecdsaKey, nil, dsig.SignOptions{})
+	assert.Equal(t, dsig.ErrPublicKeyNotRSA, err)
+}
+
+func TestSignDocument_AlreadySigned(t *testing.T) {
+	type testCase struct {
+		Opts dsig.SignOptions
+	}
+
+	testCases := map[string]testCase{
+		"root":         testCase{},
+		"ds prefix":    testCase{Opts: dsig.SignOptions{Prefix: "ds"}},
+		"reference id": testCase{Opts: dsig.SignOptions{ReferenceID: "foo"}},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			signed, err := dsig.SignDocument([]byte(`<root><foo ID="foo">xxx</foo></root>`), testKey, testCert, tt.Opts)
+			assert.NoError(t, err)
+
+			_, err = dsig.SignDocument(signed, testKey, testCert, tt.Opts)
+			assert.Equal(t, dsig.ErrAlreadySigned, err)
+		})
+	}
+}
+
+func TestSignDocument_CoSign(t *testing.T) {
+	// The inner signature is over #foo, and the outer one is over the whole
+	// document, including the inner signature.
+	inner, err := dsig.SignDocument([]byte(`<root><foo ID="foo">xxx</foo><bar>yyy</bar></root>`), testKey, testCert, dsig.SignOptions{Prefix: "ds", ReferenceID: "foo"})
+	assert.NoError(t, err)
+
+	outer, err := dsig.SignDocument(inner, testKey, testCert, dsig.SignOptions{Prefix: "ds"})
+	assert.NoError(t, err)
+
+	sigs := signatureElement.FindAllString(strings.Replace(string(outer), "</ds:Signature>", "</ds:Signature>\n", -1), -1)
+	assert.Len(t, sigs, 2)
+
+	for _, sig := range sigs {
+		var s dsig.Signature
+		assert.NoError(t, xml.Unmarshal([]byte(sig), &s))
+		assert.NoError(t, s.Verify(testCert, xml.NewDecoder(strings.NewReader(string(outer)))))
+		assert.Equal(t, dsig.ErrBadDigest, s.Verify(testCert, xml.NewDecoder(strings.NewReader(strings.Replace(string(outer), "xxx", "zzz", 1)))))
+	}
+}
+
+func TestSignDocument_ReferenceID(t *testing.T) {
+	wsu := "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd"
+
+	type testCase struct {
+		Doc         string
+		IDAttribute xml.Name
+		Parent      string
+		Signed      string
+		Unsigned    string
+	}
+
+	testCases := map[string]testCase{
+		"saml assertion": testCase{
+			Doc:         `<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" ID="response"><saml:Assertion xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="assertion"><saml:Subject>alice</saml:Subject></saml:Assertion><Other>xxx</Other></samlp:Response>`,
+			IDAttribute: xml.Name{Local: "ID"},
+			Parent:      "saml:Assertion",
+			Signed:      "alice",
+			Unsigned:    "xxx",
+		},
+		"wsu:Id": testCase{
+			Doc:         `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/" xmlns:wsu="` + wsu + `"><soap:Header>xxx</soap:Header><soap:Body wsu:Id="assertion"><Foo>alice</Foo></soap:Body></soap:Envelope>`,
+			IDAttribute: xml.Name{Space: wsu, Local: "Id"},
+			Parent:      "soap:Body",
+			Signed:      "alice",
+			Unsigned:    "xxx",
+		},
+		"empty element": testCase{
+			Doc:         `<root><foo ID="assertion" attr="alice" /><bar>xxx</bar></root>`,
+			IDAttribute: xml.Name{Local: "ID"},
+			Parent:      "foo",
+			Signed:      "alice",
+			Unsigned:    "xxx",
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			signed, err := dsig.SignDocument([]byte(tt.Doc), testKey, testCert, dsig.SignOptions{Prefix: "ds", ReferenceID: "assertion", IDAttribute: tt.IDAttribute})
+			assert.NoError(t, err)
+			assert.Contains(t, string(signed), `<ds:Reference URI="#assertion">`)
+
+			// The signature is the last child of the element it signs.
+			assert.Contains(t, string(signed), "</ds:Signature></"+tt.Parent+">")
+
+			var sig dsig.Signature
+			assert.NoError(t, xml.Unmarshal([]byte(signatureElement.FindString(string(signed))), &sig))
+
+			verify := func(doc string) error {
+				return sig.VerifyWithOptions(testCert, xml.NewDecoder(strings.NewReader(doc)), dsig.VerifyOptions{IDAttribute: tt.IDAttribute})
+			}
+
+			assert.NoError(t, verify(string(signed)))
+			assert.NoError(t, verify(strings.Replace(string(signed), tt.Unsigned, "yyy", 1)))
+			assert.Equal(t, dsig.ErrBadDigest, verify(strings.Replace(string(signed), tt.Signed, "mallory", 1)))
+		})
+	}
+}
+
+func TestSignDocument_ReferenceIDErrors(t *testing.T) {
+	type testCase struct {
+		Doc         string
+		IDAttribute xml.Name
+		Err         error
+	}
+
+	testCases := map[string]testCase{
+		"missing": testCase{
+			Doc: `<root><foo ID="other" /></root>`,
+			Err: dsig.ErrReferenceNotFound,
+		},
+		"missing in configured attribute": testCase{
+			Doc:         `<root><foo Id="assertion" /></root>`,
+			IDAttribute: xml.Name{Local: "ID"},
+			Err:         dsig.ErrReferenceNotFound,
+		},
+		"duplicate": testCase{
+			Doc: `<root><foo ID="assertion" /><bar ID="assertion" /></root>`,
+			Err: dsig.ErrDuplicateID,
+		},
+		"duplicate across attributes": testCase{
+			Doc: `<root><foo ID="assertion" /><bar Id="assertion" /></root>`,
+			Err: dsig.ErrDuplicateID,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := dsig.SignDocument([]byte(tt.Doc), testKey, nil, dsig.SignOptions{ReferenceID: "assertion", IDAttribute: tt.IDAttribute})
+			assert.Equal(t, tt.Err, err)
+		})
+	}
+
+	// With a configured attribute, other attributes with the same value don't
+	// count as duplicates.
+	_, err := dsig.SignDocument([]byte(`<root><foo ID="assertion" /><bar Id="assertion" /></root>`), testKey, nil, dsig.SignOptions{ReferenceID: "assertion", IDAttribute: xml.Name{Local: "ID"}})
+	assert.NoError(t, err)
+}
+
+func TestSignDocument_InsertAfter(t *testing.T) {
+	issuer := xml.Name{Space: "urn:oasis:names:tc:SAML:2.0:assertion", Local: "Issuer"}
+
+	type testCase struct {
+		Doc         string
+		ReferenceID string
+		Want        string
+		Err         error
+	}
+
+	testCases := map[string]testCase{
+		"saml assertion": testCase{
+			Doc:         `<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion"><saml:Issuer>idp</saml:Issuer><saml:Assertion ID="assertion"><saml:Issuer>idp</saml:Issuer><saml:Subject>alice</saml:Subject></saml:Assertion></samlp:Response>`,
+			ReferenceID: "assertion",
+			Want:        `<saml:Assertion ID="assertion"><saml:Issuer>idp</saml:Issuer><ds:Signature`,
+		},
+		"saml response": testCase{
+			Doc:  `<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol"><Issuer xmlns="urn:oasis:names:tc:SAML:2.0:assertion">idp</Issuer><samlp:Status></samlp:Status></samlp:Response>`,
+			Want: `<Issuer xmlns="urn:oasis:names:tc:SAML:2.0:assertion">idp</Issuer><ds:Signature`,
+		},
+		"empty issuer": testCase{
+			Doc:  `<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion"><saml:Issuer /><samlp:Status></samlp:Status></samlp:Response>`,
+			Want: `<saml:Issuer /><ds:Signature`,
+		},
+		"no issuer": testCase{
+			Doc: `<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol"><samlp:Status></samlp:Status></samlp:Response>`,
+			Err: dsig.ErrInsertionPointNotFound,
+		},
+		"issuer in another namespace": testCase{
+			Doc: `<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol"><samlp:Issuer>idp</samlp:Issuer></samlp:Response>`,
+			Err: dsig.ErrInsertionPointNotFound,
+		},
+		"issuer not a child": testCase{
+			Doc: `<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion"><saml:Assertion ID="assertion"><saml:Issuer>idp</saml:Issuer></saml:Assertion></samlp:Response>`,
+			Err: dsig.ErrInsertionPointNotFound,
+		},
+		"already signed after issuer": testCase{
+			Doc: `<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion"><saml:Issuer>idp</saml:Issuer><Signature xmlns="http://www.w3.org/2000/09/xmldsig#"></Signature></samlp:Response>`,
+			Err: dsig.ErrAlreadySigned,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			signed, err := dsig.SignDocument([]byte(tt.Doc), testKey, testCert, dsig.SignOptions{Prefix: "ds", ReferenceID: tt.ReferenceID, InsertAfter: issuer})
+			assert.Equal(t, tt.Err, err)
+			if tt.Err != nil {
+				return
+			}
+
+			assert.Contains(t, string(signed), tt.Want)
+
+			var sig dsig.Signature
+			assert.NoError(t, xml.Unmarshal([]byte(signatureElement.FindString(string(signed))), &sig))
+			assert.NoError(t, sig.VerifyWithOptions(testCert, xml.NewDecoder(strings.NewReader(string(signed))), dsig.VerifyOptions{AllowArbitraryReferences: true}))
+
+			// Apart from the signature, the document is unchanged.
+			assert.Equal(t, tt.Doc, signatureElement.ReplaceAllString(string(signed), ""))
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package dsig
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SignedInfoMismatchError is returned by Verify if the SignedInfo of a
+// Signature disagrees with the ds:SignedInfo that was actually signed.
+//
+// Verify reads algorithms and the DigestValue from the Signature struct, but
+// checks the SignatureValue against the ds:SignedInfo it finds in the token
+// stream. The two can disagree if the struct was unmarshaled from different
+// data than the token stream, or if the document contains more than one
+// ds:Signature. Trusting the struct in that case could let an attacker have one
+// algorithm applied to data that claims another, so Verify refuses to continue.
+//
+// Field is the name of the part of SignedInfo that differs, such as
+// "SignatureMethod", "URI", "Transform", or "InclusiveNamespaces", or
+// "References" or "Transforms" if the number of References or of a
+// Reference's Transforms differs. Struct is its value in the Signature, and
+// Signed is its value in the signed data. The InclusiveNamespaces of a
+// CanonicalizationMethod or Transform are compared by their prefixes.
+type SignedInfoMismatchError struct {
+	Field  string
+	Struct string
+	Signed string
+}
+
+func (e *SignedInfoMismatchError) Error() string {
+	return fmt.Sprintf("dsig: SignedInfo %s does not match signed data: signature has %q, signed data has %q", e.Field, e.Struct, e.Signed)
+}
+
+// checkSignedInfo checks that s agrees with the canonicalized ds:SignedInfo
+// that was extracted from the token stream.
+func checkSignedInfo(s *SignedInfo, canonical []byte) error {
+	var signed SignedInfo
+	if err := xml.Unmarshal(canonical, &signed); err != nil {
+		return err
+	}
+
+	type field struct {
+		name   string
+		sig    string
+		signed string
+	}
+
+	fields := []field{
+		{"CanonicalizationMethod", s.CanonicalizationMethod.Algorithm, signed.CanonicalizationMethod.Algorithm},
+		{"InclusiveNamespaces", prefixList(s.CanonicalizationMethod.InclusiveNamespaces), prefixList(signed.CanonicalizationMethod.InclusiveNamespaces)},
+		{"SignatureMethod", s.SignatureMethod.Algorithm, signed.SignatureMethod.Algorithm},
+	}
+
+	if len(s.References) == len(signed.References) {
+		for i := range s.References {
+			sigRef, signedRef := &s.References[i], &signed.References[i]
+			fields = append(fields,
+				field{"URI", sigRef.URI, signedRef.URI},
+				field{"DigestMethod", sigRef.DigestMethod.Algorithm, signedRef.DigestMethod.Algorithm},
+				field{"DigestValue", sigRef.DigestValue, signedRef.DigestValue},
+			)
+
+			if len(sigRef.Transforms) != len(signedRef.Transforms) {
+				fields = append(fields, field{"Transforms", strconv.Itoa(len(sigRef.Transforms)), strconv.Itoa(len(signedRef.Transforms))})
+				continue
+			}
+
+			for j := range sigRef.Transforms {
+				sigTransform, signedTransform := &sigRef.Transforms[j], &signedRef.Transforms[j]
+				fields = append(fields,
+					field{"Transform", sigTransform.Algorithm, signedTransform.Algorithm},
+					field{"XPath", sigTransform.XPath, signedTransform.XPath},
+					field{"InclusiveNamespaces", prefixList(sigTransform.InclusiveNamespaces), prefixList(signedTransform.InclusiveNamespaces)},
+				)
+			}
+		}
+	} else {
+		fields = append(fields, field{"References", strconv.Itoa(len(s.References)), strconv.Itoa(len(signed.References))})
+	}
+
+	for _, f := range fields {
+		if f.sig != f.signed {
+			return &SignedInfoMismatchError{Field: f.name, Struct: f.sig, Signed: f.signed}
+		}
+	}
+
+	return nil
+}
+
+// prefixList returns the prefixes of n, separated by spaces, so that two
+// PrefixLists that differ only in whitespace compare equal.
+func prefixList(n *InclusiveNamespaces) string {
+	return strings.Join(n.prefixes(), " ")
+}
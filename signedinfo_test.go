@@ -0,0 +1,131 @@
+package dsig_test
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/dsig"
+)
+
+func TestVerify_SignedInfoMismatch(t *testing.T) {
+	doc := signTestDocument(t, `<root><foo>xxx</foo>`+testSignatureFormat+`</root>`, base64.StdEncoding)
+
+	var payload struct {
+		Signature dsig.Signature `xml:"http://www.w3.org/2000/09/xmldsig# Signature"`
+	}
+
+	assert.NoError(t, xml.Unmarshal([]byte(doc), &payload))
+
+	type testCase struct {
+		Modify func(s *dsig.Signature)
+		Field  string
+	}
+
+	testCases := map[string]testCase{
+		"canonicalization method": testCase{
+			Modify: func(s *dsig.Signature) {
+				s.SignedInfo.CanonicalizationMethod.Algorithm = dsig.CanonicalizationMethodAlgorithmExclusiveWithComments
+			},
+			Field: "CanonicalizationMethod",
+		},
+		"signature method": testCase{
+			Modify: func(s *dsig.Signature) {
+				s.SignedInfo.SignatureMethod.Algorithm = dsig.SignatureMethodAlgorithmSHA1
+			},
+			Field: "SignatureMethod",
+		},
+		"digest method": testCase{
+			Modify: func(s *dsig.Signature) {
+				s.SignedInfo.Reference().DigestMethod.Algorithm = dsig.DigestMethodAlgorithmSHA1
+			},
+			Field: "DigestMethod",
+		},
+		"digest value": testCase{
+			Modify: func(s *dsig.Signature) {
+				s.SignedInfo.Reference().DigestValue = base64.StdEncoding.EncodeToString(make([]byte, 32))
+			},
+			Field: "DigestValue",
+		},
+		"uri": testCase{
+			Modify: func(s *dsig.Signature) {
+				s.SignedInfo.Reference().URI = "#xpointer(/)"
+			},
+			Field: "URI",
+		},
+		"transform count": testCase{
+			Modify: func(s *dsig.Signature) {
+				s.SignedInfo.Reference().Transforms = s.SignedInfo.Reference().Transforms[:1]
+			},
+			Field: "Transforms",
+		},
+		"transform algorithm": testCase{
+			Modify: func(s *dsig.Signature) {
+				s.SignedInfo.Reference().Transforms[1].Algorithm = dsig.CanonicalizationMethodAlgorithmInclusive
+			},
+			Field: "Transform",
+		},
+		"transform prefix list": testCase{
+			Modify: func(s *dsig.Signature) {
+				s.SignedInfo.Reference().Transforms[1].InclusiveNamespaces = &dsig.InclusiveNamespaces{PrefixList: "xs"}
+			},
+			Field: "InclusiveNamespaces",
+		},
+		"canonicalization prefix list": testCase{
+			Modify: func(s *dsig.Signature) {
+				s.SignedInfo.CanonicalizationMethod.InclusiveNamespaces = &dsig.InclusiveNamespaces{PrefixList: "xs"}
+			},
+			Field: "InclusiveNamespaces",
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			sig := payload.Signature
+			sig.SignedInfo.References = append([]dsig.Reference(nil), sig.SignedInfo.References...)
+			for i := range sig.SignedInfo.References {
+				sig.SignedInfo.References[i].Transforms = append([]dsig.Transform(nil), sig.SignedInfo.References[i].Transforms...)
+			}
+
+			tt.Modify(&sig)
+
+			err := sig.Verify(testCert, xml.NewDecoder(strings.NewReader(doc)))
+
+			var mismatchErr *dsig.SignedInfoMismatchError
+			assert.True(t, errors.As(err, &mismatchErr))
+			assert.Equal(t, tt.Field, mismatchErr.Field)
+		})
+	}
+}
+
+func TestVerify_SignedInfoMismatch_MultipleSignatures(t *testing.T) {
+	doc := signTestDocument(t, `<root><foo>xxx</foo>`+testSignatureFormat+`</root>`, base64.StdEncoding)
+
+	// A second ds:Signature claiming a weaker signature algorithm, without a
+	// SignatureValue of its own. xml.Unmarshal keeps the last SignatureMethod it
+	// sees, but the SignatureValue of the first ds:Signature, and so the first
+	// is the one that is split out.
+	weak := strings.Replace(testSignatureFormat, dsig.SignatureMethodAlgorithmSHA256, dsig.SignatureMethodAlgorithmSHA1, 1)
+	weak = strings.Replace(weak, "<ds:SignatureValue>%s</ds:SignatureValue>", "", 1)
+	doc = strings.Replace(doc, "</root>", strings.Replace(weak, "%s", "", -1)+"</root>", 1)
+
+	var payload struct {
+		Signature dsig.Signature `xml:"http://www.w3.org/2000/09/xmldsig# Signature"`
+	}
+
+	assert.NoError(t, xml.Unmarshal([]byte(doc), &payload))
+	assert.Equal(t, dsig.SignatureMethodAlgorithmSHA1, payload.Signature.SignedInfo.SignatureMethod.Algorithm)
+
+	err := payload.Signature.Verify(testCert, xml.NewDecoder(strings.NewReader(doc)))
+
+	var mismatchErr *dsig.SignedInfoMismatchError
+	assert.True(t, errors.As(err, &mismatchErr))
+	assert.Equal(t, &dsig.SignedInfoMismatchError{
+		Field:  "SignatureMethod",
+		Struct: dsig.SignatureMethodAlgorithmSHA1,
+		Signed: dsig.SignatureMethodAlgorithmSHA256,
+	}, mismatchErr)
+}
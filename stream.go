@@ -0,0 +1,223 @@
+package dsig
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"io"
+
+	"github.com/ucarion/dsig/internal/canon"
+	"github.com/ucarion/dsig/internal/sigsplit"
+	"github.com/ucarion/dsig/internal/stack"
+)
+
+// SignStream is like SignDocument, but reads the document from r and writes
+// the signed document to w as it goes, rather than holding all of it in
+// memory. It's meant for documents too large for SignDocument, such as
+// generated reports of hundreds of megabytes.
+//
+// The document is digested as it's read: each token is canonicalized and
+// written to the digest's hash.Hash, and then written out to w unchanged. Only
+// the current token, the namespaces in scope, and the root element's start tag
+// are kept, along with the ds:Signature being built, so memory use doesn't
+// grow with the size of the document. When the root element's end tag is
+// reached, the signature is computed and written just before it, and the rest
+// of r is copied to w.
+//
+// The signature always has a single Reference to the whole document, so
+// opts.References and opts.ReferenceID are ignored; the rest of opts, and cert,
+// are handled as they are by SignDocument. The output is the same as what
+// SignDocument would return for the same document, and a document that
+// already has a child-of-root ds:Signature is rejected with ErrAlreadySigned,
+// as it is by SignDocument.
+//
+// If SignStream returns an error, part of the document may already have been
+// written to w.
+func SignStream(w io.Writer, r io.Reader, signer crypto.Signer, cert *x509.Certificate, opts SignOptions) error {
+	if cert != nil && opts.Certificate == nil && len(opts.CertificateChain) == 0 {
+		opts.Certificate = cert
+	}
+
+	opts.References = nil
+	opts.ReferenceID = ""
+
+	s, err := NewSignature(opts)
+	if err != nil {
+		return err
+	}
+
+	digestHashes, signatureHash, ids, err := s.signingParams(signer)
+	if err != nil {
+		return err
+	}
+
+	in := &streamReader{r: bufio.NewReader(r)}
+	tokens := &streamTokens{w: w, r: in, decoder: xml.NewDecoder(in)}
+
+	ref := s.SignedInfo.Reference()
+	h := digestHashes[0].New()
+	if err := canon.CanonicalizeTo(h, ref.applyCustomTransforms(tokens), ref.canonOptions()); err != nil {
+		return err
+	}
+
+	digestValues := []string{wrapBase64(base64.StdEncoding.EncodeToString(h.Sum(nil)), s.Base64LineLength)}
+
+	// ds:SignedInfo is canonicalized in the context of the root element, which
+	// is all of the document that its namespaces and xml:* attributes can come
+	// from.
+	rootEnd := []byte("</" + qualifiedName(tokens.rootName) + ">")
+
+	unsigned, err := xml.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	var withSignature []xml.Token
+	decoder := xml.NewDecoder(io.MultiReader(bytes.NewReader(tokens.root), bytes.NewReader(unsigned), bytes.NewReader(rootEnd)))
+	for {
+		t, err := decoder.RawToken()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+
+			return err
+		}
+
+		withSignature = append(withSignature, xml.CopyToken(t))
+	}
+
+	if err := s.signDigests(signer, withSignature, ids[0], signatureHash, digestValues); err != nil {
+		return err
+	}
+
+	signed, err := xml.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	// The root element's end tag hasn't been written yet. If the root element
+	// is an empty-element tag, like <foo/>, none of it has, and it's written as a
+	// start tag and an end tag, like <foo></foo>, so that it can contain the
+	// signature.
+	if tokens.empty {
+		in.pending.Reset()
+		if _, err := w.Write(tokens.root); err != nil {
+			return err
+		}
+
+		in.pending.Write(rootEnd)
+	}
+
+	if _, err := w.Write(signed); err != nil {
+		return err
+	}
+
+	if _, err := in.pending.WriteTo(w); err != nil {
+		return err
+	}
+
+	_, err = io.Copy(w, in.r)
+	return err
+}
+
+// streamReader is the input of SignStream. It's an io.ByteReader, so that an
+// xml.Decoder reads from it a byte at a time rather than buffering ahead, and
+// it keeps the bytes that have been read but not yet written out.
+type streamReader struct {
+	r       *bufio.Reader
+	pending bytes.Buffer
+}
+
+func (s *streamReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	s.pending.Write(p[:n])
+	return n, err
+}
+
+func (s *streamReader) ReadByte() (byte, error) {
+	b, err := s.r.ReadByte()
+	if err == nil {
+		s.pending.WriteByte(b)
+	}
+
+	return b, err
+}
+
+// streamTokens reads the tokens of the document for SignStream. Before reading
+// each token, it writes the document up to that token to w, so that only the
+// token being read is pending. It stops after the root element's end tag,
+// which is left pending, as the signature goes before it.
+type streamTokens struct {
+	w       io.Writer
+	r       *streamReader
+	decoder *xml.Decoder
+	written int64 // how much of the document has been written to w
+	depth   int
+	names   stack.Stack
+
+	// root is the root element's start tag, and rootName its name. If the root
+	// element is an empty-element tag, empty is true, and root is rewritten as a
+	// start tag, which is left pending rather than written.
+	root     []byte
+	rootName xml.Name
+	empty    bool
+}
+
+func (s *streamTokens) RawToken() (xml.Token, error) {
+	if s.depth == 0 && s.root != nil {
+		return nil, io.EOF
+	}
+
+	if !s.empty {
+		// The decoder may have read the first byte of the next token already, so
+		// what has been read is written only up to its offset.
+		n := s.decoder.InputOffset() - s.written
+		if _, err := s.w.Write(s.r.pending.Next(int(n))); err != nil {
+			return nil, err
+		}
+
+		s.written += n
+	}
+
+	t, err := s.decoder.RawToken()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := t.(type) {
+	case xml.StartElement:
+		s.depth++
+		s.names.Push(sigsplit.DeclaredNamespaces(t))
+		if s.depth == 2 && s.names.Get(t.Name.Space) == namespace && t.Name.Local == "Signature" {
+			return nil, ErrAlreadySigned
+		}
+
+		if s.depth == 1 {
+			s.rootName = t.Name
+			s.root = append([]byte(nil), s.r.pending.Bytes()...)
+			if bytes.HasSuffix(s.root, []byte("/>")) {
+				s.empty = true
+				s.root = append(s.root[:len(s.root)-2], '>')
+			}
+		}
+	case xml.EndElement:
+		s.depth--
+		s.names.Pop()
+	}
+
+	return t, nil
+}
+
+// qualifiedName returns name as it's written in a tag, with its prefix, if any,
+// in name.Space, as RawToken returns it.
+func qualifiedName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+
+	return name.Space + ":" + name.Local
+}
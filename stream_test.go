@@ -0,0 +1,149 @@
+package dsig_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/dsig"
+)
+
+func TestSignStream(t *testing.T) {
+	type testCase struct {
+		doc  string
+		opts dsig.SignOptions
+	}
+
+	testCases := map[string]testCase{
+		"simple": testCase{
+			doc: `<foo><bar>xxx</bar></foo>`,
+		},
+		"prolog and epilog": testCase{
+			doc: "<?xml version=\"1.0\"?>\n<!-- before --><foo a=\"1\">\n  <bar>xxx &amp; yyy</bar>\n</foo>\n<!-- after -->\n",
+		},
+		"empty root": testCase{
+			doc: `<foo xmlns="urn:foo" a="1" />`,
+		},
+		"namespaces": testCase{
+			doc:  `<a:foo xmlns:a="urn:a" xmlns:b="urn:b" xml:lang="en"><b:bar b:x="1">xxx</b:bar></a:foo>`,
+			opts: dsig.SignOptions{Prefix: "ds", InclusivePrefixes: []string{"b"}},
+		},
+		"inclusive c14n": testCase{
+			doc:  `<a:foo xmlns:a="urn:a" xmlns:b="urn:b" xml:lang="en"><b:bar b:x="1">xxx</b:bar></a:foo>`,
+			opts: dsig.SignOptions{CanonicalizationAlgorithm: dsig.CanonicalizationMethodAlgorithmInclusive},
+		},
+		"base64 line length": testCase{
+			doc:  `<foo><bar>xxx</bar></foo>`,
+			opts: dsig.SignOptions{Base64LineLength: 64, DigestAlgorithm: dsig.DigestMethodAlgorithmSHA1},
+		},
+		"reference id ignored": testCase{
+			doc:  `<foo><bar ID="bar">xxx</bar></foo>`,
+			opts: dsig.SignOptions{ReferenceID: "bar"},
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var out bytes.Buffer
+			assert.NoError(t, dsig.SignStream(&out, strings.NewReader(tt.doc), testKey, testCert, tt.opts))
+
+			// The output is the same as SignDocument's, with the ReferenceID that
+			// SignStream ignores left out.
+			opts := tt.opts
+			opts.ReferenceID = ""
+			expected, err := dsig.SignDocument([]byte(tt.doc), testKey, testCert, opts)
+			assert.NoError(t, err)
+			assert.Equal(t, string(expected), out.String())
+
+			verifyTestDocument(t, out.String())
+		})
+	}
+}
+
+func TestSignStream_Errors(t *testing.T) {
+	var out bytes.Buffer
+	assert.Equal(t, io.ErrUnexpectedEOF, dsig.SignStream(&out, strings.NewReader(`<foo><bar>`), testKey, testCert, dsig.SignOptions{}))
+	assert.Equal(t, dsig.ErrBadDigestAlgorithm, dsig.SignStream(&out, strings.NewReader(`<foo></foo>`), testKey, testCert, dsig.SignOptions{DigestAlgorithm: "bad"}))
+
+	signed, err := dsig.SignDocument([]byte(`<foo></foo>`), testKey, testCert, dsig.SignOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, dsig.ErrAlreadySigned, dsig.SignStream(&out, bytes.NewReader(signed), testKey, testCert, dsig.SignOptions{}))
+}
+
+// syntheticReport is an io.Reader of a generated XML document of about size
+// bytes, made up of many small rows. It never holds more than one row in
+// memory, so that the benchmark measures only what SignStream keeps.
+type syntheticReport struct {
+	size    int
+	read    int
+	row     int
+	pending []byte
+	done    bool
+
+	// peakHeap is the most heap in use seen while reading, sampled every
+	// megabyte.
+	peakHeap uint64
+	sampled  int
+}
+
+func (r *syntheticReport) Read(p []byte) (int, error) {
+	if len(r.pending) == 0 {
+		switch {
+		case r.done:
+			return 0, io.EOF
+		case r.read == 0:
+			r.pending = []byte(`<report xmlns="urn:report" xmlns:x="urn:x">`)
+		case r.read >= r.size:
+			r.pending = []byte(`</report>`)
+			r.done = true
+		default:
+			r.pending = []byte(fmt.Sprintf(`<row id="%d"><name>row &amp; %d</name><x:value unit="ms">%d</x:value></row>`+"\n", r.row, r.row, r.row*7))
+			r.row++
+		}
+	}
+
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	r.read += n
+
+	if r.read-r.sampled >= 1<<20 {
+		r.sampled = r.read
+
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+		if m.HeapInuse > r.peakHeap {
+			r.peakHeap = m.HeapInuse
+		}
+	}
+
+	return n, nil
+}
+
+func BenchmarkSignStream(b *testing.B) {
+	for _, size := range []int{1 << 20, 16 << 20, 256 << 20} {
+		b.Run(fmt.Sprintf("%dMB", size>>20), func(b *testing.B) {
+			b.SetBytes(int64(size))
+
+			var peakHeap uint64
+			for i := 0; i < b.N; i++ {
+				r := &syntheticReport{size: size}
+				if err := dsig.SignStream(ioutil.Discard, r, testKey, testCert, dsig.SignOptions{}); err != nil {
+					b.Fatal(err)
+				}
+
+				if r.peakHeap > peakHeap {
+					peakHeap = r.peakHeap
+				}
+			}
+
+			// peak-heap-B should stay about the same as the size of the document
+			// grows.
+			b.ReportMetric(float64(peakHeap), "peak-heap-B")
+		})
+	}
+}
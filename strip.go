@@ -0,0 +1,81 @@
+package dsig
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+)
+
+// StripSignature removes the enveloped Signature from doc, and returns the
+// remaining document along with the Signature that was removed.
+//
+// Only the bytes making up the ds:Signature element are removed; everything
+// else in doc, including whitespace around the Signature, is preserved
+// byte-for-byte. StripSignature considers any ds:Signature that is an immediate
+// child of the root element to be enveloped. If there are none, StripSignature
+// returns ErrSignatureNotFound, and if there are several, it returns
+// ErrMultipleSignatures; use StripSignatures to remove all of them.
+func StripSignature(doc []byte) ([]byte, *Signature, error) {
+	stripped, sigs, err := StripSignatures(doc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(sigs) > 1 {
+		return nil, nil, ErrMultipleSignatures
+	}
+
+	return stripped, sigs[0], nil
+}
+
+// StripSignatures is like StripSignature, but removes every enveloped
+// Signature from doc, such as those of a document signed by several parties,
+// and returns all of them in document order.
+//
+// Note that Verify removes only the signature being verified, so the document
+// StripSignatures returns is not what any one of several signatures signed.
+func StripSignatures(doc []byte) ([]byte, []*Signature, error) {
+	var sigs []*Signature
+	var stripped []byte
+	var last int64 // the offset in doc up to which we've copied into stripped
+
+	depth := 0
+	decoder := xml.NewDecoder(bytes.NewReader(doc))
+	for {
+		offset := decoder.InputOffset()
+		t, err := decoder.Token()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+
+			return nil, nil, err
+		}
+
+		switch t := t.(type) {
+		case xml.StartElement:
+			if depth != 1 || t.Name.Space != namespace || t.Name.Local != "Signature" {
+				depth++
+				continue
+			}
+
+			var s Signature
+			if err := decoder.DecodeElement(&s, &t); err != nil {
+				return nil, nil, err
+			}
+
+			sigs = append(sigs, &s)
+			stripped = append(stripped, doc[last:offset]...)
+			last = decoder.InputOffset()
+		case xml.EndElement:
+			depth--
+		}
+	}
+
+	if len(sigs) == 0 {
+		return nil, nil, ErrSignatureNotFound
+	}
+
+	stripped = append(stripped, doc[last:]...)
+	return stripped, sigs, nil
+}
@@ -0,0 +1,46 @@
+package dsig_test
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/dsig"
+)
+
+func TestStripSignature(t *testing.T) {
+	unsigned := "<?xml version=\"1.0\"?>\n<root a='1'>\n\t<foo>xxx</foo>\n\t%s\n\t<!-- keep me -->\n</root>\n"
+	doc := signTestDocument(t, strings.Replace(unsigned, "%s", testSignatureFormat, 1), base64.StdEncoding)
+
+	stripped, sig, err := dsig.StripSignature([]byte(doc))
+	assert.NoError(t, err)
+	assert.Equal(t, strings.Replace(unsigned, "%s", "", 1), string(stripped))
+	assert.Equal(t, dsig.SignatureMethodAlgorithmSHA256, sig.SignedInfo.SignatureMethod.Algorithm)
+	assert.NoError(t, verifyTestDocument(t, doc))
+}
+
+func TestStripSignature_Multiple(t *testing.T) {
+	doc := `<root><ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:SignatureValue>first</ds:SignatureValue></ds:Signature><foo /><Signature xmlns="http://www.w3.org/2000/09/xmldsig#"><SignatureValue>second</SignatureValue></Signature></root>`
+
+	_, _, err := dsig.StripSignature([]byte(doc))
+	assert.Equal(t, dsig.ErrMultipleSignatures, err)
+
+	stripped, sigs, err := dsig.StripSignatures([]byte(doc))
+	assert.NoError(t, err)
+	assert.Equal(t, `<root><foo /></root>`, string(stripped))
+	assert.Len(t, sigs, 2)
+	assert.Equal(t, "first", sigs[0].SignatureValue.Value)
+	assert.Equal(t, "second", sigs[1].SignatureValue.Value)
+}
+
+func TestStripSignature_Nested(t *testing.T) {
+	// Only child-of-root signatures are enveloped signatures.
+	doc := `<root><foo><ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#"></ds:Signature></foo></root>`
+
+	_, _, err := dsig.StripSignature([]byte(doc))
+	assert.Equal(t, dsig.ErrSignatureNotFound, err)
+
+	_, _, err = dsig.StripSignatures([]byte(doc))
+	assert.Equal(t, dsig.ErrSignatureNotFound, err)
+}
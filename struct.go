@@ -0,0 +1,47 @@
+package dsig
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/xml"
+)
+
+// VerifyStruct verifies the Signature embedded in v, using cert, when the
+// original bytes that v was unmarshaled from are no longer available.
+//
+// VerifyStruct marshals v with xml.Marshal, and then verifies the ds:Signature
+// that is an immediate child of the root element of the result, exactly as
+// Verify would. If there is no such ds:Signature, VerifyStruct returns
+// ErrSignatureNotFound, and if there is more than one, it returns
+// ErrMultipleSignatures.
+//
+// This only works if marshaling v reproduces the signed data closely enough
+// that it canonicalizes the same way as the original. That is rarely the case
+// unless the original was itself produced by xml.Marshal from the same types.
+// Anything v doesn't capture is lost, including:
+//
+//  - Elements and attributes that have no corresponding field in v.
+//  - Comments and processing instructions, if the signature was made with a
+//    "with comments" c14n algorithm.
+//  - Whitespace between elements.
+//  - Namespace prefixes, as xml.Marshal always uses default namespace
+//    declarations. This affects ds:SignedInfo too, so signatures made over a
+//    ds:SignedInfo with a prefix, such as "ds:", cannot be verified.
+//
+// When the signed data does not survive the round trip, VerifyStruct returns
+// ErrBadDigest, just as Verify does for a tampered document. There is no way
+// for VerifyStruct to tell the two cases apart, so if at all possible, keep the
+// original bytes and use Verify instead.
+func VerifyStruct(cert *x509.Certificate, v interface{}) error {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	_, s, err := StripSignature(data)
+	if err != nil {
+		return err
+	}
+
+	return s.Verify(cert, NewDecoder(bytes.NewReader(data)))
+}
@@ -0,0 +1,84 @@
+package dsig_test
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/dsig"
+)
+
+// structSignature is a signature whose DigestValue and SignatureValue are %s
+// verbs, so that once marshaled it can be passed to signTestDocument.
+var structSignature = dsig.Signature{
+	SignedInfo: dsig.SignedInfo{
+		CanonicalizationMethod: dsig.CanonicalizationMethod{Algorithm: dsig.CanonicalizationMethodAlgorithmExclusive},
+		SignatureMethod:        dsig.SignatureMethod{Algorithm: dsig.SignatureMethodAlgorithmSHA256},
+		References: []dsig.Reference{
+			dsig.Reference{
+				Transforms: []dsig.Transform{
+					dsig.Transform{Algorithm: dsig.TransformAlgorithmEnveloped},
+					dsig.Transform{Algorithm: dsig.CanonicalizationMethodAlgorithmExclusive},
+				},
+				DigestMethod: dsig.DigestMethod{Algorithm: dsig.DigestMethodAlgorithmSHA256},
+				DigestValue:  "%s",
+			},
+		},
+	},
+	SignatureValue: dsig.SignatureValue{Value: "%s"},
+}
+
+type structDoc struct {
+	XMLName   xml.Name `xml:"root"`
+	Foo       string   `xml:"foo"`
+	Signature dsig.Signature
+}
+
+type structDocWithBar struct {
+	XMLName   xml.Name `xml:"root"`
+	Foo       string   `xml:"foo"`
+	Bar       string   `xml:"bar"`
+	Signature dsig.Signature
+}
+
+func TestVerifyStruct(t *testing.T) {
+	format, err := xml.Marshal(structDoc{Foo: "xxx", Signature: structSignature})
+	assert.NoError(t, err)
+
+	doc := signTestDocument(t, string(format), base64.StdEncoding)
+
+	var v structDoc
+	assert.NoError(t, xml.Unmarshal([]byte(doc), &v))
+	assert.NoError(t, dsig.VerifyStruct(testCert, v))
+	assert.NoError(t, dsig.VerifyStruct(testCert, &v))
+
+	v.Foo = "yyy"
+	assert.Equal(t, dsig.ErrBadDigest, dsig.VerifyStruct(testCert, v))
+}
+
+func TestVerifyStruct_LossyRoundTrip(t *testing.T) {
+	// The signed document has a bar element, but structDoc has nowhere to put
+	// it. Re-marshaling loses bar, and so the digest no longer matches.
+	format, err := xml.Marshal(structDocWithBar{Foo: "xxx", Bar: "yyy", Signature: structSignature})
+	assert.NoError(t, err)
+
+	doc := signTestDocument(t, string(format), base64.StdEncoding)
+
+	var withBar structDocWithBar
+	assert.NoError(t, xml.Unmarshal([]byte(doc), &withBar))
+	assert.NoError(t, dsig.VerifyStruct(testCert, withBar))
+
+	var v structDoc
+	assert.NoError(t, xml.Unmarshal([]byte(doc), &v))
+	assert.Equal(t, dsig.ErrBadDigest, dsig.VerifyStruct(testCert, v))
+}
+
+func TestVerifyStruct_NoSignature(t *testing.T) {
+	v := struct {
+		XMLName xml.Name `xml:"root"`
+		Foo     string   `xml:"foo"`
+	}{Foo: "xxx"}
+
+	assert.Equal(t, dsig.ErrSignatureNotFound, dsig.VerifyStruct(testCert, v))
+}
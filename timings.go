@@ -0,0 +1,69 @@
+package dsig
+
+import "time"
+
+// VerifyTimings describes how long each phase of verifying a signature took.
+// See the documentation for VerifyOptions.Timings.
+type VerifyTimings struct {
+	// Canonicalization is the time spent reading the document, splitting it
+	// into the signed data and ds:SignedInfo, and canonicalizing them. Reading
+	// and canonicalizing happen together, so the time to tokenize the document
+	// is included here.
+	Canonicalization time.Duration
+
+	// Hashing is the time spent hashing the signed data and ds:SignedInfo.
+	Hashing time.Duration
+
+	// PublicKey is the time spent on public-key operations. If several keys
+	// were tried, as can happen with VerifyWithTrustStore, this is the time
+	// spent on all of them.
+	PublicKey time.Duration
+}
+
+// timer accumulates VerifyTimings while a signature is being verified. The
+// methods of a nil *timer do nothing, so that timing costs nothing when
+// VerifyOptions.Timings is nil.
+type timer struct {
+	timings VerifyTimings
+}
+
+// startTimer prepares opts to collect timings, if opts.Timings is set. The
+// returned function reports the timings, and must be called once verification
+// is done.
+func (o *VerifyOptions) startTimer() func() {
+	if o.Timings == nil || o.timer != nil {
+		return func() {}
+	}
+
+	t := &timer{}
+	o.timer = t
+	return func() {
+		o.Timings(t.timings)
+	}
+}
+
+func (t *timer) now() time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+
+	return time.Now()
+}
+
+func (t *timer) canonicalization(start time.Time) {
+	if t != nil {
+		t.timings.Canonicalization += time.Since(start)
+	}
+}
+
+func (t *timer) hashing(start time.Time) {
+	if t != nil {
+		t.timings.Hashing += time.Since(start)
+	}
+}
+
+func (t *timer) publicKey(start time.Time) {
+	if t != nil {
+		t.timings.PublicKey += time.Since(start)
+	}
+}
@@ -0,0 +1,54 @@
+package dsig_test
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/dsig"
+)
+
+func TestVerifyWithOptions_Timings(t *testing.T) {
+	doc := signTestDocument(t, `<root>`+strings.Repeat(`<foo>xxx</foo>`, 1000)+testSignatureFormat+`</root>`, base64.StdEncoding)
+
+	var calls []dsig.VerifyTimings
+	opts := dsig.VerifyOptions{
+		Timings: func(timings dsig.VerifyTimings) {
+			calls = append(calls, timings)
+		},
+	}
+
+	assert.NoError(t, verifyTestDocumentWithOptions(t, doc, opts))
+	assert.Len(t, calls, 1)
+	assert.True(t, calls[0].Canonicalization > 0)
+	assert.True(t, calls[0].Hashing > 0)
+	assert.True(t, calls[0].PublicKey > 0)
+
+	// Timings are reported for invalid signatures too, but only for the phases
+	// that were reached.
+	calls = nil
+	assert.Equal(t, dsig.ErrBadDigest, verifyTestDocumentWithOptions(t, strings.Replace(doc, "xxx", "yyy", 1), opts))
+	assert.Len(t, calls, 1)
+	assert.True(t, calls[0].Canonicalization > 0)
+	assert.Equal(t, 0, int(calls[0].PublicKey))
+
+	// VerifyWithTrustStore reports once, no matter how many keys it tries.
+	var payload struct {
+		Signature dsig.Signature `xml:"http://www.w3.org/2000/09/xmldsig# Signature"`
+	}
+
+	assert.NoError(t, xml.Unmarshal([]byte(doc), &payload))
+
+	_, other := generateTestCert()
+
+	var ts dsig.TrustStore
+	ts.AddPublicKey(other.PublicKey)
+	ts.AddPublicKey(testCert.PublicKey)
+
+	calls = nil
+	_, err := payload.Signature.VerifyWithTrustStore(&ts, xml.NewDecoder(strings.NewReader(doc)), opts)
+	assert.NoError(t, err)
+	assert.Len(t, calls, 1)
+}
@@ -0,0 +1,37 @@
+package dsig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+
+	"github.com/ucarion/c14n"
+)
+
+// ErrEmptyTLSCertificate is returned by VerifyTLS if the given tls.Certificate
+// has neither a Leaf nor any DER-encoded certificates.
+var ErrEmptyTLSCertificate = errors.New("dsig: tls.Certificate has no certificates")
+
+// VerifyTLS is like Verify, but takes the certificate to verify with from a
+// tls.Certificate, as is convenient in services that already manage their
+// peers' certificates for mutual TLS.
+//
+// The leaf certificate is used. If cert.Leaf is nil, cert.Certificate[0] is
+// parsed instead. The rest of the chain in cert is ignored, and as with Verify,
+// the certificate isn't checked for expiry.
+func (s *Signature) VerifyTLS(cert tls.Certificate, r c14n.RawTokenReader) error {
+	leaf := cert.Leaf
+	if leaf == nil {
+		if len(cert.Certificate) == 0 {
+			return ErrEmptyTLSCertificate
+		}
+
+		var err error
+		leaf, err = x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.Verify(leaf, r)
+}
@@ -0,0 +1,62 @@
+package dsig_test
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/dsig"
+)
+
+func TestVerifyTLS(t *testing.T) {
+	doc := signTestDocument(t, `<root><foo>xxx</foo>`+testSignatureFormat+`</root>`, base64.StdEncoding)
+
+	var payload struct {
+		Signature dsig.Signature `xml:"http://www.w3.org/2000/09/xmldsig# Signature"`
+	}
+
+	assert.NoError(t, xml.Unmarshal([]byte(doc), &payload))
+
+	type testCase struct {
+		Cert tls.Certificate
+		Err  error
+	}
+
+	testCases := map[string]testCase{
+		"leaf": testCase{
+			Cert: tls.Certificate{Leaf: testCert},
+			Err:  nil,
+		},
+		"der only": testCase{
+			Cert: tls.Certificate{Certificate: [][]byte{testCert.Raw}},
+			Err:  nil,
+		},
+		"leaf takes precedence": testCase{
+			Cert: tls.Certificate{Certificate: [][]byte{[]byte("not a certificate")}, Leaf: testCert},
+			Err:  nil,
+		},
+		"empty": testCase{
+			Cert: tls.Certificate{},
+			Err:  dsig.ErrEmptyTLSCertificate,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := payload.Signature.VerifyTLS(tt.Cert, xml.NewDecoder(strings.NewReader(doc)))
+			assert.Equal(t, tt.Err, err)
+		})
+	}
+
+	// Certificates that can't be parsed are reported as such.
+	err := payload.Signature.VerifyTLS(tls.Certificate{Certificate: [][]byte{[]byte("not a certificate")}}, xml.NewDecoder(strings.NewReader(doc)))
+	assert.Error(t, err)
+
+	// A valid certificate for the wrong key doesn't verify.
+	_, other := generateTestCert()
+	err = payload.Signature.VerifyTLS(tls.Certificate{Leaf: other}, xml.NewDecoder(strings.NewReader(doc)))
+	assert.Error(t, err)
+}
@@ -0,0 +1,36 @@
+package dsig
+
+import "github.com/ucarion/c14n"
+
+// TokenReader is the source of XML tokens that Verify reads the signed
+// document from. It's the same interface as c14n.RawTokenReader, and
+// *xml.Decoder implements it.
+//
+// Alternative tokenizers can be used with Verify, as long as they follow the
+// same contract as xml.Decoder's RawToken:
+//
+// Tokens are returned in document order, and RawToken returns io.EOF (and no
+// token) once the document is exhausted. A token and an error are never
+// returned together.
+//
+// Only xml.StartElement, xml.EndElement, xml.CharData, xml.Comment,
+// xml.ProcInst, and xml.Directive tokens are returned. Every StartElement is
+// matched by an EndElement, including for self-closing tags like <foo />.
+//
+// Names are not namespace-resolved. The Space of an element or attribute name
+// is the prefix it was written with ("ds" for ds:Signature), or the empty
+// string if it had no prefix. Namespace declarations are returned as ordinary
+// attributes: xmlns:ds is returned as Name{Space: "xmlns", Local: "ds"}, and
+// xmlns is returned as Name{Space: "", Local: "xmlns"}. Attributes are returned
+// in the order they appeared in the document.
+//
+// Character data and attribute values have had entity and character references
+// replaced, and line endings normalized to "\n", as required by the XML
+// specification. Adjacent character data may be split into several CharData
+// tokens.
+//
+// Verify copies any tokens it needs to retain, so a token's underlying bytes
+// need only remain valid until the next call to RawToken.
+//
+// The dsigtest package can check whether a tokenizer follows this contract.
+type TokenReader = c14n.RawTokenReader
@@ -0,0 +1,268 @@
+package dsig
+
+import (
+	"encoding/xml"
+	"errors"
+	"strings"
+)
+
+// ErrUnsupportedTransform is returned by Verify if a Reference uses an XSLT or
+// XPath transform that isn't an identity transform.
+var ErrUnsupportedTransform = errors.New("dsig: unsupported transform")
+
+// TransformAlgorithmEnveloped is the URI for the enveloped signature
+// transform.
+var TransformAlgorithmEnveloped = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+
+// TransformAlgorithmXPath is the URI for the XPath filtering transform.
+var TransformAlgorithmXPath = "http://www.w3.org/TR/1999/REC-xpath-19991116"
+
+// TransformAlgorithmXSLT is the URI for the XSLT transform.
+var TransformAlgorithmXSLT = "http://www.w3.org/TR/1999/REC-xslt-19991116"
+
+// TransformAlgorithmDSig2 is the URI for the XML Signature 2.0 transform,
+// which contains a dsig2:Selection.
+var TransformAlgorithmDSig2 = "http://www.w3.org/2010/xmldsig2#transform"
+
+// dsig2Namespace is the XML namespace of the elements introduced in XML
+// Signature 2.0.
+var dsig2Namespace = "http://www.w3.org/2010/xmldsig2#"
+
+// xsltNamespace is the XML namespace of XSLT stylesheets.
+var xsltNamespace = "http://www.w3.org/1999/XSL/Transform"
+
+// Transform contains information about one of the transforms applied to the
+// data of a Reference before it's digested.
+//
+// Verify does not evaluate transforms, other than those registered with
+// RegisterTransform. The enveloped signature and canonicalization transforms
+// are always applied, whether or not they're listed. XPath and XSLT transforms
+// are only accepted if they have no effect on their input; see the
+// documentation for Verify.
+type Transform struct {
+	XMLName   xml.Name `xml:"http://www.w3.org/2000/09/xmldsig# Transform"`
+	Algorithm string   `xml:"Algorithm,attr"`
+
+	// XPath is the expression of an XPath transform.
+	XPath string `xml:"http://www.w3.org/2000/09/xmldsig# XPath,omitempty"`
+
+	// Selection is the dsig2:Selection of an XML Signature 2.0 transform, or nil
+	// if there isn't one.
+	Selection *Selection `xml:"http://www.w3.org/2010/xmldsig2# Selection,omitempty"`
+
+	// InclusiveNamespaces is the InclusiveNamespaces parameter of an Exclusive
+	// Canonical XML transform, or nil if there isn't one.
+	InclusiveNamespaces *InclusiveNamespaces `xml:"http://www.w3.org/2001/10/xml-exc-c14n# InclusiveNamespaces,omitempty"`
+
+	// xsltIdentity is whether the transform's content is an XSLT identity
+	// stylesheet.
+	xsltIdentity bool
+
+	// ambiguous is whether the transform has more than one XPath expression or
+	// XSLT stylesheet.
+	ambiguous bool
+}
+
+// UnmarshalXML implements xml.Unmarshaler.
+//
+// XSLT stylesheets are not retained; Transform only records whether the
+// stylesheet is one that Verify accepts.
+func (t *Transform) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	t.XMLName = start.Name
+	for _, attr := range start.Attr {
+		if attr.Name.Space == "" && attr.Name.Local == "Algorithm" {
+			t.Algorithm = attr.Value
+		}
+	}
+
+	xpaths, stylesheets := 0, 0
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return err
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			switch {
+			case tok.Name.Space == namespace && tok.Name.Local == "XPath":
+				if err := d.DecodeElement(&t.XPath, &tok); err != nil {
+					return err
+				}
+
+				xpaths++
+				t.ambiguous = t.ambiguous || xpaths > 1
+			case tok.Name.Space == dsig2Namespace && tok.Name.Local == "Selection":
+				t.Selection = &Selection{}
+				if err := d.DecodeElement(t.Selection, &tok); err != nil {
+					return err
+				}
+			case tok.Name.Space == excC14NNamespace && tok.Name.Local == "InclusiveNamespaces":
+				t.InclusiveNamespaces = &InclusiveNamespaces{}
+				if err := d.DecodeElement(t.InclusiveNamespaces, &tok); err != nil {
+					return err
+				}
+			case tok.Name.Space == xsltNamespace:
+				identity, err := isXSLTIdentity(d, tok)
+				if err != nil {
+					return err
+				}
+
+				stylesheets++
+				t.xsltIdentity = identity
+				t.ambiguous = t.ambiguous || stylesheets > 1
+			default:
+				if err := d.Skip(); err != nil {
+					return err
+				}
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// check returns ErrUnsupportedTransform if t is an XPath or XSLT transform that
+// might change its input.
+func (t *Transform) check() error {
+	switch t.Algorithm {
+	case TransformAlgorithmXPath:
+		if t.ambiguous || !isXPathIdentity(t.XPath) {
+			return ErrUnsupportedTransform
+		}
+	case TransformAlgorithmXSLT:
+		if t.ambiguous || !t.xsltIdentity {
+			return ErrUnsupportedTransform
+		}
+	case TransformAlgorithmDSig2:
+		feature := "transform"
+		if t.Selection != nil {
+			feature = "selection " + t.Selection.Algorithm
+		}
+
+		return &DSig2UnsupportedError{Feature: feature}
+	}
+
+	return nil
+}
+
+// isXPathIdentity returns whether expr is an XPath filter expression that
+// selects every node.
+func isXPathIdentity(expr string) bool {
+	switch strings.Join(strings.Fields(expr), "") {
+	case "true()", "1":
+		return true
+	default:
+		return false
+	}
+}
+
+// xsltIdentityElement is one of the elements that make up the XSLT identity
+// stylesheet.
+type xsltIdentityElement struct {
+	locals  []string // the allowed local names of the element
+	attr    string   // the name of the element's required attribute, if any
+	pattern bool     // whether the attribute must be the pattern "@*|node()"
+}
+
+// xsltIdentity are the elements of the XSLT identity stylesheet, from
+// outermost to innermost:
+//
+//  <xsl:stylesheet version="1.0" xmlns:xsl="http://www.w3.org/1999/XSL/Transform">
+//    <xsl:template match="@*|node()">
+//      <xsl:copy>
+//        <xsl:apply-templates select="@*|node()" />
+//      </xsl:copy>
+//    </xsl:template>
+//  </xsl:stylesheet>
+//
+// Each element must appear exactly once.
+var xsltIdentity = []xsltIdentityElement{
+	{locals: []string{"stylesheet", "transform"}, attr: "version"},
+	{locals: []string{"template"}, attr: "match", pattern: true},
+	{locals: []string{"copy"}},
+	{locals: []string{"apply-templates"}, attr: "select", pattern: true},
+}
+
+// isXSLTIdentity reads the stylesheet that starts with start, and returns
+// whether it is exactly the XSLT identity stylesheet.
+//
+// Whitespace and comments are ignored. Any other content makes the stylesheet
+// not an identity stylesheet, even if it would in practice behave like one.
+func isXSLTIdentity(d *xml.Decoder, start xml.StartElement) (bool, error) {
+	ok := true
+	depth := 0
+	seen := make([]bool, len(xsltIdentity))
+	tok := xml.Token(start)
+
+	for {
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if depth >= len(xsltIdentity) || seen[depth] || !xsltIdentity[depth].matches(t) {
+				ok = false
+			} else {
+				seen[depth] = true
+			}
+
+			depth++
+		case xml.EndElement:
+			depth--
+			if depth == 0 {
+				for _, s := range seen {
+					ok = ok && s
+				}
+
+				return ok, nil
+			}
+		case xml.CharData:
+			if len(strings.TrimSpace(string(t))) != 0 {
+				ok = false
+			}
+		case xml.ProcInst, xml.Directive:
+			ok = false
+		}
+
+		var err error
+		tok, err = d.Token()
+		if err != nil {
+			return false, err
+		}
+	}
+}
+
+// matches returns whether t is the element that e describes.
+func (e *xsltIdentityElement) matches(t xml.StartElement) bool {
+	if t.Name.Space != xsltNamespace || !containsString(e.locals, t.Name.Local) {
+		return false
+	}
+
+	found := false
+	for _, attr := range t.Attr {
+		if attr.Name.Space == "xmlns" || (attr.Name.Space == "" && attr.Name.Local == "xmlns") {
+			continue
+		}
+
+		if attr.Name.Space != "" || attr.Name.Local != e.attr {
+			return false
+		}
+
+		if e.pattern && !isAttributesAndNodes(attr.Value) {
+			return false
+		}
+
+		found = true
+	}
+
+	return found || e.attr == ""
+}
+
+// isAttributesAndNodes returns whether pattern is "@*|node()", in either order
+// and ignoring whitespace.
+func isAttributesAndNodes(pattern string) bool {
+	switch strings.Join(strings.Fields(pattern), "") {
+	case "@*|node()", "node()|@*":
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,97 @@
+package dsig_test
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/dsig"
+)
+
+func TestVerify_Transforms(t *testing.T) {
+	identityXSLT := `<xsl:stylesheet version="1.0" xmlns:xsl="http://www.w3.org/1999/XSL/Transform">
+  <xsl:template match="@*|node()">
+    <!-- copy everything -->
+    <xsl:copy><xsl:apply-templates select="node() | @*" /></xsl:copy>
+  </xsl:template>
+</xsl:stylesheet>`
+
+	type testCase struct {
+		Transform string
+		Err       error
+	}
+
+	testCases := map[string]testCase{
+		"xpath true": testCase{
+			Transform: `<ds:Transform Algorithm="http://www.w3.org/TR/1999/REC-xpath-19991116"><ds:XPath> true() </ds:XPath></ds:Transform>`,
+			Err:       nil,
+		},
+		"xpath one": testCase{
+			Transform: `<ds:Transform Algorithm="http://www.w3.org/TR/1999/REC-xpath-19991116"><ds:XPath>1</ds:XPath></ds:Transform>`,
+			Err:       nil,
+		},
+		"xpath filter": testCase{
+			Transform: `<ds:Transform Algorithm="http://www.w3.org/TR/1999/REC-xpath-19991116"><ds:XPath>not(self::foo)</ds:XPath></ds:Transform>`,
+			Err:       dsig.ErrUnsupportedTransform,
+		},
+		"xpath missing": testCase{
+			Transform: `<ds:Transform Algorithm="http://www.w3.org/TR/1999/REC-xpath-19991116"></ds:Transform>`,
+			Err:       dsig.ErrUnsupportedTransform,
+		},
+		"xpath repeated": testCase{
+			Transform: `<ds:Transform Algorithm="http://www.w3.org/TR/1999/REC-xpath-19991116"><ds:XPath>not(self::foo)</ds:XPath><ds:XPath>true()</ds:XPath></ds:Transform>`,
+			Err:       dsig.ErrUnsupportedTransform,
+		},
+		"xslt identity": testCase{
+			Transform: `<ds:Transform Algorithm="http://www.w3.org/TR/1999/REC-xslt-19991116">` + identityXSLT + `</ds:Transform>`,
+			Err:       nil,
+		},
+		"xslt identity, transform element": testCase{
+			Transform: `<ds:Transform Algorithm="http://www.w3.org/TR/1999/REC-xslt-19991116">` + strings.ReplaceAll(identityXSLT, "xsl:stylesheet", "xsl:transform") + `</ds:Transform>`,
+			Err:       nil,
+		},
+		"xslt extra template": testCase{
+			Transform: `<ds:Transform Algorithm="http://www.w3.org/TR/1999/REC-xslt-19991116">` + strings.Replace(identityXSLT, "</xsl:stylesheet>", `<xsl:template match="foo" /></xsl:stylesheet>`, 1) + `</ds:Transform>`,
+			Err:       dsig.ErrUnsupportedTransform,
+		},
+		"xslt repeated copy": testCase{
+			Transform: `<ds:Transform Algorithm="http://www.w3.org/TR/1999/REC-xslt-19991116">` + strings.Replace(identityXSLT, "</xsl:copy>", `</xsl:copy><xsl:copy />`, 1) + `</ds:Transform>`,
+			Err:       dsig.ErrUnsupportedTransform,
+		},
+		"xslt literal output": testCase{
+			Transform: `<ds:Transform Algorithm="http://www.w3.org/TR/1999/REC-xslt-19991116">` + strings.Replace(identityXSLT, "<xsl:copy>", `<xsl:copy>injected`, 1) + `</ds:Transform>`,
+			Err:       dsig.ErrUnsupportedTransform,
+		},
+		"xslt different match": testCase{
+			Transform: `<ds:Transform Algorithm="http://www.w3.org/TR/1999/REC-xslt-19991116">` + strings.Replace(identityXSLT, `match="@*|node()"`, `match="node()"`, 1) + `</ds:Transform>`,
+			Err:       dsig.ErrUnsupportedTransform,
+		},
+		"xslt missing": testCase{
+			Transform: `<ds:Transform Algorithm="http://www.w3.org/TR/1999/REC-xslt-19991116"></ds:Transform>`,
+			Err:       dsig.ErrUnsupportedTransform,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			format := `<root><foo>xxx</foo>` + strings.Replace(testSignatureFormat, `</ds:Transforms>`, tt.Transform+`</ds:Transforms>`, 1) + `</root>`
+			doc := signTestDocument(t, format, base64.StdEncoding)
+			assert.Equal(t, tt.Err, verifyTestDocument(t, doc))
+		})
+	}
+}
+
+func TestTransform_Unmarshal(t *testing.T) {
+	var sig dsig.Signature
+	assert.NoError(t, xml.Unmarshal([]byte(fmt.Sprintf(testSignatureFormat, "", "")), &sig))
+
+	var algorithms []string
+	for _, transform := range sig.SignedInfo.Reference().Transforms {
+		algorithms = append(algorithms, transform.Algorithm)
+	}
+
+	assert.Equal(t, []string{dsig.TransformAlgorithmEnveloped, dsig.CanonicalizationMethodAlgorithmExclusive}, algorithms)
+}
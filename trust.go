@@ -0,0 +1,267 @@
+package dsig
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"github.com/ucarion/c14n"
+)
+
+// ErrUntrustedKey is returned by VerifyWithTrustStore if the trust store has no
+// key that could have created the signature.
+var ErrUntrustedKey = errors.New("dsig: no trusted key for signature")
+
+// TrustStoreLoadError is returned when trust material can't be loaded into a
+// TrustStore.
+type TrustStoreLoadError struct {
+	// Input identifies which input failed to load, such as "PEM block 2".
+	Input string
+
+	// Err is the reason the input failed to load.
+	Err error
+}
+
+func (e *TrustStoreLoadError) Error() string {
+	return fmt.Sprintf("dsig: loading %s: %v", e.Input, e.Err)
+}
+
+// Unwrap returns e.Err.
+func (e *TrustStoreLoadError) Unwrap() error {
+	return e.Err
+}
+
+// TrustStore is a set of keys that signatures can be verified against.
+//
+// A TrustStore can hold certificates, bare public keys, and certificate pools.
+// Certificates and public keys are trusted directly. A certificate pool is
+// used to decide whether to trust the certificates a signature carries in its
+// KeyInfo.
+//
+// The zero value of TrustStore is an empty store, ready to use.
+type TrustStore struct {
+	certs []*x509.Certificate
+	keys  []crypto.PublicKey
+	pools []*x509.CertPool
+}
+
+// AddCertificate adds cert to t. The certificate's public key will be trusted.
+//
+// The certificate's validity period is not checked, as with Verify.
+func (t *TrustStore) AddCertificate(cert *x509.Certificate) {
+	t.certs = append(t.certs, cert)
+}
+
+// AddPublicKey adds key to t. The key will be trusted.
+func (t *TrustStore) AddPublicKey(key crypto.PublicKey) {
+	t.keys = append(t.keys, key)
+}
+
+// AddCertPool adds pool to t. Certificates in a signature's KeyInfo will be
+// trusted if they chain up to pool, as checked by x509.Certificate's Verify at
+// the time of verification.
+func (t *TrustStore) AddCertPool(pool *x509.CertPool) {
+	t.pools = append(t.pools, pool)
+}
+
+// AddPEM adds the certificates and public keys in a PEM bundle to t.
+//
+// data may contain any number of "CERTIFICATE" and "PUBLIC KEY" blocks. If any
+// block can't be loaded, AddPEM returns a *TrustStoreLoadError identifying the
+// block, and none of the bundle is added to t.
+func (t *TrustStore) AddPEM(data []byte) error {
+	var certs []*x509.Certificate
+	var keys []crypto.PublicKey
+
+	for i := 1; ; i++ {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+
+		input := fmt.Sprintf("PEM block %d", i)
+		switch block.Type {
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return &TrustStoreLoadError{Input: input, Err: err}
+			}
+
+			certs = append(certs, cert)
+		case "PUBLIC KEY":
+			key, err := x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				return &TrustStoreLoadError{Input: input, Err: err}
+			}
+
+			keys = append(keys, key)
+		default:
+			return &TrustStoreLoadError{Input: input, Err: fmt.Errorf("unsupported PEM block type %q", block.Type)}
+		}
+	}
+
+	if len(certs) == 0 && len(keys) == 0 {
+		return &TrustStoreLoadError{Input: "PEM", Err: errors.New("no PEM blocks found")}
+	}
+
+	t.certs = append(t.certs, certs...)
+	t.keys = append(t.keys, keys...)
+	return nil
+}
+
+// AddDER adds a DER-encoded certificate or PKIX public key to t. If der is
+// neither, AddDER returns a *TrustStoreLoadError.
+func (t *TrustStore) AddDER(der []byte) error {
+	if cert, err := x509.ParseCertificate(der); err == nil {
+		t.certs = append(t.certs, cert)
+		return nil
+	}
+
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return &TrustStoreLoadError{Input: "DER", Err: errors.New("not a certificate or public key")}
+	}
+
+	t.keys = append(t.keys, key)
+	return nil
+}
+
+// Len returns the number of certificates, public keys, and certificate pools in
+// t.
+func (t *TrustStore) Len() int {
+	return len(t.certs) + len(t.keys) + len(t.pools)
+}
+
+// Fingerprints returns the hex-encoded SHA-256 fingerprints of the certificates
+// and public keys in t, in the order they were added: first certificates, then
+// public keys.
+//
+// A certificate's fingerprint is of its DER encoding, as with "openssl x509
+// -fingerprint -sha256". A public key's fingerprint is of its PKIX DER
+// encoding. Certificate pools don't have fingerprints.
+func (t *TrustStore) Fingerprints() []string {
+	var fingerprints []string
+	for _, cert := range t.certs {
+		sum := sha256.Sum256(cert.Raw)
+		fingerprints = append(fingerprints, hex.EncodeToString(sum[:]))
+	}
+
+	for _, key := range t.keys {
+		der, err := x509.MarshalPKIXPublicKey(key)
+		if err != nil {
+			fingerprints = append(fingerprints, "")
+			continue
+		}
+
+		sum := sha256.Sum256(der)
+		fingerprints = append(fingerprints, hex.EncodeToString(sum[:]))
+	}
+
+	return fingerprints
+}
+
+// trustedKey is a key from a TrustStore, along with the certificate it came
+// from, if any.
+type trustedKey struct {
+	publicKey crypto.PublicKey
+	cert      *x509.Certificate
+}
+
+// trustedKeys returns the keys in t that may be used to verify a signature with
+// the given KeyInfo, which may be nil.
+func (t *TrustStore) trustedKeys(keyInfo *KeyInfo) []trustedKey {
+	var keys []trustedKey
+	for _, cert := range t.certs {
+		keys = append(keys, trustedKey{publicKey: cert.PublicKey, cert: cert})
+	}
+
+	for _, key := range t.keys {
+		keys = append(keys, trustedKey{publicKey: key})
+	}
+
+	if keyInfo == nil || len(t.pools) == 0 {
+		return keys
+	}
+
+	certs := keyInfo.certificates()
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs {
+		intermediates.AddCert(cert)
+	}
+
+	for _, cert := range certs {
+		for _, pool := range t.pools {
+			_, err := cert.Verify(x509.VerifyOptions{
+				Roots:         pool,
+				Intermediates: intermediates,
+				KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+			})
+
+			if err == nil {
+				keys = append(keys, trustedKey{publicKey: cert.PublicKey, cert: cert})
+				break
+			}
+		}
+	}
+
+	return keys
+}
+
+// VerifyWithTrustStore is like VerifyWithResult, but verifies s against the
+// keys in a TrustStore instead of a single certificate.
+//
+// The signature is valid if any trusted key verifies it. If ts has no key that
+// could have created the signature, VerifyWithTrustStore returns
+// ErrUntrustedKey. If no key verifies the signature, the error from the first
+// key tried is returned; keys are tried in the order they were added, with
+// certificates from KeyInfo last.
+func (s *Signature) VerifyWithTrustStore(ts *TrustStore, r c14n.RawTokenReader, opts VerifyOptions) (*VerifyResult, error) {
+	result, _, err := s.verifyWithTrustStore(ts, r, opts)
+	return result, err
+}
+
+// verifyWithTrustStore does the work of VerifyWithTrustStore, and additionally
+// returns the key that verified s.
+func (s *Signature) verifyWithTrustStore(ts *TrustStore, r c14n.RawTokenReader, opts VerifyOptions) (*VerifyResult, *trustedKey, error) {
+	defer opts.startTimer()()
+
+	result, toVerify, err := s.verifyDigest(r, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keys := ts.trustedKeys(s.KeyInfo)
+	if len(keys) == 0 {
+		return nil, nil, ErrUntrustedKey
+	}
+
+	var firstErr error
+	for i := range keys {
+		err := keys[i].verify(s, toVerify, opts)
+		if err == nil {
+			return result, &keys[i], nil
+		}
+
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return nil, nil, firstErr
+}
+
+// verify checks that s is a valid signature of toVerify by k.
+func (k *trustedKey) verify(s *Signature, toVerify []byte, opts VerifyOptions) error {
+	if opts.QCStatements != nil {
+		if err := opts.QCStatements.check(k.cert); err != nil {
+			return err
+		}
+	}
+
+	return s.verifySignature(k.publicKey, toVerify, opts)
+}
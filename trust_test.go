@@ -0,0 +1,176 @@
+package dsig_test
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/dsig"
+)
+
+func TestTrustStore_Load(t *testing.T) {
+	_, otherCert := generateTestCert()
+	otherKeyDER, err := x509.MarshalPKIXPublicKey(otherCert.PublicKey)
+	assert.NoError(t, err)
+
+	bundle := append(
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: testCert.Raw}),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: otherKeyDER})...,
+	)
+
+	var ts dsig.TrustStore
+	assert.NoError(t, ts.AddPEM(bundle))
+	assert.NoError(t, ts.AddDER(otherCert.Raw))
+	assert.NoError(t, ts.AddDER(otherKeyDER))
+	ts.AddCertificate(testCert)
+	ts.AddPublicKey(testCert.PublicKey)
+	ts.AddCertPool(x509.NewCertPool())
+
+	certFingerprint := sha256.Sum256(testCert.Raw)
+	otherCertFingerprint := sha256.Sum256(otherCert.Raw)
+	otherKeyFingerprint := sha256.Sum256(otherKeyDER)
+	testKeyDER, err := x509.MarshalPKIXPublicKey(testCert.PublicKey)
+	assert.NoError(t, err)
+	testKeyFingerprint := sha256.Sum256(testKeyDER)
+
+	assert.Equal(t, 7, ts.Len())
+	assert.Equal(t, []string{
+		hex.EncodeToString(certFingerprint[:]),
+		hex.EncodeToString(otherCertFingerprint[:]),
+		hex.EncodeToString(certFingerprint[:]),
+		hex.EncodeToString(otherKeyFingerprint[:]),
+		hex.EncodeToString(otherKeyFingerprint[:]),
+		hex.EncodeToString(testKeyFingerprint[:]),
+	}, ts.Fingerprints())
+}
+
+func TestTrustStore_LoadErrors(t *testing.T) {
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: testCert.Raw})
+
+	type testCase struct {
+		Load  func(ts *dsig.TrustStore) error
+		Input string
+	}
+
+	testCases := map[string]testCase{
+		"no pem blocks": testCase{
+			Load:  func(ts *dsig.TrustStore) error { return ts.AddPEM([]byte("not pem")) },
+			Input: "PEM",
+		},
+		"bad certificate in bundle": testCase{
+			Load: func(ts *dsig.TrustStore) error {
+				return ts.AddPEM(append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("bad")})...))
+			},
+			Input: "PEM block 2",
+		},
+		"unsupported block type": testCase{
+			Load: func(ts *dsig.TrustStore) error {
+				return ts.AddPEM(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: []byte("secret")}))
+			},
+			Input: "PEM block 1",
+		},
+		"bad der": testCase{
+			Load:  func(ts *dsig.TrustStore) error { return ts.AddDER([]byte("bad")) },
+			Input: "DER",
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var ts dsig.TrustStore
+			err := tt.Load(&ts)
+
+			var loadErr *dsig.TrustStoreLoadError
+			assert.True(t, errors.As(err, &loadErr))
+			assert.Equal(t, tt.Input, loadErr.Input)
+			assert.Equal(t, 0, ts.Len())
+		})
+	}
+}
+
+func TestVerifyWithTrustStore(t *testing.T) {
+	_, otherCert := generateTestCert()
+	pool := x509.NewCertPool()
+	pool.AddCert(testCert)
+
+	keyInfo := `<ds:KeyInfo><ds:X509Data><ds:X509Certificate>` + base64.StdEncoding.EncodeToString(testCert.Raw) + `</ds:X509Certificate></ds:X509Data></ds:KeyInfo></ds:Signature>`
+	withKeyInfo := strings.Replace(testSignatureFormat, `</ds:Signature>`, keyInfo, 1)
+
+	type testCase struct {
+		Format string
+		Load   func(ts *dsig.TrustStore)
+		Err    error
+	}
+
+	testCases := map[string]testCase{
+		"empty store": testCase{
+			Format: testSignatureFormat,
+			Load:   func(ts *dsig.TrustStore) {},
+			Err:    dsig.ErrUntrustedKey,
+		},
+		"trusted certificate": testCase{
+			Format: testSignatureFormat,
+			Load:   func(ts *dsig.TrustStore) { ts.AddCertificate(testCert) },
+			Err:    nil,
+		},
+		"trusted public key": testCase{
+			Format: testSignatureFormat,
+			Load:   func(ts *dsig.TrustStore) { ts.AddPublicKey(testCert.PublicKey) },
+			Err:    nil,
+		},
+		"trusted key among others": testCase{
+			Format: testSignatureFormat,
+			Load: func(ts *dsig.TrustStore) {
+				ts.AddCertificate(otherCert)
+				ts.AddCertificate(testCert)
+			},
+			Err: nil,
+		},
+		"only other keys": testCase{
+			Format: testSignatureFormat,
+			Load:   func(ts *dsig.TrustStore) { ts.AddCertificate(otherCert) },
+			Err:    rsa.ErrVerification,
+		},
+		"pool without key info": testCase{
+			Format: testSignatureFormat,
+			Load:   func(ts *dsig.TrustStore) { ts.AddCertPool(pool) },
+			Err:    dsig.ErrUntrustedKey,
+		},
+		"pool trusting key info": testCase{
+			Format: withKeyInfo,
+			Load:   func(ts *dsig.TrustStore) { ts.AddCertPool(pool) },
+			Err:    nil,
+		},
+		"pool not trusting key info": testCase{
+			Format: withKeyInfo,
+			Load:   func(ts *dsig.TrustStore) { ts.AddCertPool(x509.NewCertPool()) },
+			Err:    dsig.ErrUntrustedKey,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			doc := signTestDocument(t, `<root><foo>xxx</foo>`+tt.Format+`</root>`, base64.StdEncoding)
+
+			var payload struct {
+				Signature dsig.Signature `xml:"http://www.w3.org/2000/09/xmldsig# Signature"`
+			}
+
+			assert.NoError(t, xml.Unmarshal([]byte(doc), &payload))
+
+			var ts dsig.TrustStore
+			tt.Load(&ts)
+
+			_, err := payload.Signature.VerifyWithTrustStore(&ts, xml.NewDecoder(strings.NewReader(doc)), dsig.VerifyOptions{})
+			assert.Equal(t, tt.Err, err)
+		})
+	}
+}
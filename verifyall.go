@@ -0,0 +1,242 @@
+package dsig
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/xml"
+	"io"
+	"strings"
+
+	"github.com/ucarion/dsig/internal/sigsplit"
+	"github.com/ucarion/dsig/internal/stack"
+)
+
+// SignatureResult is the outcome of verifying one of the signatures in a
+// document, as returned by VerifyAll.
+type SignatureResult struct {
+	// Path is the local names of the elements from the root of the document
+	// down to the ds:Signature, in the same "a>b>c" syntax as VerifyField.
+	Path string
+
+	// Index is the position of the ds:Signature among all of the ds:Signature
+	// elements in the document, in document order, starting from zero. It
+	// tells apart signatures that have the same Path.
+	Index int
+
+	// Signature is the signature that was found, or nil if it couldn't be
+	// decoded.
+	Signature *Signature
+
+	// ID is the value of the ds:Signature element's Id attribute, if any.
+	ID string
+
+	// ReferenceURI is the URI of the signature's Reference, which describes
+	// what the signature covers. The empty string means the signature covers
+	// the whole of the ds:Signature element's parent.
+	ReferenceURI string
+
+	// Certificate is the certificate that verified the signature, if the
+	// signature was valid and the key that verified it came from a certificate.
+	Certificate *x509.Certificate
+
+	// Result describes the signature, if it was valid.
+	Result *VerifyResult
+
+	// Err is why the signature was found to be invalid, or nil if it was valid.
+	Err error
+}
+
+// VerifyAll finds every ds:Signature in data, verifies each of them, and
+// returns the outcome for each signature.
+//
+// Each signature is verified as if its parent element were the whole
+// document, so each ds:Signature must be enveloped by the element it signs,
+// as is the case in SAML. Signatures that are the root element are reported
+// with ErrSignatureNotFound.
+//
+// If ts is non-nil, each signature is verified with VerifyWithTrustStore. If ts
+// is nil, each signature is instead verified with the first certificate in its
+// own KeyInfo, and signatures without one are reported with
+// ErrMissingKeyInfo. Such a signature only shows that the document wasn't
+// changed after it was signed by whoever holds the certificate's key; anyone
+// can produce a certificate, so it's up to the caller to decide whether to
+// trust the Certificate in each SignatureResult.
+//
+// An invalid signature does not stop VerifyAll from verifying the others. The
+// returned error is non-nil only if data can't be read at all, in which case
+// no results are returned. data is read with the default limits of
+// NewDecoder.
+func VerifyAll(data []byte, ts *TrustStore, opts VerifyOptions) ([]SignatureResult, error) {
+	tokens, found, err := findSignatures(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []SignatureResult
+	for i, f := range found {
+		result := SignatureResult{Path: f.path, Index: i}
+		if f.parent < 0 {
+			result.Err = ErrSignatureNotFound
+			results = append(results, result)
+			continue
+		}
+
+		var s Signature
+		sigTokens := recorderReplay(subtree(tokens, f.start, f.scope))
+		if err := xml.NewTokenDecoder(&sigTokens).Decode(&s); err != nil {
+			result.Err = err
+			results = append(results, result)
+			continue
+		}
+
+		result.Signature = &s
+		result.ID = s.ID
+		result.ReferenceURI = s.SignedInfo.Reference().URI
+
+		parentTokens := recorderReplay(subtree(tokens, f.parent, f.parentScope))
+		if ts != nil {
+			var key *trustedKey
+			result.Result, key, result.Err = s.verifyWithTrustStore(ts, &parentTokens, opts)
+			if key != nil {
+				result.Certificate = key.cert
+			}
+		} else {
+			var cert *x509.Certificate
+			if s.KeyInfo != nil {
+				if certs := s.KeyInfo.certificates(); len(certs) > 0 {
+					cert = certs[0]
+				}
+			}
+
+			if cert == nil {
+				result.Err = ErrMissingKeyInfo
+			} else {
+				result.Result, result.Err = s.VerifyWithResult(cert, &parentTokens, opts)
+				if result.Err == nil {
+					result.Certificate = cert
+				}
+			}
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// foundSignature is a ds:Signature found by findSignatures.
+type foundSignature struct {
+	// path is the path to the ds:Signature, in VerifyField syntax.
+	path string
+
+	// start is the index of the ds:Signature start element, and scope is the
+	// namespaces in scope where it appears.
+	start int
+	scope map[string]string
+
+	// parent is the index of the start element of the ds:Signature's parent,
+	// or -1 if the ds:Signature has no parent. parentScope is the namespaces in
+	// scope where the parent appears.
+	parent      int
+	parentScope map[string]string
+}
+
+// findSignatures reads all of the raw tokens in data, and finds the
+// ds:Signature elements among them.
+func findSignatures(data []byte) ([]xml.Token, []foundSignature, error) {
+	var tokens []xml.Token
+	var found []foundSignature
+
+	var path []string
+	var starts []int
+	s := stack.Stack{}
+
+	decoder := NewDecoder(bytes.NewReader(data))
+	for {
+		t, err := decoder.RawToken()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+
+			return nil, nil, err
+		}
+
+		t = xml.CopyToken(t)
+		tokens = append(tokens, t)
+
+		switch t := t.(type) {
+		case xml.StartElement:
+			names := map[string]string{}
+			for _, attr := range t.Attr {
+				if attr.Name.Space == "xmlns" {
+					names[attr.Name.Local] = attr.Value
+				} else if attr.Name.Space == "" && attr.Name.Local == "xmlns" {
+					names[""] = attr.Value
+				}
+			}
+
+			s.Push(names)
+			path = append(path, t.Name.Local)
+
+			if s.Get(t.Name.Space) == namespace && t.Name.Local == "Signature" {
+				// The namespaces in scope where an element appears are those of the
+				// elements above it in the stack.
+				above := s[:len(s)-1]
+				f := foundSignature{
+					path:   strings.Join(path, ">"),
+					start:  len(tokens) - 1,
+					scope:  above.InScope(),
+					parent: -1,
+				}
+
+				if len(starts) > 0 {
+					aboveParent := s[:len(s)-2]
+					f.parent = starts[len(starts)-1]
+					f.parentScope = aboveParent.InScope()
+				}
+
+				found = append(found, f)
+			}
+
+			starts = append(starts, len(tokens)-1)
+		case xml.EndElement:
+			// RawToken doesn't check that elements are balanced.
+			if len(starts) == 0 {
+				return nil, nil, &xml.SyntaxError{Msg: "unexpected end element </" + t.Name.Local + ">"}
+			}
+
+			s.Pop()
+			path = path[:len(path)-1]
+			starts = starts[:len(starts)-1]
+		}
+	}
+
+	return tokens, found, nil
+}
+
+// subtree returns the element that starts at tokens[i], with the namespaces in
+// scope declared on its start element.
+func subtree(tokens []xml.Token, i int, scope map[string]string) []xml.Token {
+	start := tokens[i].(xml.StartElement).Copy()
+	sigsplit.InjectNamespaces(&start, scope)
+
+	out := []xml.Token{start}
+	depth := 1
+	for _, t := range tokens[i+1:] {
+		if depth == 0 {
+			break
+		}
+
+		switch t.(type) {
+		case xml.StartElement:
+			depth++
+		case xml.EndElement:
+			depth--
+		}
+
+		out = append(out, t)
+	}
+
+	return out
+}
@@ -0,0 +1,128 @@
+package dsig_test
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/dsig"
+)
+
+func TestVerifyAll(t *testing.T) {
+	// The assertion is signed on its own, and then put in a response that
+	// declares the assertion's namespace on its behalf.
+	assertion := signTestDocument(t, `<saml:Assertion xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="a"><saml:Issuer>idp</saml:Issuer>`+testSignatureFormat+`</saml:Assertion>`, base64.StdEncoding)
+	assertion = strings.Replace(assertion, ` xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion"`, "", 1)
+
+	broken := `<Broken><foo>yyy</foo>` + strings.Replace(fmt.Sprintf(testSignatureFormat, "AAAA", "AAAA"), "<ds:Signature ", `<ds:Signature Id="broken" `, 1) + `</Broken>`
+
+	format := `<Response xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion">` + strings.ReplaceAll(assertion+broken, "%", "%%") + testSignatureFormat + `</Response>`
+	doc := signTestDocument(t, format, base64.StdEncoding)
+
+	var ts dsig.TrustStore
+	ts.AddCertificate(testCert)
+
+	results, err := dsig.VerifyAll([]byte(doc), &ts, dsig.VerifyOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, results, 3)
+
+	type summary struct {
+		Path        string
+		Index       int
+		ID          string
+		Certificate bool
+		Valid       bool
+		Err         error
+	}
+
+	var summaries []summary
+	for _, r := range results {
+		assert.NotNil(t, r.Signature)
+		assert.Equal(t, "", r.ReferenceURI)
+		summaries = append(summaries, summary{
+			Path:        r.Path,
+			Index:       r.Index,
+			ID:          r.ID,
+			Certificate: r.Certificate == testCert,
+			Valid:       r.Result != nil,
+			Err:         r.Err,
+		})
+	}
+
+	assert.Equal(t, []summary{
+		summary{Path: "Response>Assertion>Signature", Index: 0, Certificate: true, Valid: true},
+		summary{Path: "Response>Broken>Signature", Index: 1, ID: "broken", Err: dsig.ErrBadDigest},
+		summary{Path: "Response>Signature", Index: 2, Certificate: true, Valid: true},
+	}, summaries)
+}
+
+func TestVerifyAll_KeyInfo(t *testing.T) {
+	keyInfo := `<ds:KeyInfo><ds:X509Data><ds:X509Certificate>` + base64.StdEncoding.EncodeToString(testCert.Raw) + `</ds:X509Certificate></ds:X509Data></ds:KeyInfo></ds:Signature>`
+	withKeyInfo := strings.Replace(testSignatureFormat, `</ds:Signature>`, keyInfo, 1)
+
+	type testCase struct {
+		Format string
+		Err    error
+	}
+
+	testCases := map[string]testCase{
+		"with key info": testCase{
+			Format: `<root><foo>xxx</foo>` + withKeyInfo + `</root>`,
+			Err:    nil,
+		},
+		"without key info": testCase{
+			Format: `<root><foo>xxx</foo>` + testSignatureFormat + `</root>`,
+			Err:    dsig.ErrMissingKeyInfo,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			doc := signTestDocument(t, tt.Format, base64.StdEncoding)
+
+			results, err := dsig.VerifyAll([]byte(doc), nil, dsig.VerifyOptions{})
+			assert.NoError(t, err)
+			assert.Len(t, results, 1)
+			assert.Equal(t, tt.Err, results[0].Err)
+
+			if tt.Err == nil {
+				assert.True(t, testCert.Equal(results[0].Certificate))
+			}
+		})
+	}
+}
+
+func TestVerifyAll_Malformed(t *testing.T) {
+	type testCase struct {
+		Doc string
+	}
+
+	testCases := map[string]testCase{
+		"unbalanced": testCase{Doc: `<root></foo></root></root>`},
+		"syntax":     testCase{Doc: `<root`},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			results, err := dsig.VerifyAll([]byte(tt.Doc), nil, dsig.VerifyOptions{})
+			assert.Nil(t, results)
+
+			var syntaxErr *xml.SyntaxError
+			assert.True(t, errors.As(err, &syntaxErr))
+		})
+	}
+}
+
+func TestVerifyAll_RootSignature(t *testing.T) {
+	doc := fmt.Sprintf(testSignatureFormat, "AAAA", "AAAA")
+
+	results, err := dsig.VerifyAll([]byte(doc), nil, dsig.VerifyOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []dsig.SignatureResult{
+		dsig.SignatureResult{Path: "Signature", Index: 0, Err: dsig.ErrSignatureNotFound},
+	}, results)
+}
@@ -0,0 +1,107 @@
+package dsig
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+// wrapBase64 inserts a newline into s, a base64 string, after every n
+// characters. If n isn't positive, s is returned unchanged.
+func wrapBase64(s string, n int) string {
+	if n <= 0 || len(s) <= n {
+		return s
+	}
+
+	var b strings.Builder
+	for len(s) > n {
+		b.WriteString(s[:n])
+		b.WriteByte('\n')
+		s = s[n:]
+	}
+
+	b.WriteString(s)
+	return b.String()
+}
+
+// base64Elements are the local names of the elements whose content
+// SignOptions.Base64LineLength wraps.
+var base64Elements = map[string]bool{
+	"SignatureValue":  true,
+	"DigestValue":     true,
+	"X509Certificate": true,
+}
+
+// unescapeLineBreaks rewrites data, a marshaled Signature, replacing the
+// character references that xml.Encoder writes for newlines with literal
+// newlines, in the text of the elements in base64Elements.
+//
+// The two are equivalent to an XML parser, but parsers that read base64 line
+// by line only understand the latter. Objects are left alone, since their
+// content isn't written by xml.Encoder.
+func unescapeLineBreaks(data []byte) ([]byte, error) {
+	var out bytes.Buffer
+	var names []string
+	objects := 0
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		offset := decoder.InputOffset()
+		t, err := decoder.RawToken()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+
+			return nil, err
+		}
+
+		raw := data[offset:decoder.InputOffset()]
+
+		switch t := t.(type) {
+		case xml.StartElement:
+			names = append(names, t.Name.Local)
+			if t.Name.Local == "Object" {
+				objects++
+			}
+		case xml.EndElement:
+			names = names[:len(names)-1]
+			if t.Name.Local == "Object" {
+				objects--
+			}
+		case xml.CharData:
+			if objects == 0 && len(names) > 0 && base64Elements[names[len(names)-1]] {
+				raw = bytes.ReplaceAll(raw, []byte("&#xA;"), []byte("\n"))
+			}
+		}
+
+		out.Write(raw)
+	}
+
+	return out.Bytes(), nil
+}
+
+// base64LineLength returns the length that s, a base64 value, was wrapped at
+// by wrapBase64, or zero if s isn't wrapped that way.
+func base64LineLength(s string) int {
+	lines := strings.Split(s, "\n")
+	if len(lines) == 1 {
+		return 0
+	}
+
+	// Every line is as long as the first, except the last, which may be
+	// shorter.
+	n := len(lines[0])
+	for i, line := range lines {
+		if line == "" || strings.TrimSpace(line) != line || len(line) > n {
+			return 0
+		}
+
+		if i < len(lines)-1 && len(line) != n {
+			return 0
+		}
+	}
+
+	return n
+}
@@ -0,0 +1,122 @@
+package dsig_test
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/dsig"
+	"github.com/ucarion/dsig/internal/canon"
+)
+
+// base64Element matches the elements whose text Base64LineLength wraps.
+var base64Element = regexp.MustCompile(`(?s)<(?:\w+:)?(SignatureValue|DigestValue|X509Certificate)(?:\s[^>]*)?>(.*?)</`)
+
+func TestSignOptions_Base64LineLength(t *testing.T) {
+	type doc struct {
+		XMLName   xml.Name `xml:"urn:example Doc"`
+		Foo       string   `xml:"urn:example Foo"`
+		Signature dsig.Signature
+	}
+
+	type testCase struct {
+		Prefix     string
+		LineLength int
+	}
+
+	testCases := map[string]testCase{
+		"unwrapped": testCase{
+			LineLength: 0,
+		},
+		"76 columns": testCase{
+			LineLength: 76,
+		},
+		"16 columns": testCase{
+			LineLength: 16,
+		},
+		"1 column": testCase{
+			LineLength: 1,
+		},
+		"longer than any line": testCase{
+			LineLength: 4096,
+		},
+		"76 columns with prefix": testCase{
+			Prefix:     "ds",
+			LineLength: 76,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			s, err := dsig.NewSignature(dsig.SignOptions{Certificate: testCert, Prefix: tt.Prefix, Base64LineLength: tt.LineLength})
+			assert.NoError(t, err)
+
+			d := doc{Foo: "xxx", Signature: *s}
+			unsigned, err := xml.Marshal(d)
+			assert.NoError(t, err)
+			assert.NoError(t, d.Signature.Sign(testKey, xml.NewDecoder(bytes.NewReader(unsigned))))
+
+			signed, err := xml.Marshal(d)
+			assert.NoError(t, err)
+			assert.NotContains(t, string(signed), "&#xA;")
+
+			matches := base64Element.FindAllStringSubmatch(string(signed), -1)
+			assert.Len(t, matches, 3)
+			for _, m := range matches {
+				lines := strings.Split(m[2], "\n")
+				if tt.LineLength == 0 || len(strings.Join(lines, "")) <= tt.LineLength {
+					assert.Len(t, lines, 1, m[1])
+				}
+
+				for i, line := range lines {
+					if tt.LineLength > 0 && i < len(lines)-1 {
+						assert.Len(t, line, tt.LineLength, m[1])
+					}
+				}
+			}
+
+			var decoded doc
+			assert.NoError(t, xml.Unmarshal(signed, &decoded))
+			assert.Equal(t, d.Signature.SignatureValue.Value, decoded.Signature.SignatureValue.Value)
+			assert.NoError(t, decoded.Signature.Verify(testCert, xml.NewDecoder(bytes.NewReader(signed))))
+		})
+	}
+}
+
+func TestSignOptions_Base64LineLengthDetached(t *testing.T) {
+	digest := sha256.Sum256([]byte("xxx"))
+	s, err := dsig.SignDetachedDigest(testKey, "https://example.com/xxx", digest[:], dsig.SignOptions{Base64LineLength: 16})
+	assert.NoError(t, err)
+
+	data, err := xml.Marshal(s)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "&#xA;")
+
+	for _, m := range base64Element.FindAllStringSubmatch(string(data), -1) {
+		assert.Contains(t, m[2], "\n", m[1])
+	}
+
+	// The signature is over ds:SignedInfo as it appears, line breaks and all, in
+	// the marshaled signature.
+	start := strings.Index(string(data), "<SignedInfo")
+	end := strings.Index(string(data), "</SignedInfo>") + len("</SignedInfo>")
+	signedInfo, err := canon.Canonicalize(xml.NewDecoder(strings.NewReader(string(data[start:end]))), canon.Options{})
+	assert.NoError(t, err)
+	assert.Contains(t, string(signedInfo), "\n")
+
+	var decoded dsig.Signature
+	assert.NoError(t, xml.Unmarshal(data, &decoded))
+
+	signature, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(decoded.SignatureValue.Value), ""))
+	assert.NoError(t, err)
+
+	hashed := sha256.Sum256(signedInfo)
+	assert.NoError(t, rsa.VerifyPKCS1v15(&testKey.PublicKey, crypto.SHA256, hashed[:], signature))
+}
@@ -0,0 +1,66 @@
+package dsig
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+)
+
+// ErrNoX509DigestMatch is returned by SelectCertificate if none of the
+// candidate certificates match a dsig11:X509Digest in the signature's KeyInfo,
+// including if the signature has no dsig11:X509Digest at all.
+var ErrNoX509DigestMatch = errors.New("dsig: no certificate matches X509Digest")
+
+// X509Digest is a digest of the DER encoding of a certificate, identifying the
+// certificate that a Signature was created with. It's an element in the XML
+// Signature 1.1 namespace, "http://www.w3.org/2009/xmldsig11#".
+type X509Digest struct {
+	// Algorithm is the digest algorithm, as a DigestMethodAlgorithm value.
+	Algorithm string `xml:"Algorithm,attr"`
+
+	// Value is the base64-encoded digest.
+	Value string `xml:",chardata"`
+}
+
+// SelectCertificate returns the first of candidates whose digest matches a
+// dsig11:X509Digest in the KeyInfo of s. The X509Digest elements are tried in
+// the order they appear.
+//
+// This is how a signature identifies which of several pre-shared certificates
+// it was created with. SelectCertificate does not verify s; pass the returned
+// certificate to Verify to do that. Since the candidates come from the caller,
+// the certificate can be trusted as much as the candidates are.
+//
+// Each X509Digest's Algorithm must be one of the DigestMethodAlgorithm values.
+// If it isn't, SelectCertificate returns ErrBadDigestAlgorithm. If no candidate
+// matches, SelectCertificate returns ErrNoX509DigestMatch.
+func (s *Signature) SelectCertificate(candidates []*x509.Certificate) (*x509.Certificate, error) {
+	if s.KeyInfo == nil {
+		return nil, ErrNoX509DigestMatch
+	}
+
+	for _, data := range s.KeyInfo.X509Data {
+		for _, digest := range data.X509Digests {
+			method := DigestMethod{Algorithm: digest.Algorithm}
+			digestHash, err := method.hash()
+			if err != nil {
+				return nil, err
+			}
+
+			expected, err := decodeBase64(digest.Value)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, cert := range candidates {
+				h := digestHash.New()
+				h.Write(cert.Raw)
+				if bytes.Equal(expected, h.Sum(nil)) {
+					return cert, nil
+				}
+			}
+		}
+	}
+
+	return nil, ErrNoX509DigestMatch
+}
@@ -0,0 +1,86 @@
+package dsig_test
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/dsig"
+)
+
+func TestSignature_SelectCertificate(t *testing.T) {
+	_, otherCert := generateTestCert()
+
+	sha256Digest := sha256.Sum256(testCert.Raw)
+	sha1Digest := sha1.Sum(testCert.Raw)
+
+	x509Digest := func(algorithm string, digest []byte) string {
+		return `<dsig11:X509Digest xmlns:dsig11="http://www.w3.org/2009/xmldsig11#" Algorithm="` + algorithm + `">` + base64.StdEncoding.EncodeToString(digest) + `</dsig11:X509Digest>`
+	}
+
+	type testCase struct {
+		KeyInfo    string
+		Candidates []*x509.Certificate
+		Cert       *x509.Certificate
+		Err        error
+	}
+
+	testCases := map[string]testCase{
+		"sha256": testCase{
+			KeyInfo:    `<ds:KeyInfo><ds:X509Data>` + x509Digest(dsig.DigestMethodAlgorithmSHA256, sha256Digest[:]) + `</ds:X509Data></ds:KeyInfo>`,
+			Candidates: []*x509.Certificate{otherCert, testCert},
+			Cert:       testCert,
+		},
+		"sha1": testCase{
+			KeyInfo:    `<ds:KeyInfo><ds:X509Data>` + x509Digest(dsig.DigestMethodAlgorithmSHA1, sha1Digest[:]) + `</ds:X509Data></ds:KeyInfo>`,
+			Candidates: []*x509.Certificate{otherCert, testCert},
+			Cert:       testCert,
+		},
+		"no match": testCase{
+			KeyInfo:    `<ds:KeyInfo><ds:X509Data>` + x509Digest(dsig.DigestMethodAlgorithmSHA256, sha256Digest[:]) + `</ds:X509Data></ds:KeyInfo>`,
+			Candidates: []*x509.Certificate{otherCert},
+			Err:        dsig.ErrNoX509DigestMatch,
+		},
+		"wrong namespace": testCase{
+			KeyInfo:    `<ds:KeyInfo><ds:X509Data><ds:X509Digest Algorithm="` + dsig.DigestMethodAlgorithmSHA256 + `">` + base64.StdEncoding.EncodeToString(sha256Digest[:]) + `</ds:X509Digest></ds:X509Data></ds:KeyInfo>`,
+			Candidates: []*x509.Certificate{testCert},
+			Err:        dsig.ErrNoX509DigestMatch,
+		},
+		"unsupported algorithm": testCase{
+			KeyInfo:    `<ds:KeyInfo><ds:X509Data>` + x509Digest("http://example.com/md5", sha256Digest[:]) + `</ds:X509Data></ds:KeyInfo>`,
+			Candidates: []*x509.Certificate{testCert},
+			Err:        dsig.ErrBadDigestAlgorithm,
+		},
+		"no key info": testCase{
+			KeyInfo:    ``,
+			Candidates: []*x509.Certificate{testCert},
+			Err:        dsig.ErrNoX509DigestMatch,
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			format := strings.Replace(testSignatureFormat, "</ds:Signature>", tt.KeyInfo+"</ds:Signature>", 1)
+			doc := signTestDocument(t, `<root><foo>xxx</foo>`+format+`</root>`, base64.StdEncoding)
+
+			var payload struct {
+				Signature dsig.Signature `xml:"http://www.w3.org/2000/09/xmldsig# Signature"`
+			}
+
+			assert.NoError(t, xml.Unmarshal([]byte(doc), &payload))
+
+			cert, err := payload.Signature.SelectCertificate(tt.Candidates)
+			assert.Equal(t, tt.Err, err)
+			assert.Equal(t, tt.Cert, cert)
+
+			if cert != nil {
+				assert.NoError(t, payload.Signature.Verify(cert, xml.NewDecoder(strings.NewReader(doc))))
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package dsig
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/ucarion/c14n"
+	"github.com/ucarion/dsig/internal/stack"
+)
+
+// xopNamespace is the XML namespace of the xop:Include element.
+var xopNamespace = "http://www.w3.org/2004/08/xop/include"
+
+// XOPPartNotFoundError is returned by VerifyWithOptions if the document
+// contains an xop:Include element referring to a MIME part that isn't in
+// VerifyOptions.XOPParts.
+type XOPPartNotFoundError struct {
+	// CID is the Content-ID of the missing part, without the "cid:" prefix.
+	CID string
+}
+
+func (e *XOPPartNotFoundError) Error() string {
+	return fmt.Sprintf("dsig: xop part not found: %s", e.CID)
+}
+
+// xopReader is a c14n.RawTokenReader that replaces xop:Include elements with
+// the base64-encoded contents of the MIME part they refer to.
+//
+// This reconstitutes the XML that an MTOM-optimized message was made from,
+// which is what its signer signed.
+type xopReader struct {
+	r     c14n.RawTokenReader
+	parts map[string][]byte
+	stack stack.Stack
+	skip  int // depth of the xop:Include being skipped, or zero if none
+}
+
+func (x *xopReader) RawToken() (xml.Token, error) {
+	for {
+		t, err := x.r.RawToken()
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := t.(type) {
+		case xml.StartElement:
+			names := map[string]string{}
+			for _, attr := range t.Attr {
+				if attr.Name.Space == "xmlns" {
+					names[attr.Name.Local] = attr.Value
+				} else if attr.Name.Space == "" && attr.Name.Local == "xmlns" {
+					names[""] = attr.Value
+				}
+			}
+
+			x.stack.Push(names)
+
+			if x.skip != 0 {
+				continue
+			}
+
+			if x.stack.Get(t.Name.Space) != xopNamespace || t.Name.Local != "Include" {
+				return t, nil
+			}
+
+			x.skip = x.stack.Len()
+
+			var href string
+			for _, attr := range t.Attr {
+				if attr.Name.Space == "" && attr.Name.Local == "href" {
+					href = attr.Value
+				}
+			}
+
+			cid, err := url.PathUnescape(strings.TrimPrefix(href, "cid:"))
+			if err != nil {
+				return nil, err
+			}
+
+			part, ok := x.parts[cid]
+			if !ok {
+				return nil, &XOPPartNotFoundError{CID: cid}
+			}
+
+			return xml.CharData(base64.StdEncoding.EncodeToString(part)), nil
+		case xml.EndElement:
+			depth := x.stack.Len()
+			x.stack.Pop()
+
+			if x.skip == 0 {
+				return t, nil
+			}
+
+			if x.skip == depth {
+				x.skip = 0
+			}
+		default:
+			if x.skip == 0 {
+				return t, nil
+			}
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package dsig_test
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/dsig"
+)
+
+func TestVerifyWithOptions_XOPParts(t *testing.T) {
+	inlined := base64.StdEncoding.EncodeToString([]byte("hello, world"))
+	signed := signTestDocument(t, `<root><data>`+inlined+`</data>`+testSignatureFormat+`</root>`, base64.StdEncoding)
+	optimized := strings.Replace(signed, inlined, `<xop:Include xmlns:xop="http://www.w3.org/2004/08/xop/include" href="cid:part%401.example.com"></xop:Include>`, 1)
+
+	type testCase struct {
+		Doc   string
+		Parts map[string][]byte
+		Err   error
+	}
+
+	testCases := map[string]testCase{
+		"inlined, no parts": testCase{
+			Doc:   signed,
+			Parts: nil,
+			Err:   nil,
+		},
+		"optimized, no parts": testCase{
+			Doc:   optimized,
+			Parts: nil,
+			Err:   dsig.ErrBadDigest,
+		},
+		"optimized, with parts": testCase{
+			Doc:   optimized,
+			Parts: map[string][]byte{"part@1.example.com": []byte("hello, world")},
+			Err:   nil,
+		},
+		"optimized, wrong part": testCase{
+			Doc:   optimized,
+			Parts: map[string][]byte{"part@1.example.com": []byte("goodbye, world")},
+			Err:   dsig.ErrBadDigest,
+		},
+		"optimized, missing part": testCase{
+			Doc:   optimized,
+			Parts: map[string][]byte{},
+			Err:   &dsig.XOPPartNotFoundError{CID: "part@1.example.com"},
+		},
+	}
+
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := verifyTestDocumentWithOptions(t, tt.Doc, dsig.VerifyOptions{XOPParts: tt.Parts})
+			assert.Equal(t, tt.Err, err)
+		})
+	}
+}